@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -12,6 +13,8 @@ import (
 	"github.com/loganmanery/passmanager/pkg/generator"
 	"github.com/loganmanery/passmanager/pkg/manager"
 	"github.com/loganmanery/passmanager/pkg/models"
+	"github.com/loganmanery/passmanager/pkg/otp"
+	"github.com/loganmanery/passmanager/pkg/urlmatch"
 
 	"golang.org/x/term"
 )
@@ -71,7 +74,7 @@ func runCLI(pm *manager.PasswordManager) {
 	for {
 		fmt.Println("\nMain Menu:")
 		fmt.Println("1. List all passwords")
-		fmt.Println("2. Add new password")
+		fmt.Println("2. Add new item")
 		fmt.Println("3. View password details")
 		fmt.Println("4. Update password")
 		fmt.Println("5. Delete password")
@@ -79,6 +82,17 @@ func runCLI(pm *manager.PasswordManager) {
 		fmt.Println("7. Export vault")
 		fmt.Println("8. Import vault")
 		fmt.Println("9. Lock vault")
+		fmt.Println("10. Verify audit log")
+		fmt.Println("11. Password history")
+		fmt.Println("12. Settings")
+		fmt.Println("13. Trash")
+		fmt.Println("14. Manage tags")
+		fmt.Println("15. Custom fields")
+		fmt.Println("16. Attachments")
+		fmt.Println("17. Show one-time password")
+		fmt.Println("18. Search")
+		fmt.Println("19. Find by URL")
+		fmt.Println("20. Find duplicates")
 		fmt.Println("0. Exit")
 		fmt.Print("Enter your choice: ")
 
@@ -114,6 +128,28 @@ func runCLI(pm *manager.PasswordManager) {
 				fmt.Printf("Error: %v\n", err)
 				return
 			}
+		case "10":
+			verifyAuditLog(pm)
+		case "11":
+			passwordHistory(pm, reader)
+		case "12":
+			settings(pm, reader)
+		case "13":
+			manageTrash(pm, reader)
+		case "14":
+			manageTags(pm, reader)
+		case "15":
+			manageCustomFields(pm, reader)
+		case "16":
+			manageAttachments(pm, reader)
+		case "17":
+			showOTPCode(pm, reader)
+		case "18":
+			searchPasswords(pm, reader)
+		case "19":
+			findByURL(pm, reader)
+		case "20":
+			manageDuplicates(pm, reader)
 		case "0":
 			fmt.Println("Exiting...")
 			return
@@ -140,7 +176,11 @@ func unlockVault(pm *manager.PasswordManager, reader *bufio.Reader) error {
 			// If it fails, we might need to create a new master password
 			if strings.Contains(err.Error(), "no salt found") {
 				fmt.Println("No vault found. Let's create a new one.")
-				return createMasterPassword(pm, reader)
+				err = createMasterPassword(pm, reader)
+				if err != nil {
+					return err
+				}
+				return restoreVault(pm, reader)
 			}
 			return err
 		}
@@ -154,14 +194,58 @@ func unlockVault(pm *manager.PasswordManager, reader *bufio.Reader) error {
 
 // createMasterPassword handles creation of a new master password
 func createMasterPassword(pm *manager.PasswordManager, reader *bufio.Reader) error {
-	var password, confirm string
-	var err error
+	password, err := readNewPassword("master password")
+	if err != nil {
+		return err
+	}
+
+	err = pm.CreateMasterPassword(password)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Master password created successfully!")
+	return nil
+}
+
+// restoreVault offers to fill a newly created vault from an export file
+func restoreVault(pm *manager.PasswordManager, reader *bufio.Reader) error {
+	fmt.Print("Restore entries from an export file? (y/n) [n]: ")
+	if !confirmOption(readLine(reader), false) {
+		return nil
+	}
+
+	fmt.Print("Enter export file path: ")
+	filePath := readLine(reader)
+	if filePath == "" {
+		fmt.Println("Restore cancelled.")
+		return nil
+	}
+
+	fmt.Print("Enter export password: ")
+	exportPassword, err := readPassword()
+	if err != nil {
+		return err
+	}
+
+	report, err := pm.ImportVault(filePath, exportPassword, manager.ImportOptions{Mode: manager.ImportModeAppend})
+	if err != nil {
+		fmt.Printf("Error restoring vault: %v\n", err)
+		return nil
+	}
+
+	fmt.Printf("Vault restored successfully: %s.\n", report)
+	return nil
+}
 
+// readNewPassword asks for a new password of at least 8 characters until it
+// is entered twice the same way
+func readNewPassword(kind string) (string, error) {
 	for {
-		fmt.Print("Create a new master password: ")
-		password, err = readPassword()
+		fmt.Printf("Create a new %s: ", kind)
+		password, err := readPassword()
 		if err != nil {
-			return err
+			return "", err
 		}
 
 		if len(password) < 8 {
@@ -169,10 +253,10 @@ func createMasterPassword(pm *manager.PasswordManager, reader *bufio.Reader) err
 			continue
 		}
 
-		fmt.Print("Confirm master password: ")
-		confirm, err = readPassword()
+		fmt.Printf("Confirm %s: ", kind)
+		confirm, err := readPassword()
 		if err != nil {
-			return err
+			return "", err
 		}
 
 		if password != confirm {
@@ -180,16 +264,8 @@ func createMasterPassword(pm *manager.PasswordManager, reader *bufio.Reader) err
 			continue
 		}
 
-		break
-	}
-
-	err = pm.CreateMasterPassword(password)
-	if err != nil {
-		return err
+		return password, nil
 	}
-
-	fmt.Println("Master password created successfully!")
-	return nil
 }
 
 // readPassword reads a password without echoing it to the terminal
@@ -211,35 +287,191 @@ func listPasswords(pm *manager.PasswordManager) {
 		return
 	}
 
+	printEntries(entries)
+}
+
+// printEntries displays a table of password entries
+func printEntries(entries []models.PasswordEntry) {
 	if len(entries) == 0 {
 		fmt.Println("No passwords found.")
 		return
 	}
 
 	fmt.Println("\nStored Passwords:")
-	fmt.Println("ID   | Title                 | Username               | Category")
-	fmt.Println("-----+-----------------------+------------------------+----------")
+	fmt.Println("ID   | Type           | Title                 | Username               | Category")
+	fmt.Println("-----+----------------+-----------------------+------------------------+----------")
 
 	for _, entry := range entries {
 		title := truncateString(entry.Title, 20)
 		username := truncateString(entry.Username, 22)
 		category := truncateString(entry.Category, 10)
 
-		fmt.Printf("%-4d | %-21s | %-22s | %s\n",
-			entry.ID, title, username, category)
+		fmt.Printf("%-4d | %-14s | %-21s | %-22s | %s\n",
+			entry.ID, entry.Type, title, username, category)
+	}
+}
+
+// searchPasswords lists the entries matching a query
+func searchPasswords(pm *manager.PasswordManager, reader *bufio.Reader) {
+	fmt.Println("Search words and filters, e.g. tag:prod url:*.aws.amazon.com updated:<90d -category:personal has:totp")
+	fmt.Print("Query: ")
+	input := readLine(reader)
+
+	entries, err := pm.SearchPasswords(models.SearchParams{Query: input})
+	if err != nil {
+		fmt.Printf("Error searching passwords: %v\n", err)
+		return
+	}
+
+	printEntries(entries)
+}
+
+// findByURL lists the entries matching a page URL, best match first
+func findByURL(pm *manager.PasswordManager, reader *bufio.Reader) {
+	fmt.Print("Page URL: ")
+	pageURL := readLine(reader)
+
+	candidates, err := pm.FindByURL(pageURL)
+	if err != nil {
+		fmt.Printf("Error finding passwords: %v\n", err)
+		return
+	}
+
+	entries := make([]models.PasswordEntry, len(candidates))
+	for i, candidate := range candidates {
+		entries[i] = candidate.Entry
+	}
+	printEntries(entries)
+}
+
+// manageDuplicates lists groups of duplicate entries and offers to merge each group
+func manageDuplicates(pm *manager.PasswordManager, reader *bufio.Reader) {
+	groups, err := pm.FindDuplicates()
+	if err != nil {
+		fmt.Printf("Error finding duplicates: %v\n", err)
+		return
+	}
+
+	if len(groups) == 0 {
+		fmt.Println("No duplicates found.")
+		return
+	}
+
+	for _, group := range groups {
+		fmt.Printf("\n%s (%s):\n", group.Site, group.Username)
+		for i, entry := range group.Entries {
+			fmt.Printf("%2d. %s (ID %d, updated %s)\n", i+1, entry.Title, entry.ID,
+				entry.LastUpdated.Format("2006-01-02"))
+		}
+		if !group.SamePassword {
+			fmt.Println("Warning: these entries have different passwords; merged passwords are kept in the history.")
+		}
+
+		fmt.Print("Merge into which entry? (number, empty to skip): ")
+		choice := readLine(reader)
+		if choice == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(choice)
+		if err != nil || n < 1 || n > len(group.Entries) {
+			fmt.Println("Invalid choice, skipping.")
+			continue
+		}
+
+		keep := group.Entries[n-1]
+		var mergeIDs []int64
+		for _, entry := range group.Entries {
+			if entry.ID != keep.ID {
+				mergeIDs = append(mergeIDs, entry.ID)
+			}
+		}
+
+		err = pm.MergePasswords(keep.ID, mergeIDs...)
+		if err != nil {
+			fmt.Printf("Error merging entries: %v\n", err)
+			continue
+		}
+
+		fmt.Printf("Merged %d entries into %s; the others were moved to the trash.\n", len(mergeIDs), keep.Title)
 	}
 }
 
-// addPassword adds a new password entry
+// addPassword adds a new entry, prompting for the fields of its item type
 func addPassword(pm *manager.PasswordManager, reader *bufio.Reader) {
 	var entry models.PasswordEntry
+	var err error
+
+	fmt.Printf("Item type (%s) [login]: ", strings.Join(models.ItemTypes, ", "))
+	entry.Type, err = manager.ParseItemType(readLine(reader))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
 
 	fmt.Print("Title: ")
 	entry.Title = readLine(reader)
 
+	switch entry.Type {
+	case models.ItemTypeLogin:
+		err = readLoginItem(pm, reader, &entry)
+	case models.ItemTypeSecureNote:
+		fmt.Println("Note (end with a line containing only '.'):")
+		entry.Notes = readMultiline(reader)
+	case models.ItemTypeCard:
+		err = readCardItem(reader, &entry)
+	case models.ItemTypeIdentity:
+		readIdentityItem(reader, &entry)
+	case models.ItemTypeSSHKey:
+		readSSHKeyItem(reader, &entry)
+	case models.ItemTypeAPICredential:
+		readAPICredentialItem(reader, &entry)
+	case models.ItemTypeWiFi:
+		readWiFiItem(reader, &entry)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	if entry.Type != models.ItemTypeSecureNote {
+		fmt.Print("Notes: ")
+		entry.Notes = readLine(reader)
+	}
+
+	fmt.Print("Category: ")
+	entry.Category = readLine(reader)
+
+	fmt.Print("Tags (comma separated): ")
+	entry.Tags = manager.ParseTags(readLine(reader))
+
+	for {
+		field, ok := readCustomField(reader)
+		if !ok {
+			break
+		}
+		entry.CustomFields = append(entry.CustomFields, field)
+	}
+
+	id, err := pm.AddPassword(entry)
+	if err != nil {
+		fmt.Printf("Error adding password: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Password added with ID: %d\n", id)
+}
+
+// readLoginItem prompts for the fields of a login
+func readLoginItem(pm *manager.PasswordManager, reader *bufio.Reader, entry *models.PasswordEntry) error {
 	fmt.Print("URL: ")
 	entry.URL = readLine(reader)
 
+	if entry.URL != "" {
+		fmt.Printf("URL match (%s) [domain]: ", strings.Join(urlmatch.Modes, ", "))
+		entry.URLMatch = readLine(reader)
+	}
+
 	fmt.Print("Username: ")
 	entry.Username = readLine(reader)
 
@@ -251,35 +483,159 @@ func addPassword(pm *manager.PasswordManager, reader *bufio.Reader) {
 		genOptions := generator.DefaultOptions()
 		password, err := pm.GeneratePassword(genOptions)
 		if err != nil {
-			fmt.Printf("Error generating password: %v\n", err)
-			return
+			return fmt.Errorf("failed to generate password: %w", err)
 		}
 		entry.Password = password
 		fmt.Printf("Generated password: %s\n", password)
 	}
 
-	fmt.Print("Notes: ")
-	entry.Notes = readLine(reader)
+	fmt.Print("TOTP secret, otpauth:// or steam:// URI (optional): ")
+	entry.TOTP = readLine(reader)
 
-	fmt.Print("Category: ")
-	entry.Category = readLine(reader)
+	return nil
+}
 
-	id, err := pm.AddPassword(entry)
-	if err != nil {
-		fmt.Printf("Error adding password: %v\n", err)
-		return
+// readCardItem prompts for the fields of a payment card
+func readCardItem(reader *bufio.Reader, entry *models.PasswordEntry) error {
+	card := &models.CardData{}
+
+	fmt.Print("Cardholder name: ")
+	card.CardholderName = readLine(reader)
+
+	fmt.Print("Card number: ")
+	card.Number = readLine(reader)
+
+	fmt.Print("Brand (leave empty to detect): ")
+	card.Brand = readLine(reader)
+
+	fmt.Print("Expiry (MM/YY): ")
+	if expiry := readLine(reader); expiry != "" {
+		month, year, ok := strings.Cut(expiry, "/")
+		if !ok {
+			return errors.New("expiry must be written as MM/YY")
+		}
+		var err error
+		card.ExpiryMonth, err = strconv.Atoi(strings.TrimSpace(month))
+		if err != nil {
+			return errors.New("invalid expiry month")
+		}
+		card.ExpiryYear, err = strconv.Atoi(strings.TrimSpace(year))
+		if err != nil {
+			return errors.New("invalid expiry year")
+		}
 	}
 
-	fmt.Printf("Password added with ID: %d\n", id)
+	fmt.Print("Security code: ")
+	card.CVV = readLine(reader)
+
+	fmt.Print("PIN (optional): ")
+	card.PIN = readLine(reader)
+
+	entry.Card = card
+	return nil
+}
+
+// readIdentityItem prompts for the fields of an identity
+func readIdentityItem(reader *bufio.Reader, entry *models.PasswordEntry) {
+	identity := &models.IdentityData{}
+
+	prompts := []struct {
+		label string
+		value *string
+	}{
+		{"First name", &identity.FirstName},
+		{"Middle name", &identity.MiddleName},
+		{"Last name", &identity.LastName},
+		{"Company", &identity.Company},
+		{"Email", &identity.Email},
+		{"Phone", &identity.Phone},
+		{"Address line 1", &identity.Address1},
+		{"Address line 2", &identity.Address2},
+		{"City", &identity.City},
+		{"State", &identity.State},
+		{"Postal code", &identity.PostalCode},
+		{"Country", &identity.Country},
+		{"Social security number", &identity.SSN},
+		{"Passport number", &identity.PassportNumber},
+		{"License number", &identity.LicenseNumber},
+	}
+	for _, prompt := range prompts {
+		fmt.Printf("%s: ", prompt.label)
+		*prompt.value = readLine(reader)
+	}
+
+	entry.Identity = identity
+}
+
+// readSSHKeyItem prompts for the fields of an SSH key
+func readSSHKeyItem(reader *bufio.Reader, entry *models.PasswordEntry) {
+	key := &models.SSHKeyData{}
+
+	fmt.Print("Host: ")
+	entry.URL = readLine(reader)
+
+	fmt.Print("Username: ")
+	entry.Username = readLine(reader)
+
+	fmt.Println("Private key (end with a line containing only '.'):")
+	key.PrivateKey = readMultiline(reader)
+
+	fmt.Print("Passphrase (leave empty if unencrypted): ")
+	entry.Password = readLine(reader)
+
+	fmt.Print("Public key (leave empty to derive): ")
+	key.PublicKey = readLine(reader)
+
+	entry.SSHKey = key
+}
+
+// readAPICredentialItem prompts for the fields of an API credential
+func readAPICredentialItem(reader *bufio.Reader, entry *models.PasswordEntry) {
+	credential := &models.APICredentialData{}
+
+	fmt.Print("Endpoint URL: ")
+	entry.URL = readLine(reader)
+
+	fmt.Print("Key ID: ")
+	credential.KeyID = readLine(reader)
+
+	fmt.Print("Secret: ")
+	entry.Password = readLine(reader)
+
+	fmt.Print("Expires (YYYY-MM-DD, optional): ")
+	credential.ExpiresAt = readLine(reader)
+
+	entry.APICredential = credential
+}
+
+// readWiFiItem prompts for the fields of a Wi-Fi network
+func readWiFiItem(reader *bufio.Reader, entry *models.PasswordEntry) {
+	wifi := &models.WiFiData{}
+
+	fmt.Print("SSID: ")
+	wifi.SSID = readLine(reader)
+	if entry.Title == "" {
+		entry.Title = wifi.SSID
+	}
+
+	fmt.Print("Security (open, wep, wpa, wpa2, wpa3) [wpa2]: ")
+	wifi.Security = readLine(reader)
+
+	if wifi.Security != manager.WiFiSecurityOpen {
+		fmt.Print("Passphrase: ")
+		entry.Password = readLine(reader)
+	}
+
+	fmt.Print("Hidden network? (y/n) [n]: ")
+	wifi.Hidden = confirmOption(readLine(reader), false)
+
+	entry.WiFi = wifi
 }
 
 // viewPassword displays a single password entry
 func viewPassword(pm *manager.PasswordManager, reader *bufio.Reader) {
-	fmt.Print("Enter password ID: ")
-	idStr := readLine(reader)
-	id, err := strconv.ParseInt(idStr, 10, 64)
-	if err != nil {
-		fmt.Println("Invalid ID.")
+	id, ok := selectEntry(pm, reader, "Search for an entry: ")
+	if !ok {
 		return
 	}
 
@@ -290,22 +646,96 @@ func viewPassword(pm *manager.PasswordManager, reader *bufio.Reader) {
 	}
 
 	fmt.Println("\nPassword Details:")
+	fmt.Printf("UUID: %s\n", entry.UUID)
+	fmt.Printf("Type: %s\n", entry.Type)
 	fmt.Printf("Title: %s\n", entry.Title)
-	fmt.Printf("URL: %s\n", entry.URL)
-	fmt.Printf("Username: %s\n", entry.Username)
-	fmt.Printf("Password: %s\n", entry.Password)
+	printItemDetails(entry)
 	fmt.Printf("Notes: %s\n", entry.Notes)
 	fmt.Printf("Category: %s\n", entry.Category)
+	fmt.Printf("Tags: %s\n", strings.Join(entry.Tags, ", "))
+	printCustomFields(entry.CustomFields)
+	if entry.TOTP != "" {
+		// Generating an HOTP code consumes a counter value, so only do it on request
+		if key, err := otp.Parse(entry.TOTP); err == nil && key.IsCounterBased() {
+			fmt.Println("One-time password: HOTP (use 'Show one-time password' to generate a code)")
+		} else if code, err := pm.GetOTPCode(entry.ID); err != nil {
+			fmt.Printf("One-time password: error: %v\n", err)
+		} else {
+			fmt.Printf("One-time password: %s (%ds remaining)\n", code.Code, int(code.Remaining.Seconds()))
+		}
+	}
 	fmt.Printf("Last Updated: %s\n", entry.LastUpdated.Format("2006-01-02 15:04:05"))
 }
 
+// printItemDetails displays the fields specific to the type of an entry
+func printItemDetails(entry models.PasswordEntry) {
+	switch entry.Type {
+	case models.ItemTypeSecureNote:
+		return
+	case models.ItemTypeCard:
+		if card := entry.Card; card != nil {
+			fmt.Printf("Cardholder: %s\n", card.CardholderName)
+			fmt.Printf("Number: %s\n", card.Number)
+			fmt.Printf("Brand: %s\n", card.Brand)
+			if card.ExpiryMonth > 0 {
+				fmt.Printf("Expiry: %02d/%02d\n", card.ExpiryMonth, card.ExpiryYear%100)
+			}
+			fmt.Printf("Security code: %s\n", card.CVV)
+			if card.PIN != "" {
+				fmt.Printf("PIN: %s\n", card.PIN)
+			}
+		}
+	case models.ItemTypeIdentity:
+		if identity := entry.Identity; identity != nil {
+			name := strings.Join(strings.Fields(identity.FirstName+" "+identity.MiddleName+" "+identity.LastName), " ")
+			fmt.Printf("Name: %s\n", name)
+			fmt.Printf("Company: %s\n", identity.Company)
+			fmt.Printf("Email: %s\n", identity.Email)
+			fmt.Printf("Phone: %s\n", identity.Phone)
+			fmt.Printf("Address: %s\n", strings.Join(nonEmpty(identity.Address1, identity.Address2,
+				identity.City, identity.State, identity.PostalCode, identity.Country), ", "))
+			fmt.Printf("Social security number: %s\n", identity.SSN)
+			fmt.Printf("Passport number: %s\n", identity.PassportNumber)
+			fmt.Printf("License number: %s\n", identity.LicenseNumber)
+		}
+	case models.ItemTypeSSHKey:
+		fmt.Printf("Host: %s\n", entry.URL)
+		fmt.Printf("Username: %s\n", entry.Username)
+		if key := entry.SSHKey; key != nil {
+			fmt.Printf("Fingerprint: %s\n", key.Fingerprint)
+			fmt.Printf("Public key: %s\n", key.PublicKey)
+			fmt.Printf("Private key:\n%s\n", key.PrivateKey)
+		}
+		if entry.Password != "" {
+			fmt.Printf("Passphrase: %s\n", entry.Password)
+		}
+	case models.ItemTypeAPICredential:
+		fmt.Printf("Endpoint: %s\n", entry.URL)
+		if credential := entry.APICredential; credential != nil {
+			fmt.Printf("Key ID: %s\n", credential.KeyID)
+			fmt.Printf("Secret: %s\n", entry.Password)
+			if credential.ExpiresAt != "" {
+				fmt.Printf("Expires: %s\n", credential.ExpiresAt)
+			}
+		}
+	case models.ItemTypeWiFi:
+		if wifi := entry.WiFi; wifi != nil {
+			fmt.Printf("SSID: %s\n", wifi.SSID)
+			fmt.Printf("Security: %s\n", wifi.Security)
+			fmt.Printf("Hidden: %t\n", wifi.Hidden)
+		}
+		fmt.Printf("Passphrase: %s\n", entry.Password)
+	default:
+		fmt.Printf("URL: %s\n", entry.URL)
+		fmt.Printf("Username: %s\n", entry.Username)
+		fmt.Printf("Password: %s\n", entry.Password)
+	}
+}
+
 // updatePassword updates an existing password entry
 func updatePassword(pm *manager.PasswordManager, reader *bufio.Reader) {
-	fmt.Print("Enter password ID to update: ")
-	idStr := readLine(reader)
-	id, err := strconv.ParseInt(idStr, 10, 64)
-	if err != nil {
-		fmt.Println("Invalid ID.")
+	id, ok := selectEntry(pm, reader, "Search for an entry to update: ")
+	if !ok {
 		return
 	}
 
@@ -329,6 +759,12 @@ func updatePassword(pm *manager.PasswordManager, reader *bufio.Reader) {
 		entry.URL = newURL
 	}
 
+	fmt.Printf("URL match (%s) [%s]: ", strings.Join(urlmatch.Modes, ", "), entry.URLMatch)
+	newURLMatch := readLine(reader)
+	if newURLMatch != "" {
+		entry.URLMatch = newURLMatch
+	}
+
 	fmt.Printf("Username [%s]: ", entry.Username)
 	newUsername := readLine(reader)
 	if newUsername != "" {
@@ -362,6 +798,14 @@ func updatePassword(pm *manager.PasswordManager, reader *bufio.Reader) {
 		entry.Category = newCategory
 	}
 
+	fmt.Print("TOTP secret, otpauth:// or steam:// URI (leave empty to keep current, '-' to remove): ")
+	newTOTP := readLine(reader)
+	if newTOTP == "-" {
+		entry.TOTP = ""
+	} else if newTOTP != "" {
+		entry.TOTP = newTOTP
+	}
+
 	err = pm.UpdatePassword(entry)
 	if err != nil {
 		fmt.Printf("Error updating password: %v\n", err)
@@ -373,28 +817,25 @@ func updatePassword(pm *manager.PasswordManager, reader *bufio.Reader) {
 
 // deletePassword deletes a password entry
 func deletePassword(pm *manager.PasswordManager, reader *bufio.Reader) {
-	fmt.Print("Enter password ID to delete: ")
-	idStr := readLine(reader)
-	id, err := strconv.ParseInt(idStr, 10, 64)
-	if err != nil {
-		fmt.Println("Invalid ID.")
+	id, ok := selectEntry(pm, reader, "Search for an entry to delete: ")
+	if !ok {
 		return
 	}
 
-	fmt.Print("Are you sure you want to delete this password? (y/n): ")
+	fmt.Print("Move this password to the trash? (y/n): ")
 	confirm := readLine(reader)
 	if strings.ToLower(confirm) != "y" {
 		fmt.Println("Deletion cancelled.")
 		return
 	}
 
-	err = pm.DeletePassword(id)
+	err := pm.DeletePassword(id)
 	if err != nil {
 		fmt.Printf("Error deleting password: %v\n", err)
 		return
 	}
 
-	fmt.Println("Password deleted successfully.")
+	fmt.Println("Password moved to the trash.")
 }
 
 // generatePassword generates a random password
@@ -464,7 +905,31 @@ func exportVault(pm *manager.PasswordManager, reader *bufio.Reader) {
 		return
 	}
 
-	err := pm.ExportVault(filePath)
+	fmt.Print("Format (passmanager, age, csv, kdbx) [passmanager]: ")
+	switch strings.ToLower(readLine(reader)) {
+	case "", "passmanager":
+	case "age":
+		exportVaultAge(pm, reader, filePath)
+		return
+	case "csv":
+		exportVaultCSV(pm, reader, filePath)
+		return
+	case "kdbx":
+		exportVaultKDBX(pm, filePath)
+		return
+	default:
+		fmt.Println("Unknown format.")
+		return
+	}
+
+	fmt.Println("The export is protected by its own password, needed to import it into this or any other vault.")
+	exportPassword, err := readNewPassword("export password")
+	if err != nil {
+		fmt.Printf("Error reading password: %v\n", err)
+		return
+	}
+
+	err = pm.ExportVault(filePath, exportPassword)
 	if err != nil {
 		fmt.Printf("Error exporting vault: %v\n", err)
 		return
@@ -473,40 +938,1004 @@ func exportVault(pm *manager.PasswordManager, reader *bufio.Reader) {
 	fmt.Println("Vault exported successfully.")
 }
 
-// importVault imports the password vault from a file
-func importVault(pm *manager.PasswordManager, reader *bufio.Reader) {
-	fmt.Print("Enter import file path: ")
-	filePath := readLine(reader)
-	if filePath == "" {
-		fmt.Println("Import cancelled.")
+// exportVaultAge exports the password vault to an age-encrypted file
+func exportVaultAge(pm *manager.PasswordManager, reader *bufio.Reader, filePath string) {
+	fmt.Println("Warning: the file can be decrypted with the age tool and contains every password, previous password and attachment in plaintext.")
+
+	var keys manager.AgeKeys
+	fmt.Print("Encrypt with a (p)assphrase or to (r)ecipient keys [p]: ")
+	switch strings.ToLower(readLine(reader)) {
+	case "", "p":
+		passphrase, err := readNewPassword("age passphrase")
+		if err != nil {
+			fmt.Printf("Error reading passphrase: %v\n", err)
+			return
+		}
+		keys.Passphrase = passphrase
+	case "r":
+		fmt.Print("Enter recipient public keys (age1...), separated by spaces: ")
+		keys.Recipients = strings.FieldsFunc(readLine(reader), func(r rune) bool {
+			return r == ' ' || r == ','
+		})
+	default:
+		fmt.Println("Invalid choice.")
 		return
 	}
 
-	fmt.Print("This will overwrite any existing passwords. Continue? (y/n): ")
-	confirm := readLine(reader)
-	if strings.ToLower(confirm) != "y" {
-		fmt.Println("Import cancelled.")
+	err := pm.ExportVaultAge(filePath, keys)
+	if err != nil {
+		fmt.Printf("Error exporting vault: %v\n", err)
 		return
 	}
 
-	err := pm.ImportVault(filePath)
+	fmt.Println("Vault exported successfully.")
+}
+
+// exportVaultKDBX exports the password vault to a KeePass database
+func exportVaultKDBX(pm *manager.PasswordManager, filePath string) {
+	fmt.Println("The database can be opened with KeePass, KeePassXC and other KDBX 4 clients.")
+	password, err := readNewPassword("database password")
 	if err != nil {
-		fmt.Printf("Error importing vault: %v\n", err)
+		fmt.Printf("Error reading password: %v\n", err)
+		return
+	}
+
+	count, err := pm.ExportKDBX(filePath, password)
+	if err != nil {
+		fmt.Printf("Error exporting vault: %v\n", err)
 		return
 	}
 
-	fmt.Println("Vault imported successfully.")
+	fmt.Printf("%d entries exported successfully.\n", count)
 }
 
-// Helper functions
+// exportVaultCSV exports the password vault to a plaintext CSV file after an
+// explicit confirmation
+func exportVaultCSV(pm *manager.PasswordManager, reader *bufio.Reader, filePath string) {
+	fmt.Println("WARNING: a CSV export is NOT encrypted. Every password in the vault will be")
+	fmt.Println("readable by anyone and any program with access to the file, including backups")
+	fmt.Println("and sync services. Card, identity and other item details are left out.")
+	fmt.Print("Type EXPORT to continue: ")
+	if readLine(reader) != "EXPORT" {
+		fmt.Println("Export cancelled.")
+		return
+	}
 
-// readLine reads a line from the reader and trims spaces
-func readLine(reader *bufio.Reader) string {
-	text, err := reader.ReadString('\n')
+	format, ok := readCSVFormat(reader)
+	if !ok {
+		return
+	}
+
+	count, err := pm.ExportCSV(filePath, format)
 	if err != nil {
-		return ""
+		fmt.Printf("Error exporting vault: %v\n", err)
+		return
 	}
-	return strings.TrimSpace(text)
+
+	fmt.Printf("%d entries exported. Delete the file as soon as you no longer need it.\n", count)
+}
+
+// readCSVFormat asks for a CSV preset, or for the column of each field
+func readCSVFormat(reader *bufio.Reader) (manager.CSVFormat, bool) {
+	fmt.Print("CSV format (chrome, firefox, 1password, lastpass, custom) [chrome]: ")
+	preset := strings.ToLower(readLine(reader))
+	switch preset {
+	case "":
+		return manager.CSVFormat{Preset: manager.CSVPresetChrome}, true
+	case manager.CSVPresetChrome, manager.CSVPresetFirefox, manager.CSVPresetOnePassword, manager.CSVPresetLastPass:
+		return manager.CSVFormat{Preset: preset}, true
+	case "custom":
+	default:
+		fmt.Println("Unknown format.")
+		return manager.CSVFormat{}, false
+	}
+
+	format := manager.CSVFormat{Columns: make(map[string]string)}
+	for _, field := range manager.CSVFields {
+		fmt.Printf("Column for %s (empty for none): ", field)
+		if header := readLine(reader); header != "" {
+			format.Columns[field] = header
+		}
+	}
+	return format, true
+}
+
+// importVault imports the password vault from a native or age export, or
+// from another password manager
+func importVault(pm *manager.PasswordManager, reader *bufio.Reader) {
+	fmt.Print("Enter import file path: ")
+	filePath := readLine(reader)
+	if filePath == "" {
+		fmt.Println("Import cancelled.")
+		return
+	}
+
+	fmt.Print("Import from (passmanager, bitwarden, keepass, csv, pass) [passmanager]: ")
+	switch strings.ToLower(readLine(reader)) {
+	case "", "passmanager":
+	case "bitwarden":
+		importExternal(reader, "Bitwarden", func() (*manager.ImportSource, error) {
+			return pm.ReadBitwarden(filePath)
+		})
+		return
+	case "keepass":
+		importKeePass(pm, reader, filePath)
+		return
+	case "csv":
+		format, ok := readCSVFormat(reader)
+		if !ok {
+			return
+		}
+		importExternal(reader, "CSV", func() (*manager.ImportSource, error) {
+			return pm.ReadCSV(filePath, format)
+		})
+		return
+	case "pass":
+		importPass(pm, reader, filePath)
+		return
+	default:
+		fmt.Println("Unknown source.")
+		return
+	}
+
+	isAge, err := manager.IsAgeFile(filePath)
+	if err != nil {
+		fmt.Printf("Error reading file: %v\n", err)
+		return
+	}
+
+	var keys manager.AgeKeys
+	var exportPassword string
+	if isAge {
+		keys, err = readAgeIdentities(reader)
+	} else {
+		fmt.Print("Enter export password: ")
+		exportPassword, err = readPassword()
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	options, ok := readImportOptions(reader)
+	if !ok {
+		fmt.Println("Import cancelled.")
+		return
+	}
+
+	var report manager.ImportReport
+	if isAge {
+		report, err = pm.ImportVaultAge(filePath, keys, options)
+	} else {
+		report, err = pm.ImportVault(filePath, exportPassword, options)
+	}
+	if err != nil {
+		fmt.Printf("Error importing vault: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Vault imported successfully: %s.\n", report)
+}
+
+// importKeePass imports a KeePass XML export or KDBX database, asking for the
+// composite key of a database
+func importKeePass(pm *manager.PasswordManager, reader *bufio.Reader, filePath string) {
+	if strings.EqualFold(filepath.Ext(filePath), ".xml") {
+		importExternal(reader, "KeePass", func() (*manager.ImportSource, error) {
+			return pm.ReadKeePassXML(filePath)
+		})
+		return
+	}
+
+	var key manager.KeePassKey
+	var err error
+	fmt.Print("Enter KeePass database password (empty for none): ")
+	key.Password, err = readPassword()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	fmt.Print("Enter key file path (empty for none): ")
+	key.KeyFile = readLine(reader)
+
+	importExternal(reader, "KeePass", func() (*manager.ImportSource, error) {
+		return pm.ReadKDBX(filePath, key)
+	})
+}
+
+// importPass imports a pass password store directory, decrypting its files
+// with gpg unless they were decrypted beforehand
+func importPass(pm *manager.PasswordManager, reader *bufio.Reader, dir string) {
+	var decryptor manager.PassDecryptor
+	fmt.Print("Decrypt .gpg files with gpg? (y/n) [y]: ")
+	if confirmOption(readLine(reader), true) {
+		decryptor = manager.GPGDecryptor{}
+	}
+
+	importExternal(reader, "pass", func() (*manager.ImportSource, error) {
+		return pm.ReadPass(dir, decryptor)
+	})
+}
+
+// importExternal imports a file from another password manager, first showing
+// a dry run of what would be imported and asking for confirmation. The file
+// is read once, so the import is exactly what the preview showed.
+func importExternal(reader *bufio.Reader, source string, read func() (*manager.ImportSource, error)) {
+	options, ok := readImportOptions(reader)
+	if !ok {
+		fmt.Println("Import cancelled.")
+		return
+	}
+
+	src, err := read()
+	if err != nil {
+		fmt.Printf("Error reading %s export: %v\n", source, err)
+		return
+	}
+
+	// Conflicts are only resolved interactively in the real import
+	preview := options
+	preview.DryRun = true
+	preview.Resolve = nil
+	report, err := src.Import(preview)
+	if err != nil {
+		fmt.Printf("Error previewing import from %s: %v\n", source, err)
+		return
+	}
+
+	printImportReport(report)
+	if report.Added == 0 && report.Updated == 0 {
+		fmt.Println("Nothing to import.")
+		return
+	}
+
+	fmt.Printf("Import %d entries from %s? (y/n): ", report.Added+report.Updated, source)
+	if strings.ToLower(readLine(reader)) != "y" {
+		fmt.Println("Import cancelled.")
+		return
+	}
+
+	report, err = src.Import(options)
+	if err != nil {
+		fmt.Printf("Error importing from %s: %v\n", source, err)
+		return
+	}
+
+	fmt.Printf("Imported from %s successfully: %s.\n", source, report)
+}
+
+// printImportReport lists the entries an import adds or updates and its warnings
+func printImportReport(report manager.ImportReport) {
+	fmt.Printf("\nImport preview: %s\n", report)
+	for _, entry := range report.Entries {
+		action := "+"
+		if entry.Updated {
+			action = "~"
+		}
+		details := entry.Type
+		if entry.Category != "" {
+			details += ", " + entry.Category
+		}
+		fmt.Printf("  %s %s (%s)\n", action, entry.Title, details)
+	}
+
+	if len(report.Warnings) > 0 {
+		fmt.Println("Warnings:")
+		for _, warning := range report.Warnings {
+			fmt.Printf("  - %s\n", warning)
+		}
+	}
+}
+
+// readAgeIdentities asks for the passphrase or identity file to decrypt an
+// age file with
+func readAgeIdentities(reader *bufio.Reader) (manager.AgeKeys, error) {
+	var keys manager.AgeKeys
+
+	fmt.Print("Decrypt with a (p)assphrase or an (i)dentity file [p]: ")
+	switch strings.ToLower(readLine(reader)) {
+	case "", "p":
+		fmt.Print("Enter age passphrase: ")
+		passphrase, err := readPassword()
+		if err != nil {
+			return keys, err
+		}
+		keys.Passphrase = passphrase
+	case "i":
+		fmt.Print("Enter identity file path: ")
+		data, err := os.ReadFile(readLine(reader))
+		if err != nil {
+			return keys, err
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				keys.Identities = append(keys.Identities, line)
+			}
+		}
+	default:
+		return keys, errors.New("invalid choice")
+	}
+
+	return keys, nil
+}
+
+// readImportOptions asks how to combine imported entries with the vault,
+// returning false if the user cancels
+func readImportOptions(reader *bufio.Reader) (manager.ImportOptions, bool) {
+	fmt.Print("Import mode (merge, append, replace) [merge]: ")
+	options := manager.ImportOptions{Mode: strings.ToLower(readLine(reader))}
+	if options.Mode == "" {
+		options.Mode = manager.ImportModeMerge
+	}
+
+	switch options.Mode {
+	case manager.ImportModeReplace:
+		fmt.Print("This will permanently delete every existing password, including the trash. Continue? (y/n): ")
+		if strings.ToLower(readLine(reader)) != "y" {
+			return options, false
+		}
+	case manager.ImportModeMerge:
+		fmt.Print("Resolve conflicts one by one instead of keeping the newest version? (y/n) [n]: ")
+		if confirmOption(readLine(reader), false) {
+			options.Resolve = func(existing, imported models.PasswordEntry) manager.ConflictResolution {
+				return resolveImportConflict(reader, existing, imported)
+			}
+		}
+	}
+
+	return options, true
+}
+
+// resolveImportConflict asks which version to keep of an entry that exists in
+// both the vault and an import
+func resolveImportConflict(reader *bufio.Reader, existing, imported models.PasswordEntry) manager.ConflictResolution {
+	fmt.Printf("\nConflict for %q:\n", existing.Title)
+	trashed := ""
+	if existing.IsTrashed() {
+		trashed = " (in the trash, restored if the import is used)"
+	}
+	fmt.Printf("  vault:  %s, updated %s%s\n", existing.Title, existing.LastUpdated.Format("2006-01-02 15:04:05"), trashed)
+	fmt.Printf("  import: %s, updated %s\n", imported.Title, imported.LastUpdated.Format("2006-01-02 15:04:05"))
+
+	for {
+		fmt.Print("Keep (v)ault, use (i)mport, keep (b)oth or (n)ewest [n]: ")
+		switch strings.ToLower(readLine(reader)) {
+		case "", "n":
+			return manager.ResolveNewest
+		case "v":
+			return manager.ResolveKeepExisting
+		case "i":
+			return manager.ResolveUseImported
+		case "b":
+			return manager.ResolveKeepBoth
+		}
+		fmt.Println("Invalid choice.")
+	}
+}
+
+// verifyAuditLog checks the audit log hash chain for tampering
+func verifyAuditLog(pm *manager.PasswordManager) {
+	result, err := pm.VerifyAuditLog()
+	if err != nil {
+		fmt.Printf("Error verifying audit log: %v\n", err)
+		return
+	}
+
+	if !result.Valid {
+		fmt.Printf("Audit log verification FAILED after %d valid records.\n", result.Records)
+		fmt.Printf("First broken link at record %d: %s\n", result.BrokenSeq, result.Reason)
+		return
+	}
+
+	fmt.Printf("Audit log intact: %d records verified.\n", result.Records)
+}
+
+// passwordHistory lists the previous passwords of an entry and optionally restores one
+func passwordHistory(pm *manager.PasswordManager, reader *bufio.Reader) {
+	id, ok := selectEntry(pm, reader, "Search for an entry: ")
+	if !ok {
+		return
+	}
+
+	history, err := pm.GetPasswordHistory(id)
+	if err != nil {
+		fmt.Printf("Error retrieving password history: %v\n", err)
+		return
+	}
+
+	if len(history) == 0 {
+		fmt.Println("No previous passwords found.")
+		return
+	}
+
+	fmt.Println("\nPassword History:")
+	fmt.Println("Version | Replaced            | Password")
+	fmt.Println("--------+---------------------+----------------------")
+
+	for _, version := range history {
+		fmt.Printf("%-7d | %-19s | %s\n",
+			version.ID, version.CreatedAt.Format("2006-01-02 15:04:05"), version.Password)
+	}
+
+	fmt.Print("\nEnter version to restore (leave empty to cancel): ")
+	versionStr := readLine(reader)
+	if versionStr == "" {
+		return
+	}
+
+	versionID, err := strconv.ParseInt(versionStr, 10, 64)
+	if err != nil {
+		fmt.Println("Invalid version.")
+		return
+	}
+
+	err = pm.RestorePasswordVersion(versionID)
+	if err != nil {
+		fmt.Printf("Error restoring password: %v\n", err)
+		return
+	}
+
+	fmt.Println("Password restored successfully.")
+}
+
+// settings displays and updates vault settings
+func settings(pm *manager.PasswordManager, reader *bufio.Reader) {
+	retention, err := pm.GetHistoryRetention()
+	if err != nil {
+		fmt.Printf("Error reading settings: %v\n", err)
+		return
+	}
+
+	trashDays, err := pm.GetTrashRetentionDays()
+	if err != nil {
+		fmt.Printf("Error reading settings: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Password history versions to keep per entry, 0 for unlimited [%d]: ", retention)
+	retentionStr := readLine(reader)
+	if retentionStr != "" {
+		newRetention, err := strconv.Atoi(retentionStr)
+		if err != nil || newRetention < 0 {
+			fmt.Println("Invalid number.")
+			return
+		}
+
+		err = pm.SetHistoryRetention(newRetention)
+		if err != nil {
+			fmt.Printf("Error saving settings: %v\n", err)
+			return
+		}
+	}
+
+	fmt.Printf("Days to keep deleted passwords in the trash, 0 to keep forever [%d]: ", trashDays)
+	trashDaysStr := readLine(reader)
+	if trashDaysStr != "" {
+		newTrashDays, err := strconv.Atoi(trashDaysStr)
+		if err != nil || newTrashDays < 0 {
+			fmt.Println("Invalid number.")
+			return
+		}
+
+		err = pm.SetTrashRetentionDays(newTrashDays)
+		if err != nil {
+			fmt.Printf("Error saving settings: %v\n", err)
+			return
+		}
+	}
+
+	fmt.Println("Settings saved.")
+}
+
+// manageTrash lists trashed passwords and restores or permanently deletes them
+func manageTrash(pm *manager.PasswordManager, reader *bufio.Reader) {
+	entries, err := pm.GetTrash()
+	if err != nil {
+		fmt.Printf("Error listing trash: %v\n", err)
+		return
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("The trash is empty.")
+		return
+	}
+
+	fmt.Println("\nTrash:")
+	fmt.Println("ID   | Title                 | Username               | Deleted")
+	fmt.Println("-----+-----------------------+------------------------+--------------------")
+
+	for _, entry := range entries {
+		title := truncateString(entry.Title, 20)
+		username := truncateString(entry.Username, 22)
+
+		fmt.Printf("%-4d | %-21s | %-22s | %s\n",
+			entry.ID, title, username, entry.DeletedAt.Format("2006-01-02 15:04:05"))
+	}
+
+	fmt.Println("\n1. Restore password")
+	fmt.Println("2. Permanently delete password")
+	fmt.Println("3. Empty trash")
+	fmt.Println("0. Back")
+	fmt.Print("Enter your choice: ")
+
+	switch readLine(reader) {
+	case "1":
+		fmt.Print("Enter password ID to restore: ")
+		id, err := strconv.ParseInt(readLine(reader), 10, 64)
+		if err != nil {
+			fmt.Println("Invalid ID.")
+			return
+		}
+
+		err = pm.RestorePassword(id)
+		if err != nil {
+			fmt.Printf("Error restoring password: %v\n", err)
+			return
+		}
+
+		fmt.Println("Password restored successfully.")
+	case "2":
+		fmt.Print("Enter password ID to permanently delete: ")
+		id, err := strconv.ParseInt(readLine(reader), 10, 64)
+		if err != nil {
+			fmt.Println("Invalid ID.")
+			return
+		}
+
+		// Only entries listed above can be deleted permanently
+		inTrash := false
+		for _, entry := range entries {
+			if entry.ID == id {
+				inTrash = true
+				break
+			}
+		}
+		if !inTrash {
+			fmt.Printf("Password %d is not in the trash.\n", id)
+			return
+		}
+
+		fmt.Print("This cannot be undone. Continue? (y/n): ")
+		if strings.ToLower(readLine(reader)) != "y" {
+			fmt.Println("Deletion cancelled.")
+			return
+		}
+
+		err = pm.PurgePassword(id)
+		if err != nil {
+			fmt.Printf("Error deleting password: %v\n", err)
+			return
+		}
+
+		fmt.Println("Password permanently deleted.")
+	case "3":
+		fmt.Printf("Permanently delete all %d passwords in the trash? (y/n): ", len(entries))
+		if strings.ToLower(readLine(reader)) != "y" {
+			fmt.Println("Deletion cancelled.")
+			return
+		}
+
+		purged, err := pm.EmptyTrash()
+		if err != nil {
+			fmt.Printf("Error emptying trash: %v\n", err)
+			return
+		}
+
+		fmt.Printf("%d passwords permanently deleted.\n", purged)
+	}
+}
+
+// manageTags adds or removes tags on a password entry, or lists entries by tag
+func manageTags(pm *manager.PasswordManager, reader *bufio.Reader) {
+	tags, err := pm.GetTags()
+	if err != nil {
+		fmt.Printf("Error listing tags: %v\n", err)
+		return
+	}
+
+	if len(tags) > 0 {
+		fmt.Printf("\nTags in use: %s\n", strings.Join(tags, ", "))
+	}
+
+	fmt.Println("\n1. Add tags to a password")
+	fmt.Println("2. Remove tags from a password")
+	fmt.Println("3. List passwords by tag")
+	fmt.Println("0. Back")
+	fmt.Print("Enter your choice: ")
+
+	switch readLine(reader) {
+	case "1":
+		id, input, ok := readTagEdit(pm, reader)
+		if !ok {
+			return
+		}
+
+		err = pm.AddTags(id, input...)
+		if err != nil {
+			fmt.Printf("Error adding tags: %v\n", err)
+			return
+		}
+
+		fmt.Println("Tags added successfully.")
+	case "2":
+		id, input, ok := readTagEdit(pm, reader)
+		if !ok {
+			return
+		}
+
+		err = pm.RemoveTags(id, input...)
+		if err != nil {
+			fmt.Printf("Error removing tags: %v\n", err)
+			return
+		}
+
+		fmt.Println("Tags removed successfully.")
+	case "3":
+		fmt.Print("Tags (comma separated): ")
+		input := manager.ParseTags(readLine(reader))
+		if len(input) == 0 {
+			fmt.Println("No tags given.")
+			return
+		}
+
+		fmt.Print("Require all tags instead of any? (y/n) [n]: ")
+		matchAll := confirmOption(readLine(reader), false)
+
+		entries, err := pm.SearchPasswords(models.SearchParams{
+			Tags:         input,
+			MatchAllTags: matchAll,
+		})
+		if err != nil {
+			fmt.Printf("Error searching passwords: %v\n", err)
+			return
+		}
+
+		printEntries(entries)
+	}
+}
+
+// readTagEdit prompts for an entry and a list of tags
+func readTagEdit(pm *manager.PasswordManager, reader *bufio.Reader) (int64, []string, bool) {
+	id, ok := selectEntry(pm, reader, "Search for an entry: ")
+	if !ok {
+		return 0, nil, false
+	}
+
+	fmt.Print("Tags (comma separated): ")
+	tags := manager.ParseTags(readLine(reader))
+	if len(tags) == 0 {
+		fmt.Println("No tags given.")
+		return 0, nil, false
+	}
+
+	return id, tags, true
+}
+
+// manageCustomFields adds, updates or removes custom fields on a password entry
+func manageCustomFields(pm *manager.PasswordManager, reader *bufio.Reader) {
+	id, ok := selectEntry(pm, reader, "Search for an entry: ")
+	if !ok {
+		return
+	}
+
+	entry, err := pm.GetPassword(id)
+	if err != nil {
+		fmt.Printf("Error retrieving password: %v\n", err)
+		return
+	}
+
+	fmt.Printf("\nCustom fields of %s:\n", entry.Title)
+	if len(entry.CustomFields) == 0 {
+		fmt.Println("No custom fields.")
+	}
+	printCustomFields(entry.CustomFields)
+
+	fmt.Println("\n1. Add or update field")
+	fmt.Println("2. Remove field")
+	fmt.Println("0. Back")
+	fmt.Print("Enter your choice: ")
+
+	switch readLine(reader) {
+	case "1":
+		field, ok := readCustomField(reader)
+		if !ok {
+			return
+		}
+
+		err = pm.SetCustomField(id, field)
+		if err != nil {
+			fmt.Printf("Error saving custom field: %v\n", err)
+			return
+		}
+
+		fmt.Println("Custom field saved.")
+	case "2":
+		fmt.Print("Field name: ")
+		name := readLine(reader)
+		if name == "" {
+			return
+		}
+
+		err = pm.RemoveCustomField(id, name)
+		if err != nil {
+			fmt.Printf("Error removing custom field: %v\n", err)
+			return
+		}
+
+		fmt.Println("Custom field removed.")
+	}
+}
+
+// readCustomField prompts for a custom field, returning false when no name is given
+func readCustomField(reader *bufio.Reader) (models.CustomField, bool) {
+	var field models.CustomField
+
+	fmt.Print("Custom field name (leave empty to finish): ")
+	field.Name = readLine(reader)
+	if field.Name == "" {
+		return field, false
+	}
+
+	fmt.Print("Type (text/hidden/url) [text]: ")
+	field.Type = strings.ToLower(readLine(reader))
+
+	fmt.Print("Value: ")
+	if field.Type == models.FieldTypeHidden {
+		// Don't echo hidden values
+		value, err := readPassword()
+		if err != nil {
+			fmt.Printf("Error reading input: %v\n", err)
+			return field, false
+		}
+		field.Value = value
+	} else {
+		field.Value = readLine(reader)
+	}
+
+	return field, true
+}
+
+// printCustomFields displays custom fields, one per line
+func printCustomFields(fields []models.CustomField) {
+	for _, field := range fields {
+		fmt.Printf("%s (%s): %s\n", field.Name, field.Type, field.Value)
+	}
+}
+
+// manageAttachments attaches, lists, extracts and deletes files on a password entry
+func manageAttachments(pm *manager.PasswordManager, reader *bufio.Reader) {
+	id, ok := selectEntry(pm, reader, "Search for an entry: ")
+	if !ok {
+		return
+	}
+
+	attachments, err := pm.GetAttachments(id)
+	if err != nil {
+		fmt.Printf("Error listing attachments: %v\n", err)
+		return
+	}
+
+	if len(attachments) == 0 {
+		fmt.Println("No attachments.")
+	} else {
+		fmt.Println("\nAttachments:")
+		fmt.Println("ID   | Name                           | Size")
+		fmt.Println("-----+--------------------------------+------------")
+
+		for _, attachment := range attachments {
+			fmt.Printf("%-4d | %-30s | %d bytes\n",
+				attachment.ID, truncateString(attachment.Name, 30), attachment.Size)
+		}
+	}
+
+	fmt.Println("\n1. Attach file")
+	fmt.Println("2. Extract attachment")
+	fmt.Println("3. Delete attachment")
+	fmt.Println("0. Back")
+	fmt.Print("Enter your choice: ")
+
+	switch readLine(reader) {
+	case "1":
+		fmt.Print("File path: ")
+		path := readLine(reader)
+		if path == "" {
+			return
+		}
+
+		_, err = pm.AttachFile(id, path)
+		if err != nil {
+			fmt.Printf("Error attaching file: %v\n", err)
+			return
+		}
+
+		fmt.Println("File attached successfully.")
+	case "2":
+		fmt.Print("Enter attachment ID: ")
+		attachmentID, err := strconv.ParseInt(readLine(reader), 10, 64)
+		if err != nil {
+			fmt.Println("Invalid ID.")
+			return
+		}
+
+		fmt.Print("Save to path: ")
+		path := readLine(reader)
+		if path == "" {
+			return
+		}
+
+		err = pm.ExtractAttachmentToFile(attachmentID, path)
+		if err != nil {
+			fmt.Printf("Error extracting attachment: %v\n", err)
+			return
+		}
+
+		fmt.Println("Attachment extracted successfully.")
+	case "3":
+		fmt.Print("Enter attachment ID: ")
+		attachmentID, err := strconv.ParseInt(readLine(reader), 10, 64)
+		if err != nil {
+			fmt.Println("Invalid ID.")
+			return
+		}
+
+		fmt.Print("Are you sure you want to delete this attachment? (y/n): ")
+		if strings.ToLower(readLine(reader)) != "y" {
+			fmt.Println("Deletion cancelled.")
+			return
+		}
+
+		err = pm.DeleteAttachment(attachmentID)
+		if err != nil {
+			fmt.Printf("Error deleting attachment: %v\n", err)
+			return
+		}
+
+		fmt.Println("Attachment deleted successfully.")
+	}
+}
+
+// showOTPCode displays the current one-time password of an entry until the user is done
+func showOTPCode(pm *manager.PasswordManager, reader *bufio.Reader) {
+	id, ok := selectEntry(pm, reader, "Search for an entry: ")
+	if !ok {
+		return
+	}
+
+	for {
+		code, err := pm.GetOTPCode(id)
+		if err != nil {
+			fmt.Printf("Error generating one-time password: %v\n", err)
+			return
+		}
+
+		if code.Type == otp.TypeHOTP {
+			fmt.Printf("\nCode: %s (counter %d)\n", code.Code, code.Counter)
+			fmt.Print("Press Enter for the next code or 'q' to go back: ")
+		} else {
+			fmt.Printf("\nCode: %s (%ds remaining)\n", code.Code, int(code.Remaining.Seconds()))
+			fmt.Print("Press Enter to refresh or 'q' to go back: ")
+		}
+		if strings.ToLower(readLine(reader)) == "q" {
+			return
+		}
+	}
+}
+
+// Helper functions
+
+// selectEntry asks for an entry by name and returns the ID of the chosen one.
+// The answer is fuzzy matched against the vault; "#<id>" selects by ID and a
+// UUID selects the entry with that UUID.
+func selectEntry(pm *manager.PasswordManager, reader *bufio.Reader, prompt string) (int64, bool) {
+	fmt.Print(prompt)
+	query := readLine(reader)
+	if query == "" {
+		fmt.Println("No entry given.")
+		return 0, false
+	}
+
+	if strings.HasPrefix(query, "#") {
+		id, err := strconv.ParseInt(query[1:], 10, 64)
+		if err != nil {
+			fmt.Println("Invalid ID.")
+			return 0, false
+		}
+		return id, true
+	}
+
+	if models.IsUUID(query) {
+		entry, err := pm.GetPasswordByUUID(query)
+		if err != nil {
+			fmt.Printf("Error retrieving password: %v\n", err)
+			return 0, false
+		}
+		return entry.ID, true
+	}
+
+	matches, err := pm.FuzzySearch(query, 10)
+	if err != nil {
+		fmt.Printf("Error searching entries: %v\n", err)
+		return 0, false
+	}
+
+	switch len(matches) {
+	case 0:
+		fmt.Println("No matching entries.")
+		return 0, false
+	case 1:
+		fmt.Printf("Selected: %s\n", describeMatch(matches[0]))
+		return matches[0].Entry.ID, true
+	}
+
+	fmt.Println("\nMatching entries:")
+	for i, match := range matches {
+		fmt.Printf("%2d. %s\n", i+1, describeMatch(match))
+	}
+
+	fmt.Print("Choose an entry [1]: ")
+	choice := readLine(reader)
+	if choice == "" {
+		return matches[0].Entry.ID, true
+	}
+
+	n, err := strconv.Atoi(choice)
+	if err != nil || n < 1 || n > len(matches) {
+		fmt.Println("Invalid choice.")
+		return 0, false
+	}
+	return matches[n-1].Entry.ID, true
+}
+
+// describeMatch formats a fuzzy match for display, highlighting the matched characters
+func describeMatch(match manager.FuzzyMatch) string {
+	open, close := "[", "]"
+	if term.IsTerminal(int(os.Stdout.Fd())) {
+		open, close = "\033[1;4m", "\033[0m"
+	}
+
+	if match.Field == "title" {
+		return match.Highlight(open, close)
+	}
+	return fmt.Sprintf("%s (%s: %s)", match.Entry.Title, match.Field, match.Highlight(open, close))
+}
+
+// readLine reads a line from the reader and trims spaces
+func readLine(reader *bufio.Reader) string {
+	text, err := reader.ReadString('\n')
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(text)
+}
+
+// readMultiline reads lines until a line containing only "." or end of input
+func readMultiline(reader *bufio.Reader) string {
+	var lines []string
+	for {
+		line, err := reader.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if line == "." || (err != nil && line == "") {
+			break
+		}
+		lines = append(lines, line)
+		if err != nil {
+			break
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// nonEmpty returns the values that are not empty
+func nonEmpty(values ...string) []string {
+	var result []string
+	for _, value := range values {
+		if value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
 }
 
 // truncateString truncates a string to the specified length
@@ -3,8 +3,15 @@ module github.com/loganmanery/passmanager
 go 1.23.2
 
 require (
+	filippo.io/age v1.2.1
 	github.com/mattn/go-sqlite3 v1.14.24
+	github.com/tobischo/argon2 v0.1.0
 	golang.org/x/crypto v0.36.0
+	golang.org/x/net v0.37.0
+	golang.org/x/term v0.30.0
 )
 
-require golang.org/x/sys v0.31.0 // indirect
+require (
+	golang.org/x/sys v0.31.0 // indirect
+	golang.org/x/text v0.23.0 // indirect
+)
@@ -1,6 +1,9 @@
 package crypto
 
 import (
+	"errors"
+	"fmt"
+
 	"golang.org/x/crypto/argon2"
 )
 
@@ -12,16 +15,75 @@ const (
 	argonKeyLen  = 32        // Output key length (for AES-256)
 )
 
+// Limits on Argon2 parameters read from files, so that a crafted file cannot
+// demand unbounded time or memory
+const (
+	maxArgonTime   = 64
+	maxArgonMemory = 1024 * 1024 // 1 GiB
+)
+
+// KDFArgon2id names the Argon2id key derivation function
+const KDFArgon2id = "argon2id"
+
+// KDFParams describes how DeriveKey turns a password into a key
+type KDFParams struct {
+	Algorithm string `json:"algorithm"`
+	Time      uint32 `json:"time"`
+	MemoryKiB uint32 `json:"memory_kib"`
+	Threads   uint8  `json:"threads"`
+	KeyLength uint32 `json:"key_length"`
+}
+
+// KDFParams returns the parameters used by DeriveKey
+func (s *aesCryptoService) KDFParams() KDFParams {
+	return KDFParams{
+		Algorithm: KDFArgon2id,
+		Time:      argonTime,
+		MemoryKiB: argonMemory,
+		Threads:   argonThreads,
+		KeyLength: argonKeyLen,
+	}
+}
+
+// Validate checks that the parameters are supported and within safe limits
+func (p KDFParams) Validate() error {
+	if p.Algorithm != KDFArgon2id {
+		return fmt.Errorf("unsupported key derivation %q", p.Algorithm)
+	}
+	if p.Time < 1 || p.Time > maxArgonTime {
+		return fmt.Errorf("argon2 time %d out of range", p.Time)
+	}
+	if p.Threads < 1 {
+		return errors.New("argon2 needs at least one thread")
+	}
+	if p.MemoryKiB < 8*uint32(p.Threads) || p.MemoryKiB > maxArgonMemory {
+		return fmt.Errorf("argon2 memory %d KiB out of range", p.MemoryKiB)
+	}
+	if p.KeyLength != argonKeyLen {
+		return fmt.Errorf("unsupported key length %d", p.KeyLength)
+	}
+	return nil
+}
+
 // DeriveKey derives an encryption key from a password and salt using Argon2id
 func (s *aesCryptoService) DeriveKey(password string, salt []byte) ([]byte, error) {
-	// Generate the encryption key from master password
+	return s.DeriveKeyWithParams(password, salt, s.KDFParams())
+}
+
+// DeriveKeyWithParams derives an encryption key from a password and salt using
+// Argon2id with the given parameters
+func (s *aesCryptoService) DeriveKeyWithParams(password string, salt []byte, params KDFParams) ([]byte, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+
 	key := argon2.IDKey(
 		[]byte(password),
 		salt,
-		argonTime,
-		argonMemory,
-		argonThreads,
-		argonKeyLen,
+		params.Time,
+		params.MemoryKiB,
+		params.Threads,
+		params.KeyLength,
 	)
 
 	return key, nil
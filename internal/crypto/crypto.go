@@ -1,10 +1,19 @@
 package crypto
 
+import "io"
+
 // CryptoService defines the interface for encryption operations
 type CryptoService interface {
 	// DeriveKey derives an encryption key from a password and salt
 	DeriveKey(password string, salt []byte) ([]byte, error)
 
+	// DeriveKeyWithParams derives an encryption key from a password and salt
+	// using explicit key derivation parameters
+	DeriveKeyWithParams(password string, salt []byte, params KDFParams) ([]byte, error)
+
+	// KDFParams returns the parameters used by DeriveKey
+	KDFParams() KDFParams
+
 	// GenerateSalt generates a cryptographically secure random salt
 	GenerateSalt() ([]byte, error)
 
@@ -16,6 +25,27 @@ type CryptoService interface {
 
 	// VerifyKey verifies if a key can decrypt a test vector
 	VerifyKey(key []byte, testVector []byte) (bool, error)
+
+	// NewEncryptWriter returns a writer that encrypts to dst in authenticated chunks
+	NewEncryptWriter(dst io.Writer, key []byte) (io.WriteCloser, error)
+
+	// NewDecryptReader returns a reader that decrypts and authenticates a chunked stream
+	NewDecryptReader(src io.Reader, key []byte) (io.Reader, error)
+
+	// EncryptStream encrypts src to dst in authenticated chunks
+	EncryptStream(dst io.Writer, src io.Reader, key []byte) error
+
+	// DecryptStream decrypts and authenticates a chunked stream from src to dst
+	DecryptStream(dst io.Writer, src io.Reader, key []byte) error
+
+	// DeriveSubkey derives a purpose-specific key from the master key
+	DeriveSubkey(key []byte, purpose string) ([]byte, error)
+
+	// ComputeMAC computes a message authentication code over data
+	ComputeMAC(data []byte, key []byte) []byte
+
+	// VerifyMAC checks a message authentication code in constant time
+	VerifyMAC(data []byte, key []byte, expected []byte) bool
 }
 
 // NewCryptoService creates a new instance of the default crypto service
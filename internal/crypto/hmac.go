@@ -0,0 +1,34 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// subkeyLen is the length of keys derived from the master key
+const subkeyLen = 32
+
+// DeriveSubkey derives a purpose-specific key from the master key using HKDF-SHA256
+func (s *aesCryptoService) DeriveSubkey(key []byte, purpose string) ([]byte, error) {
+	subkey := make([]byte, subkeyLen)
+	reader := hkdf.New(sha256.New, key, nil, []byte(purpose))
+	if _, err := io.ReadFull(reader, subkey); err != nil {
+		return nil, err
+	}
+	return subkey, nil
+}
+
+// ComputeMAC computes an HMAC-SHA256 over data with the provided key
+func (s *aesCryptoService) ComputeMAC(data []byte, key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// VerifyMAC checks an HMAC-SHA256 in constant time
+func (s *aesCryptoService) VerifyMAC(data []byte, key []byte, expected []byte) bool {
+	return hmac.Equal(s.ComputeMAC(data, key), expected)
+}
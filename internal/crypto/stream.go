@@ -0,0 +1,278 @@
+package crypto
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Streaming encryption parameters. A stream is a header of a version byte and
+// a random salt, followed by AES-GCM sealed chunks. Each stream uses its own key
+// derived from the caller's key and the salt, and each chunk nonce is a counter
+// with a flag marking the final chunk, so that reordering, truncation and
+// appended data are all detected (the STREAM construction).
+const (
+	streamVersion    = 1
+	streamSaltSize   = 16
+	streamChunkSize  = 64 * 1024
+	streamKeyPurpose = "passmanager stream v1"
+)
+
+// StreamCipher names the cipher and construction of encrypted streams
+const StreamCipher = "AES-256-GCM-STREAM"
+
+// ErrStreamAuth is returned when a chunk of an encrypted stream fails to
+// authenticate, because the key is wrong or the data was modified
+var ErrStreamAuth = errors.New("encrypted stream authentication failed")
+
+// NewEncryptWriter returns a writer that encrypts everything written to it into
+// dst. Close must be called to seal the final chunk; it does not close dst.
+func (s *aesCryptoService) NewEncryptWriter(dst io.Writer, key []byte) (io.WriteCloser, error) {
+	w, err := newStreamWriter(dst, key)
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// NewDecryptReader returns a reader that decrypts and authenticates a stream
+// from src. Data is only returned once its chunk has been authenticated, and
+// reading fails instead of returning io.EOF if the stream was truncated.
+func (s *aesCryptoService) NewDecryptReader(src io.Reader, key []byte) (io.Reader, error) {
+	r, err := newStreamReader(src, key)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// EncryptStream encrypts everything read from src and writes it to dst
+func (s *aesCryptoService) EncryptStream(dst io.Writer, src io.Reader, key []byte) error {
+	w, err := s.NewEncryptWriter(dst, key)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, src); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+// DecryptStream decrypts an encrypted stream read from src and writes the plaintext to dst.
+// Only authenticated chunks are written; an error is returned if the stream was modified or truncated.
+func (s *aesCryptoService) DecryptStream(dst io.Writer, src io.Reader, key []byte) error {
+	r, err := s.NewDecryptReader(src, key)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, r)
+	return err
+}
+
+// newStreamAEAD derives the per-stream key and creates the chunk cipher
+func newStreamAEAD(key, salt []byte) (cipher.AEAD, error) {
+	streamKey := make([]byte, 32)
+	reader := hkdf.New(sha256.New, key, salt, []byte(streamKeyPurpose))
+	if _, err := io.ReadFull(reader, streamKey); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(streamKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// streamNonce builds the nonce for a chunk from its counter and final flag
+func streamNonce(nonce []byte, counter uint64, final bool) []byte {
+	for i := range nonce {
+		nonce[i] = 0
+	}
+	binary.BigEndian.PutUint64(nonce[len(nonce)-9:len(nonce)-1], counter)
+	if final {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+// streamWriter encrypts data written to it in fixed-size chunks
+type streamWriter struct {
+	dst     io.Writer
+	aead    cipher.AEAD
+	nonce   []byte
+	counter uint64
+	buf     []byte
+	out     []byte
+	closed  bool
+}
+
+// newStreamWriter writes the stream header to dst and returns a writer for the plaintext
+func newStreamWriter(dst io.Writer, key []byte) (*streamWriter, error) {
+	salt := make([]byte, streamSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := newStreamAEAD(key, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	header := append([]byte{streamVersion}, salt...)
+	if _, err := dst.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &streamWriter{
+		dst:   dst,
+		aead:  aead,
+		nonce: make([]byte, aead.NonceSize()),
+		buf:   make([]byte, 0, streamChunkSize),
+		out:   make([]byte, 0, streamChunkSize+aead.Overhead()),
+	}, nil
+}
+
+// Write buffers plaintext and seals every full chunk once more data follows it
+func (w *streamWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("write to closed stream")
+	}
+
+	written := 0
+	for len(p) > 0 {
+		// A full chunk is only sealed when more data arrives, so that the
+		// chunk left in the buffer at Close can be marked as final
+		if len(w.buf) == streamChunkSize {
+			if err := w.seal(false); err != nil {
+				return written, err
+			}
+		}
+
+		n := copy(w.buf[len(w.buf):streamChunkSize], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+	}
+
+	return written, nil
+}
+
+// Close seals the final chunk. It does not close the underlying writer.
+func (w *streamWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.seal(true)
+}
+
+// seal encrypts the buffered plaintext as the next chunk
+func (w *streamWriter) seal(final bool) error {
+	w.out = w.aead.Seal(w.out[:0], streamNonce(w.nonce, w.counter, final), w.buf, nil)
+	if _, err := w.dst.Write(w.out); err != nil {
+		return err
+	}
+
+	w.counter++
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// streamReader decrypts and authenticates a stream chunk by chunk
+type streamReader struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	nonce   []byte
+	counter uint64
+	enc     []byte
+	plain   []byte
+	pending []byte
+	done    bool
+	err     error
+}
+
+// newStreamReader reads the stream header from src and returns a reader for the plaintext
+func newStreamReader(src io.Reader, key []byte) (*streamReader, error) {
+	header := make([]byte, 1+streamSaltSize)
+	if _, err := io.ReadFull(src, header); err != nil {
+		return nil, errors.New("encrypted stream too short")
+	}
+	if header[0] != streamVersion {
+		return nil, errors.New("unsupported encrypted stream version")
+	}
+
+	aead, err := newStreamAEAD(key, header[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	return &streamReader{
+		src:   bufio.NewReaderSize(src, streamChunkSize+aead.Overhead()),
+		aead:  aead,
+		nonce: make([]byte, aead.NonceSize()),
+		enc:   make([]byte, streamChunkSize+aead.Overhead()),
+		plain: make([]byte, 0, streamChunkSize),
+	}, nil
+}
+
+// Read returns decrypted plaintext, opening the next chunk when needed
+func (r *streamReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+		r.err = r.open()
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// open reads and authenticates the next chunk
+func (r *streamReader) open() error {
+	n, err := io.ReadFull(r.src, r.enc)
+	final := false
+	switch {
+	case errors.Is(err, io.EOF):
+		return errors.New("encrypted stream truncated")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		// A short chunk can only be the last one
+		final = true
+	case err != nil:
+		return err
+	default:
+		// A full chunk is the last one if nothing follows it
+		if _, err := r.src.Peek(1); err != nil {
+			if !errors.Is(err, io.EOF) {
+				return err
+			}
+			final = true
+		}
+	}
+
+	r.plain, err = r.aead.Open(r.plain[:0], streamNonce(r.nonce, r.counter, final), r.enc[:n], nil)
+	if err != nil {
+		return ErrStreamAuth
+	}
+
+	r.counter++
+	r.done = final
+	r.pending = r.plain
+	return nil
+}
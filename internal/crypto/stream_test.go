@@ -0,0 +1,190 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// streamHeaderSize and sealedChunkSize give the layout of an encrypted stream
+const (
+	streamHeaderSize = 1 + streamSaltSize
+	sealedChunkSize  = streamChunkSize + 16
+)
+
+// testStreamKey returns a fixed key for stream tests
+func testStreamKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+// testPlaintext returns n bytes of recognizable plaintext
+func testPlaintext(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	return data
+}
+
+// encryptTestStream encrypts plaintext into a stream
+func encryptTestStream(t *testing.T, plaintext, key []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := NewCryptoService().EncryptStream(&buf, bytes.NewReader(plaintext), key); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   int
+		chunks int
+	}{
+		{"empty", 0, 1},
+		{"less than a chunk", 1000, 1},
+		{"exactly one chunk", streamChunkSize, 1},
+		{"one byte over a chunk", streamChunkSize + 1, 2},
+		{"several chunks", 3*streamChunkSize + 123, 4},
+	}
+
+	svc := NewCryptoService()
+	key := testStreamKey(1)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plaintext := testPlaintext(tt.size)
+			stream := encryptTestStream(t, plaintext, key)
+
+			// Every chunk but the last is full, and the last carries its tag
+			want := streamHeaderSize + tt.size + tt.chunks*16
+			if len(stream) != want {
+				t.Errorf("stream is %d bytes, want %d", len(stream), want)
+			}
+
+			var got bytes.Buffer
+			if err := svc.DecryptStream(&got, bytes.NewReader(stream), key); err != nil {
+				t.Fatalf("DecryptStream failed: %v", err)
+			}
+			if !bytes.Equal(got.Bytes(), plaintext) {
+				t.Errorf("decrypted %d bytes that differ from the %d bytes encrypted", got.Len(), len(plaintext))
+			}
+		})
+	}
+}
+
+func TestStreamWriterSmallWrites(t *testing.T) {
+	svc := NewCryptoService()
+	key := testStreamKey(1)
+	plaintext := testPlaintext(2*streamChunkSize + 10)
+
+	var buf bytes.Buffer
+	w, err := svc.NewEncryptWriter(&buf, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(plaintext); i += 1000 {
+		end := min(i+1000, len(plaintext))
+		if _, err := w.Write(plaintext[i:end]); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	r, err := svc.NewDecryptReader(&buf, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading failed: %v", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Error("decrypted data differs from the plaintext")
+	}
+}
+
+func TestStreamRejects(t *testing.T) {
+	key := testStreamKey(1)
+	stream := encryptTestStream(t, testPlaintext(3*streamChunkSize+500), key)
+	chunk := func(i int) []byte {
+		start := streamHeaderSize + i*sealedChunkSize
+		return stream[start:min(start+sealedChunkSize, len(stream))]
+	}
+
+	swapped := bytes.Clone(stream[:streamHeaderSize])
+	swapped = append(swapped, chunk(1)...)
+	swapped = append(swapped, chunk(0)...)
+	swapped = append(swapped, chunk(2)...)
+	swapped = append(swapped, chunk(3)...)
+
+	flipped := bytes.Clone(stream)
+	flipped[streamHeaderSize+sealedChunkSize+100] ^= 1
+
+	tests := []struct {
+		name   string
+		stream []byte
+		key    []byte
+	}{
+		{"final chunk missing", stream[:streamHeaderSize+3*sealedChunkSize], key},
+		{"cut after the first chunk", stream[:streamHeaderSize+sealedChunkSize], key},
+		{"cut inside a chunk", stream[:streamHeaderSize+sealedChunkSize+100], key},
+		{"chunks swapped", swapped, key},
+		{"data after the final chunk", append(bytes.Clone(stream), 0), key},
+		{"final chunk repeated", append(bytes.Clone(stream), chunk(3)...), key},
+		{"bit flipped", flipped, key},
+		{"salt changed", append([]byte{stream[0], stream[1] ^ 1}, stream[2:]...), key},
+		{"wrong key", stream, testStreamKey(2)},
+	}
+
+	svc := NewCryptoService()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := svc.DecryptStream(io.Discard, bytes.NewReader(tt.stream), tt.key)
+			if !errors.Is(err, ErrStreamAuth) {
+				t.Errorf("DecryptStream error = %v, want ErrStreamAuth", err)
+			}
+		})
+	}
+}
+
+func TestStreamReaderReturnsOnlyAuthenticatedData(t *testing.T) {
+	key := testStreamKey(1)
+	stream := encryptTestStream(t, testPlaintext(2*streamChunkSize+10), key)
+	stream[streamHeaderSize+sealedChunkSize+5] ^= 1
+
+	// The first chunk is intact and returned; the damaged second one is not
+	var got bytes.Buffer
+	err := NewCryptoService().DecryptStream(&got, bytes.NewReader(stream), key)
+	if !errors.Is(err, ErrStreamAuth) {
+		t.Fatalf("DecryptStream error = %v, want ErrStreamAuth", err)
+	}
+	if got.Len() != streamChunkSize {
+		t.Errorf("got %d bytes before the failure, want %d", got.Len(), streamChunkSize)
+	}
+}
+
+func TestStreamHeaderErrors(t *testing.T) {
+	svc := NewCryptoService()
+	key := testStreamKey(1)
+
+	if _, err := svc.NewDecryptReader(bytes.NewReader([]byte{streamVersion, 1, 2}), key); err == nil {
+		t.Error("short header accepted")
+	}
+
+	stream := encryptTestStream(t, []byte("hello"), key)
+	stream[0] = streamVersion + 1
+	if _, err := svc.NewDecryptReader(bytes.NewReader(stream), key); err == nil {
+		t.Error("unknown version accepted")
+	}
+
+	// A stream without any chunk was cut off right after its header
+	err := svc.DecryptStream(io.Discard, bytes.NewReader(stream[:streamHeaderSize]), key)
+	if err == nil {
+		t.Error("stream without chunks accepted")
+	}
+}
@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+)
+
+// attachmentChunkSize is the maximum size of a single attachment content row
+const attachmentChunkSize = 1024 * 1024
+
+// AddAttachment stores an attachment and its encrypted content, read from content
+// until EOF. Nothing is stored if reading content fails.
+func (s *SQLiteStorage) AddAttachment(attachment *models.Attachment, content io.Reader) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	id, err := insertAttachment(tx, attachment, content)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// insertAttachment stores an attachment and its encrypted content within a
+// transaction, splitting the content into chunks
+func insertAttachment(tx *sql.Tx, attachment *models.Attachment, content io.Reader) (int64, error) {
+	result, err := tx.Exec(`
+		INSERT INTO attachments (password_id, name, size, created_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+	`, attachment.PasswordID, attachment.Name, attachment.Size)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	stmt, err := tx.Prepare("INSERT INTO attachment_chunks (attachment_id, seq, data) VALUES (?, ?, ?)")
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	buf := make([]byte, attachmentChunkSize)
+	for seq := 0; ; seq++ {
+		n, err := io.ReadFull(content, buf)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, err
+		}
+
+		_, err = stmt.Exec(id, seq, buf[:n])
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return id, nil
+}
+
+// GetAttachments retrieves the attachments of an entry
+func (s *SQLiteStorage) GetAttachments(passwordID int64) ([]models.Attachment, error) {
+	rows, err := s.db.Query(`
+		SELECT id, password_id, name, size, created_at
+		FROM attachments WHERE password_id = ? ORDER BY name, id
+	`, passwordID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attachments []models.Attachment
+	for rows.Next() {
+		var attachment models.Attachment
+		err := rows.Scan(&attachment.ID, &attachment.PasswordID, &attachment.Name,
+			&attachment.Size, &attachment.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		attachments = append(attachments, attachment)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return attachments, nil
+}
+
+// GetAttachment retrieves a single attachment by ID
+func (s *SQLiteStorage) GetAttachment(id int64) (*models.Attachment, error) {
+	var attachment models.Attachment
+	err := s.db.QueryRow(`
+		SELECT id, password_id, name, size, created_at
+		FROM attachments WHERE id = ?
+	`, id).Scan(&attachment.ID, &attachment.PasswordID, &attachment.Name,
+		&attachment.Size, &attachment.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &attachment, nil
+}
+
+// ReadAttachment writes the encrypted content of an attachment to w
+func (s *SQLiteStorage) ReadAttachment(id int64, w io.Writer) error {
+	rows, err := s.db.Query(`
+		SELECT data FROM attachment_chunks
+		WHERE attachment_id = ? ORDER BY seq
+	`, id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// DeleteAttachment deletes an attachment and its content
+func (s *SQLiteStorage) DeleteAttachment(id int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.Exec("DELETE FROM attachment_chunks WHERE attachment_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM attachments WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	err = requireAffected(result)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// exportAttachments retrieves the attachments of an entry with their
+// encrypted content
+func exportAttachments(tx *sql.Tx, passwordID int64) ([]models.ExportAttachment, error) {
+	rows, err := tx.Query(`
+		SELECT a.id, a.name, a.size, c.data
+		FROM attachments a
+		LEFT JOIN attachment_chunks c ON c.attachment_id = a.id
+		WHERE a.password_id = ?
+		ORDER BY a.name, a.id, c.seq
+	`, passwordID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.ExportAttachment
+	lastID := int64(-1)
+	for rows.Next() {
+		var id int64
+		var attachment models.ExportAttachment
+		var data []byte
+		if err := rows.Scan(&id, &attachment.Name, &attachment.Size, &data); err != nil {
+			return nil, err
+		}
+
+		// Every chunk is a row of its own
+		if id != lastID {
+			lastID = id
+			result = append(result, attachment)
+		}
+		last := &result[len(result)-1]
+		last.Data = append(last.Data, data...)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+)
+
+// AppendAuditLog appends a chained audit record and updates the chain head
+func (s *SQLiteStorage) AppendAuditLog(entry *models.AuditLogEntry, head []byte) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	result, err := tx.Exec(`
+		INSERT INTO audit_log (seq, action, resource_type, resource_id, details, created_at, prev_mac, mac)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, entry.Seq, entry.Action, entry.ResourceType, entry.ResourceID, entry.Details,
+		entry.CreatedAt.UTC(), entry.PrevMAC, entry.MAC)
+	if err != nil {
+		return err
+	}
+
+	entry.ID, err = result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT OR REPLACE INTO config (key, value) VALUES (?, ?)", "audit_head", head)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetLastAuditLog retrieves the most recent audit record, or nil if the log is empty
+func (s *SQLiteStorage) GetLastAuditLog() (*models.AuditLogEntry, error) {
+	var entry models.AuditLogEntry
+	var resourceID sql.NullInt64
+	var details sql.NullString
+
+	err := s.db.QueryRow(`
+		SELECT id, seq, action, resource_type, resource_id, details, created_at, prev_mac, mac
+		FROM audit_log WHERE seq IS NOT NULL ORDER BY seq DESC LIMIT 1
+	`).Scan(&entry.ID, &entry.Seq, &entry.Action, &entry.ResourceType, &resourceID,
+		&details, &entry.CreatedAt, &entry.PrevMAC, &entry.MAC)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // Empty log, not an error
+		}
+		return nil, err
+	}
+
+	entry.ResourceID = resourceID.Int64
+	entry.Details = details.String
+
+	return &entry, nil
+}
+
+// GetAuditLog retrieves every audit record in insertion order
+func (s *SQLiteStorage) GetAuditLog() ([]models.AuditLogEntry, error) {
+	rows, err := s.db.Query(`
+		SELECT id, seq, action, resource_type, resource_id, details, created_at, prev_mac, mac
+		FROM audit_log ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.AuditLogEntry
+	for rows.Next() {
+		var entry models.AuditLogEntry
+		var seq, resourceID sql.NullInt64
+		var details sql.NullString
+
+		err := rows.Scan(&entry.ID, &seq, &entry.Action, &entry.ResourceType, &resourceID,
+			&details, &entry.CreatedAt, &entry.PrevMAC, &entry.MAC)
+		if err != nil {
+			return nil, err
+		}
+
+		entry.Seq = seq.Int64
+		entry.ResourceID = resourceID.Int64
+		entry.Details = details.String
+
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// GetAuditHead retrieves the authenticated head of the audit chain
+func (s *SQLiteStorage) GetAuditHead() ([]byte, error) {
+	var head []byte
+	err := s.db.QueryRow("SELECT value FROM config WHERE key = 'audit_head'").Scan(&head)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // No audit records yet, not an error
+		}
+		return nil, err
+	}
+	return head, nil
+}
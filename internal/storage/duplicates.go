@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+)
+
+// MergePasswords folds entries into the entry keepID: it is overwritten with
+// the merged entry survivor the way UpdatePassword does, their password
+// history and attachments move to it, the given encrypted passwords are
+// archived in its history, and the merged entries are moved to the trash
+func (s *SQLiteStorage) MergePasswords(keepID int64, survivor models.ExportEntry, mergeIDs []int64, archived [][]byte) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = updateEntry(tx, keepID, survivor)
+	if err != nil {
+		return err
+	}
+
+	for _, encPassword := range archived {
+		_, err = tx.Exec(`
+			INSERT INTO password_history (password_id, password, created_at)
+			VALUES (?, ?, CURRENT_TIMESTAMP)
+		`, keepID, encPassword)
+		if err != nil {
+			return err
+		}
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(mergeIDs)), ", ")
+	args := []interface{}{keepID}
+	for _, id := range mergeIDs {
+		args = append(args, id)
+	}
+
+	for _, table := range []string{"password_history", "attachments"} {
+		_, err = tx.Exec("UPDATE "+table+" SET password_id = ? WHERE password_id IN ("+placeholders+")", args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	result, err := tx.Exec(`
+		UPDATE passwords SET deleted_at = CURRENT_TIMESTAMP
+		WHERE id IN (`+placeholders+`) AND deleted_at IS NULL
+	`, args[1:]...)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected != int64(len(mergeIDs)) {
+		err = sql.ErrNoRows
+		return err
+	}
+
+	return tx.Commit()
+}
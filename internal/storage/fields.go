@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"database/sql"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+)
+
+// GetCustomFields retrieves the custom fields of an entry in display order, along
+// with their stored values. Field values are left empty for the caller to decode.
+func (s *SQLiteStorage) GetCustomFields(passwordID int64) ([]models.CustomField, [][]byte, error) {
+	rows, err := s.db.Query(`
+		SELECT name, type, value FROM custom_fields
+		WHERE password_id = ? ORDER BY position, id
+	`, passwordID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var fields []models.CustomField
+	var values [][]byte
+	for rows.Next() {
+		var field models.CustomField
+		var value []byte
+		if err := rows.Scan(&field.Name, &field.Type, &value); err != nil {
+			return nil, nil, err
+		}
+
+		fields = append(fields, field)
+		values = append(values, value)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return fields, values, nil
+}
+
+// SaveCustomFields replaces the custom fields of an entry with the given fields
+// and their stored values, and marks the entry as updated
+func (s *SQLiteStorage) SaveCustomFields(passwordID int64, fields []models.CustomField, values [][]byte) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = replaceCustomFields(tx, passwordID, fields, values)
+	if err != nil {
+		return err
+	}
+
+	err = touchEntry(tx, passwordID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// replaceCustomFields sets the exact custom fields of an entry within a transaction
+func replaceCustomFields(tx *sql.Tx, passwordID int64, fields []models.CustomField, values [][]byte) error {
+	_, err := tx.Exec("DELETE FROM custom_fields WHERE password_id = ?", passwordID)
+	if err != nil {
+		return err
+	}
+
+	for i, field := range fields {
+		_, err = tx.Exec(`
+			INSERT INTO custom_fields (password_id, position, name, type, value)
+			VALUES (?, ?, ?, ?, ?)
+		`, passwordID, i, field.Name, field.Type, values[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// exportCustomFields loads the custom fields of all entries, keyed by entry ID
+func exportCustomFields(tx *sql.Tx) (map[int64][]models.ExportCustomField, error) {
+	rows, err := tx.Query(`
+		SELECT password_id, name, type, value FROM custom_fields
+		ORDER BY password_id, position, id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[int64][]models.ExportCustomField)
+	for rows.Next() {
+		var passwordID int64
+		var name, fieldType string
+		var value []byte
+		if err := rows.Scan(&passwordID, &name, &fieldType, &value); err != nil {
+			return nil, err
+		}
+
+		result[passwordID] = append(result[passwordID], models.ExportCustomField{
+			Name:  name,
+			Type:  fieldType,
+			Value: value,
+		})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
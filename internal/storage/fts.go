@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// ftsTagsColumn collects the tags of the entry a trigger fires for
+const ftsTagsColumn = `(
+	SELECT GROUP_CONCAT(t.name, ' ') FROM entry_tags et
+	JOIN tags t ON t.id = et.tag_id
+	WHERE et.password_id = %s
+)`
+
+// ftsRank weighs matches in the title highest, then url and username, tags and category
+const ftsRank = `bm25(passwords_fts, 10.0, 5.0, 5.0, 3.0, 1.0)`
+
+// ftsTriggers keep the full-text index in sync with passwords and their tags
+var ftsTriggers = []string{
+	`CREATE TRIGGER passwords_fts_insert AFTER INSERT ON passwords BEGIN
+		INSERT INTO passwords_fts (rowid, title, url, username, tags, category)
+		VALUES (NEW.id, NEW.title, NEW.url, NEW.username, ` + ftsTags("NEW.id") + `, NEW.category);
+	END`,
+	`CREATE TRIGGER passwords_fts_update AFTER UPDATE OF title, url, username, category ON passwords BEGIN
+		UPDATE passwords_fts SET title = NEW.title, url = NEW.url, username = NEW.username, category = NEW.category
+		WHERE rowid = NEW.id;
+	END`,
+	`CREATE TRIGGER passwords_fts_delete AFTER DELETE ON passwords BEGIN
+		DELETE FROM passwords_fts WHERE rowid = OLD.id;
+	END`,
+	`CREATE TRIGGER entry_tags_fts_insert AFTER INSERT ON entry_tags BEGIN
+		UPDATE passwords_fts SET tags = ` + ftsTags("NEW.password_id") + ` WHERE rowid = NEW.password_id;
+	END`,
+	`CREATE TRIGGER entry_tags_fts_delete AFTER DELETE ON entry_tags BEGIN
+		UPDATE passwords_fts SET tags = ` + ftsTags("OLD.password_id") + ` WHERE rowid = OLD.password_id;
+	END`,
+}
+
+// ftsTriggerNames lists the triggers created by ftsTriggers
+var ftsTriggerNames = []string{
+	"passwords_fts_insert",
+	"passwords_fts_update",
+	"passwords_fts_delete",
+	"entry_tags_fts_insert",
+	"entry_tags_fts_delete",
+}
+
+// initializeSearchIndex sets up the FTS5 index used by SearchPasswords. When
+// SQLite was built without FTS5 the triggers are removed, so that a vault
+// indexed by another build stays writable, and searches fall back to LIKE.
+// The index is rebuilt whenever its triggers had to be (re)created.
+//
+// go-sqlite3 only compiles FTS5 in with the sqlite_fts5 build tag, so
+// binaries built without -tags sqlite_fts5 always use the LIKE fallback.
+func (s *SQLiteStorage) initializeSearchIndex() error {
+	var available bool
+	err := s.db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&available)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if !available {
+		for _, name := range ftsTriggerNames {
+			_, err = tx.Exec("DROP TRIGGER IF EXISTS " + name)
+			if err != nil {
+				return err
+			}
+		}
+		s.fts = false
+		return tx.Commit()
+	}
+
+	var triggers int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FROM sqlite_master
+		WHERE type = 'trigger' AND name IN ('` + strings.Join(ftsTriggerNames, "', '") + `')
+	`).Scan(&triggers)
+	if err != nil {
+		return err
+	}
+
+	if triggers != len(ftsTriggerNames) {
+		err = rebuildSearchIndex(tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	s.fts = true
+	return nil
+}
+
+// rebuildSearchIndex recreates the FTS5 index and its triggers from scratch
+func rebuildSearchIndex(tx *sql.Tx) error {
+	statements := []string{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS passwords_fts USING fts5(
+			title, url, username, tags, category,
+			tokenize = 'unicode61 remove_diacritics 2',
+			prefix = '2 3'
+		)`,
+		`DELETE FROM passwords_fts`,
+		`INSERT INTO passwords_fts (rowid, title, url, username, tags, category)
+		SELECT id, title, url, username, ` + ftsTags("passwords.id") + `, category FROM passwords`,
+	}
+	for _, name := range ftsTriggerNames {
+		statements = append(statements, "DROP TRIGGER IF EXISTS "+name)
+	}
+	statements = append(statements, ftsTriggers...)
+
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ftsTags returns the tags subquery for the entry with the given ID expression
+func ftsTags(id string) string {
+	return fmt.Sprintf(ftsTagsColumn, id)
+}
+
+// ftsQuery turns a search keyword into an FTS5 query. Quoted text is matched
+// as a phrase and every other word as a prefix; all of them must match.
+func ftsQuery(keyword string) string {
+	var terms []string
+	rest := strings.TrimSpace(keyword)
+	for rest != "" {
+		var term string
+		if rest[0] == '"' {
+			phrase, after, _ := strings.Cut(rest[1:], `"`)
+			term, rest = strings.TrimSpace(phrase), after
+			if term != "" {
+				terms = append(terms, ftsString(term))
+			}
+		} else {
+			term, rest, _ = strings.Cut(rest, " ")
+			term = strings.TrimRight(term, "*")
+			if term != "" {
+				terms = append(terms, ftsString(term)+"*")
+			}
+		}
+		rest = strings.TrimSpace(rest)
+	}
+	return strings.Join(terms, " AND ")
+}
+
+// ftsString quotes a string for use in an FTS5 query
+func ftsString(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
@@ -0,0 +1,138 @@
+//go:build sqlite_fts5
+
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+)
+
+// newFTSTestStorage returns an empty test vault that uses the full-text index
+func newFTSTestStorage(t *testing.T) *SQLiteStorage {
+	t.Helper()
+
+	s := newTestStorage(t)
+	if !s.fts {
+		t.Fatal("the sqlite_fts5 build did not enable the full-text index")
+	}
+	return s
+}
+
+// ftsRow returns the indexed title and tags of an entry
+func ftsRow(t *testing.T, s *SQLiteStorage, id int64) (title, tags string, found bool) {
+	t.Helper()
+
+	var indexedTags sql.NullString
+	err := s.db.QueryRow("SELECT title, tags FROM passwords_fts WHERE rowid = ?", id).Scan(&title, &indexedTags)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", "", false
+	}
+	if err != nil {
+		t.Fatalf("reading the index failed: %v", err)
+	}
+	return title, indexedTags.String, true
+}
+
+// searchTitles returns the titles of the entries matching keyword, in order
+func searchTitles(t *testing.T, s *SQLiteStorage, keyword string) []string {
+	t.Helper()
+
+	entries, err := s.SearchPasswords(models.SearchParams{Keyword: keyword})
+	if err != nil {
+		t.Fatalf("search for %q failed: %v", keyword, err)
+	}
+	var titles []string
+	for _, entry := range entries {
+		titles = append(titles, entry.Title)
+	}
+	return titles
+}
+
+func TestSearchIndexTriggers(t *testing.T) {
+	s := newFTSTestStorage(t)
+
+	// Inserting an entry indexes it along with its tags
+	id := addTestEntry(t, s, models.ExportEntry{Title: "GitHub", Tags: []string{"work"}})
+	title, tags, found := ftsRow(t, s, id)
+	if !found || title != "GitHub" || tags != "work" {
+		t.Fatalf("indexed %q with tags %q (found %v), want GitHub with work", title, tags, found)
+	}
+
+	// Updating it replaces the indexed title and tags
+	err := s.UpdatePassword(id, models.ExportEntry{Title: "GitLab", Password: []byte("ciphertext"), Tags: []string{"home"}})
+	if err != nil {
+		t.Fatalf("UpdatePassword failed: %v", err)
+	}
+	title, tags, _ = ftsRow(t, s, id)
+	if title != "GitLab" || tags != "home" {
+		t.Errorf("after the update indexed %q with tags %q, want GitLab with home", title, tags)
+	}
+	if got := searchTitles(t, s, "github"); got != nil {
+		t.Errorf("old title still matches: %q", got)
+	}
+	if got := searchTitles(t, s, "home"); !reflect.DeepEqual(got, []string{"GitLab"}) {
+		t.Errorf("new tag matches %q, want GitLab", got)
+	}
+
+	// Adding and removing tags on their own keeps the index in sync too
+	if err := s.AddTags(id, []string{"ci"}); err != nil {
+		t.Fatalf("AddTags failed: %v", err)
+	}
+	if got := searchTitles(t, s, "ci"); !reflect.DeepEqual(got, []string{"GitLab"}) {
+		t.Errorf("added tag matches %q, want GitLab", got)
+	}
+	if err := s.RemoveTags(id, []string{"ci"}); err != nil {
+		t.Fatalf("RemoveTags failed: %v", err)
+	}
+	if got := searchTitles(t, s, "ci"); got != nil {
+		t.Errorf("removed tag still matches: %q", got)
+	}
+
+	// Purging it from the trash removes it from the index
+	if err := s.DeletePassword(id); err != nil {
+		t.Fatalf("DeletePassword failed: %v", err)
+	}
+	if err := s.PurgePassword(id); err != nil {
+		t.Fatalf("PurgePassword failed: %v", err)
+	}
+	if _, _, found := ftsRow(t, s, id); found {
+		t.Error("purged entry is still indexed")
+	}
+}
+
+func TestSearchIndexQueries(t *testing.T) {
+	s := newFTSTestStorage(t)
+	addTestEntry(t, s, models.ExportEntry{Title: "GitHub", URL: "https://example.com/login"})
+	addTestEntry(t, s, models.ExportEntry{Title: "Work code", URL: "https://github.example.com/"})
+	addTestEntry(t, s, models.ExportEntry{Title: "Hello World Blog"})
+	addTestEntry(t, s, models.ExportEntry{Title: "World Hello"})
+	addTestEntry(t, s, models.ExportEntry{Title: "Café", Username: "jürgen"})
+
+	tests := []struct {
+		keyword string
+		want    []string
+	}{
+		// Title matches rank above matches in the URL
+		{"github", []string{"GitHub", "Work code"}},
+		// Every word is a prefix
+		{"git", []string{"GitHub", "Work code"}},
+		{"gith cod", []string{"Work code"}},
+		// Quoted words must appear together and in order
+		{`"hello world"`, []string{"Hello World Blog"}},
+		// Shorter titles with the same words rank first
+		{"hello world", []string{"World Hello", "Hello World Blog"}},
+		// Diacritics are ignored
+		{"cafe jurgen", []string{"Café"}},
+		{"gitlab", nil},
+	}
+
+	for _, tt := range tests {
+		if got := searchTitles(t, s, tt.keyword); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("search for %q = %q, want %q", tt.keyword, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"database/sql"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+)
+
+// GetPasswordHistory retrieves the previous passwords of an entry, newest first,
+// along with their encrypted values
+func (s *SQLiteStorage) GetPasswordHistory(passwordID int64) ([]models.PasswordHistoryEntry, [][]byte, error) {
+	rows, err := s.db.Query(`
+		SELECT id, password_id, password, created_at
+		FROM password_history WHERE password_id = ?
+		ORDER BY created_at DESC, id DESC
+	`, passwordID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.PasswordHistoryEntry
+	var encPasswords [][]byte
+	for rows.Next() {
+		var entry models.PasswordHistoryEntry
+		var encPassword []byte
+		err := rows.Scan(&entry.ID, &entry.PasswordID, &encPassword, &entry.CreatedAt)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		entries = append(entries, entry)
+		encPasswords = append(encPasswords, encPassword)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return entries, encPasswords, nil
+}
+
+// GetPasswordHistoryEntry retrieves a single history record by ID
+func (s *SQLiteStorage) GetPasswordHistoryEntry(id int64) (*models.PasswordHistoryEntry, []byte, error) {
+	var entry models.PasswordHistoryEntry
+	var encPassword []byte
+
+	err := s.db.QueryRow(`
+		SELECT id, password_id, password, created_at
+		FROM password_history WHERE id = ?
+	`, id).Scan(&entry.ID, &entry.PasswordID, &encPassword, &entry.CreatedAt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &entry, encPassword, nil
+}
+
+// PrunePasswordHistory keeps only the newest keep history records for an entry.
+// A passwordID of 0 prunes the history of every entry.
+func (s *SQLiteStorage) PrunePasswordHistory(passwordID int64, keep int) error {
+	_, err := s.db.Exec(`
+		DELETE FROM password_history
+		WHERE (? = 0 OR password_id = ?)
+		AND id NOT IN (
+			SELECT h.id FROM password_history h
+			WHERE h.password_id = password_history.password_id
+			ORDER BY h.created_at DESC, h.id DESC
+			LIMIT ?
+		)
+	`, passwordID, passwordID, keep)
+	return err
+}
+
+// exportHistory retrieves the encrypted password history of every entry,
+// oldest first, keyed by entry ID
+func exportHistory(tx *sql.Tx) (map[int64][]models.ExportHistory, error) {
+	rows, err := tx.Query(`
+		SELECT password_id, password, created_at FROM password_history
+		ORDER BY password_id, created_at, id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[int64][]models.ExportHistory)
+	for rows.Next() {
+		var passwordID int64
+		var record models.ExportHistory
+		if err := rows.Scan(&passwordID, &record.Password, &record.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		record.CreatedAt = record.CreatedAt.UTC()
+		result[passwordID] = append(result[passwordID], record)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
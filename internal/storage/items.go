@@ -0,0 +1,21 @@
+package storage
+
+import "github.com/loganmanery/passmanager/pkg/models"
+
+// GetItemData retrieves the encrypted type-specific data of an entry, or nil if it has none
+func (s *SQLiteStorage) GetItemData(passwordID int64) ([]byte, error) {
+	var encData []byte
+	err := s.db.QueryRow("SELECT item_data FROM passwords WHERE id = ?", passwordID).Scan(&encData)
+	if err != nil {
+		return nil, err
+	}
+	return encData, nil
+}
+
+// itemType returns the stored item type of an entry, defaulting to a login
+func itemType(typ string) string {
+	if typ == "" {
+		return models.ItemTypeLogin
+	}
+	return typ
+}
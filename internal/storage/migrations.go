@@ -1,5 +1,7 @@
 package storage
 
+import "fmt"
+
 // initializeSchema sets up the necessary database tables
 func (s *SQLiteStorage) initializeSchema() error {
 	// Create config table
@@ -45,6 +47,70 @@ func (s *SQLiteStorage) initializeSchema() error {
 		return err
 	}
 
+	// Create tags tables
+	_, err = s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS tags (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT UNIQUE NOT NULL
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS entry_tags (
+			password_id INTEGER NOT NULL,
+			tag_id INTEGER NOT NULL,
+			PRIMARY KEY (password_id, tag_id)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create custom fields table
+	_, err = s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS custom_fields (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			password_id INTEGER NOT NULL,
+			position INTEGER NOT NULL DEFAULT 0,
+			name TEXT NOT NULL,
+			type TEXT NOT NULL,
+			value BLOB
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create attachment tables. Encrypted content is split across chunk rows
+	// so that large files never have to be held in memory at once.
+	_, err = s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS attachments (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			password_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			size INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS attachment_chunks (
+			attachment_id INTEGER NOT NULL,
+			seq INTEGER NOT NULL,
+			data BLOB NOT NULL,
+			PRIMARY KEY (attachment_id, seq)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
 	// Create audit log table
 	_, err = s.db.Exec(`
 		CREATE TABLE IF NOT EXISTS audit_log (
@@ -60,6 +126,81 @@ func (s *SQLiteStorage) initializeSchema() error {
 		return err
 	}
 
+	// Create password history table
+	_, err = s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS password_history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			password_id INTEGER NOT NULL,
+			password BLOB,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Add soft delete column to passwords
+	err = s.addColumnIfMissing("passwords", "deleted_at", "TIMESTAMP")
+	if err != nil {
+		return err
+	}
+
+	// Add encrypted one-time password secret column to passwords
+	err = s.addColumnIfMissing("passwords", "totp", "BLOB")
+	if err != nil {
+		return err
+	}
+
+	// Add HOTP counter column to passwords
+	err = s.addColumnIfMissing("passwords", "otp_counter", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+
+	// Add item type discriminator and encrypted type-specific data to passwords
+	err = s.addColumnIfMissing("passwords", "item_type", "TEXT NOT NULL DEFAULT 'login'")
+	if err != nil {
+		return err
+	}
+
+	err = s.addColumnIfMissing("passwords", "item_data", "BLOB")
+	if err != nil {
+		return err
+	}
+
+	// Add URL match mode column to passwords
+	err = s.addColumnIfMissing("passwords", "url_match", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+
+	// Add stable entry UUID column to passwords and assign UUIDs to older entries
+	err = s.addColumnIfMissing("passwords", "uuid", "TEXT")
+	if err != nil {
+		return err
+	}
+
+	err = s.backfillUUIDs()
+	if err != nil {
+		return err
+	}
+
+	// Add hash chain columns to audit log
+	err = s.addColumnIfMissing("audit_log", "seq", "INTEGER")
+	if err != nil {
+		return err
+	}
+
+	err = s.addColumnIfMissing("audit_log", "prev_mac", "BLOB")
+	if err != nil {
+		return err
+	}
+
+	err = s.addColumnIfMissing("audit_log", "mac", "BLOB")
+	if err != nil {
+		return err
+	}
+
 	// Create indexes
 	_, err = s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_passwords_title ON passwords(title)`)
 	if err != nil {
@@ -71,5 +212,73 @@ func (s *SQLiteStorage) initializeSchema() error {
 		return err
 	}
 
-	return nil
+	_, err = s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_passwords_deleted_at ON passwords(deleted_at)`)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_passwords_item_type ON passwords(item_type)`)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_passwords_uuid ON passwords(uuid)`)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_entry_tags_tag ON entry_tags(tag_id)`)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_custom_fields_password ON custom_fields(password_id)`)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_attachments_password ON attachments(password_id)`)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_audit_log_seq ON audit_log(seq)`)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_password_history_password ON password_history(password_id)`)
+	if err != nil {
+		return err
+	}
+
+	// Set up the full-text search index
+	return s.initializeSearchIndex()
+}
+
+// addColumnIfMissing adds a column to an existing table created by an older schema
+func (s *SQLiteStorage) addColumnIfMissing(table, column, definition string) error {
+	rows, err := s.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue interface{}
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
 }
@@ -0,0 +1,38 @@
+package storage
+
+import "database/sql"
+
+// GetTOTP retrieves the encrypted one-time password secret of an entry, or nil if it has none
+func (s *SQLiteStorage) GetTOTP(passwordID int64) ([]byte, error) {
+	var encTOTP []byte
+	err := s.db.QueryRow("SELECT totp FROM passwords WHERE id = ?", passwordID).Scan(&encTOTP)
+	if err != nil {
+		return nil, err
+	}
+	return encTOTP, nil
+}
+
+// GetOTPCounter retrieves the HOTP counter of an entry, the counter value its
+// next code is generated with
+func (s *SQLiteStorage) GetOTPCounter(passwordID int64) (uint64, error) {
+	var counter sql.NullInt64
+	err := s.db.QueryRow("SELECT otp_counter FROM passwords WHERE id = ?", passwordID).Scan(&counter)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(counter.Int64), nil
+}
+
+// NextOTPCounter atomically increments the HOTP counter of an entry and returns
+// the counter value to generate the code with
+func (s *SQLiteStorage) NextOTPCounter(passwordID int64) (uint64, error) {
+	var counter int64
+	err := s.db.QueryRow(`
+		UPDATE passwords SET otp_counter = COALESCE(otp_counter, 0) + 1
+		WHERE id = ? RETURNING otp_counter - 1
+	`, passwordID).Scan(&counter)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(counter), nil
+}
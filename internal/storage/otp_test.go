@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+)
+
+func TestNextOTPCounter(t *testing.T) {
+	s := newTestStorage(t)
+	id := addTestEntry(t, s, models.ExportEntry{Title: "VPN", TOTP: []byte("secret"), OTPCounter: 7})
+	other := addTestEntry(t, s, models.ExportEntry{Title: "Bank", TOTP: []byte("secret")})
+
+	// Each call hands out the stored counter and moves past it
+	for want := uint64(7); want < 10; want++ {
+		counter, err := s.NextOTPCounter(id)
+		if err != nil {
+			t.Fatalf("NextOTPCounter failed: %v", err)
+		}
+		if counter != want {
+			t.Errorf("NextOTPCounter = %d, want %d", counter, want)
+		}
+	}
+
+	// Other entries keep their own counter
+	counter, err := s.NextOTPCounter(other)
+	if err != nil {
+		t.Fatalf("NextOTPCounter failed: %v", err)
+	}
+	if counter != 0 {
+		t.Errorf("NextOTPCounter of another entry = %d, want 0", counter)
+	}
+
+	if _, err := s.NextOTPCounter(id + other); err == nil {
+		t.Error("NextOTPCounter succeeded for a missing entry")
+	}
+}
+
+func TestGetOTPCounter(t *testing.T) {
+	s := newTestStorage(t)
+	id := addTestEntry(t, s, models.ExportEntry{Title: "VPN", TOTP: []byte("secret"), OTPCounter: 7})
+
+	if _, err := s.NextOTPCounter(id); err != nil {
+		t.Fatalf("NextOTPCounter failed: %v", err)
+	}
+	counter, err := s.GetOTPCounter(id)
+	if err != nil {
+		t.Fatalf("GetOTPCounter failed: %v", err)
+	}
+	if counter != 8 {
+		t.Errorf("GetOTPCounter = %d, want 8", counter)
+	}
+
+	if _, err := s.GetOTPCounter(id + 1); err == nil {
+		t.Error("GetOTPCounter succeeded for a missing entry")
+	}
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/loganmanery/passmanager/pkg/query"
+)
+
+// queryColumns maps the fields matched by a query to their column
+var queryColumns = map[string]string{
+	query.FieldTitle:    "title",
+	query.FieldURL:      "url",
+	query.FieldUsername: "username",
+	query.FieldCategory: "category",
+	query.FieldType:     "item_type",
+	query.FieldCreated:  "created_at",
+	query.FieldUpdated:  "updated_at",
+}
+
+// queryProperties maps the properties tested by has: to their condition
+var queryProperties = map[string]string{
+	query.HasTOTP:       `COALESCE(LENGTH(totp), 0) > 0`,
+	query.HasTags:       `EXISTS (SELECT 1 FROM entry_tags WHERE password_id = passwords.id)`,
+	query.HasNotes:      `COALESCE(LENGTH(notes), 0) > 0`,
+	query.HasURL:        `COALESCE(url, '') <> ''`,
+	query.HasUsername:   `COALESCE(username, '') <> ''`,
+	query.HasFields:     `EXISTS (SELECT 1 FROM custom_fields WHERE password_id = passwords.id)`,
+	query.HasAttachment: `EXISTS (SELECT 1 FROM attachments WHERE password_id = passwords.id)`,
+	query.HasHistory:    `EXISTS (SELECT 1 FROM password_history WHERE password_id = passwords.id)`,
+}
+
+// queryCondition translates a parsed query into an SQL condition on the
+// passwords table and its arguments
+func (s *SQLiteStorage) queryCondition(node query.Node) (string, []interface{}, error) {
+	switch n := node.(type) {
+	case query.And:
+		return s.joinConditions(n.Terms, " AND ")
+	case query.Or:
+		return s.joinConditions(n.Terms, " OR ")
+	case query.Not:
+		condition, args, err := s.queryCondition(n.Term)
+		if err != nil {
+			return "", nil, err
+		}
+		return `NOT (` + condition + `)`, args, nil
+	case query.Text:
+		if match := ftsQuery(n.Value); s.fts && match != "" {
+			return `id IN (SELECT rowid FROM passwords_fts WHERE passwords_fts MATCH ?)`, []interface{}{match}, nil
+		}
+		term := "%" + likeEscape(n.Value) + "%"
+		return `(title LIKE ? ESCAPE '\' OR url LIKE ? ESCAPE '\' OR username LIKE ? ESCAPE '\')`,
+			[]interface{}{term, term, term}, nil
+	case query.Match:
+		return matchCondition(n)
+	case query.Has:
+		condition, ok := queryProperties[n.Property]
+		if !ok {
+			return "", nil, fmt.Errorf("unsupported property has:%s", n.Property)
+		}
+		return condition, nil, nil
+	case query.Compare:
+		column, ok := queryColumns[n.Field]
+		if !ok {
+			return "", nil, fmt.Errorf("unsupported time field %s", n.Field)
+		}
+		return `DATETIME(` + column + `) ` + n.Op + ` DATETIME(?)`, []interface{}{n.Time.UTC().Format(timestampFormat)}, nil
+	}
+
+	return "", nil, fmt.Errorf("unsupported query node %T", node)
+}
+
+// joinConditions translates terms and joins their conditions with an operator
+func (s *SQLiteStorage) joinConditions(terms []query.Node, operator string) (string, []interface{}, error) {
+	var conditions []string
+	var args []interface{}
+	for _, term := range terms {
+		condition, termArgs, err := s.queryCondition(term)
+		if err != nil {
+			return "", nil, err
+		}
+		conditions = append(conditions, condition)
+		args = append(args, termArgs...)
+	}
+	return `(` + strings.Join(conditions, operator) + `)`, args, nil
+}
+
+// matchCondition translates a field match. Wildcard patterns must match the
+// whole value; plain values match tags, categories and types exactly and
+// other fields as a substring. URL patterns may match just the host.
+func matchCondition(m query.Match) (string, []interface{}, error) {
+	if m.Field == query.FieldTag {
+		condition := `t.name = ? COLLATE NOCASE`
+		value := m.Value
+		if m.Pattern {
+			condition = `t.name LIKE ? ESCAPE '\'`
+			value = globToLike(m.Value)
+		}
+		return `id IN (
+			SELECT et.password_id FROM entry_tags et
+			JOIN tags t ON t.id = et.tag_id
+			WHERE ` + condition + `
+		)`, []interface{}{value}, nil
+	}
+
+	column, ok := queryColumns[m.Field]
+	if !ok {
+		return "", nil, fmt.Errorf("unsupported field %s:", m.Field)
+	}
+	column = `COALESCE(` + column + `, '')`
+
+	switch {
+	case m.Pattern && m.Field == query.FieldURL:
+		pattern := globToLike(m.Value)
+		return `(` + column + ` LIKE ? ESCAPE '\' OR ` + column + ` LIKE ? ESCAPE '\' OR ` +
+				column + ` LIKE ? ESCAPE '\' OR ` + column + ` LIKE ? ESCAPE '\')`,
+			[]interface{}{pattern, pattern + "/%", "%://" + pattern, "%://" + pattern + "/%"}, nil
+	case m.Pattern:
+		return column + ` LIKE ? ESCAPE '\'`, []interface{}{globToLike(m.Value)}, nil
+	case m.Field == query.FieldCategory || m.Field == query.FieldType:
+		return column + ` = ? COLLATE NOCASE`, []interface{}{m.Value}, nil
+	}
+
+	return column + ` LIKE ? ESCAPE '\'`, []interface{}{"%" + likeEscape(m.Value) + "%"}, nil
+}
+
+// globToLike converts a * and ? wildcard pattern to a LIKE pattern
+func globToLike(pattern string) string {
+	return strings.NewReplacer("*", "%", "?", "_").Replace(likeEscape(pattern))
+}
+
+// likeEscape escapes the LIKE wildcards in s, using \ as the escape character
+func likeEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+)
+
+// newTestStorage opens an empty vault in memory
+func newTestStorage(t *testing.T) *SQLiteStorage {
+	t.Helper()
+
+	s := newSQLiteStorage(":memory:")
+	if err := s.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	// Every connection to :memory: opens a database of its own
+	s.db.SetMaxOpenConns(1)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// addTestEntry adds an entry with placeholder ciphertexts
+func addTestEntry(t *testing.T, s *SQLiteStorage, entry models.ExportEntry) int64 {
+	t.Helper()
+
+	if entry.Password == nil {
+		entry.Password = []byte("ciphertext")
+	}
+	id, err := s.AddPassword(entry)
+	if err != nil {
+		t.Fatalf("AddPassword(%q) failed: %v", entry.Title, err)
+	}
+	return id
+}
+
+// seedQueryVault fills a vault with entries that the query tests tell apart
+func seedQueryVault(t *testing.T, s *SQLiteStorage) {
+	t.Helper()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	old := now.AddDate(0, 0, -200)
+
+	addTestEntry(t, s, models.ExportEntry{
+		Title: "AWS Console", URL: "https://console.aws.amazon.com/", Username: "admin",
+		Category: "Work", Tags: []string{"prod", "cloud"}, TOTP: []byte("secret"),
+		CreatedAt: old, UpdatedAt: now.AddDate(0, 0, -10),
+	})
+	addTestEntry(t, s, models.ExportEntry{
+		Title: "AWS Staging", URL: "signin.aws.amazon.com", Username: "deploy",
+		Category: "Work", Tags: []string{"staging", "cloud"},
+		CreatedAt: old, UpdatedAt: old,
+	})
+	addTestEntry(t, s, models.ExportEntry{
+		Title: "Amazon", URL: "https://www.amazon.com/", Username: "john@example.com",
+		Category: "Personal", Tags: []string{"shopping"}, Notes: []byte("notes"),
+		CreatedAt: old, UpdatedAt: now.AddDate(0, 0, -30),
+	})
+	addTestEntry(t, s, models.ExportEntry{
+		Title: "100% Bank", URL: "https://bank.example.com/", Username: "john_doe",
+		Category: "Finance", Tags: []string{"prod"},
+		CustomFields: []models.ExportCustomField{{Name: "PIN", Type: models.FieldTypeHidden, Value: []byte("ciphertext")}},
+		CreatedAt:    time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC), UpdatedAt: old,
+	})
+	addTestEntry(t, s, models.ExportEntry{
+		Type: models.ItemTypeSecureNote, Title: "Wifi", Notes: []byte("notes"),
+		CreatedAt: now, UpdatedAt: now,
+	})
+}
+
+func TestSearchQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"tag:prod", []string{"100% Bank", "AWS Console"}},
+		{"tag:PROD", []string{"100% Bank", "AWS Console"}},
+		{"tag:s*", []string{"AWS Staging", "Amazon"}},
+		{"url:*.aws.amazon.com", []string{"AWS Console", "AWS Staging"}},
+		{"url:*.amazon.com", []string{"AWS Console", "AWS Staging", "Amazon"}},
+		{"url:amazon", []string{"AWS Console", "AWS Staging", "Amazon"}},
+		{"updated:<90d", []string{"AWS Console", "Amazon", "Wifi"}},
+		{"updated:>90d", []string{"100% Bank", "AWS Staging"}},
+		{"created:2024-01-31", []string{"100% Bank"}},
+		{"-category:work", []string{"100% Bank", "Amazon", "Wifi"}},
+		{"category:WORK", []string{"AWS Console", "AWS Staging"}},
+		{"has:totp", []string{"AWS Console"}},
+		{"-has:totp has:url", []string{"100% Bank", "AWS Staging", "Amazon"}},
+		{"has:notes", []string{"Amazon", "Wifi"}},
+		{"has:fields", []string{"100% Bank"}},
+		{"has:tags -has:username", nil},
+		{"type:secure_note", []string{"Wifi"}},
+		{"user:john", []string{"100% Bank", "Amazon"}},
+		{"user:john_", []string{"100% Bank"}},
+		{`title:"100%"`, []string{"100% Bank"}},
+		{`title:"aws console"`, []string{"AWS Console"}},
+		{"tag:prod OR tag:shopping", []string{"100% Bank", "AWS Console", "Amazon"}},
+		{"aws -(tag:staging OR has:notes)", []string{"AWS Console"}},
+		{"tag:prod url:*.aws.amazon.com updated:<90d -category:personal has:totp", []string{"AWS Console"}},
+		{"tag:nothing", nil},
+	}
+
+	for _, fts := range []bool{false, true} {
+		s := newTestStorage(t)
+		if fts && !s.fts {
+			t.Log("SQLite was built without FTS5, skipping the full-text index")
+			continue
+		}
+		s.fts = fts
+		seedQueryVault(t, s)
+
+		for _, tt := range tests {
+			entries, err := s.SearchPasswords(models.SearchParams{Query: tt.query})
+			if err != nil {
+				t.Errorf("fts=%v: query %q failed: %v", fts, tt.query, err)
+				continue
+			}
+
+			var got []string
+			for _, entry := range entries {
+				got = append(got, entry.Title)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fts=%v: query %q = %q, want %q", fts, tt.query, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestSearchQueryText(t *testing.T) {
+	s := newTestStorage(t)
+	seedQueryVault(t, s)
+
+	// Free text must behave the same with the index and with the LIKE fallback
+	for _, fts := range []bool{false, true} {
+		if fts && !s.fts {
+			continue
+		}
+		s.fts = fts
+
+		entries, err := s.SearchPasswords(models.SearchParams{Query: "console -staging"})
+		if err != nil {
+			t.Fatalf("fts=%v: query failed: %v", fts, err)
+		}
+		if len(entries) != 1 || entries[0].Title != "AWS Console" {
+			t.Errorf("fts=%v: got %d entries, want only AWS Console", fts, len(entries))
+		}
+	}
+}
+
+func TestSearchQueryErrors(t *testing.T) {
+	s := newTestStorage(t)
+
+	for _, q := range []string{`title:"open`, "has:password", "(tag:a", "updated:90d"} {
+		_, err := s.SearchPasswords(models.SearchParams{Query: q})
+		if err == nil || !strings.HasPrefix(err.Error(), "invalid query: ") {
+			t.Errorf("query %q: got error %v, want an invalid query error", q, err)
+		}
+	}
+}
+
+func TestSearchQueryTrash(t *testing.T) {
+	s := newTestStorage(t)
+	id := addTestEntry(t, s, models.ExportEntry{Title: "Old", Tags: []string{"prod"}})
+	if err := s.DeletePassword(id); err != nil {
+		t.Fatalf("DeletePassword failed: %v", err)
+	}
+
+	entries, err := s.SearchPasswords(models.SearchParams{Query: "tag:prod"})
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("trashed entry matched: %v", entries)
+	}
+
+	entries, err = s.SearchPasswords(models.SearchParams{Query: "tag:prod", IncludeTrashed: true})
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("got %d entries including the trash, want 1", len(entries))
+	}
+}
@@ -1,19 +1,26 @@
 package storage
 
 import (
+	"bytes"
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/loganmanery/passmanager/pkg/models"
+	searchquery "github.com/loganmanery/passmanager/pkg/query"
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// timestampFormat is the format SQLite stores CURRENT_TIMESTAMP in
+const timestampFormat = "2006-01-02 15:04:05"
+
 // SQLiteStorage implements StorageService using SQLite
 type SQLiteStorage struct {
 	db     *sql.DB
 	dbPath string
+	fts    bool
 }
 
 // newSQLiteStorage creates a new SQLite storage service
@@ -82,37 +89,96 @@ func (s *SQLiteStorage) SaveTestVector(vector []byte) error {
 	return err
 }
 
-// AddPassword adds a new password entry
-func (s *SQLiteStorage) AddPassword(entry *models.PasswordEntry, encPassword, encNotes []byte) (int64, error) {
+// GetSetting retrieves a setting value, returning an empty string if it is not set
+func (s *SQLiteStorage) GetSetting(key string) (string, error) {
+	var value []byte
+	err := s.db.QueryRow("SELECT value FROM config WHERE key = ?", "setting:"+key).Scan(&value)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil // Not set, caller applies its default
+		}
+		return "", err
+	}
+	return string(value), nil
+}
+
+// SaveSetting saves a setting value
+func (s *SQLiteStorage) SaveSetting(key, value string) error {
+	_, err := s.db.Exec("INSERT OR REPLACE INTO config (key, value) VALUES (?, ?)", "setting:"+key, []byte(value))
+	return err
+}
+
+// AddPassword adds a new password entry, encrypted by the caller, with its
+// tags and custom fields. Missing timestamps default to the current time.
+func (s *SQLiteStorage) AddPassword(entry models.ExportEntry) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	entryUUID, err := newUUID()
+	if err != nil {
+		return 0, err
+	}
+
 	// Insert the entry
-	result, err := s.db.Exec(`
-		INSERT INTO passwords (title, url, username, password, notes, category, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
-	`, entry.Title, entry.URL, entry.Username, encPassword, encNotes, entry.Category)
+	result, err := tx.Exec(insertPasswordQuery, append([]interface{}{entryUUID}, importColumns(entry)...)...)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	err = insertTags(tx, id, entry.Tags)
+	if err != nil {
+		return 0, err
+	}
+
+	err = replaceExportedFields(tx, id, entry.CustomFields)
 	if err != nil {
 		return 0, err
 	}
 
-	return result.LastInsertId()
+	return id, tx.Commit()
 }
 
+// insertPasswordQuery inserts an entry with the UUID followed by the columns
+// of importColumns
+const insertPasswordQuery = `
+	INSERT INTO passwords (uuid, item_type, title, url, url_match, username, password, notes, totp, otp_counter, item_data, category, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, COALESCE(?, CURRENT_TIMESTAMP), COALESCE(?, CURRENT_TIMESTAMP))
+`
+
 // GetPassword retrieves a password entry by ID
 func (s *SQLiteStorage) GetPassword(id int64) (*models.PasswordEntry, []byte, []byte, error) {
 	var entry models.PasswordEntry
 	var encPassword, encNotes []byte
 	var createdAt, updatedAt string
+	var deletedAt sql.NullTime
+	var tags sql.NullString
 
 	err := s.db.QueryRow(`
-		SELECT id, title, url, username, password, notes, category, created_at, updated_at
+		SELECT id, uuid, item_type, title, url, url_match, username, password, notes, category, created_at, updated_at, deleted_at, `+tagsColumn+`
 		FROM passwords WHERE id = ?
-	`, id).Scan(&entry.ID, &entry.Title, &entry.URL, &entry.Username, &encPassword, &encNotes, &entry.Category, &createdAt, &updatedAt)
+	`, id).Scan(&entry.ID, &entry.UUID, &entry.Type, &entry.Title, &entry.URL, &entry.URLMatch, &entry.Username, &encPassword, &encNotes, &entry.Category, &createdAt, &updatedAt, &deletedAt, &tags)
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
+	entry.Tags = splitTags(tags)
+
 	// Parse timestamps
 	entry.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
 	entry.LastUpdated, _ = time.Parse(time.RFC3339, updatedAt)
+	entry.DeletedAt = deletedAt.Time
 
 	return &entry, encPassword, encNotes, nil
 
@@ -121,8 +187,8 @@ func (s *SQLiteStorage) GetPassword(id int64) (*models.PasswordEntry, []byte, []
 // GetAllPasswords retrieves all password entries (without sensitive data)
 func (s *SQLiteStorage) GetAllPasswords() ([]models.PasswordEntry, error) {
 	rows, err := s.db.Query(`
-		SELECT id, title, url, username, category, created_at, updated_at
-		FROM passwords ORDER BY title
+		SELECT id, uuid, item_type, title, url, url_match, username, category, created_at, updated_at, ` + tagsColumn + `
+		FROM passwords WHERE deleted_at IS NULL ORDER BY title
 	`)
 	if err != nil {
 		return nil, err
@@ -133,8 +199,9 @@ func (s *SQLiteStorage) GetAllPasswords() ([]models.PasswordEntry, error) {
 	for rows.Next() {
 		var entry models.PasswordEntry
 		var createdAt, updatedAt string
-		err := rows.Scan(&entry.ID, &entry.Title, &entry.URL, &entry.Username,
-			&entry.Category, &createdAt, &updatedAt)
+		var tags sql.NullString
+		err := rows.Scan(&entry.ID, &entry.UUID, &entry.Type, &entry.Title, &entry.URL, &entry.URLMatch, &entry.Username,
+			&entry.Category, &createdAt, &updatedAt, &tags)
 		if err != nil {
 			return nil, err
 		}
@@ -142,6 +209,7 @@ func (s *SQLiteStorage) GetAllPasswords() ([]models.PasswordEntry, error) {
 		// Parse timestamps
 		entry.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
 		entry.LastUpdated, _ = time.Parse(time.RFC3339, updatedAt)
+		entry.Tags = splitTags(tags)
 
 		// Note: Password and Notes are not loaded here for security
 		entries = append(entries, entry)
@@ -154,36 +222,159 @@ func (s *SQLiteStorage) GetAllPasswords() ([]models.PasswordEntry, error) {
 	return entries, nil
 }
 
-// UpdatePassword updates an existing password entry
-func (s *SQLiteStorage) UpdatePassword(entry *models.PasswordEntry, encPassword, encNotes []byte) error {
-	// Update the entry
-	_, err := s.db.Exec(`
+// UpdatePassword overwrites an existing password entry with one encrypted by
+// the caller, replacing its tags and custom fields and archiving the previous
+// password in the history table when it changes. The HOTP counter is only
+// reset when the one-time password secret changes.
+func (s *SQLiteStorage) UpdatePassword(id int64, entry models.ExportEntry) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = updateEntry(tx, id, entry)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// updateEntry overwrites an entry within a transaction the way
+// UpdatePassword does
+func updateEntry(tx *sql.Tx, id int64, entry models.ExportEntry) error {
+	// Archive the current password if it is being replaced
+	var oldPassword []byte
+	err := tx.QueryRow("SELECT password FROM passwords WHERE id = ?", id).Scan(&oldPassword)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(oldPassword, entry.Password) {
+		_, err = tx.Exec(`
+			INSERT INTO password_history (password_id, password, created_at)
+			VALUES (?, ?, CURRENT_TIMESTAMP)
+		`, id, oldPassword)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Update the entry; the CASE sees the stored secret, as SQLite evaluates
+	// every assignment against the row before the update
+	_, err = tx.Exec(`
 		UPDATE passwords
-		SET title = ?, url = ?, username = ?, password = ?, notes = ?, category = ?, updated_at = CURRENT_TIMESTAMP
+		SET item_type = ?, title = ?, url = ?, url_match = ?, username = ?, password = ?, notes = ?,
+			otp_counter = CASE WHEN totp IS ? THEN otp_counter ELSE ? END, totp = ?,
+			item_data = ?, category = ?, updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
-	`, entry.Title, entry.URL, entry.Username, encPassword, encNotes, entry.Category, entry.ID)
+	`, itemType(entry.Type), entry.Title, entry.URL, entry.URLMatch, entry.Username, entry.Password, entry.Notes,
+		entry.TOTP, int64(entry.OTPCounter), entry.TOTP, entry.ItemData, entry.Category, id)
+	if err != nil {
+		return err
+	}
 
-	return err
+	err = replaceTags(tx, id, entry.Tags)
+	if err != nil {
+		return err
+	}
+
+	return replaceExportedFields(tx, id, entry.CustomFields)
 }
 
-// DeletePassword deletes a password entry
+// DeletePassword moves a password entry to the trash
 func (s *SQLiteStorage) DeletePassword(id int64) error {
-	_, err := s.db.Exec("DELETE FROM passwords WHERE id = ?", id)
-	return err
+	result, err := s.db.Exec(`
+		UPDATE passwords SET deleted_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND deleted_at IS NULL
+	`, id)
+	if err != nil {
+		return err
+	}
+
+	return requireAffected(result)
+}
+
+// PurgePassword permanently deletes a password entry in the trash and all
+// data attached to it
+func (s *SQLiteStorage) PurgePassword(id int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Entries outside the trash have to be trashed first
+	var trashed bool
+	err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM passwords WHERE id = ? AND deleted_at IS NOT NULL)", id).Scan(&trashed)
+	if err != nil {
+		return err
+	}
+	if !trashed {
+		err = fmt.Errorf("entry %d is not in the trash", id)
+		return err
+	}
+
+	err = deleteDependents(tx, "?", id)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM passwords WHERE id = ? AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		return err
+	}
+
+	err = requireAffected(result)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 // SearchPasswords searches for password entries
 func (s *SQLiteStorage) SearchPasswords(params models.SearchParams) ([]models.PasswordEntry, error) {
+	var args []interface{}
+
+	// Rank keyword matches with the full-text index when it is available
+	from := `passwords`
+	match := ""
+	if s.fts && params.Keyword != "" {
+		match = ftsQuery(params.Keyword)
+	}
+	if match != "" {
+		from += ` JOIN (
+			SELECT rowid AS fts_id, ` + ftsRank + ` AS fts_rank
+			FROM passwords_fts WHERE passwords_fts MATCH ?
+		) fts ON fts.fts_id = passwords.id`
+		args = append(args, match)
+	}
+
 	// Base query
 	query := `
-		SELECT id, title, url, username, category, created_at, updated_at
-		FROM passwords
+		SELECT id, uuid, item_type, title, url, url_match, username, category, created_at, updated_at, ` + tagsColumn + `
+		FROM ` + from + `
 		WHERE 1=1
 	`
-	var args []interface{}
 
-	// Add search conditions
-	if params.Keyword != "" {
+	// Exclude trashed entries unless requested
+	if !params.IncludeTrashed {
+		query += ` AND deleted_at IS NULL`
+	}
+
+	// Fall back to LIKE without the index, and for keywords such as "*" that
+	// leave no full-text terms, so that they do not match every entry
+	if params.Keyword != "" && match == "" {
 		searchTerm := "%" + params.Keyword + "%"
 		query += ` AND (title LIKE ? OR url LIKE ? OR username LIKE ?)`
 		args = append(args, searchTerm, searchTerm, searchTerm)
@@ -194,6 +385,45 @@ func (s *SQLiteStorage) SearchPasswords(params models.SearchParams) ([]models.Pa
 		args = append(args, params.Category)
 	}
 
+	if params.Type != "" {
+		query += ` AND item_type = ?`
+		args = append(args, params.Type)
+	}
+
+	if params.Query != "" {
+		filter, err := searchquery.Parse(params.Query, time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("invalid query: %w", err)
+		}
+		if filter != nil {
+			condition, filterArgs, err := s.queryCondition(filter)
+			if err != nil {
+				return nil, err
+			}
+			query += ` AND ` + condition
+			args = append(args, filterArgs...)
+		}
+	}
+
+	if len(params.Tags) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(params.Tags)), ", ")
+		query += ` AND id IN (
+			SELECT et.password_id FROM entry_tags et
+			JOIN tags t ON t.id = et.tag_id
+			WHERE t.name IN (` + placeholders + `)
+			GROUP BY et.password_id`
+		for _, tag := range params.Tags {
+			args = append(args, tag)
+		}
+
+		// Require every tag to be present rather than any of them
+		if params.MatchAllTags {
+			query += ` HAVING COUNT(DISTINCT t.name) = ?`
+			args = append(args, len(params.Tags))
+		}
+		query += `)`
+	}
+
 	// Add sorting
 	if params.SortBy != "" {
 		query += ` ORDER BY ` + params.SortBy
@@ -202,6 +432,8 @@ func (s *SQLiteStorage) SearchPasswords(params models.SearchParams) ([]models.Pa
 		} else {
 			query += ` ASC`
 		}
+	} else if match != "" {
+		query += ` ORDER BY fts.fts_rank ASC, title ASC`
 	} else {
 		query += ` ORDER BY title ASC`
 	}
@@ -228,8 +460,9 @@ func (s *SQLiteStorage) SearchPasswords(params models.SearchParams) ([]models.Pa
 	for rows.Next() {
 		var entry models.PasswordEntry
 		var createdAt, updatedAt string
-		err := rows.Scan(&entry.ID, &entry.Title, &entry.URL, &entry.Username,
-			&entry.Category, &createdAt, &updatedAt)
+		var tags sql.NullString
+		err := rows.Scan(&entry.ID, &entry.UUID, &entry.Type, &entry.Title, &entry.URL, &entry.URLMatch, &entry.Username,
+			&entry.Category, &createdAt, &updatedAt, &tags)
 		if err != nil {
 			return nil, err
 		}
@@ -237,6 +470,7 @@ func (s *SQLiteStorage) SearchPasswords(params models.SearchParams) ([]models.Pa
 		// Parse timestamps
 		entry.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
 		entry.LastUpdated, _ = time.Parse(time.RFC3339, updatedAt)
+		entry.Tags = splitTags(tags)
 
 		entries = append(entries, entry)
 	}
@@ -248,53 +482,104 @@ func (s *SQLiteStorage) SearchPasswords(params models.SearchParams) ([]models.Pa
 	return entries, nil
 }
 
-// ExportData exports all entries for backup
-func (s *SQLiteStorage) ExportData() ([]map[string]interface{}, error) {
-	rows, err := s.db.Query(`
-		SELECT id, title, url, username, password, notes, category, created_at, updated_at
-		FROM passwords
-	`)
+// ExportData exports all entries outside the trash for backup, with their
+// custom fields, password history and attachments
+func (s *SQLiteStorage) ExportData() ([]models.ExportEntry, error) {
+	var result []models.ExportEntry
+	err := s.ExportEntries(nil, func(entry models.ExportEntry) error {
+		result = append(result, entry)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return result, nil
+}
+
+// ExportEntries exports the entries outside the trash one at a time, so that
+// only one entry and its attachments are held in memory. Count, unless nil,
+// is called first with the number of entries, then fn with every entry. The
+// entries are read in one transaction, a consistent snapshot of the vault.
+func (s *SQLiteStorage) ExportEntries(count func(n int) error, fn func(entry models.ExportEntry) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	// Nothing is written, so the transaction is never committed
+	defer tx.Rollback()
+
+	if count != nil {
+		var n int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM passwords WHERE deleted_at IS NULL").Scan(&n); err != nil {
+			return err
+		}
+		if err := count(n); err != nil {
+			return err
+		}
+	}
+
+	customFields, err := exportCustomFields(tx)
+	if err != nil {
+		return err
+	}
+
+	history, err := exportHistory(tx)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`
+		SELECT id, uuid, item_type, title, url, url_match, username, password, notes, totp, otp_counter, item_data, category, created_at, updated_at, ` + tagsColumn + `
+		FROM passwords WHERE deleted_at IS NULL
+		ORDER BY id
+	`)
+	if err != nil {
+		return err
+	}
 	defer rows.Close()
 
-	var result []map[string]interface{}
 	for rows.Next() {
-		var id int64
-		var title, url, username, category, createdAt, updatedAt string
-		var password, notes []byte
-
-		err := rows.Scan(&id, &title, &url, &username, &password, &notes,
-			&category, &createdAt, &updatedAt)
+		var id, otpCounter int64
+		var entry models.ExportEntry
+		var createdAt, updatedAt sql.NullTime
+		var tags sql.NullString
+
+		err := rows.Scan(&id, &entry.UUID, &entry.Type, &entry.Title, &entry.URL, &entry.URLMatch, &entry.Username,
+			&entry.Password, &entry.Notes, &entry.TOTP, &otpCounter, &entry.ItemData, &entry.Category,
+			&createdAt, &updatedAt, &tags)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		entry := map[string]interface{}{
-			"id":         id,
-			"title":      title,
-			"url":        url,
-			"username":   username,
-			"password":   password,
-			"notes":      notes,
-			"category":   category,
-			"created_at": createdAt,
-			"updated_at": updatedAt,
-		}
+		entry.OTPCounter = uint64(otpCounter)
+		entry.CreatedAt = createdAt.Time.UTC()
+		entry.UpdatedAt = updatedAt.Time.UTC()
+		entry.Tags = splitTags(tags)
+		entry.CustomFields = customFields[id]
+		entry.History = history[id]
 
-		result = append(result, entry)
-	}
+		entry.Attachments, err = exportAttachments(tx, id)
+		if err != nil {
+			return err
+		}
 
-	if err = rows.Err(); err != nil {
-		return nil, err
+		if err := fn(entry); err != nil {
+			return err
+		}
 	}
 
-	return result, nil
+	return rows.Err()
 }
 
-// ImportData imports entries from a backup
-func (s *SQLiteStorage) ImportData(entries []map[string]interface{}) error {
+// ImportData imports entries from a backup. With replace set, every existing
+// entry is removed first. Added entries are inserted, keeping their UUID unless
+// it is missing or already in use; updated entries overwrite the entry with
+// the same UUID, archiving its current password in the history when it
+// changes, and are restored from the trash. Imported history records and
+// attachments are added, except that an updated entry keeps a single copy of
+// a record with the same password ciphertext and time or an attachment with
+// the same name and size.
+func (s *SQLiteStorage) ImportData(added, updated []models.ExportEntry, replace bool) error {
 	tx, err := s.db.Begin()
 	if err != nil {
 		return err
@@ -305,26 +590,80 @@ func (s *SQLiteStorage) ImportData(entries []map[string]interface{}) error {
 		}
 	}()
 
-	stmt, err := tx.Prepare(`
-		INSERT INTO passwords (title, url, username, password, notes, category, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-	`)
+	if replace {
+		err = deleteDependents(tx, "SELECT id FROM passwords")
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("DELETE FROM passwords")
+		if err != nil {
+			return err
+		}
+	}
+
+	insertStmt, err := tx.Prepare(insertPasswordQuery)
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
-
-	for _, entry := range entries {
-		_, err = stmt.Exec(
-			entry["title"],
-			entry["url"],
-			entry["username"],
-			entry["password"],
-			entry["notes"],
-			entry["category"],
-			entry["created_at"],
-			entry["updated_at"],
-		)
+	defer insertStmt.Close()
+
+	for _, entry := range added {
+		var entryUUID string
+		entryUUID, err = importUUID(tx, entry.UUID)
+		if err != nil {
+			return err
+		}
+
+		var result sql.Result
+		result, err = insertStmt.Exec(append([]interface{}{entryUUID}, importColumns(entry)...)...)
+		if err != nil {
+			return err
+		}
+
+		var id int64
+		id, err = result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		err = importDependents(tx, id, entry, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, entry := range updated {
+		var id int64
+		var oldPassword []byte
+		err = tx.QueryRow("SELECT id, password FROM passwords WHERE uuid = ?", entry.UUID).Scan(&id, &oldPassword)
+		if err != nil {
+			return err
+		}
+
+		if !bytes.Equal(oldPassword, entry.Password) {
+			_, err = tx.Exec(`
+				INSERT INTO password_history (password_id, password, created_at)
+				VALUES (?, ?, CURRENT_TIMESTAMP)
+			`, id, oldPassword)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.Exec(`
+			UPDATE passwords
+			SET item_type = ?, title = ?, url = ?, url_match = ?, username = ?,
+				password = ?, notes = ?, totp = ?, otp_counter = ?, item_data = ?, category = ?,
+				created_at = COALESCE(?, CURRENT_TIMESTAMP), updated_at = COALESCE(?, CURRENT_TIMESTAMP),
+				deleted_at = NULL
+			WHERE id = ?
+		`, append(importColumns(entry), id)...)
+		if err != nil {
+			return err
+		}
+
+		err = importDependents(tx, id, entry, true)
 		if err != nil {
 			return err
 		}
@@ -332,3 +671,152 @@ func (s *SQLiteStorage) ImportData(entries []map[string]interface{}) error {
 
 	return tx.Commit()
 }
+
+// importColumns returns the column values of an imported entry in the order
+// used by ImportData, from item_type to updated_at
+func importColumns(entry models.ExportEntry) []interface{} {
+	return []interface{}{
+		itemType(entry.Type),
+		entry.Title,
+		entry.URL,
+		entry.URLMatch,
+		entry.Username,
+		entry.Password,
+		entry.Notes,
+		entry.TOTP,
+		int64(entry.OTPCounter),
+		entry.ItemData,
+		entry.Category,
+		importTime(entry.CreatedAt),
+		importTime(entry.UpdatedAt),
+	}
+}
+
+// importTime formats an imported timestamp the way SQLite stores
+// CURRENT_TIMESTAMP, or returns nil for a missing one
+func importTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(timestampFormat)
+}
+
+// importDependents replaces the tags and custom fields of an entry with
+// imported ones and adds its imported history and attachments. With merge
+// set the import overwrites an existing entry, so history records with the
+// same password ciphertext and time and attachments with the same name and
+// size are left out as already present.
+func importDependents(tx *sql.Tx, id int64, entry models.ExportEntry, merge bool) error {
+	err := replaceTags(tx, id, entry.Tags)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range entry.History {
+		if merge {
+			var exists bool
+			err = tx.QueryRow(`
+				SELECT EXISTS (
+					SELECT 1 FROM password_history WHERE password_id = ? AND password = ? AND created_at = ?
+				)
+			`, id, record.Password, importTime(record.CreatedAt)).Scan(&exists)
+			if err != nil {
+				return err
+			}
+			if exists {
+				continue
+			}
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO password_history (password_id, password, created_at)
+			VALUES (?, ?, COALESCE(?, CURRENT_TIMESTAMP))
+		`, id, record.Password, importTime(record.CreatedAt))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, file := range entry.Attachments {
+		if merge {
+			var exists bool
+			err = tx.QueryRow(`
+				SELECT EXISTS (SELECT 1 FROM attachments WHERE password_id = ? AND name = ? AND size = ?)
+			`, id, file.Name, file.Size).Scan(&exists)
+			if err != nil {
+				return err
+			}
+			if exists {
+				continue
+			}
+		}
+
+		attachment := models.Attachment{PasswordID: id, Name: file.Name, Size: file.Size}
+		_, err = insertAttachment(tx, &attachment, bytes.NewReader(file.Data))
+		if err != nil {
+			return err
+		}
+	}
+
+	return replaceExportedFields(tx, id, entry.CustomFields)
+}
+
+// replaceExportedFields sets the custom fields of an entry to encrypted ones
+// within a transaction
+func replaceExportedFields(tx *sql.Tx, passwordID int64, exported []models.ExportCustomField) error {
+	fields := make([]models.CustomField, len(exported))
+	values := make([][]byte, len(exported))
+	for i, field := range exported {
+		fields[i] = models.CustomField{Name: field.Name, Type: field.Type}
+		values[i] = field.Value
+	}
+	return replaceCustomFields(tx, passwordID, fields, values)
+}
+
+// requireAffected returns sql.ErrNoRows if a statement did not change any row
+func requireAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// touchEntry sets the update time of an entry within a transaction, for edits
+// that do not go through updateEntry, so that imports see the entry as changed
+func touchEntry(tx *sql.Tx, id int64) error {
+	result, err := tx.Exec("UPDATE passwords SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	return requireAffected(result)
+}
+
+// dependentTables lists the tables holding per-entry data keyed by password_id
+var dependentTables = []string{"password_history", "entry_tags", "custom_fields", "attachments"}
+
+// deleteDependents removes the data attached to the entries selected by ids,
+// which is either a single placeholder or a subquery returning entry IDs
+func deleteDependents(tx *sql.Tx, ids string, args ...interface{}) error {
+	// Attachment content is keyed by attachment, so remove it before the attachments
+	_, err := tx.Exec(`
+		DELETE FROM attachment_chunks WHERE attachment_id IN (
+			SELECT id FROM attachments WHERE password_id IN (`+ids+`)
+		)
+	`, args...)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range dependentTables {
+		_, err := tx.Exec("DELETE FROM "+table+" WHERE password_id IN ("+ids+")", args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return deleteOrphanTags(tx)
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+)
+
+// storedHistory returns the history ciphertexts of an entry, sorted
+func storedHistory(t *testing.T, s *SQLiteStorage, id int64) []string {
+	t.Helper()
+
+	_, passwords, err := s.GetPasswordHistory(id)
+	if err != nil {
+		t.Fatalf("GetPasswordHistory failed: %v", err)
+	}
+
+	var result []string
+	for _, password := range passwords {
+		result = append(result, string(password))
+	}
+	sort.Strings(result)
+	return result
+}
+
+// storedAttachments returns the attachments of an entry as name and content
+func storedAttachments(t *testing.T, s *SQLiteStorage, id int64) []models.ExportAttachment {
+	t.Helper()
+
+	attachments, err := s.GetAttachments(id)
+	if err != nil {
+		t.Fatalf("GetAttachments failed: %v", err)
+	}
+
+	var result []models.ExportAttachment
+	for _, attachment := range attachments {
+		var content bytes.Buffer
+		if err := s.ReadAttachment(attachment.ID, &content); err != nil {
+			t.Fatalf("ReadAttachment failed: %v", err)
+		}
+		result = append(result, models.ExportAttachment{Name: attachment.Name, Size: attachment.Size, Data: content.Bytes()})
+	}
+	return result
+}
+
+func TestImportDataHistoryAndAttachments(t *testing.T) {
+	s := newTestStorage(t)
+	second := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// Records from the same second and attachments of the same name are all
+	// kept for a new entry
+	entry := models.ExportEntry{
+		UUID: "8f0c5c9e-4b5e-4a8e-9a3c-2f1d0b6e7a11", Title: "GitHub", Password: []byte("current"),
+		History: []models.ExportHistory{
+			{Password: []byte("first"), CreatedAt: second},
+			{Password: []byte("second"), CreatedAt: second},
+			{Password: []byte("third"), CreatedAt: second},
+		},
+		Attachments: []models.ExportAttachment{
+			{Name: "codes.txt", Size: 3, Data: []byte("abc")},
+			{Name: "codes.txt", Size: 4, Data: []byte("abcd")},
+		},
+	}
+	if err := s.ImportData([]models.ExportEntry{entry}, nil, false); err != nil {
+		t.Fatalf("ImportData failed: %v", err)
+	}
+	id, err := s.GetPasswordID(entry.UUID)
+	if err != nil {
+		t.Fatalf("GetPasswordID failed: %v", err)
+	}
+
+	if got, want := storedHistory(t, s, id), []string{"first", "second", "third"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("history = %q, want %q", got, want)
+	}
+	if got := storedAttachments(t, s, id); !reflect.DeepEqual(got, entry.Attachments) {
+		t.Errorf("attachments = %+v, want %+v", got, entry.Attachments)
+	}
+
+	// Importing the entry over itself adds only what it does not have yet
+	entry.History = append(entry.History,
+		models.ExportHistory{Password: []byte("fourth"), CreatedAt: second},
+		models.ExportHistory{Password: []byte("first"), CreatedAt: second.Add(time.Hour)},
+	)
+	entry.Attachments = append(entry.Attachments, models.ExportAttachment{Name: "codes.txt", Size: 5, Data: []byte("abcde")})
+	if err := s.ImportData(nil, []models.ExportEntry{entry}, false); err != nil {
+		t.Fatalf("ImportData failed: %v", err)
+	}
+
+	if got, want := storedHistory(t, s, id), []string{"first", "first", "fourth", "second", "third"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("history = %q, want %q", got, want)
+	}
+	if got := storedAttachments(t, s, id); !reflect.DeepEqual(got, entry.Attachments) {
+		t.Errorf("attachments = %+v, want %+v", got, entry.Attachments)
+	}
+}
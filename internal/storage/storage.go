@@ -1,6 +1,11 @@
 package storage
 
-import "github.com/loganmanery/passmanager/pkg/models"
+import (
+	"io"
+	"time"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+)
 
 // StorageService defines the interface for database operations
 type StorageService interface {
@@ -22,29 +27,125 @@ type StorageService interface {
 	// SaveTestVector saves a test vector to the database
 	SaveTestVector(vector []byte) error
 
-	// AddPassword adds a new password entry
-	AddPassword(entry *models.PasswordEntry, encPassword, encNotes []byte) (int64, error)
+	// GetSetting retrieves a setting value, or an empty string if unset
+	GetSetting(key string) (string, error)
+
+	// SaveSetting saves a setting value
+	SaveSetting(key, value string) error
+
+	// AddPassword adds a new encrypted password entry with its tags and custom fields
+	AddPassword(entry models.ExportEntry) (int64, error)
 
 	// GetPassword retrieves a password entry by ID
 	GetPassword(id int64) (*models.PasswordEntry, []byte, []byte, error)
 
-	// GetAllPasswords retrieves all password entries (without sensitive data)
+	// GetAllPasswords retrieves all password entries outside the trash (without sensitive data)
 	GetAllPasswords() ([]models.PasswordEntry, error)
 
-	// UpdatePassword updates an existing password entry
-	UpdatePassword(entry *models.PasswordEntry, encPassword, encNotes []byte) error
+	// UpdatePassword overwrites an existing password entry with an encrypted one, archiving a replaced password
+	UpdatePassword(id int64, entry models.ExportEntry) error
 
-	// DeletePassword deletes a password entry
+	// DeletePassword moves a password entry to the trash
 	DeletePassword(id int64) error
 
+	// GetTrashedPasswords retrieves all entries in the trash
+	GetTrashedPasswords() ([]models.PasswordEntry, error)
+
+	// RestorePassword moves an entry out of the trash
+	RestorePassword(id int64) error
+
+	// PurgePassword permanently deletes a password entry in the trash
+	PurgePassword(id int64) error
+
+	// PurgeTrash permanently deletes entries trashed at or before the cutoff
+	PurgeTrash(before time.Time) (int64, error)
+
 	// SearchPasswords searches for password entries
 	SearchPasswords(params models.SearchParams) ([]models.PasswordEntry, error)
 
-	// ExportData exports all entries for backup
-	ExportData() ([]map[string]interface{}, error)
+	// ExportData exports all entries outside the trash for backup, with
+	// their password history and attachments
+	ExportData() ([]models.ExportEntry, error)
+
+	// ExportEntries exports the entries outside the trash one at a time,
+	// calling count with their number first
+	ExportEntries(count func(n int) error, fn func(entry models.ExportEntry) error) error
+
+	// ImportData imports entries from a backup, adding new entries and
+	// updating existing ones by UUID, optionally replacing all entries
+	ImportData(added, updated []models.ExportEntry, replace bool) error
+
+	// GetPasswordID resolves the UUID of an entry to its ID
+	GetPasswordID(uuid string) (int64, error)
+
+	// GetEntryVersions retrieves the UUID, title and update time of every entry, including the trash
+	GetEntryVersions() (map[string]models.PasswordEntry, error)
+
+	// GetTOTP retrieves the encrypted one-time password secret of an entry
+	GetTOTP(passwordID int64) ([]byte, error)
+
+	// GetOTPCounter retrieves the HOTP counter of an entry
+	GetOTPCounter(passwordID int64) (uint64, error)
+
+	// NextOTPCounter atomically increments and returns the HOTP counter of an entry
+	NextOTPCounter(passwordID int64) (uint64, error)
+
+	// GetItemData retrieves the encrypted type-specific data of an entry
+	GetItemData(passwordID int64) ([]byte, error)
+
+	// MergePasswords folds duplicate entries into one surviving entry
+	MergePasswords(keepID int64, survivor models.ExportEntry, mergeIDs []int64, archived [][]byte) error
+
+	// AddTags attaches tags to a password entry and marks it as updated
+	AddTags(passwordID int64, tags []string) error
+
+	// RemoveTags detaches tags from a password entry and marks it as updated
+	RemoveTags(passwordID int64, tags []string) error
+
+	// GetTags retrieves the names of all tags in use
+	GetTags() ([]string, error)
+
+	// GetCustomFields retrieves the custom fields of an entry with their stored values
+	GetCustomFields(passwordID int64) ([]models.CustomField, [][]byte, error)
+
+	// SaveCustomFields replaces the custom fields of an entry and marks it as updated
+	SaveCustomFields(passwordID int64, fields []models.CustomField, values [][]byte) error
+
+	// AddAttachment stores an attachment and its encrypted content
+	AddAttachment(attachment *models.Attachment, content io.Reader) (int64, error)
+
+	// GetAttachments retrieves the attachments of an entry
+	GetAttachments(passwordID int64) ([]models.Attachment, error)
+
+	// GetAttachment retrieves a single attachment by ID
+	GetAttachment(id int64) (*models.Attachment, error)
+
+	// ReadAttachment writes the encrypted content of an attachment to w
+	ReadAttachment(id int64, w io.Writer) error
+
+	// DeleteAttachment deletes an attachment and its content
+	DeleteAttachment(id int64) error
+
+	// GetPasswordHistory retrieves the previous passwords of an entry
+	GetPasswordHistory(passwordID int64) ([]models.PasswordHistoryEntry, [][]byte, error)
+
+	// GetPasswordHistoryEntry retrieves a single history record by ID
+	GetPasswordHistoryEntry(id int64) (*models.PasswordHistoryEntry, []byte, error)
+
+	// PrunePasswordHistory keeps only the newest history records for an entry
+	PrunePasswordHistory(passwordID int64, keep int) error
+
+	// AppendAuditLog appends a chained audit record and updates the chain head
+	AppendAuditLog(entry *models.AuditLogEntry, head []byte) error
+
+	// GetLastAuditLog retrieves the most recent audit record
+	GetLastAuditLog() (*models.AuditLogEntry, error)
+
+	// GetAuditLog retrieves every audit record in insertion order
+	GetAuditLog() ([]models.AuditLogEntry, error)
 
-	// ImportData imports entries from a backup
-	ImportData(entries []map[string]interface{}) error
+	// GetAuditHead retrieves the authenticated head of the audit chain
+	GetAuditHead() ([]byte, error)
 }
 
 // NewStorageService creates a new instance of the default storage service
@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+)
+
+// tagsColumn selects an entry's tags as a comma-separated list
+const tagsColumn = `(
+	SELECT GROUP_CONCAT(t.name) FROM entry_tags et
+	JOIN tags t ON t.id = et.tag_id
+	WHERE et.password_id = passwords.id
+)`
+
+// AddTags attaches tags to a password entry, creating tags that do not exist
+// yet, and marks the entry as updated
+func (s *SQLiteStorage) AddTags(passwordID int64, tags []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = insertTags(tx, passwordID, tags)
+	if err != nil {
+		return err
+	}
+
+	err = touchEntry(tx, passwordID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RemoveTags detaches tags from a password entry and marks it as updated
+func (s *SQLiteStorage) RemoveTags(passwordID int64, tags []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	for _, tag := range tags {
+		_, err = tx.Exec(`
+			DELETE FROM entry_tags
+			WHERE password_id = ? AND tag_id = (SELECT id FROM tags WHERE name = ?)
+		`, passwordID, tag)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = deleteOrphanTags(tx)
+	if err != nil {
+		return err
+	}
+
+	err = touchEntry(tx, passwordID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetTags retrieves the names of all tags in use, sorted alphabetically
+func (s *SQLiteStorage) GetTags() ([]string, error) {
+	rows, err := s.db.Query("SELECT name FROM tags ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// insertTags attaches tags to an entry within a transaction
+func insertTags(tx *sql.Tx, passwordID int64, tags []string) error {
+	for _, tag := range tags {
+		_, err := tx.Exec("INSERT OR IGNORE INTO tags (name) VALUES (?)", tag)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`
+			INSERT OR IGNORE INTO entry_tags (password_id, tag_id)
+			SELECT ?, id FROM tags WHERE name = ?
+		`, passwordID, tag)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceTags sets the exact tag list of an entry within a transaction
+func replaceTags(tx *sql.Tx, passwordID int64, tags []string) error {
+	_, err := tx.Exec("DELETE FROM entry_tags WHERE password_id = ?", passwordID)
+	if err != nil {
+		return err
+	}
+
+	err = insertTags(tx, passwordID, tags)
+	if err != nil {
+		return err
+	}
+
+	return deleteOrphanTags(tx)
+}
+
+// deleteOrphanTags removes tags no longer attached to any entry
+func deleteOrphanTags(tx *sql.Tx) error {
+	_, err := tx.Exec("DELETE FROM tags WHERE id NOT IN (SELECT tag_id FROM entry_tags)")
+	return err
+}
+
+// splitTags parses the output of tagsColumn into a sorted slice
+func splitTags(value sql.NullString) []string {
+	if !value.Valid || value.String == "" {
+		return nil
+	}
+
+	tags := strings.Split(value.String, ",")
+	sort.Strings(tags)
+	return tags
+}
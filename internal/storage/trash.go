@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+)
+
+// GetTrashedPasswords retrieves all entries in the trash, most recently deleted first
+func (s *SQLiteStorage) GetTrashedPasswords() ([]models.PasswordEntry, error) {
+	rows, err := s.db.Query(`
+		SELECT id, uuid, item_type, title, url, username, category, created_at, updated_at, deleted_at
+		FROM passwords WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, title
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.PasswordEntry
+	for rows.Next() {
+		var entry models.PasswordEntry
+		var createdAt, updatedAt string
+		var deletedAt sql.NullTime
+		err := rows.Scan(&entry.ID, &entry.UUID, &entry.Type, &entry.Title, &entry.URL, &entry.Username,
+			&entry.Category, &createdAt, &updatedAt, &deletedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		// Parse timestamps
+		entry.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+		entry.LastUpdated, _ = time.Parse(time.RFC3339, updatedAt)
+		entry.DeletedAt = deletedAt.Time
+
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// RestorePassword moves an entry out of the trash
+func (s *SQLiteStorage) RestorePassword(id int64) error {
+	result, err := s.db.Exec(`
+		UPDATE passwords SET deleted_at = NULL
+		WHERE id = ? AND deleted_at IS NOT NULL
+	`, id)
+	if err != nil {
+		return err
+	}
+
+	return requireAffected(result)
+}
+
+// PurgeTrash permanently deletes entries trashed at or before the cutoff,
+// returning the number of entries removed
+func (s *SQLiteStorage) PurgeTrash(before time.Time) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	cutoff := before.UTC().Format(timestampFormat)
+	expired := `
+		SELECT id FROM passwords
+		WHERE deleted_at IS NOT NULL AND datetime(deleted_at) <= datetime(?)
+	`
+
+	err = deleteDependents(tx, expired, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec("DELETE FROM passwords WHERE id IN ("+expired+")", cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, tx.Commit()
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+)
+
+// newUUID generates a random version 4 UUID
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// backfillUUIDs assigns UUIDs to entries created before entries had them
+func (s *SQLiteStorage) backfillUUIDs() error {
+	rows, err := s.db.Query("SELECT id FROM passwords WHERE uuid IS NULL")
+	if err != nil {
+		return err
+	}
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		entryUUID, err := newUUID()
+		if err != nil {
+			return err
+		}
+		_, err = s.db.Exec("UPDATE passwords SET uuid = ? WHERE id = ?", entryUUID, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetPasswordID resolves the UUID of an entry to its ID
+func (s *SQLiteStorage) GetPasswordID(uuid string) (int64, error) {
+	var id int64
+	err := s.db.QueryRow("SELECT id FROM passwords WHERE uuid = ?", strings.ToLower(uuid)).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// importUUID returns the UUID for an imported entry: its own if it is a
+// valid UUID that is not in use yet, or a fresh one
+func importUUID(tx *sql.Tx, entryUUID string) (string, error) {
+	if models.IsUUID(entryUUID) {
+		entryUUID = strings.ToLower(entryUUID)
+		var exists bool
+		err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM passwords WHERE uuid = ?)", entryUUID).Scan(&exists)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return entryUUID, nil
+		}
+	}
+	return newUUID()
+}
+
+// GetEntryVersions retrieves the UUID, title and update time of every entry,
+// including the trash, keyed by UUID
+func (s *SQLiteStorage) GetEntryVersions() (map[string]models.PasswordEntry, error) {
+	rows, err := s.db.Query("SELECT id, uuid, title, updated_at, deleted_at FROM passwords")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make(map[string]models.PasswordEntry)
+	for rows.Next() {
+		var entry models.PasswordEntry
+		var entryUUID, updatedAt string
+		var deletedAt sql.NullTime
+		err := rows.Scan(&entry.ID, &entryUUID, &entry.Title, &updatedAt, &deletedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		entry.LastUpdated, _ = time.Parse(time.RFC3339, updatedAt)
+		entry.DeletedAt = deletedAt.Time
+		versions[entryUUID] = entry
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+)
+
+func TestBackfillUUIDs(t *testing.T) {
+	s := newTestStorage(t)
+	ids := []int64{
+		addTestEntry(t, s, models.ExportEntry{Title: "GitHub"}),
+		addTestEntry(t, s, models.ExportEntry{Title: "GitLab"}),
+		addTestEntry(t, s, models.ExportEntry{Title: "Bitbucket"}),
+	}
+
+	// Turn the vault into one from before entries had UUIDs
+	for _, stmt := range []string{
+		"DROP INDEX idx_passwords_uuid",
+		"ALTER TABLE passwords DROP COLUMN uuid",
+	} {
+		if _, err := s.db.Exec(stmt); err != nil {
+			t.Fatalf("%s failed: %v", stmt, err)
+		}
+	}
+
+	if err := s.initializeSchema(); err != nil {
+		t.Fatalf("initializeSchema failed: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		entry, _, _, err := s.GetPassword(id)
+		if err != nil {
+			t.Fatalf("GetPassword failed: %v", err)
+		}
+		if !models.IsUUID(entry.UUID) || entry.UUID != strings.ToLower(entry.UUID) {
+			t.Errorf("entry %q has UUID %q, want a lowercase UUID", entry.Title, entry.UUID)
+		}
+		if seen[entry.UUID] {
+			t.Errorf("entry %q has UUID %q of another entry", entry.Title, entry.UUID)
+		}
+		seen[entry.UUID] = true
+
+		got, err := s.GetPasswordID(entry.UUID)
+		if err != nil || got != id {
+			t.Errorf("GetPasswordID(%q) = %d, %v, want %d", entry.UUID, got, err, id)
+		}
+	}
+
+	// Running the migration again keeps the assigned UUIDs
+	before := make(map[int64]string)
+	for _, id := range ids {
+		entry, _, _, err := s.GetPassword(id)
+		if err != nil {
+			t.Fatalf("GetPassword failed: %v", err)
+		}
+		before[id] = entry.UUID
+	}
+	if err := s.initializeSchema(); err != nil {
+		t.Fatalf("initializeSchema failed: %v", err)
+	}
+	for _, id := range ids {
+		entry, _, _, err := s.GetPassword(id)
+		if err != nil {
+			t.Fatalf("GetPassword failed: %v", err)
+		}
+		if entry.UUID != before[id] {
+			t.Errorf("entry %q UUID changed from %q to %q", entry.Title, before[id], entry.UUID)
+		}
+	}
+
+	if _, err := s.GetPasswordID("00000000-0000-4000-8000-000000000000"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetPasswordID of an unknown UUID error = %v, want %v", err, sql.ErrNoRows)
+	}
+}
@@ -0,0 +1,236 @@
+// Package kdbx reads and writes KeePass databases in the KDBX 4 format and
+// reads KeePass 2.x XML exports.
+package kdbx
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Standard string fields of an entry
+const (
+	FieldTitle    = "Title"
+	FieldUserName = "UserName"
+	FieldPassword = "Password"
+	FieldURL      = "URL"
+	FieldNotes    = "Notes"
+)
+
+// Errors returned when a database cannot be opened
+var (
+	ErrInvalidKey = errors.New("wrong password or key file")
+	ErrCorrupt    = errors.New("database is damaged")
+)
+
+// Database is the decrypted content of a KeePass database. Binaries holds
+// the content of attachments, which entries refer to by index.
+type Database struct {
+	Meta     Meta
+	Root     Group
+	Binaries [][]byte
+}
+
+// Meta holds the database settings used when reading entries
+type Meta struct {
+	Generator         string `xml:"Generator"`
+	DatabaseName      string `xml:"DatabaseName"`
+	RecycleBinEnabled Bool   `xml:"RecycleBinEnabled"`
+	RecycleBinUUID    UUID   `xml:"RecycleBinUUID"`
+}
+
+// Group is a folder of entries and subgroups
+type Group struct {
+	UUID    UUID    `xml:"UUID"`
+	Name    string  `xml:"Name"`
+	Notes   string  `xml:"Notes,omitempty"`
+	Times   Times   `xml:"Times"`
+	Entries []Entry `xml:"Entry"`
+	Groups  []Group `xml:"Group"`
+}
+
+// Entry is a database entry. History holds previous versions of the entry,
+// oldest first.
+type Entry struct {
+	UUID     UUID        `xml:"UUID"`
+	Tags     string      `xml:"Tags,omitempty"`
+	Times    Times       `xml:"Times"`
+	Strings  []String    `xml:"String"`
+	Binaries []BinaryRef `xml:"Binary"`
+	History  []Entry     `xml:"History>Entry,omitempty"`
+}
+
+// Get returns the value of a string field, or "" if the entry has none
+func (e Entry) Get(key string) string {
+	for _, s := range e.Strings {
+		if s.Key == key {
+			return s.Value.Content
+		}
+	}
+	return ""
+}
+
+// Times holds the timestamps of a group or entry
+type Times struct {
+	CreationTime         Time `xml:"CreationTime"`
+	LastModificationTime Time `xml:"LastModificationTime"`
+	LastAccessTime       Time `xml:"LastAccessTime"`
+	ExpiryTime           Time `xml:"ExpiryTime"`
+	Expires              Bool `xml:"Expires"`
+	UsageCount           int  `xml:"UsageCount"`
+	LocationChanged      Time `xml:"LocationChanged"`
+}
+
+// String is a named string field of an entry
+type String struct {
+	Key   string `xml:"Key"`
+	Value Value  `xml:"Value"`
+}
+
+// Value is the value of a string field. Database files mark protected values
+// with Protected, XML exports with ProtectInMemory.
+type Value struct {
+	Content         string `xml:",chardata"`
+	Protected       Bool   `xml:"Protected,attr,omitempty"`
+	ProtectInMemory Bool   `xml:"ProtectInMemory,attr,omitempty"`
+}
+
+// IsProtected reports whether the value is marked as sensitive
+func (v Value) IsProtected() bool {
+	return bool(v.Protected || v.ProtectInMemory)
+}
+
+// BinaryRef attaches a binary of the database to an entry under a file name
+type BinaryRef struct {
+	Key   string `xml:"Key"`
+	Value struct {
+		Ref int `xml:"Ref,attr"`
+	} `xml:"Value"`
+}
+
+// UUID identifies a group or entry, encoded as base64 in the XML
+type UUID [16]byte
+
+// NewUUID returns a random (version 4) UUID
+func NewUUID() (UUID, error) {
+	var u UUID
+	if _, err := rand.Read(u[:]); err != nil {
+		return UUID{}, err
+	}
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return u, nil
+}
+
+// ParseUUID parses a UUID in its canonical textual form
+func ParseUUID(s string) (UUID, error) {
+	var u UUID
+	data, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+	if err != nil || len(data) != len(u) {
+		return UUID{}, fmt.Errorf("invalid UUID %q", s)
+	}
+	copy(u[:], data)
+	return u, nil
+}
+
+// String formats the UUID in its canonical textual form
+func (u UUID) String() string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// MarshalText encodes the UUID as base64
+func (u UUID) MarshalText() ([]byte, error) {
+	return []byte(base64.StdEncoding.EncodeToString(u[:])), nil
+}
+
+// UnmarshalText decodes a base64 UUID. An empty one is the zero UUID.
+func (u *UUID) UnmarshalText(text []byte) error {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(text)))
+	if err != nil {
+		return fmt.Errorf("invalid UUID: %w", err)
+	}
+	switch len(data) {
+	case 0:
+		*u = UUID{}
+	case len(u):
+		copy(u[:], data)
+	default:
+		return fmt.Errorf("invalid UUID: %d bytes", len(data))
+	}
+	return nil
+}
+
+// Bool is a boolean written as True or False
+type Bool bool
+
+// MarshalText encodes the boolean the way KeePass does
+func (b Bool) MarshalText() ([]byte, error) {
+	if b {
+		return []byte("True"), nil
+	}
+	return []byte("False"), nil
+}
+
+// UnmarshalText decodes a boolean. Anything but true is false, as some
+// fields may also be null.
+func (b *Bool) UnmarshalText(text []byte) error {
+	value, _ := strconv.ParseBool(strings.TrimSpace(string(text)))
+	*b = Bool(value)
+	return nil
+}
+
+// MarshalXMLAttr encodes a boolean attribute
+func (b Bool) MarshalXMLAttr(name xml.Name) (xml.Attr, error) {
+	text, _ := b.MarshalText()
+	return xml.Attr{Name: name, Value: string(text)}, nil
+}
+
+// UnmarshalXMLAttr decodes a boolean attribute
+func (b *Bool) UnmarshalXMLAttr(attr xml.Attr) error {
+	return b.UnmarshalText([]byte(attr.Value))
+}
+
+// kdbxEpoch is the Unix time of 0001-01-01, from which KDBX 4 counts seconds
+const kdbxEpoch = -62135596800
+
+// Time is a timestamp. KDBX 4 encodes it as base64 of the seconds since
+// 0001-01-01, XML exports as an ISO 8601 date.
+type Time struct {
+	time.Time
+}
+
+// MarshalText encodes the time the KDBX 4 way
+func (t Time) MarshalText() ([]byte, error) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(t.Unix()-kdbxEpoch))
+	return []byte(base64.StdEncoding.EncodeToString(buf[:])), nil
+}
+
+// UnmarshalText decodes a time in either encoding. An empty one is the zero
+// time.
+func (t *Time) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+	if s == "" {
+		t.Time = time.Time{}
+		return nil
+	}
+
+	if parsed, err := time.Parse(time.RFC3339, s); err == nil {
+		t.Time = parsed.UTC()
+		return nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(data) != 8 {
+		return fmt.Errorf("invalid time %q", s)
+	}
+	t.Time = time.Unix(int64(binary.LittleEndian.Uint64(data))+kdbxEpoch, 0).UTC()
+	return nil
+}
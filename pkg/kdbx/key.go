@@ -0,0 +1,315 @@
+package kdbx
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/tobischo/argon2"
+)
+
+// Key is the composite key of a database: a password, the content of a key
+// file, or both. An empty password is only used when there is no key file.
+type Key struct {
+	Password string
+	KeyFile  []byte
+}
+
+// composite hashes the parts of the key into the composite key
+func (k Key) composite() ([]byte, error) {
+	hash := sha256.New()
+	if k.Password != "" || k.KeyFile == nil {
+		sum := sha256.Sum256([]byte(k.Password))
+		hash.Write(sum[:])
+	}
+	if k.KeyFile != nil {
+		data, err := keyFileData(k.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		hash.Write(data)
+	}
+	return hash.Sum(nil), nil
+}
+
+// keyFile is an XML key file as written by KeePass
+type keyFile struct {
+	XMLName xml.Name `xml:"KeyFile"`
+	Version string   `xml:"Meta>Version"`
+	Data    struct {
+		Hash  string `xml:"Hash,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"Key>Data"`
+}
+
+// keyFileData returns the key of a key file. XML key files hold the key in
+// base64 (version 1) or hex with a checksum (version 2); other files are the
+// key itself if they are 32 bytes or 64 hex digits, or else are hashed.
+func keyFileData(data []byte) ([]byte, error) {
+	if bytes.Contains(data[:min(len(data), 256)], []byte("<KeyFile")) {
+		var file keyFile
+		if err := xml.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("invalid key file: %w", err)
+		}
+
+		value := strings.Join(strings.Fields(file.Data.Value), "")
+		switch {
+		case strings.HasPrefix(file.Version, "1."):
+			key, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid key file: %w", err)
+			}
+			return key, nil
+		case strings.HasPrefix(file.Version, "2."):
+			key, err := hex.DecodeString(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid key file: %w", err)
+			}
+			sum := sha256.Sum256(key)
+			if !strings.EqualFold(file.Data.Hash, hex.EncodeToString(sum[:4])) {
+				return nil, errors.New("invalid key file: checksum mismatch")
+			}
+			return key, nil
+		default:
+			return nil, fmt.Errorf("unsupported key file version %q", file.Version)
+		}
+	}
+
+	switch len(data) {
+	case 32:
+		return data, nil
+	case 64:
+		if key, err := hex.DecodeString(string(data)); err == nil {
+			return key, nil
+		}
+	}
+
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
+
+// KDF identifiers, the $UUID of the KDF parameters. AES-KDF has a second
+// identifier used by KeePassXC for KDBX 4 files.
+var (
+	kdfAES      = []byte{0xc9, 0xd9, 0xf3, 0x9a, 0x62, 0x8a, 0x44, 0x60, 0xbf, 0x74, 0x0d, 0x08, 0xc1, 0x8a, 0x4f, 0xea}
+	kdfAES4     = []byte{0x7c, 0x02, 0xbb, 0x82, 0x79, 0xa7, 0x4a, 0xc0, 0x92, 0x7d, 0x11, 0x4a, 0x00, 0x64, 0x82, 0x38}
+	kdfArgon2d  = []byte{0xef, 0x63, 0x6d, 0xdf, 0x8c, 0x29, 0x44, 0x4b, 0x91, 0xf7, 0xa9, 0xa4, 0x03, 0xe3, 0x0a, 0x0c}
+	kdfArgon2id = []byte{0x9e, 0x29, 0x8b, 0x19, 0x56, 0xdb, 0x47, 0x73, 0xb2, 0x3d, 0xfc, 0x3e, 0xc6, 0xf0, 0xa1, 0xe6}
+)
+
+// KDF limits accepted from a database header. The header is only
+// authenticated after the key is derived, so a crafted file must not be able
+// to demand unbounded time or memory. Argon2 is limited in memory and in
+// memory times iterations, the total amount of memory it passes over.
+const (
+	argon2Version   = 0x13
+	maxArgon2Memory = 1 << 30 // 1 GiB
+	maxArgon2Work   = 64 << 30
+	maxAESRounds    = 1 << 30
+)
+
+// transformKey derives the transformed key from the composite key with the
+// KDF of the database
+func transformKey(composite []byte, params variantDict) ([]byte, error) {
+	id, _ := params["$UUID"].([]byte)
+	salt, _ := params["S"].([]byte)
+
+	switch {
+	case bytes.Equal(id, kdfAES), bytes.Equal(id, kdfAES4):
+		rounds, ok := params["R"].(uint64)
+		if !ok || len(salt) != 32 || rounds > maxAESRounds {
+			return nil, errors.New("invalid AES-KDF parameters")
+		}
+		return aesKDF(composite, salt, rounds)
+	case bytes.Equal(id, kdfArgon2d), bytes.Equal(id, kdfArgon2id):
+		iterations, _ := params["I"].(uint64)
+		memory, _ := params["M"].(uint64)
+		parallelism, _ := params["P"].(uint32)
+		version, _ := params["V"].(uint32)
+		if version != argon2Version {
+			return nil, fmt.Errorf("unsupported Argon2 version %#x", version)
+		}
+		if len(salt) < 8 || iterations < 1 || iterations > 1<<32-1 || parallelism < 1 || parallelism > 255 ||
+			memory < 8*1024*uint64(parallelism) || memory > maxArgon2Memory || iterations*memory > maxArgon2Work {
+			return nil, errors.New("invalid Argon2 parameters")
+		}
+
+		if bytes.Equal(id, kdfArgon2d) {
+			return argon2.DKey(composite, salt, uint32(iterations), uint32(memory/1024), uint8(parallelism), 32), nil
+		}
+		return argon2.IDKey(composite, salt, uint32(iterations), uint32(memory/1024), uint8(parallelism), 32), nil
+	default:
+		return nil, fmt.Errorf("unsupported KDF %x", id)
+	}
+}
+
+// aesKDF encrypts the key with AES-256 rounds times and hashes the result
+func aesKDF(key, seed []byte, rounds uint64) ([]byte, error) {
+	block, err := aes.NewCipher(seed)
+	if err != nil {
+		return nil, err
+	}
+
+	transformed := bytes.Clone(key)
+	for i := uint64(0); i < rounds; i++ {
+		block.Encrypt(transformed[:16], transformed[:16])
+		block.Encrypt(transformed[16:], transformed[16:])
+	}
+
+	sum := sha256.Sum256(transformed)
+	return sum[:], nil
+}
+
+// Variant dictionary value types
+const (
+	variantEnd    = 0x00
+	variantUInt32 = 0x04
+	variantUInt64 = 0x05
+	variantBool   = 0x08
+	variantInt32  = 0x0c
+	variantInt64  = 0x0d
+	variantString = 0x18
+	variantBytes  = 0x42
+)
+
+// variantDictVersion is the version of the variant dictionary format
+const variantDictVersion = 0x0100
+
+// variantDict is a typed key-value map of a KDBX 4 header, such as the KDF
+// parameters
+type variantDict map[string]interface{}
+
+// readVariantDict decodes a variant dictionary
+func readVariantDict(data []byte) (variantDict, error) {
+	r := bytes.NewReader(data)
+
+	var version uint16
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return nil, err
+	}
+	if version>>8 != variantDictVersion>>8 {
+		return nil, fmt.Errorf("unsupported variant dictionary version %#x", version)
+	}
+
+	dict := make(variantDict)
+	for {
+		kind, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if kind == variantEnd {
+			return dict, nil
+		}
+
+		name, err := readSized(r)
+		if err != nil {
+			return nil, err
+		}
+		value, err := readSized(r)
+		if err != nil {
+			return nil, err
+		}
+
+		switch kind {
+		case variantUInt32, variantInt32:
+			if len(value) != 4 {
+				return nil, fmt.Errorf("invalid variant dictionary value %q", name)
+			}
+			if kind == variantUInt32 {
+				dict[string(name)] = binary.LittleEndian.Uint32(value)
+			} else {
+				dict[string(name)] = int32(binary.LittleEndian.Uint32(value))
+			}
+		case variantUInt64, variantInt64:
+			if len(value) != 8 {
+				return nil, fmt.Errorf("invalid variant dictionary value %q", name)
+			}
+			if kind == variantUInt64 {
+				dict[string(name)] = binary.LittleEndian.Uint64(value)
+			} else {
+				dict[string(name)] = int64(binary.LittleEndian.Uint64(value))
+			}
+		case variantBool:
+			if len(value) != 1 {
+				return nil, fmt.Errorf("invalid variant dictionary value %q", name)
+			}
+			dict[string(name)] = value[0] != 0
+		case variantString:
+			dict[string(name)] = string(value)
+		case variantBytes:
+			dict[string(name)] = value
+		default:
+			return nil, fmt.Errorf("unknown variant dictionary type %#x", kind)
+		}
+	}
+}
+
+// marshal encodes the dictionary, with its entries sorted by name
+func (d variantDict) marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint16(variantDictVersion))
+
+	for _, name := range slices.Sorted(maps.Keys(d)) {
+		var kind byte
+		var value []byte
+		switch v := d[name].(type) {
+		case uint32:
+			kind, value = variantUInt32, binary.LittleEndian.AppendUint32(nil, v)
+		case int32:
+			kind, value = variantInt32, binary.LittleEndian.AppendUint32(nil, uint32(v))
+		case uint64:
+			kind, value = variantUInt64, binary.LittleEndian.AppendUint64(nil, v)
+		case int64:
+			kind, value = variantInt64, binary.LittleEndian.AppendUint64(nil, uint64(v))
+		case bool:
+			kind, value = variantBool, []byte{0}
+			if v {
+				value[0] = 1
+			}
+		case string:
+			kind, value = variantString, []byte(v)
+		case []byte:
+			kind, value = variantBytes, v
+		default:
+			return nil, fmt.Errorf("unsupported variant dictionary value %q of type %T", name, v)
+		}
+
+		buf.WriteByte(kind)
+		writeSized(&buf, []byte(name))
+		writeSized(&buf, value)
+	}
+
+	buf.WriteByte(variantEnd)
+	return buf.Bytes(), nil
+}
+
+// writeSized writes a value prefixed with its 32-bit length
+func writeSized(buf *bytes.Buffer, value []byte) {
+	binary.Write(buf, binary.LittleEndian, uint32(len(value)))
+	buf.Write(value)
+}
+
+// readSized reads a value prefixed with its 32-bit length
+func readSized(r *bytes.Reader) ([]byte, error) {
+	var size uint32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return nil, err
+	}
+	if int64(size) > int64(r.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	value := make([]byte, size)
+	_, err := io.ReadFull(r, value)
+	return value, err
+}
@@ -0,0 +1,451 @@
+package kdbx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"golang.org/x/crypto/chacha20"
+)
+
+// File signature and format version
+const (
+	signature1   = 0x9aa2d903
+	signature2   = 0xb54bfb67
+	majorVersion = 4
+)
+
+// Outer header field IDs
+const (
+	headerEnd         = 0
+	headerCipherID    = 2
+	headerCompression = 3
+	headerMasterSeed  = 4
+	headerIV          = 7
+	headerKDF         = 11
+)
+
+// Inner header field IDs
+const (
+	innerEnd       = 0
+	innerStreamID  = 1
+	innerStreamKey = 2
+	innerBinary    = 3
+)
+
+// Cipher identifiers
+var (
+	cipherAES256   = []byte{0x31, 0xc1, 0xf2, 0xe6, 0xbf, 0x71, 0x43, 0x50, 0xbe, 0x58, 0x05, 0x21, 0x6a, 0xfc, 0x5a, 0xff}
+	cipherChaCha20 = []byte{0xd6, 0x03, 0x8a, 0x2b, 0x8b, 0x6f, 0x4c, 0xb5, 0xa5, 0x24, 0x33, 0x9a, 0x31, 0xdb, 0xb5, 0x9a}
+)
+
+// Compression and inner stream settings
+const (
+	compressionGzip  = 1
+	streamChaCha20   = 3
+	maxHeaderSize    = 1 << 20
+	maxBlockSize     = math.MaxInt32
+	headerHMACIndex  = math.MaxUint64
+	hmacKeySuffix    = 0x01
+	masterSeedLength = 32
+)
+
+// header is the unencrypted outer header of a database
+type header struct {
+	cipherID    []byte
+	compression uint32
+	masterSeed  []byte
+	iv          []byte
+	kdf         variantDict
+}
+
+// document is the XML of a database or export
+type document struct {
+	XMLName xml.Name `xml:"KeePassFile"`
+	Meta    meta     `xml:"Meta"`
+	Root    struct {
+		Group Group `xml:"Group"`
+	} `xml:"Root"`
+}
+
+// meta adds the binaries of XML exports, which databases keep in the inner
+// header, to the database settings
+type meta struct {
+	Meta
+	Binaries []struct {
+		ID         int    `xml:"ID,attr"`
+		Compressed Bool   `xml:"Compressed,attr"`
+		Content    string `xml:",chardata"`
+	} `xml:"Binaries>Binary"`
+}
+
+// Read decrypts a KDBX 4 database with its composite key. ErrInvalidKey is
+// returned for a wrong key and ErrCorrupt for a damaged file.
+func Read(r io.Reader, key Key) (*Database, error) {
+	var raw bytes.Buffer
+	h, err := readHeader(io.TeeReader(r, &raw))
+	if err != nil {
+		return nil, err
+	}
+
+	var sums [64]byte
+	if _, err := io.ReadFull(r, sums[:]); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	headerSum := sha256.Sum256(raw.Bytes())
+	if !hmac.Equal(sums[:32], headerSum[:]) {
+		return nil, fmt.Errorf("%w: header checksum mismatch", ErrCorrupt)
+	}
+
+	composite, err := key.composite()
+	if err != nil {
+		return nil, err
+	}
+	transformed, err := transformKey(composite, h.kdf)
+	if err != nil {
+		return nil, err
+	}
+
+	hmacKey := sha512.Sum512(append(append(bytes.Clone(h.masterSeed), transformed...), hmacKeySuffix))
+	if !hmac.Equal(sums[32:], blockHMAC(hmacKey[:], headerHMACIndex, raw.Bytes())) {
+		return nil, ErrInvalidKey
+	}
+
+	payload, err := readBlocks(r, hmacKey[:])
+	if err != nil {
+		return nil, err
+	}
+
+	encKey := sha256.Sum256(append(bytes.Clone(h.masterSeed), transformed...))
+	payload, err = decrypt(h, encKey[:], payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var content io.Reader = bytes.NewReader(payload)
+	if h.compression == compressionGzip {
+		gz, err := gzip.NewReader(content)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		defer gz.Close()
+		content = gz
+	}
+
+	stream, binaries, err := readInnerHeader(content)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc document
+	if err := xml.NewTokenDecoder(&protectedReader{dec: xml.NewDecoder(content), stream: stream}).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+
+	return &Database{Meta: doc.Meta.Meta, Root: doc.Root.Group, Binaries: binaries}, nil
+}
+
+// ReadXML reads an unencrypted KeePass 2.x XML export
+func ReadXML(r io.Reader) (*Database, error) {
+	var doc document
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid KeePass XML: %w", err)
+	}
+
+	binaries := make([][]byte, len(doc.Meta.Binaries))
+	for _, binary := range doc.Meta.Binaries {
+		if binary.ID < 0 || binary.ID >= len(binaries) {
+			return nil, fmt.Errorf("invalid KeePass XML: binary ID %d out of range", binary.ID)
+		}
+
+		data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(binary.Content), ""))
+		if err != nil {
+			return nil, fmt.Errorf("invalid KeePass XML: binary %d: %w", binary.ID, err)
+		}
+		if binary.Compressed {
+			data, err = gunzip(data)
+			if err != nil {
+				return nil, fmt.Errorf("invalid KeePass XML: binary %d: %w", binary.ID, err)
+			}
+		}
+		binaries[binary.ID] = data
+	}
+
+	return &Database{Meta: doc.Meta.Meta, Root: doc.Root.Group, Binaries: binaries}, nil
+}
+
+// readHeader reads the signature and outer header of a database
+func readHeader(r io.Reader) (*header, error) {
+	var start struct {
+		Signature1, Signature2 uint32
+		Version                uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &start); err != nil {
+		return nil, fmt.Errorf("not a KeePass database: %w", err)
+	}
+	if start.Signature1 != signature1 || start.Signature2 != signature2 {
+		return nil, errors.New("not a KeePass database")
+	}
+	if major := start.Version >> 16; major != majorVersion {
+		return nil, fmt.Errorf("unsupported KDBX version %d.%d, save the database as KDBX 4", major, start.Version&0xffff)
+	}
+
+	h := &header{}
+	for {
+		var field struct {
+			ID   uint8
+			Size uint32
+		}
+		if err := binary.Read(r, binary.LittleEndian, &field); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		if field.Size > maxHeaderSize {
+			return nil, fmt.Errorf("%w: header field too large", ErrCorrupt)
+		}
+
+		data := make([]byte, field.Size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+
+		switch field.ID {
+		case headerEnd:
+			if h.cipherID == nil || len(h.masterSeed) != masterSeedLength || h.iv == nil || h.kdf == nil {
+				return nil, fmt.Errorf("%w: incomplete header", ErrCorrupt)
+			}
+			return h, nil
+		case headerCipherID:
+			h.cipherID = data
+		case headerCompression:
+			if len(data) != 4 {
+				return nil, fmt.Errorf("%w: invalid compression flags", ErrCorrupt)
+			}
+			h.compression = binary.LittleEndian.Uint32(data)
+		case headerMasterSeed:
+			h.masterSeed = data
+		case headerIV:
+			h.iv = data
+		case headerKDF:
+			kdf, err := readVariantDict(data)
+			if err != nil {
+				return nil, fmt.Errorf("%w: KDF parameters: %v", ErrCorrupt, err)
+			}
+			h.kdf = kdf
+		}
+	}
+}
+
+// blockKey derives the HMAC key of a block from the database HMAC key
+func blockKey(hmacKey []byte, index uint64) []byte {
+	var prefix [8]byte
+	binary.LittleEndian.PutUint64(prefix[:], index)
+	sum := sha512.Sum512(append(prefix[:], hmacKey...))
+	return sum[:]
+}
+
+// blockHMAC authenticates a block of the HMAC block stream, or the header
+func blockHMAC(hmacKey []byte, index uint64, data []byte) []byte {
+	mac := hmac.New(sha256.New, blockKey(hmacKey, index))
+	if index == headerHMACIndex {
+		mac.Write(data)
+		return mac.Sum(nil)
+	}
+
+	var prefix [12]byte
+	binary.LittleEndian.PutUint64(prefix[:8], index)
+	binary.LittleEndian.PutUint32(prefix[8:], uint32(len(data)))
+	mac.Write(prefix[:])
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// readBlocks reads and authenticates the encrypted payload, which is split
+// into blocks that each carry an HMAC, up to the empty final block
+func readBlocks(r io.Reader, hmacKey []byte) ([]byte, error) {
+	var payload bytes.Buffer
+	for index := uint64(0); ; index++ {
+		var block struct {
+			HMAC [32]byte
+			Size uint32
+		}
+		if err := binary.Read(r, binary.LittleEndian, &block); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		if block.Size > maxBlockSize {
+			return nil, fmt.Errorf("%w: block too large", ErrCorrupt)
+		}
+
+		// The size is not authenticated yet, so only allocate what the file holds
+		var data bytes.Buffer
+		if _, err := io.CopyN(&data, r, int64(block.Size)); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		if !hmac.Equal(block.HMAC[:], blockHMAC(hmacKey, index, data.Bytes())) {
+			return nil, fmt.Errorf("%w: block %d failed authentication", ErrCorrupt, index)
+		}
+
+		if block.Size == 0 {
+			return payload.Bytes(), nil
+		}
+		payload.Write(data.Bytes())
+	}
+}
+
+// decrypt decrypts the payload with the cipher of the database
+func decrypt(h *header, key, payload []byte) ([]byte, error) {
+	switch {
+	case bytes.Equal(h.cipherID, cipherAES256):
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		if len(h.iv) != aes.BlockSize || len(payload) == 0 || len(payload)%aes.BlockSize != 0 {
+			return nil, fmt.Errorf("%w: invalid AES payload", ErrCorrupt)
+		}
+
+		plaintext := make([]byte, len(payload))
+		cipher.NewCBCDecrypter(block, h.iv).CryptBlocks(plaintext, payload)
+
+		// Remove the PKCS #7 padding
+		padding := int(plaintext[len(plaintext)-1])
+		if padding < 1 || padding > aes.BlockSize {
+			return nil, fmt.Errorf("%w: invalid padding", ErrCorrupt)
+		}
+		for _, b := range plaintext[len(plaintext)-padding:] {
+			if int(b) != padding {
+				return nil, fmt.Errorf("%w: invalid padding", ErrCorrupt)
+			}
+		}
+		return plaintext[:len(plaintext)-padding], nil
+	case bytes.Equal(h.cipherID, cipherChaCha20):
+		stream, err := chacha20.NewUnauthenticatedCipher(key, h.iv)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		stream.XORKeyStream(payload, payload)
+		return payload, nil
+	default:
+		return nil, fmt.Errorf("unsupported cipher %x", h.cipherID)
+	}
+}
+
+// readInnerHeader reads the inner header at the start of the decrypted
+// payload, returning the stream cipher of protected values and the binaries
+func readInnerHeader(r io.Reader) (cipher.Stream, [][]byte, error) {
+	var streamID uint32
+	var streamKey []byte
+	var binaries [][]byte
+
+	for {
+		var field struct {
+			ID   uint8
+			Size uint32
+		}
+		if err := binary.Read(r, binary.LittleEndian, &field); err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		if field.Size > maxBlockSize {
+			return nil, nil, fmt.Errorf("%w: inner header field too large", ErrCorrupt)
+		}
+
+		var data bytes.Buffer
+		if _, err := io.CopyN(&data, r, int64(field.Size)); err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+
+		switch field.ID {
+		case innerEnd:
+			if streamID != streamChaCha20 {
+				return nil, nil, fmt.Errorf("unsupported inner stream cipher %d", streamID)
+			}
+			stream, err := protectedStream(streamKey)
+			return stream, binaries, err
+		case innerStreamID:
+			if data.Len() != 4 {
+				return nil, nil, fmt.Errorf("%w: invalid inner stream ID", ErrCorrupt)
+			}
+			streamID = binary.LittleEndian.Uint32(data.Bytes())
+		case innerStreamKey:
+			streamKey = data.Bytes()
+		case innerBinary:
+			// The first byte holds flags, such as memory protection
+			if data.Len() < 1 {
+				return nil, nil, fmt.Errorf("%w: invalid binary", ErrCorrupt)
+			}
+			binaries = append(binaries, data.Bytes()[1:])
+		}
+	}
+}
+
+// protectedStream returns the ChaCha20 stream that protected values are
+// encrypted with, in document order
+func protectedStream(key []byte) (cipher.Stream, error) {
+	sum := sha512.Sum512(key)
+	return chacha20.NewUnauthenticatedCipher(sum[:32], sum[32:44])
+}
+
+// protectedReader decrypts protected values while the XML is decoded, as the
+// inner stream cipher has to be applied to them in document order
+type protectedReader struct {
+	dec       *xml.Decoder
+	stream    cipher.Stream
+	protected bool
+}
+
+// Token returns the next XML token with protected values decrypted
+func (r *protectedReader) Token() (xml.Token, error) {
+	tok, err := r.dec.Token()
+	if err != nil {
+		return tok, err
+	}
+
+	switch t := tok.(type) {
+	case xml.StartElement:
+		if t.Name.Local == "Value" {
+			for _, attr := range t.Attr {
+				if attr.Name.Local != "Protected" {
+					continue
+				}
+				var protected Bool
+				if err := protected.UnmarshalText([]byte(attr.Value)); err != nil {
+					return nil, err
+				}
+				r.protected = bool(protected)
+			}
+		}
+	case xml.EndElement:
+		r.protected = false
+	case xml.CharData:
+		if r.protected {
+			data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(t)))
+			if err != nil {
+				return nil, fmt.Errorf("invalid protected value: %w", err)
+			}
+			r.stream.XORKeyStream(data, data)
+			return xml.CharData(data), nil
+		}
+	}
+	return xml.CopyToken(tok), nil
+}
+
+// gunzip decompresses gzip data
+func gunzip(data []byte) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	return io.ReadAll(gz)
+}
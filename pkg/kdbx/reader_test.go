@@ -0,0 +1,297 @@
+package kdbx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The databases in testdata were written by gokeepasslib, so that the reader
+// is tested against another implementation: aes-kdf.kdbx uses AES-KDF and
+// AES-256 with the password "correct horse", argon2-chacha20.kdbx uses
+// Argon2d and ChaCha20 with the same password and argon2-chacha20.keyx.
+const fixturePassword = "correct horse"
+
+// readFixture reads a database from testdata
+func readFixture(t *testing.T, name string, key Key) (*Database, error) {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Read(bytes.NewReader(data), key)
+}
+
+// fixtureKeyFile returns the key file of argon2-chacha20.kdbx
+func fixtureKeyFile(t *testing.T) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", "argon2-chacha20.keyx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// findString returns a string field of an entry
+func findString(t *testing.T, entry Entry, key string) String {
+	t.Helper()
+
+	for _, s := range entry.Strings {
+		if s.Key == key {
+			return s
+		}
+	}
+	t.Fatalf("entry %q has no field %q", entry.Get(FieldTitle), key)
+	return String{}
+}
+
+func TestReadFixtures(t *testing.T) {
+	tests := []struct {
+		name string
+		key  func(t *testing.T) Key
+	}{
+		{"aes-kdf.kdbx", func(t *testing.T) Key { return Key{Password: fixturePassword} }},
+		{"argon2-chacha20.kdbx", func(t *testing.T) Key { return Key{Password: fixturePassword, KeyFile: fixtureKeyFile(t)} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := readFixture(t, tt.name, tt.key(t))
+			if err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+
+			if db.Meta.DatabaseName != "Fixture" || db.Meta.Generator != "gokeepasslib" {
+				t.Errorf("meta = %+v", db.Meta)
+			}
+			root := db.Root
+			if root.Name != "Database" || len(root.Entries) != 1 || len(root.Groups) != 1 {
+				t.Fatalf("root group %q has %d entries and %d groups, want Database with 1 and 1", root.Name, len(root.Entries), len(root.Groups))
+			}
+			if note := root.Entries[0]; note.Get(FieldTitle) != "Wifi" || note.Get(FieldNotes) != "Guest network: hello" {
+				t.Errorf("note = %q: %q", note.Get(FieldTitle), note.Get(FieldNotes))
+			}
+
+			work := root.Groups[0]
+			if work.Name != "Work" || len(work.Entries) != 1 {
+				t.Fatalf("group %q has %d entries, want Work with 1", work.Name, len(work.Entries))
+			}
+			entry := work.Entries[0]
+			if got := entry.UUID.String(); got != "21020304-0506-0708-090a-0b0c0d0e0f10" {
+				t.Errorf("UUID = %s", got)
+			}
+			fields := map[string]string{
+				FieldTitle:    "GitHub",
+				FieldUserName: "octocat",
+				FieldPassword: "hunter3",
+				FieldURL:      "https://github.com/login",
+				FieldNotes:    "Recovery codes & keys\nare in the safe",
+				"PIN":         "1234",
+			}
+			for key, want := range fields {
+				if got := entry.Get(key); got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+			if !findString(t, entry, FieldPassword).Value.IsProtected() || !findString(t, entry, "PIN").Value.IsProtected() {
+				t.Error("protected fields are not marked protected")
+			}
+			if findString(t, entry, FieldUserName).Value.IsProtected() {
+				t.Error("user name is marked protected")
+			}
+			if entry.Tags != "dev;prod" {
+				t.Errorf("tags = %q", entry.Tags)
+			}
+			if want := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC); !entry.Times.LastModificationTime.Equal(want) {
+				t.Errorf("modified %v, want %v", entry.Times.LastModificationTime.Time, want)
+			}
+
+			if len(entry.History) != 1 || entry.History[0].Get(FieldPassword) != "hunter2" {
+				t.Fatalf("history = %+v, want one version with the password hunter2", entry.History)
+			}
+			if want := time.Date(2023, 9, 10, 11, 12, 13, 0, time.UTC); !entry.History[0].Times.LastModificationTime.Equal(want) {
+				t.Errorf("history version modified %v, want %v", entry.History[0].Times.LastModificationTime.Time, want)
+			}
+
+			if len(entry.Binaries) != 1 || entry.Binaries[0].Key != "id_rsa.pub" {
+				t.Fatalf("binaries = %+v, want id_rsa.pub", entry.Binaries)
+			}
+			ref := entry.Binaries[0].Value.Ref
+			if ref < 0 || ref >= len(db.Binaries) || string(db.Binaries[ref]) != "ssh-rsa AAAAB3NzaC1yc2E octocat\n" {
+				t.Errorf("binary %d of %d does not hold the attachment", ref, len(db.Binaries))
+			}
+		})
+	}
+}
+
+func TestReadFixturesWrongKey(t *testing.T) {
+	keyFile := fixtureKeyFile(t)
+	tests := []struct {
+		name string
+		file string
+		key  Key
+	}{
+		{"wrong password", "aes-kdf.kdbx", Key{Password: "wrong horse"}},
+		{"password and an unused key file", "aes-kdf.kdbx", Key{Password: fixturePassword, KeyFile: keyFile}},
+		{"missing key file", "argon2-chacha20.kdbx", Key{Password: fixturePassword}},
+		{"key file without the password", "argon2-chacha20.kdbx", Key{KeyFile: keyFile}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := readFixture(t, tt.file, tt.key); !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("Read error = %v, want ErrInvalidKey", err)
+			}
+		})
+	}
+}
+
+func TestReadXML(t *testing.T) {
+	file, err := os.Open(filepath.Join("testdata", "export.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	db, err := ReadXML(file)
+	if err != nil {
+		t.Fatalf("ReadXML failed: %v", err)
+	}
+
+	if db.Meta.DatabaseName != "Export" || !bool(db.Meta.RecycleBinEnabled) {
+		t.Errorf("meta = %+v", db.Meta)
+	}
+	if len(db.Root.Groups) != 1 || len(db.Root.Groups[0].Entries) != 1 {
+		t.Fatalf("root = %+v, want one group with one entry", db.Root)
+	}
+	group := db.Root.Groups[0]
+	entry := group.Entries[0]
+	if group.Name != "Banking" || entry.Get(FieldTitle) != "Bank" {
+		t.Errorf("entry %q in group %q, want Bank in Banking", entry.Get(FieldTitle), group.Name)
+	}
+
+	// XML exports hold protected values in plaintext, marked ProtectInMemory
+	password := findString(t, entry, FieldPassword)
+	if password.Value.Content != "s3cret&" || !password.Value.IsProtected() {
+		t.Errorf("password = %+v, want protected s3cret&", password.Value)
+	}
+	if got := entry.Get("Security answer"); got != "blue" {
+		t.Errorf("security answer = %q", got)
+	}
+	if want := time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC); !entry.Times.LastModificationTime.Equal(want) {
+		t.Errorf("modified %v, want %v", entry.Times.LastModificationTime.Time, want)
+	}
+	if len(entry.History) != 1 || entry.History[0].Get(FieldPassword) != "first" {
+		t.Errorf("history = %+v, want one version with the password first", entry.History)
+	}
+
+	// Compressed binaries are decompressed
+	if len(entry.Binaries) != 1 || len(db.Binaries) != 1 || string(db.Binaries[entry.Binaries[0].Value.Ref]) != "xml attachment body" {
+		t.Errorf("binaries = %q, referenced by %+v", db.Binaries, entry.Binaries)
+	}
+}
+
+func TestReadXMLRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		xml  string
+		err  string
+	}{
+		{"not XML", "KeePass", "invalid KeePass XML"},
+		{"binary out of range", `<KeePassFile><Meta><Binaries><Binary ID="1">aGk=</Binary></Binaries></Meta></KeePassFile>`, "binary ID 1 out of range"},
+		{"binary not base64", `<KeePassFile><Meta><Binaries><Binary ID="0">!!</Binary></Binaries></Meta></KeePassFile>`, "binary 0"},
+		{"binary not gzip", `<KeePassFile><Meta><Binaries><Binary ID="0" Compressed="True">aGk=</Binary></Binaries></Meta></KeePassFile>`, "binary 0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadXML(strings.NewReader(tt.xml))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ReadXML error = %v, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
+
+// headerWithKDF returns the start of a database whose header demands the
+// given KDF parameters. The header checksum is valid, as it is not keyed, so
+// the KDF runs before anything authenticates the header.
+func headerWithKDF(t *testing.T, kdf variantDict) []byte {
+	t.Helper()
+
+	raw, err := writeHeader(bytes.Repeat([]byte{1}, masterSeedLength), bytes.Repeat([]byte{2}, 16), kdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(raw)
+	return append(append(raw, sum[:]...), make([]byte, 32)...)
+}
+
+func TestReadRejectsKDFLimits(t *testing.T) {
+	salt := bytes.Repeat([]byte{3}, 32)
+	argon2 := func(iterations, memory uint64) variantDict {
+		return variantDict{
+			"$UUID": kdfArgon2id, "S": salt, "I": iterations, "M": memory,
+			"P": uint32(1), "V": uint32(argon2Version),
+		}
+	}
+
+	tests := []struct {
+		name string
+		kdf  variantDict
+		err  string
+	}{
+		{"AES-KDF rounds", variantDict{"$UUID": kdfAES, "S": salt, "R": uint64(maxAESRounds + 1)}, "invalid AES-KDF parameters"},
+		{"AES-KDF without rounds", variantDict{"$UUID": kdfAES4, "S": salt}, "invalid AES-KDF parameters"},
+		{"Argon2 memory", argon2(1, maxArgon2Memory+1024), "invalid Argon2 parameters"},
+		{"Argon2 work", argon2(maxArgon2Work/maxArgon2Memory+1, maxArgon2Memory), "invalid Argon2 parameters"},
+		{"Argon2 iterations", argon2(1<<32, 64<<10), "invalid Argon2 parameters"},
+		{"Argon2 too little memory", argon2(1, 4<<10), "invalid Argon2 parameters"},
+		{"Argon2 version", variantDict{"$UUID": kdfArgon2d, "S": salt, "I": uint64(1), "M": uint64(64 << 10), "P": uint32(1), "V": uint32(0x10)}, "unsupported Argon2 version 0x10"},
+		{"unknown KDF", variantDict{"$UUID": bytes.Repeat([]byte{9}, 16)}, "unsupported KDF"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			_, err := Read(bytes.NewReader(headerWithKDF(t, tt.kdf)), Key{Password: fixturePassword})
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Read error = %v, want it to contain %q", err, tt.err)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("rejecting the parameters took %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestReadRejectsOtherFiles(t *testing.T) {
+	kdbx3 := headerWithKDF(t, variantDict{"$UUID": kdfAES, "S": bytes.Repeat([]byte{3}, 32), "R": uint64(1)})
+	kdbx3[10] = 3
+
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"empty", nil, "not a KeePass database"},
+		{"other file", []byte("PK\x03\x04 this is a zip file"), "not a KeePass database"},
+		{"KDBX 3", kdbx3, "unsupported KDBX version 3.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Read(bytes.NewReader(tt.data), Key{Password: fixturePassword})
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Read error = %v, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
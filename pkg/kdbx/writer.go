@@ -0,0 +1,240 @@
+package kdbx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"io"
+)
+
+// Settings of written databases. Argon2d and AES-256 are the KDBX 4 defaults
+// of KeePass and are read by every KDBX 4 client.
+const (
+	writeArgon2Iterations  = 10
+	writeArgon2Memory      = 64 << 20 // 64 MiB
+	writeArgon2Parallelism = 2
+	writeBlockSize         = 1 << 20
+	streamKeyLength        = 64
+)
+
+// Write encrypts the database with the composite key and writes it in the
+// KDBX 4 format, with Argon2d key derivation, AES-256 encryption and gzip
+// compression. Values marked Protected are also encrypted with the inner
+// stream cipher, and the binaries are stored in the inner header.
+func Write(w io.Writer, db *Database, key Key) error {
+	composite, err := key.composite()
+	if err != nil {
+		return err
+	}
+
+	masterSeed, err := randomBytes(masterSeedLength)
+	if err != nil {
+		return err
+	}
+	iv, err := randomBytes(aes.BlockSize)
+	if err != nil {
+		return err
+	}
+	salt, err := randomBytes(32)
+	if err != nil {
+		return err
+	}
+	streamKey, err := randomBytes(streamKeyLength)
+	if err != nil {
+		return err
+	}
+
+	kdf := variantDict{
+		"$UUID": kdfArgon2d,
+		"S":     salt,
+		"I":     uint64(writeArgon2Iterations),
+		"M":     uint64(writeArgon2Memory),
+		"P":     uint32(writeArgon2Parallelism),
+		"V":     uint32(argon2Version),
+	}
+	transformed, err := transformKey(composite, kdf)
+	if err != nil {
+		return err
+	}
+
+	raw, err := writeHeader(masterSeed, iv, kdf)
+	if err != nil {
+		return err
+	}
+
+	// The inner header and XML are compressed together
+	var plain bytes.Buffer
+	gz := gzip.NewWriter(&plain)
+	if _, err := gz.Write(innerHeader(streamKey, db.Binaries)); err != nil {
+		return err
+	}
+	stream, err := protectedStream(streamKey)
+	if err != nil {
+		return err
+	}
+	if err := writeXML(gz, db, stream); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	encKey := sha256.Sum256(append(bytes.Clone(masterSeed), transformed...))
+	payload, err := encrypt(encKey[:], iv, plain.Bytes())
+	if err != nil {
+		return err
+	}
+
+	hmacKey := sha512.Sum512(append(append(bytes.Clone(masterSeed), transformed...), hmacKeySuffix))
+	headerSum := sha256.Sum256(raw)
+
+	var out bytes.Buffer
+	out.Write(raw)
+	out.Write(headerSum[:])
+	out.Write(blockHMAC(hmacKey[:], headerHMACIndex, raw))
+	writeBlocks(&out, hmacKey[:], payload)
+
+	_, err = w.Write(out.Bytes())
+	return err
+}
+
+// randomBytes returns n random bytes
+func randomBytes(n int) ([]byte, error) {
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// writeHeader encodes the signature and outer header of a database
+func writeHeader(masterSeed, iv []byte, kdf variantDict) ([]byte, error) {
+	kdfData, err := kdf.marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, []uint32{signature1, signature2, majorVersion << 16})
+	writeHeaderField(&buf, headerCipherID, cipherAES256)
+	writeHeaderField(&buf, headerCompression, binary.LittleEndian.AppendUint32(nil, compressionGzip))
+	writeHeaderField(&buf, headerMasterSeed, masterSeed)
+	writeHeaderField(&buf, headerIV, iv)
+	writeHeaderField(&buf, headerKDF, kdfData)
+	writeHeaderField(&buf, headerEnd, []byte("\r\n\r\n"))
+	return buf.Bytes(), nil
+}
+
+// writeHeaderField writes a field of the outer or inner header
+func writeHeaderField(buf *bytes.Buffer, id uint8, data []byte) {
+	buf.WriteByte(id)
+	writeSized(buf, data)
+}
+
+// innerHeader encodes the inner header with the key of the inner stream
+// cipher and the binaries
+func innerHeader(streamKey []byte, binaries [][]byte) []byte {
+	var buf bytes.Buffer
+	writeHeaderField(&buf, innerStreamID, binary.LittleEndian.AppendUint32(nil, streamChaCha20))
+	writeHeaderField(&buf, innerStreamKey, streamKey)
+	for _, data := range binaries {
+		// No flags, so the binary is not protected in memory
+		writeHeaderField(&buf, innerBinary, append([]byte{0}, data...))
+	}
+	writeHeaderField(&buf, innerEnd, nil)
+	return buf.Bytes()
+}
+
+// writeXML writes the XML of the database, encrypting protected values with
+// the inner stream cipher in document order
+func writeXML(w io.Writer, db *Database, stream cipher.Stream) error {
+	var doc document
+	doc.Meta.Meta = db.Meta
+	doc.Root.Group = db.Root
+
+	plain, err := xml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	// The document is marshaled first and protected token by token, the
+	// reverse of protectedReader
+	dec := xml.NewDecoder(bytes.NewReader(plain))
+	enc := xml.NewEncoder(w)
+	protected := false
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "Value" {
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "Protected" && attr.Value == "True" {
+						protected = true
+					}
+				}
+			}
+		case xml.EndElement:
+			protected = false
+		case xml.CharData:
+			if protected {
+				data := bytes.Clone(t)
+				stream.XORKeyStream(data, data)
+				tok = xml.CharData(base64.StdEncoding.EncodeToString(data))
+			}
+		}
+
+		if err := enc.EncodeToken(tok); err != nil {
+			return err
+		}
+	}
+	return enc.Flush()
+}
+
+// encrypt encrypts the payload with AES-256 in CBC mode and PKCS #7 padding
+func encrypt(key, iv, payload []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	padding := aes.BlockSize - len(payload)%aes.BlockSize
+	ciphertext := append(bytes.Clone(payload), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, ciphertext)
+	return ciphertext, nil
+}
+
+// writeBlocks splits the encrypted payload into blocks that each carry an
+// HMAC, followed by the empty final block
+func writeBlocks(buf *bytes.Buffer, hmacKey, payload []byte) {
+	index := uint64(0)
+	for {
+		data := payload[:min(len(payload), writeBlockSize)]
+		payload = payload[len(data):]
+
+		buf.Write(blockHMAC(hmacKey, index, data))
+		writeSized(buf, data)
+		if len(data) == 0 {
+			return
+		}
+		index++
+	}
+}
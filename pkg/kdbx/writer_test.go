@@ -0,0 +1,179 @@
+package kdbx
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+)
+
+// writeTestDatabase returns a database using every part of the format the
+// writer produces, with a binary large enough to span several blocks
+func writeTestDatabase(t *testing.T) *Database {
+	t.Helper()
+
+	large := make([]byte, 3*writeBlockSize/2)
+	if _, err := rand.Read(large); err != nil {
+		t.Fatal(err)
+	}
+
+	modified := func(year int) Times {
+		at := Time{time.Date(year, 1, 2, 3, 4, 5, 0, time.UTC)}
+		return Times{CreationTime: at, LastModificationTime: at, LastAccessTime: at, LocationChanged: at}
+	}
+	entry := func(title, password string, times Times) Entry {
+		return Entry{
+			UUID:  mustUUID(t),
+			Times: times,
+			Strings: []String{
+				{Key: FieldTitle, Value: Value{Content: title}},
+				{Key: FieldUserName, Value: Value{Content: "octocat"}},
+				{Key: FieldPassword, Value: Value{Content: password, Protected: true}},
+			},
+		}
+	}
+
+	github := entry("GitHub", "hunter3 <&>", modified(2024))
+	github.Tags = "dev;prod"
+	github.Strings = append(github.Strings,
+		String{Key: FieldNotes, Value: Value{Content: "Recovery codes & keys\nare in the safe"}},
+		String{Key: "PIN", Value: Value{Content: "1234", Protected: true}},
+		String{Key: "Empty secret", Value: Value{Protected: true}},
+	)
+	github.History = []Entry{entry("GitHub", "hunter1", modified(2022)), entry("GitHub", "hunter2", modified(2023))}
+	github.Binaries = []BinaryRef{{Key: "id_rsa.pub"}, {Key: "large.bin"}}
+	github.Binaries[1].Value.Ref = 1
+
+	return &Database{
+		Meta: Meta{Generator: "passmanager", DatabaseName: "Vault"},
+		Root: Group{
+			UUID: mustUUID(t), Name: "Vault", Times: modified(2024),
+			Entries: []Entry{entry("Wifi", "guest", modified(2024))},
+			Groups: []Group{{
+				UUID: mustUUID(t), Name: "Work", Times: modified(2024),
+				Entries: []Entry{github},
+			}},
+		},
+		Binaries: [][]byte{[]byte("ssh-rsa AAAAB3NzaC1yc2E octocat\n"), large},
+	}
+}
+
+// mustUUID returns a random UUID
+func mustUUID(t *testing.T) UUID {
+	t.Helper()
+
+	u, err := NewUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// compareEntries checks that an entry read back matches the written one,
+// including its history
+func compareEntries(t *testing.T, got, want Entry) {
+	t.Helper()
+
+	if got.UUID != want.UUID || got.Tags != want.Tags || !got.Times.LastModificationTime.Equal(want.Times.LastModificationTime.Time) {
+		t.Errorf("entry %q = %s %q %v, want %s %q %v", want.Get(FieldTitle), got.UUID, got.Tags, got.Times.LastModificationTime.Time,
+			want.UUID, want.Tags, want.Times.LastModificationTime.Time)
+	}
+
+	if len(got.Strings) != len(want.Strings) {
+		t.Fatalf("entry %q has %d strings, want %d", want.Get(FieldTitle), len(got.Strings), len(want.Strings))
+	}
+	for i, s := range want.Strings {
+		if got.Strings[i].Key != s.Key || got.Strings[i].Value.Content != s.Value.Content || got.Strings[i].Value.Protected != s.Value.Protected {
+			t.Errorf("entry %q: string %+v, want %+v", want.Get(FieldTitle), got.Strings[i], s)
+		}
+	}
+
+	if len(got.Binaries) != len(want.Binaries) {
+		t.Fatalf("entry %q has %d binaries, want %d", want.Get(FieldTitle), len(got.Binaries), len(want.Binaries))
+	}
+	for i, ref := range want.Binaries {
+		if got.Binaries[i].Key != ref.Key || got.Binaries[i].Value.Ref != ref.Value.Ref {
+			t.Errorf("entry %q: binary %+v, want %+v", want.Get(FieldTitle), got.Binaries[i], ref)
+		}
+	}
+
+	if len(got.History) != len(want.History) {
+		t.Fatalf("entry %q has %d history versions, want %d", want.Get(FieldTitle), len(got.History), len(want.History))
+	}
+	for i := range want.History {
+		compareEntries(t, got.History[i], want.History[i])
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	want := writeTestDatabase(t)
+	key := Key{Password: fixturePassword, KeyFile: fixtureKeyFile(t)}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, want, key); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	data := buf.Bytes()
+
+	// Protected values are encrypted with the inner stream cipher, and the
+	// whole payload is encrypted, so no secret appears in the file
+	for _, secret := range []string{"hunter3", "octocat", "Recovery codes"} {
+		if bytes.Contains(data, []byte(secret)) {
+			t.Errorf("written database contains %q in plaintext", secret)
+		}
+	}
+
+	got, err := Read(bytes.NewReader(data), key)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	if got.Meta != want.Meta {
+		t.Errorf("meta = %+v, want %+v", got.Meta, want.Meta)
+	}
+	if len(got.Binaries) != len(want.Binaries) {
+		t.Fatalf("read %d binaries, want %d", len(got.Binaries), len(want.Binaries))
+	}
+	for i := range want.Binaries {
+		if !bytes.Equal(got.Binaries[i], want.Binaries[i]) {
+			t.Errorf("binary %d differs, %d bytes read, %d written", i, len(got.Binaries[i]), len(want.Binaries[i]))
+		}
+	}
+
+	root := got.Root
+	if root.UUID != want.Root.UUID || root.Name != want.Root.Name || len(root.Entries) != 1 || len(root.Groups) != 1 {
+		t.Fatalf("root group = %q with %d entries and %d groups, want %q with 1 and 1", root.Name, len(root.Entries), len(root.Groups), want.Root.Name)
+	}
+	compareEntries(t, root.Entries[0], want.Root.Entries[0])
+
+	work := root.Groups[0]
+	if work.UUID != want.Root.Groups[0].UUID || work.Name != "Work" || len(work.Entries) != 1 {
+		t.Fatalf("group = %q with %d entries, want Work with 1", work.Name, len(work.Entries))
+	}
+	compareEntries(t, work.Entries[0], want.Root.Groups[0].Entries[0])
+
+	// The composite key is required as a whole
+	for _, wrong := range []Key{{Password: fixturePassword}, {Password: "wrong horse", KeyFile: key.KeyFile}} {
+		if _, err := Read(bytes.NewReader(data), wrong); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Read with %d-byte key file and password %q: error = %v, want ErrInvalidKey", len(wrong.KeyFile), wrong.Password, err)
+		}
+	}
+}
+
+func TestWriteEmptyDatabase(t *testing.T) {
+	want := &Database{Root: Group{UUID: mustUUID(t), Name: "Empty"}}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, want, Key{Password: fixturePassword}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	got, err := Read(&buf, Key{Password: fixturePassword})
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if got.Root.UUID != want.Root.UUID || got.Root.Name != "Empty" || len(got.Root.Entries) != 0 || len(got.Root.Groups) != 0 || len(got.Binaries) != 0 {
+		t.Errorf("read %+v, want an empty root group", got)
+	}
+}
@@ -0,0 +1,492 @@
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/loganmanery/passmanager/pkg/models"
+)
+
+// age exports are JSON documents encrypted with the age format, so that a
+// backup can be read with the age tool alone. Unlike the native export, the
+// secrets inside the document, previous passwords and attachments included,
+// are in plaintext.
+const (
+	ageFormatVersion = 1
+	ageMagic         = "age-encryption.org/v1\n"
+)
+
+// AgeKeys selects how an age file is encrypted or decrypted: with a
+// passphrase, or with X25519 keys. Recipients are public keys (age1...) used
+// for export and Identities are secret keys (AGE-SECRET-KEY-1...) used for
+// import. A passphrase cannot be combined with keys.
+type AgeKeys struct {
+	Passphrase string
+	Recipients []string
+	Identities []string
+}
+
+// ageExport is the JSON document inside an age export
+type ageExport struct {
+	FormatVersion int        `json:"format_version"`
+	Created       time.Time  `json:"created"`
+	EntryCount    int        `json:"entry_count"`
+	Entries       []ageEntry `json:"entries"`
+}
+
+// ageEntry is an entry with its secrets, password history and attachments
+// in plaintext. Item holds the type-specific data of cards, identities and
+// the other item types.
+type ageEntry struct {
+	UUID         string           `json:"uuid"`
+	Type         string           `json:"type"`
+	Title        string           `json:"title"`
+	URL          string           `json:"url,omitempty"`
+	URLMatch     string           `json:"url_match,omitempty"`
+	Username     string           `json:"username,omitempty"`
+	Password     string           `json:"password"`
+	Notes        string           `json:"notes,omitempty"`
+	TOTP         string           `json:"totp,omitempty"`
+	OTPCounter   uint64           `json:"otp_counter,omitempty"`
+	Item         json.RawMessage  `json:"item,omitempty"`
+	Category     string           `json:"category,omitempty"`
+	Tags         []string         `json:"tags,omitempty"`
+	CustomFields []ageCustomField `json:"custom_fields,omitempty"`
+	History      []ageHistory     `json:"history,omitempty"`
+	Attachments  []ageAttachment  `json:"attachments,omitempty"`
+	CreatedAt    time.Time        `json:"created_at"`
+	UpdatedAt    time.Time        `json:"updated_at"`
+}
+
+// ageCustomField is a custom field with its value in plaintext
+type ageCustomField struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// ageHistory is a previous password in plaintext and when it was replaced
+type ageHistory struct {
+	Password  string    `json:"password"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ageAttachment is an attachment with its content in plaintext, encoded as
+// base64 in the JSON. MIMEType is sniffed from the content for other tools
+// and ignored on import.
+type ageAttachment struct {
+	Name     string `json:"name"`
+	MIMEType string `json:"mime_type"`
+	Size     int64  `json:"size"`
+	Content  []byte `json:"content"`
+}
+
+// ExportVaultAge exports the password vault, with the password history and
+// attachments of every entry, to an age-encrypted file that can be decrypted
+// with the age tool using the passphrase or one of the recipients' identities
+func (pm *PasswordManager) ExportVaultAge(filename string, keys AgeKeys) error {
+	if !pm.initialized {
+		return errors.New("password manager not initialized")
+	}
+	pm.updateLastActivity()
+
+	recipients, err := keys.recipients()
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	count, err := pm.writeAge(file, recipients)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(filename)
+		return err
+	}
+
+	return pm.logAudit(AuditActionExport, AuditResourceVault, 0, fmt.Sprintf("age: %d entries", count))
+}
+
+// writeAge writes the entries of the vault to w as an age export, reading,
+// decrypting and writing them one at a time, and returns how many it wrote
+func (pm *PasswordManager) writeAge(w io.Writer, recipients []age.Recipient) (int, error) {
+	var export *ageWriter
+	err := pm.storage.ExportEntries(func(n int) error {
+		var err error
+		export, err = newAgeWriter(w, n, recipients)
+		return err
+	}, func(entry models.ExportEntry) error {
+		plain, err := pm.ageEntry(entry)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt %q: %w", entry.Title, err)
+		}
+		return export.writeEntry(plain)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return export.count, export.close()
+}
+
+// ageWriter writes an age export an entry at a time, so that only the entry
+// being written is held in memory
+type ageWriter struct {
+	enc     io.WriteCloser
+	count   int
+	written int
+}
+
+// newAgeWriter starts an age export of count entries to w, encrypted to the
+// recipients, and writes the document up to its entries
+func newAgeWriter(w io.Writer, count int, recipients []age.Recipient) (*ageWriter, error) {
+	enc, err := age.Encrypt(w, recipients...)
+	if err != nil {
+		return nil, err
+	}
+
+	// The document is an indented ageExport written in pieces: its fields
+	// up to the entries array, then the entries as they are read
+	doc, err := json.MarshalIndent(ageExport{
+		FormatVersion: ageFormatVersion,
+		Created:       time.Now().UTC().Truncate(time.Second),
+		EntryCount:    count,
+		Entries:       []ageEntry{},
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	start := bytes.TrimSuffix(doc, []byte("]\n}"))
+	if _, err := enc.Write(start); err != nil {
+		return nil, err
+	}
+
+	return &ageWriter{enc: enc, count: count}, nil
+}
+
+// writeEntry appends an entry to the export
+func (a *ageWriter) writeEntry(entry ageEntry) error {
+	if a.written == a.count {
+		return fmt.Errorf("vault has more entries than the %d counted for the export", a.count)
+	}
+
+	data, err := json.MarshalIndent(entry, "    ", "  ")
+	if err != nil {
+		return err
+	}
+
+	sep := "\n    "
+	if a.written > 0 {
+		sep = "," + sep
+	}
+	if _, err := io.WriteString(a.enc, sep); err != nil {
+		return err
+	}
+	if _, err := a.enc.Write(data); err != nil {
+		return err
+	}
+
+	a.written++
+	return nil
+}
+
+// close ends the document and seals the encrypted stream
+func (a *ageWriter) close() error {
+	if a.written != a.count {
+		return fmt.Errorf("vault has %d entries but %d were counted for the export", a.written, a.count)
+	}
+
+	end := "]\n}\n"
+	if a.written > 0 {
+		end = "\n  " + end
+	}
+	if _, err := io.WriteString(a.enc, end); err != nil {
+		return err
+	}
+	return a.enc.Close()
+}
+
+// ImportVaultAge imports the password vault from an age-encrypted file
+// written by ExportVaultAge, combining it with the existing entries as
+// selected by the import options. ASCII-armored files are accepted too.
+func (pm *PasswordManager) ImportVaultAge(filename string, keys AgeKeys, options ImportOptions) (ImportReport, error) {
+	if !pm.initialized {
+		return ImportReport{}, errors.New("password manager not initialized")
+	}
+	pm.updateLastActivity()
+
+	identities, err := keys.identities()
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return ImportReport{}, err
+	}
+	defer file.Close()
+
+	var src io.Reader = bufio.NewReader(file)
+	if start, _ := src.(*bufio.Reader).Peek(len(armor.Header)); string(start) == armor.Header {
+		src = armor.NewReader(src)
+	}
+
+	decReader, err := age.Decrypt(src, identities...)
+	if err != nil {
+		return ImportReport{}, fmt.Errorf("failed to decrypt age file: %w", err)
+	}
+
+	var doc ageExport
+	if err := decodeStrict(json.NewDecoder(decReader), &doc); err != nil {
+		return ImportReport{}, fmt.Errorf("invalid age export: %w", err)
+	}
+	if doc.FormatVersion != ageFormatVersion {
+		return ImportReport{}, fmt.Errorf("unsupported age export format version %d", doc.FormatVersion)
+	}
+
+	// Encrypt the secrets with the vault key
+	entries := make([]models.ExportEntry, len(doc.Entries))
+	for i, entry := range doc.Entries {
+		entries[i], err = pm.ageImportEntry(entry)
+		if err != nil {
+			return ImportReport{}, fmt.Errorf("age export entry %d: %w", i+1, err)
+		}
+	}
+
+	if err := validateExportEntries(doc.EntryCount, entries); err != nil {
+		return ImportReport{}, err
+	}
+
+	return pm.importEntries(entries, options, "age", nil)
+}
+
+// IsAgeFile reports whether a file starts like an age-encrypted file, binary
+// or ASCII-armored
+func IsAgeFile(filename string) (bool, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	start := make([]byte, len(armor.Header))
+	n, err := io.ReadFull(file, start)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	start = start[:n]
+
+	return strings.HasPrefix(string(start), ageMagic) || string(start) == armor.Header, nil
+}
+
+// recipients parses the keys to encrypt an age file to
+func (k AgeKeys) recipients() ([]age.Recipient, error) {
+	if k.Passphrase != "" {
+		if len(k.Recipients) > 0 {
+			return nil, errors.New("use either a passphrase or recipients, not both")
+		}
+		recipient, err := age.NewScryptRecipient(k.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return []age.Recipient{recipient}, nil
+	}
+
+	if len(k.Recipients) == 0 {
+		return nil, errors.New("no passphrase or recipients given")
+	}
+
+	recipients := make([]age.Recipient, len(k.Recipients))
+	for i, key := range k.Recipients {
+		recipient, err := age.ParseX25519Recipient(strings.TrimSpace(key))
+		if err != nil {
+			return nil, err
+		}
+		recipients[i] = recipient
+	}
+	return recipients, nil
+}
+
+// identities parses the keys to decrypt an age file with
+func (k AgeKeys) identities() ([]age.Identity, error) {
+	if k.Passphrase != "" {
+		if len(k.Identities) > 0 {
+			return nil, errors.New("use either a passphrase or identities, not both")
+		}
+		identity, err := age.NewScryptIdentity(k.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return []age.Identity{identity}, nil
+	}
+
+	if len(k.Identities) == 0 {
+		return nil, errors.New("no passphrase or identities given")
+	}
+
+	identities := make([]age.Identity, len(k.Identities))
+	for i, key := range k.Identities {
+		identity, err := age.ParseX25519Identity(strings.TrimSpace(key))
+		if err != nil {
+			return nil, err
+		}
+		identities[i] = identity
+	}
+	return identities, nil
+}
+
+// ageEntry decrypts the secrets of an exported entry
+func (pm *PasswordManager) ageEntry(entry models.ExportEntry) (ageEntry, error) {
+	plain := ageEntry{
+		UUID:       entry.UUID,
+		Type:       entry.Type,
+		Title:      entry.Title,
+		URL:        entry.URL,
+		URLMatch:   entry.URLMatch,
+		Username:   entry.Username,
+		OTPCounter: entry.OTPCounter,
+		Category:   entry.Category,
+		Tags:       entry.Tags,
+		CreatedAt:  entry.CreatedAt,
+		UpdatedAt:  entry.UpdatedAt,
+	}
+
+	var err error
+	secrets := map[*string][]byte{&plain.Password: entry.Password, &plain.Notes: entry.Notes, &plain.TOTP: entry.TOTP}
+	for target, ciphertext := range secrets {
+		*target, err = pm.decryptSecret(ciphertext)
+		if err != nil {
+			return ageEntry{}, err
+		}
+	}
+
+	item, err := pm.decryptSecret(entry.ItemData)
+	if err != nil {
+		return ageEntry{}, err
+	}
+	if item != "" {
+		plain.Item = json.RawMessage(item)
+	}
+
+	for _, field := range entry.CustomFields {
+		value := string(field.Value)
+		if field.Type == models.FieldTypeHidden {
+			value, err = pm.decryptSecret(field.Value)
+			if err != nil {
+				return ageEntry{}, err
+			}
+		}
+		plain.CustomFields = append(plain.CustomFields, ageCustomField{Name: field.Name, Type: field.Type, Value: value})
+	}
+
+	for _, record := range entry.History {
+		password, err := pm.decryptSecret(record.Password)
+		if err != nil {
+			return ageEntry{}, err
+		}
+		plain.History = append(plain.History, ageHistory{Password: password, CreatedAt: record.CreatedAt})
+	}
+
+	for _, attachment := range entry.Attachments {
+		var content bytes.Buffer
+		if err := pm.crypto.DecryptStream(&content, bytes.NewReader(attachment.Data), pm.masterKey); err != nil {
+			return ageEntry{}, fmt.Errorf("attachment %q: %w", attachment.Name, err)
+		}
+		plain.Attachments = append(plain.Attachments, ageAttachment{
+			Name:     attachment.Name,
+			MIMEType: http.DetectContentType(content.Bytes()),
+			Size:     int64(content.Len()),
+			Content:  content.Bytes(),
+		})
+	}
+
+	return plain, nil
+}
+
+// ageImportEntry validates an entry from an age export the way AddPassword
+// does and encrypts its secrets with the vault key
+func (pm *PasswordManager) ageImportEntry(plain ageEntry) (models.ExportEntry, error) {
+	if !models.IsUUID(plain.UUID) {
+		return models.ExportEntry{}, fmt.Errorf("invalid UUID %q", plain.UUID)
+	}
+	if !isItemType(plain.Type) {
+		return models.ExportEntry{}, fmt.Errorf("invalid type %q", plain.Type)
+	}
+
+	entry := models.PasswordEntry{
+		UUID:        plain.UUID,
+		Type:        plain.Type,
+		Title:       plain.Title,
+		URL:         plain.URL,
+		URLMatch:    plain.URLMatch,
+		Username:    plain.Username,
+		Password:    plain.Password,
+		Notes:       plain.Notes,
+		TOTP:        plain.TOTP,
+		Category:    plain.Category,
+		Tags:        plain.Tags,
+		CreatedAt:   plain.CreatedAt,
+		LastUpdated: plain.UpdatedAt,
+	}
+
+	if len(plain.Item) > 0 && string(plain.Item) != "null" {
+		target := newItemData(&entry)
+		if target == nil {
+			return models.ExportEntry{}, fmt.Errorf("%s items have no item data", entry.Type)
+		}
+		if err := decodeStrict(json.NewDecoder(bytes.NewReader(plain.Item)), target); err != nil {
+			return models.ExportEntry{}, fmt.Errorf("invalid item data: %w", err)
+		}
+	}
+
+	for _, field := range plain.CustomFields {
+		entry.CustomFields = append(entry.CustomFields, models.CustomField{Name: field.Name, Type: field.Type, Value: field.Value})
+	}
+
+	result, err := pm.encryptImported(entry)
+	if err != nil {
+		return models.ExportEntry{}, err
+	}
+
+	// The exported counter may have advanced past the one in the URI
+	if result.TOTP != nil && plain.OTPCounter > result.OTPCounter {
+		result.OTPCounter = plain.OTPCounter
+	}
+
+	history := make([]models.PasswordHistoryEntry, len(plain.History))
+	for i, record := range plain.History {
+		history[i] = models.PasswordHistoryEntry{Password: record.Password, CreatedAt: record.CreatedAt}
+	}
+	result.History, err = pm.encryptImportedHistory(history)
+	if err != nil {
+		return models.ExportEntry{}, err
+	}
+
+	for _, attachment := range plain.Attachments {
+		if attachment.Size != int64(len(attachment.Content)) {
+			return models.ExportEntry{}, fmt.Errorf("attachment %q has %d bytes, expected %d", attachment.Name, len(attachment.Content), attachment.Size)
+		}
+		encrypted, err := pm.encryptImportedAttachment(attachment.Name, attachment.Content)
+		if err != nil {
+			return models.ExportEntry{}, err
+		}
+		result.Attachments = append(result.Attachments, encrypted)
+	}
+
+	return result, nil
+}
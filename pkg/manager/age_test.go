@@ -0,0 +1,232 @@
+package manager
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/loganmanery/passmanager/pkg/models"
+)
+
+const testAgePassphrase = "age passphrase"
+
+// writeAgeExport encrypts an age export of entries to a temporary file
+func writeAgeExport(t *testing.T, entries []ageEntry) string {
+	t.Helper()
+
+	recipient, err := age.NewScryptRecipient(testAgePassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Keep the test fast; the work factor does not matter here
+	recipient.SetWorkFactor(10)
+
+	filename := filepath.Join(t.TempDir(), "vault.age")
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	export, err := newAgeWriter(file, len(entries), []age.Recipient{recipient})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if err := export.writeEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := export.close(); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+// testAgeEntry returns a valid login for an age export
+func testAgeEntry() ageEntry {
+	now := time.Now().UTC().Truncate(time.Second)
+	return ageEntry{
+		UUID: "8f0c5c9e-4b5e-4a8e-9a3c-2f1d0b6e7a11", Type: models.ItemTypeLogin,
+		Title: "GitHub", Username: "octocat", Password: "hunter2",
+		CreatedAt: now, UpdatedAt: now,
+	}
+}
+
+func TestImportVaultAgeNormalizes(t *testing.T) {
+	pm := newTestManager(t)
+
+	entry := testAgeEntry()
+	entry.Tags = []string{" prod ", "dev", "dev"}
+	entry.Type = models.ItemTypeCard
+	entry.Item = json.RawMessage(`{"cardholder_name":"Mona Lisa","number":"4111 1111 1111 1111","expiry_month":12,"expiry_year":2030}`)
+	filename := writeAgeExport(t, []ageEntry{entry})
+
+	_, err := pm.ImportVaultAge(filename, AgeKeys{Passphrase: testAgePassphrase}, ImportOptions{Mode: ImportModeAppend})
+	if err != nil {
+		t.Fatalf("ImportVaultAge failed: %v", err)
+	}
+
+	imported, err := pm.GetPasswordByUUID(entry.UUID)
+	if err != nil {
+		t.Fatalf("GetPasswordByUUID failed: %v", err)
+	}
+	want, err := normalizeTags(entry.Tags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(imported.Tags, want) || len(want) != 2 {
+		t.Errorf("tags = %q, want %q", imported.Tags, want)
+	}
+	if imported.Card == nil || imported.Card.Number != "4111111111111111" {
+		t.Errorf("card = %+v", imported.Card)
+	}
+}
+
+func TestImportVaultAgeRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(entry *ageEntry)
+		err    string
+	}{
+		{"invalid UUID", func(e *ageEntry) { e.UUID = "42" }, `invalid UUID "42"`},
+		{"invalid type", func(e *ageEntry) { e.Type = "car" }, `invalid type "car"`},
+		{"missing title", func(e *ageEntry) { e.Title = " " }, "entry has no title"},
+		{"tag with a comma", func(e *ageEntry) { e.Tags = []string{"dev,prod"} }, "tags cannot contain commas"},
+		{"item of the wrong shape", func(e *ageEntry) {
+			e.Type = models.ItemTypeCard
+			e.Item = json.RawMessage(`["4111111111111111"]`)
+		}, "invalid item data"},
+		{"unknown item field", func(e *ageEntry) {
+			e.Type = models.ItemTypeWiFi
+			e.Item = json.RawMessage(`{"ssid":"home","colour":"red"}`)
+		}, `unknown field "colour"`},
+		{"item for a login", func(e *ageEntry) { e.Item = json.RawMessage(`{"ssid":"home"}`) }, "login items have no item data"},
+		{"invalid URL match", func(e *ageEntry) { e.URLMatch = "fuzzy" }, "fuzzy"},
+		{"invalid custom field", func(e *ageEntry) {
+			e.CustomFields = []ageCustomField{{Name: "PIN", Type: "secret", Value: "1234"}}
+		}, "secret"},
+		{"invalid TOTP", func(e *ageEntry) { e.TOTP = "otpauth://totp/x?secret=!!" }, "age export entry 1: one-time password secret is not valid base32"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm := newTestManager(t)
+			entry := testAgeEntry()
+			tt.mutate(&entry)
+			filename := writeAgeExport(t, []ageEntry{entry})
+
+			_, err := pm.ImportVaultAge(filename, AgeKeys{Passphrase: testAgePassphrase}, ImportOptions{Mode: ImportModeAppend})
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ImportVaultAge error = %v, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestExportVaultAgeRoundTrip(t *testing.T) {
+	pm := newTestManager(t)
+	addExportEntries(t, pm)
+	want, err := pm.storage.ExportData()
+	if err != nil {
+		t.Fatalf("ExportData failed: %v", err)
+	}
+
+	// Recipient keys avoid the cost of scrypt
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "vault.age")
+	if err := pm.ExportVaultAge(filename, AgeKeys{Recipients: []string{identity.Recipient().String()}}); err != nil {
+		t.Fatalf("ExportVaultAge failed: %v", err)
+	}
+
+	// The document itself holds the previous password and the attachment
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	decReader, err := age.Decrypt(file, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(decReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc ageExport
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("document is not valid JSON: %v", err)
+	}
+	if doc.EntryCount != len(want) || len(doc.Entries) != len(want) {
+		t.Errorf("document has %d entries counted and %d written, want %d", doc.EntryCount, len(doc.Entries), len(want))
+	}
+
+	// The entries are written one at a time, but the document reads as if
+	// it were indented as a whole
+	indented, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(indented)+"\n" {
+		t.Errorf("document =\n%s\nwant it indented as\n%s", data, indented)
+	}
+
+	github := doc.Entries[0]
+	if len(github.History) != 1 || github.History[0].Password != "hunter2" {
+		t.Errorf("history = %+v, want the previous password hunter2", github.History)
+	}
+	wantAttachment := ageAttachment{
+		Name: "id_rsa.pub", MIMEType: "text/plain; charset=utf-8",
+		Size: int64(len(testAttachment)), Content: []byte(testAttachment),
+	}
+	if len(github.Attachments) != 1 || !reflect.DeepEqual(github.Attachments[0], wantAttachment) {
+		t.Errorf("attachments = %+v, want %+v", github.Attachments, wantAttachment)
+	}
+
+	other := newTestManager(t)
+	keys := AgeKeys{Identities: []string{identity.String()}}
+	if _, err := other.ImportVaultAge(filename, keys, ImportOptions{Mode: ImportModeReplace}); err != nil {
+		t.Fatalf("ImportVaultAge failed: %v", err)
+	}
+
+	got, err := other.storage.ExportData()
+	if err != nil {
+		t.Fatalf("ExportData failed: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("imported %d entries, want %d", len(got), len(want))
+	}
+	for i := range want {
+		compareExportEntries(t, pm, want[i], other, got[i])
+	}
+}
+
+func TestExportVaultAgeEmpty(t *testing.T) {
+	pm := newTestManager(t)
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "vault.age")
+	if err := pm.ExportVaultAge(filename, AgeKeys{Recipients: []string{identity.Recipient().String()}}); err != nil {
+		t.Fatalf("ExportVaultAge failed: %v", err)
+	}
+
+	other := newTestManager(t)
+	report, err := other.ImportVaultAge(filename, AgeKeys{Identities: []string{identity.String()}}, ImportOptions{Mode: ImportModeAppend})
+	if err != nil {
+		t.Fatalf("ImportVaultAge failed: %v", err)
+	}
+	if report.Added != 0 {
+		t.Errorf("imported %d entries from an empty vault", report.Added)
+	}
+}
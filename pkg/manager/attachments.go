@@ -0,0 +1,183 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+)
+
+// AddAttachment encrypts content and attaches it to an entry outside the
+// trash under a name not used by its other attachments. The content must be
+// exactly size bytes long; it is streamed, so it never has to fit in memory.
+func (pm *PasswordManager) AddAttachment(id int64, name string, content io.Reader, size int64) (int64, error) {
+	if !pm.initialized {
+		return 0, errors.New("password manager not initialized")
+	}
+	pm.updateLastActivity()
+
+	if name == "" {
+		return 0, errors.New("attachment name cannot be empty")
+	}
+
+	// Make sure the entry exists outside the trash and the name is free
+	// before storing anything
+	entry, _, _, err := pm.storage.GetPassword(id)
+	if err != nil {
+		return 0, err
+	}
+	if entry.IsTrashed() {
+		return 0, fmt.Errorf("entry %d is in the trash", id)
+	}
+
+	existing, err := pm.storage.GetAttachments(id)
+	if err != nil {
+		return 0, err
+	}
+	for _, attachment := range existing {
+		if attachment.Name == name {
+			return 0, fmt.Errorf("entry %d already has an attachment named %q", id, name)
+		}
+	}
+
+	// Encrypt in the background while storage consumes the ciphertext
+	pr, pw := io.Pipe()
+	go func() {
+		counter := &countingReader{r: content}
+		err := pm.crypto.EncryptStream(pw, counter, pm.masterKey)
+		if err == nil && counter.n != size {
+			err = fmt.Errorf("attachment size mismatch: expected %d bytes, read %d", size, counter.n)
+		}
+		pw.CloseWithError(err)
+	}()
+
+	attachment := models.Attachment{
+		PasswordID: id,
+		Name:       name,
+		Size:       size,
+	}
+	attachmentID, err := pm.storage.AddAttachment(&attachment, pr)
+	pr.Close()
+	if err != nil {
+		return 0, fmt.Errorf("failed to store attachment: %w", err)
+	}
+
+	err = pm.logAudit(AuditActionAdd, AuditResourceAttachment, attachmentID, fmt.Sprintf("%s on entry %d", name, id))
+	if err != nil {
+		return attachmentID, err
+	}
+
+	return attachmentID, nil
+}
+
+// AttachFile encrypts a file from disk and attaches it to an entry
+func (pm *PasswordManager) AttachFile(id int64, path string) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if info.IsDir() {
+		return 0, fmt.Errorf("%s is a directory", path)
+	}
+
+	return pm.AddAttachment(id, filepath.Base(path), file, info.Size())
+}
+
+// GetAttachments lists the attachments of an entry
+func (pm *PasswordManager) GetAttachments(id int64) ([]models.Attachment, error) {
+	if !pm.initialized {
+		return nil, errors.New("password manager not initialized")
+	}
+	pm.updateLastActivity()
+
+	return pm.storage.GetAttachments(id)
+}
+
+// ExtractAttachment decrypts an attachment and writes its content to w
+func (pm *PasswordManager) ExtractAttachment(attachmentID int64, w io.Writer) error {
+	if !pm.initialized {
+		return errors.New("password manager not initialized")
+	}
+	pm.updateLastActivity()
+
+	attachment, err := pm.storage.GetAttachment(attachmentID)
+	if err != nil {
+		return err
+	}
+
+	// Read the ciphertext in the background while it is decrypted
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(pm.storage.ReadAttachment(attachmentID, pw))
+	}()
+
+	err = pm.crypto.DecryptStream(w, pr, pm.masterKey)
+	pr.Close()
+	if err != nil {
+		return fmt.Errorf("failed to decrypt attachment: %w", err)
+	}
+
+	return pm.logAudit(AuditActionExport, AuditResourceAttachment, attachmentID, attachment.Name)
+}
+
+// ExtractAttachmentToFile decrypts an attachment into a new file, which is
+// removed again if decryption fails
+func (pm *PasswordManager) ExtractAttachmentToFile(attachmentID int64, path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	err = pm.ExtractAttachment(attachmentID, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	return nil
+}
+
+// DeleteAttachment permanently deletes an attachment
+func (pm *PasswordManager) DeleteAttachment(attachmentID int64) error {
+	if !pm.initialized {
+		return errors.New("password manager not initialized")
+	}
+	pm.updateLastActivity()
+
+	attachment, err := pm.storage.GetAttachment(attachmentID)
+	if err != nil {
+		return err
+	}
+
+	err = pm.storage.DeleteAttachment(attachmentID)
+	if err != nil {
+		return err
+	}
+
+	return pm.logAudit(AuditActionDelete, AuditResourceAttachment, attachmentID, attachment.Name)
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+// Read reads from the underlying reader and counts the bytes
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,168 @@
+package manager
+
+import (
+	"bytes"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+)
+
+// countRows counts the rows of a table matching a condition
+func countRows(t *testing.T, db *sql.DB, table, where string, args ...interface{}) int {
+	t.Helper()
+
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE "+where, args...).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestAddAttachment(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.db")
+	pm := newTestManagerAt(t, path)
+	db := openTestDB(t, path)
+	id, err := pm.AddPassword(models.PasswordEntry{Title: "GitHub", Password: "hunter2"})
+	if err != nil {
+		t.Fatalf("AddPassword failed: %v", err)
+	}
+
+	// Content spanning several storage chunks comes back intact
+	content := bytes.Repeat([]byte("recovery codes\n"), 200000)
+	attID, err := pm.AddAttachment(id, "codes.txt", bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("AddAttachment failed: %v", err)
+	}
+
+	attachments, err := pm.GetAttachments(id)
+	if err != nil {
+		t.Fatalf("GetAttachments failed: %v", err)
+	}
+	if len(attachments) != 1 || attachments[0].ID != attID || attachments[0].Name != "codes.txt" || attachments[0].Size != int64(len(content)) {
+		t.Fatalf("GetAttachments = %+v, want codes.txt of %d bytes", attachments, len(content))
+	}
+
+	var got bytes.Buffer
+	if err := pm.ExtractAttachment(attID, &got); err != nil {
+		t.Fatalf("ExtractAttachment failed: %v", err)
+	}
+	if !bytes.Equal(got.Bytes(), content) {
+		t.Errorf("extracted %d bytes, want the %d bytes attached", got.Len(), len(content))
+	}
+	if n := countRows(t, db, "attachment_chunks", "attachment_id = ? AND instr(data, ?) > 0", attID, "recovery codes"); n != 0 {
+		t.Errorf("%d stored chunks hold the content in the clear", n)
+	}
+
+	// The file is written to disk and never overwritten
+	out := filepath.Join(t.TempDir(), "codes.txt")
+	if err := pm.ExtractAttachmentToFile(attID, out); err != nil {
+		t.Fatalf("ExtractAttachmentToFile failed: %v", err)
+	}
+	if data, err := os.ReadFile(out); err != nil || !bytes.Equal(data, content) {
+		t.Errorf("extracted file = %d bytes, %v, want the %d bytes attached", len(data), err, len(content))
+	}
+	if err := pm.ExtractAttachmentToFile(attID, out); err == nil {
+		t.Error("ExtractAttachmentToFile overwrote an existing file")
+	}
+
+	trashed, err := pm.AddPassword(models.PasswordEntry{Title: "GitLab", Password: "gitlab1"})
+	if err != nil {
+		t.Fatalf("AddPassword failed: %v", err)
+	}
+	if err := pm.DeletePassword(trashed); err != nil {
+		t.Fatalf("DeletePassword failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		id      int64
+		file    string
+		content string
+		size    int64
+		err     string
+	}{
+		{"short content", id, "short.txt", "abc", 5, "attachment size mismatch: expected 5 bytes, read 3"},
+		{"long content", id, "long.txt", "abcdef", 5, "attachment size mismatch: expected 5 bytes, read 6"},
+		{"empty name", id, "", "abc", 3, "attachment name cannot be empty"},
+		{"duplicate name", id, "codes.txt", "abc", 3, `already has an attachment named "codes.txt"`},
+		{"entry in the trash", trashed, "codes.txt", "abc", 3, "is in the trash"},
+		{"unknown entry", id + 100, "codes.txt", "abc", 3, "no rows"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := pm.AddAttachment(tt.id, tt.file, strings.NewReader(tt.content), tt.size)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("AddAttachment error = %v, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+
+	// The rejected attachments left nothing behind
+	if attachments, err := pm.GetAttachments(id); err != nil || len(attachments) != 1 {
+		t.Errorf("GetAttachments = %+v, %v, want only codes.txt", attachments, err)
+	}
+	if attachments, err := pm.GetAttachments(trashed); err != nil || len(attachments) != 0 {
+		t.Errorf("GetAttachments of the trashed entry = %+v, %v, want none", attachments, err)
+	}
+	if n := countRows(t, db, "attachment_chunks", "attachment_id != ?", attID); n != 0 {
+		t.Errorf("%d chunks of rejected attachments were stored", n)
+	}
+}
+
+func TestDeleteAttachment(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.db")
+	pm := newTestManagerAt(t, path)
+	db := openTestDB(t, path)
+	id, err := pm.AddPassword(models.PasswordEntry{Title: "GitHub", Password: "hunter2"})
+	if err != nil {
+		t.Fatalf("AddPassword failed: %v", err)
+	}
+
+	var attIDs []int64
+	for _, name := range []string{"codes.txt", "key.pem"} {
+		attID, err := pm.AddAttachment(id, name, strings.NewReader("content of "+name), int64(len("content of "+name)))
+		if err != nil {
+			t.Fatalf("AddAttachment failed: %v", err)
+		}
+		attIDs = append(attIDs, attID)
+	}
+
+	if err := pm.DeleteAttachment(attIDs[0]); err != nil {
+		t.Fatalf("DeleteAttachment failed: %v", err)
+	}
+	attachments, err := pm.GetAttachments(id)
+	if err != nil || len(attachments) != 1 || attachments[0].Name != "key.pem" {
+		t.Errorf("GetAttachments = %+v, %v, want only key.pem", attachments, err)
+	}
+	if n := countRows(t, db, "attachment_chunks", "attachment_id = ?", attIDs[0]); n != 0 {
+		t.Errorf("%d chunks of the deleted attachment remain", n)
+	}
+	if err := pm.ExtractAttachment(attIDs[0], &bytes.Buffer{}); err == nil {
+		t.Error("ExtractAttachment of a deleted attachment succeeded")
+	}
+	if err := pm.DeleteAttachment(attIDs[0]); err == nil {
+		t.Error("DeleteAttachment of a deleted attachment succeeded")
+	}
+
+	// Trashing keeps the attachments, purging removes them with their content
+	if err := pm.DeletePassword(id); err != nil {
+		t.Fatalf("DeletePassword failed: %v", err)
+	}
+	if attachments, err := pm.GetAttachments(id); err != nil || len(attachments) != 1 {
+		t.Errorf("GetAttachments of a trashed entry = %+v, %v, want key.pem", attachments, err)
+	}
+	if err := pm.PurgePassword(id); err != nil {
+		t.Fatalf("PurgePassword failed: %v", err)
+	}
+	if n := countRows(t, db, "attachments", "password_id = ?", id); n != 0 {
+		t.Errorf("%d attachments of the purged entry remain", n)
+	}
+	if n := countRows(t, db, "attachment_chunks", "1"); n != 0 {
+		t.Errorf("%d attachment chunks remain after the purge", n)
+	}
+}
@@ -0,0 +1,180 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+)
+
+// auditKeyPurpose is the HKDF context used to derive the audit log MAC key
+const auditKeyPurpose = "passmanager audit log v1"
+
+// Audit actions recorded by the password manager
+const (
+	AuditActionCreateVault = "create_vault"
+	AuditActionUnlock      = "unlock"
+	AuditActionAdd         = "add"
+	AuditActionUpdate      = "update"
+	AuditActionDelete      = "delete"
+	AuditActionRestore     = "restore"
+	AuditActionPurge       = "purge"
+	AuditActionTag         = "tag"
+	AuditActionExport      = "export"
+	AuditActionImport      = "import"
+	AuditActionMerge       = "merge"
+)
+
+// Audit resource types
+const (
+	AuditResourceVault      = "vault"
+	AuditResourcePassword   = "password"
+	AuditResourceAttachment = "attachment"
+)
+
+// logAudit appends a record to the audit log, chained to the previous record
+func (pm *PasswordManager) logAudit(action, resourceType string, resourceID int64, details string) error {
+	key, err := pm.auditKey()
+	if err != nil {
+		return err
+	}
+
+	last, err := pm.storage.GetLastAuditLog()
+	if err != nil {
+		return fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	entry := models.AuditLogEntry{
+		Seq:          1,
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Details:      details,
+		CreatedAt:    time.Now().UTC(),
+	}
+	if last != nil {
+		entry.Seq = last.Seq + 1
+		entry.PrevMAC = last.MAC
+	}
+	entry.MAC = pm.crypto.ComputeMAC(auditMessage(&entry), key)
+
+	head := pm.crypto.ComputeMAC(auditHeadMessage(entry.Seq, entry.MAC), key)
+	if err := pm.storage.AppendAuditLog(&entry, head); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+
+	return nil
+}
+
+// VerifyAuditLog walks the audit log chain and reports the first broken link
+func (pm *PasswordManager) VerifyAuditLog() (models.AuditVerification, error) {
+	if !pm.initialized {
+		return models.AuditVerification{}, errors.New("password manager not initialized")
+	}
+	pm.updateLastActivity()
+
+	key, err := pm.auditKey()
+	if err != nil {
+		return models.AuditVerification{}, err
+	}
+
+	entries, err := pm.storage.GetAuditLog()
+	if err != nil {
+		return models.AuditVerification{}, err
+	}
+
+	result := models.AuditVerification{Valid: true}
+	broken := func(seq int64, reason string) (models.AuditVerification, error) {
+		result.Valid = false
+		result.BrokenSeq = seq
+		result.Reason = reason
+		return result, nil
+	}
+
+	var prev *models.AuditLogEntry
+	for i := range entries {
+		entry := &entries[i]
+
+		expectedSeq := int64(1)
+		var expectedPrevMAC []byte
+		if prev != nil {
+			expectedSeq = prev.Seq + 1
+			expectedPrevMAC = prev.MAC
+		}
+
+		if entry.Seq != expectedSeq {
+			return broken(expectedSeq, fmt.Sprintf("expected record %d, found record %d (row id %d)",
+				expectedSeq, entry.Seq, entry.ID))
+		}
+		if !bytes.Equal(entry.PrevMAC, expectedPrevMAC) {
+			return broken(entry.Seq, "previous MAC does not match the preceding record")
+		}
+		if !pm.crypto.VerifyMAC(auditMessage(entry), key, entry.MAC) {
+			return broken(entry.Seq, "record MAC is invalid, the record was modified")
+		}
+
+		result.Records++
+		prev = entry
+	}
+
+	// Compare against the authenticated head to detect truncation
+	head, err := pm.storage.GetAuditHead()
+	if err != nil {
+		return models.AuditVerification{}, err
+	}
+
+	// Creating or unlocking the vault is always logged, so an unlocked vault
+	// never has an empty log
+	switch {
+	case prev == nil && head == nil:
+		return broken(1, "audit log and chain head are missing, records were deleted")
+	case prev == nil:
+		return broken(1, "audit log is empty but a chain head exists, records were deleted")
+	case head == nil:
+		return broken(prev.Seq, "chain head is missing")
+	case !pm.crypto.VerifyMAC(auditHeadMessage(prev.Seq, prev.MAC), key, head):
+		return broken(prev.Seq+1, "chain head does not match the last record, trailing records were deleted")
+	}
+
+	return result, nil
+}
+
+// auditKey derives the audit log MAC key from the master key
+func (pm *PasswordManager) auditKey() ([]byte, error) {
+	key, err := pm.crypto.DeriveSubkey(pm.masterKey, auditKeyPurpose)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive audit key: %w", err)
+	}
+	return key, nil
+}
+
+// auditMessage builds the canonical byte encoding of an audit record for MAC computation
+func auditMessage(entry *models.AuditLogEntry) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, entry.Seq)
+	writeAuditField(&buf, []byte(entry.Action))
+	writeAuditField(&buf, []byte(entry.ResourceType))
+	binary.Write(&buf, binary.BigEndian, entry.ResourceID)
+	writeAuditField(&buf, []byte(entry.Details))
+	writeAuditField(&buf, []byte(entry.CreatedAt.UTC().Format(time.RFC3339Nano)))
+	writeAuditField(&buf, entry.PrevMAC)
+	return buf.Bytes()
+}
+
+// auditHeadMessage builds the message authenticated by the chain head
+func auditHeadMessage(seq int64, mac []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("head")
+	binary.Write(&buf, binary.BigEndian, seq)
+	writeAuditField(&buf, mac)
+	return buf.Bytes()
+}
+
+// writeAuditField writes a length-prefixed field so adjacent fields cannot be confused
+func writeAuditField(buf *bytes.Buffer, field []byte) {
+	binary.Write(buf, binary.BigEndian, uint32(len(field)))
+	buf.Write(field)
+}
@@ -0,0 +1,159 @@
+package manager
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// openTestDB opens a second connection to a vault database, so that tests can
+// change rows behind the password manager's back
+func openTestDB(t *testing.T, path string) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("opening %s failed: %v", path, err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// newAuditTestVault creates a vault whose audit log holds five records, the
+// creation of the vault and four additions
+func newAuditTestVault(t *testing.T) (*PasswordManager, *sql.DB) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "vault.db")
+	pm := newTestManagerAt(t, path)
+	for _, title := range []string{"one", "two", "three", "four"} {
+		if err := pm.logAudit(AuditActionAdd, AuditResourcePassword, 1, title); err != nil {
+			t.Fatalf("logAudit failed: %v", err)
+		}
+	}
+	return pm, openTestDB(t, path)
+}
+
+func TestVerifyAuditLogIntact(t *testing.T) {
+	pm, _ := newAuditTestVault(t)
+
+	result, err := pm.VerifyAuditLog()
+	if err != nil {
+		t.Fatalf("VerifyAuditLog failed: %v", err)
+	}
+	if !result.Valid || result.Records != 5 || result.BrokenSeq != 0 {
+		t.Errorf("VerifyAuditLog = %+v, want a valid chain of 5 records", result)
+	}
+
+	// Records appended after a verification extend the chain
+	if err := pm.logAudit(AuditActionDelete, AuditResourcePassword, 1, ""); err != nil {
+		t.Fatalf("logAudit failed: %v", err)
+	}
+	result, err = pm.VerifyAuditLog()
+	if err != nil {
+		t.Fatalf("VerifyAuditLog failed: %v", err)
+	}
+	if !result.Valid || result.Records != 6 {
+		t.Errorf("VerifyAuditLog = %+v, want a valid chain of 6 records", result)
+	}
+}
+
+func TestVerifyAuditLogTampered(t *testing.T) {
+	tests := []struct {
+		name      string
+		tamper    string
+		brokenSeq int64
+		reason    string
+	}{
+		{
+			name:      "edited details",
+			tamper:    "UPDATE audit_log SET details = 'forged' WHERE seq = 3",
+			brokenSeq: 3,
+			reason:    "record MAC is invalid",
+		},
+		{
+			name:      "edited action",
+			tamper:    "UPDATE audit_log SET action = 'unlock' WHERE seq = 4",
+			brokenSeq: 4,
+			reason:    "record MAC is invalid",
+		},
+		{
+			name:      "edited previous MAC",
+			tamper:    "UPDATE audit_log SET prev_mac = x'00' WHERE seq = 2",
+			brokenSeq: 2,
+			reason:    "previous MAC does not match",
+		},
+		{
+			name:      "deleted middle record",
+			tamper:    "DELETE FROM audit_log WHERE seq = 3",
+			brokenSeq: 3,
+			reason:    "expected record 3, found record 4",
+		},
+		{
+			name:      "deleted first record",
+			tamper:    "DELETE FROM audit_log WHERE seq = 1",
+			brokenSeq: 1,
+			reason:    "expected record 1, found record 2",
+		},
+		{
+			name:      "truncated tail",
+			tamper:    "DELETE FROM audit_log WHERE seq >= 4",
+			brokenSeq: 4,
+			reason:    "trailing records were deleted",
+		},
+		{
+			name:      "forged chain head",
+			tamper:    "UPDATE config SET value = x'00' WHERE key = 'audit_head'",
+			brokenSeq: 6,
+			reason:    "chain head does not match the last record",
+		},
+		{
+			name:      "deleted chain head",
+			tamper:    "DELETE FROM config WHERE key = 'audit_head'",
+			brokenSeq: 5,
+			reason:    "chain head is missing",
+		},
+		{
+			name:      "emptied log",
+			tamper:    "DELETE FROM audit_log",
+			brokenSeq: 1,
+			reason:    "audit log is empty but a chain head exists",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm, db := newAuditTestVault(t)
+			if _, err := db.Exec(tt.tamper); err != nil {
+				t.Fatalf("tampering failed: %v", err)
+			}
+
+			result, err := pm.VerifyAuditLog()
+			if err != nil {
+				t.Fatalf("VerifyAuditLog failed: %v", err)
+			}
+			if result.Valid || result.BrokenSeq != tt.brokenSeq || !strings.Contains(result.Reason, tt.reason) {
+				t.Errorf("VerifyAuditLog = %+v, want record %d broken with %q", result, tt.brokenSeq, tt.reason)
+			}
+		})
+	}
+}
+
+func TestVerifyAuditLogEmptyWithoutHead(t *testing.T) {
+	pm, db := newAuditTestVault(t)
+	if _, err := db.Exec("DELETE FROM audit_log"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("DELETE FROM config WHERE key = 'audit_head'"); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := pm.VerifyAuditLog()
+	if err != nil {
+		t.Fatalf("VerifyAuditLog failed: %v", err)
+	}
+	if result.Valid || result.BrokenSeq != 1 || !strings.Contains(result.Reason, "chain head are missing") {
+		t.Errorf("VerifyAuditLog = %+v, want an empty log without a head reported as broken", result)
+	}
+}
@@ -0,0 +1,330 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+	"github.com/loganmanery/passmanager/pkg/urlmatch"
+)
+
+// Bitwarden item types
+const (
+	bitwardenLogin      = 1
+	bitwardenSecureNote = 2
+	bitwardenCard       = 3
+	bitwardenIdentity   = 4
+	bitwardenSSHKey     = 5
+)
+
+// Bitwarden custom field types
+const (
+	bitwardenFieldText    = 0
+	bitwardenFieldHidden  = 1
+	bitwardenFieldBoolean = 2
+	bitwardenFieldLinked  = 3
+)
+
+// bitwardenURIMatches maps Bitwarden URI match detection to URL match modes
+var bitwardenURIMatches = map[int]string{
+	0: urlmatch.ModeDomain,
+	1: urlmatch.ModeHost,
+	2: urlmatch.ModePrefix,
+	3: urlmatch.ModeExact,
+	4: urlmatch.ModeRegex,
+	5: urlmatch.ModeNever,
+}
+
+// bitwardenExport is an unencrypted Bitwarden JSON export, personal or
+// organization
+type bitwardenExport struct {
+	Encrypted   bool              `json:"encrypted"`
+	Folders     []bitwardenFolder `json:"folders"`
+	Collections []bitwardenFolder `json:"collections"`
+	Items       []bitwardenItem   `json:"items"`
+}
+
+// bitwardenFolder is a folder or an organization collection
+type bitwardenFolder struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// bitwardenItem is an item of a Bitwarden export
+type bitwardenItem struct {
+	ID              string                 `json:"id"`
+	FolderID        string                 `json:"folderId"`
+	CollectionIDs   []string               `json:"collectionIds"`
+	Type            int                    `json:"type"`
+	Name            string                 `json:"name"`
+	Notes           string                 `json:"notes"`
+	Fields          []bitwardenField       `json:"fields"`
+	Login           *bitwardenLoginData    `json:"login"`
+	Card            *bitwardenCardData     `json:"card"`
+	Identity        *bitwardenIdentityData `json:"identity"`
+	SSHKey          *bitwardenSSHKeyData   `json:"sshKey"`
+	PasswordHistory []bitwardenHistory     `json:"passwordHistory"`
+	CreationDate    time.Time              `json:"creationDate"`
+	RevisionDate    time.Time              `json:"revisionDate"`
+}
+
+// bitwardenHistory is a previous password of a Bitwarden item and when it
+// was last used, that is when it was replaced
+type bitwardenHistory struct {
+	Password     string    `json:"password"`
+	LastUsedDate time.Time `json:"lastUsedDate"`
+}
+
+// bitwardenField is a custom field of a Bitwarden item
+type bitwardenField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Type  int    `json:"type"`
+}
+
+// bitwardenLoginData holds the login of a Bitwarden item
+type bitwardenLoginData struct {
+	URIs []struct {
+		URI   string `json:"uri"`
+		Match *int   `json:"match"`
+	} `json:"uris"`
+	Username         string            `json:"username"`
+	Password         string            `json:"password"`
+	TOTP             string            `json:"totp"`
+	FIDO2Credentials []json.RawMessage `json:"fido2Credentials"`
+}
+
+// bitwardenCardData holds the card of a Bitwarden item
+type bitwardenCardData struct {
+	CardholderName string `json:"cardholderName"`
+	Brand          string `json:"brand"`
+	Number         string `json:"number"`
+	ExpMonth       string `json:"expMonth"`
+	ExpYear        string `json:"expYear"`
+	Code           string `json:"code"`
+}
+
+// bitwardenIdentityData holds the identity of a Bitwarden item
+type bitwardenIdentityData struct {
+	FirstName      string `json:"firstName"`
+	MiddleName     string `json:"middleName"`
+	LastName       string `json:"lastName"`
+	Address1       string `json:"address1"`
+	Address2       string `json:"address2"`
+	Address3       string `json:"address3"`
+	City           string `json:"city"`
+	State          string `json:"state"`
+	PostalCode     string `json:"postalCode"`
+	Country        string `json:"country"`
+	Company        string `json:"company"`
+	Email          string `json:"email"`
+	Phone          string `json:"phone"`
+	SSN            string `json:"ssn"`
+	Username       string `json:"username"`
+	PassportNumber string `json:"passportNumber"`
+	LicenseNumber  string `json:"licenseNumber"`
+}
+
+// bitwardenSSHKeyData holds the SSH key of a Bitwarden item
+type bitwardenSSHKeyData struct {
+	PrivateKey string `json:"privateKey"`
+	PublicKey  string `json:"publicKey"`
+}
+
+// ReadBitwarden reads an unencrypted Bitwarden JSON export. Logins, secure
+// notes, cards, identities and SSH keys become entries of the matching type,
+// folders become categories, organization collections become tags, and custom
+// fields, TOTP secrets and password history are kept. Bitwarden item IDs are kept as UUIDs, so
+// importing a newer export in merge mode updates the entries. Items that
+// cannot be imported are skipped with a warning in the report.
+func (pm *PasswordManager) ReadBitwarden(filename string) (*ImportSource, error) {
+	if !pm.initialized {
+		return nil, errors.New("password manager not initialized")
+	}
+	pm.updateLastActivity()
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var export bitwardenExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("invalid Bitwarden export: %w", err)
+	}
+	if export.Encrypted {
+		return nil, errors.New("encrypted Bitwarden exports are not supported; export as unencrypted JSON")
+	}
+
+	folders := make(map[string]string, len(export.Folders))
+	for _, folder := range export.Folders {
+		folders[folder.ID] = folder.Name
+	}
+	collections := make(map[string]string, len(export.Collections))
+	for _, collection := range export.Collections {
+		collections[collection.ID] = collection.Name
+	}
+
+	var warnings importWarnings
+	var entries []models.ExportEntry
+	for _, item := range export.Items {
+		entry, err := bitwardenEntry(item, folders, collections, &warnings)
+		var encrypted models.ExportEntry
+		if err == nil {
+			encrypted, err = pm.encryptImported(entry)
+		}
+		if err == nil {
+			encrypted.History, err = pm.encryptImportedHistory(bitwardenPasswordHistory(item))
+		}
+		if err != nil {
+			warnings.warnf("skipped %q: %v", item.Name, err)
+			continue
+		}
+		entries = append(entries, encrypted)
+	}
+
+	return pm.importSource("bitwarden", entries, warnings), nil
+}
+
+// bitwardenEntry converts a Bitwarden item to an entry, adding warnings for
+// the parts of it that cannot be imported
+func bitwardenEntry(item bitwardenItem, folders, collections map[string]string, warnings *importWarnings) (models.PasswordEntry, error) {
+	entry := models.PasswordEntry{
+		UUID:        item.ID,
+		Title:       item.Name,
+		Notes:       item.Notes,
+		Category:    folders[item.FolderID],
+		CreatedAt:   item.CreationDate,
+		LastUpdated: item.RevisionDate,
+	}
+
+	for _, id := range item.CollectionIDs {
+		if name := collections[id]; name != "" {
+			entry.Tags = append(entry.Tags, strings.ReplaceAll(name, ",", " "))
+		}
+	}
+
+	switch item.Type {
+	case bitwardenLogin:
+		entry.Type = models.ItemTypeLogin
+		if login := item.Login; login != nil {
+			entry.Username = login.Username
+			entry.Password = login.Password
+			entry.TOTP = login.TOTP
+			for i, uri := range login.URIs {
+				if i == 0 {
+					entry.URL = uri.URI
+					if uri.Match != nil {
+						entry.URLMatch = bitwardenURIMatches[*uri.Match]
+					}
+					// Bitwarden patterns are JavaScript regular expressions,
+					// which RE2 does not always accept
+					if entry.URLMatch == urlmatch.ModeRegex && normalizeURLMatch(&entry) != nil {
+						warnings.warnf("URL pattern of %q is not a valid regular expression and matches by domain instead", item.Name)
+						entry.URLMatch = urlmatch.ModeDomain
+					}
+					continue
+				}
+				entry.CustomFields = append(entry.CustomFields, models.CustomField{
+					Name:  uniqueFieldName(entry.CustomFields, "URL "+strconv.Itoa(i+1)),
+					Type:  models.FieldTypeURL,
+					Value: uri.URI,
+				})
+			}
+			if len(login.FIDO2Credentials) > 0 {
+				warnings.warnf("passkeys of %q were not imported", item.Name)
+			}
+		}
+	case bitwardenSecureNote:
+		entry.Type = models.ItemTypeSecureNote
+	case bitwardenCard:
+		entry.Type = models.ItemTypeCard
+		if card := item.Card; card != nil {
+			entry.Card = &models.CardData{
+				CardholderName: card.CardholderName,
+				Brand:          card.Brand,
+				Number:         card.Number,
+				CVV:            card.Code,
+			}
+			entry.Card.ExpiryMonth, _ = strconv.Atoi(strings.TrimSpace(card.ExpMonth))
+			entry.Card.ExpiryYear, _ = strconv.Atoi(strings.TrimSpace(card.ExpYear))
+		}
+	case bitwardenIdentity:
+		entry.Type = models.ItemTypeIdentity
+		if identity := item.Identity; identity != nil {
+			entry.Username = identity.Username
+			address2 := identity.Address2
+			if identity.Address3 != "" {
+				address2 = strings.TrimPrefix(address2+", "+identity.Address3, ", ")
+			}
+			entry.Identity = &models.IdentityData{
+				FirstName:      identity.FirstName,
+				MiddleName:     identity.MiddleName,
+				LastName:       identity.LastName,
+				Company:        identity.Company,
+				Email:          identity.Email,
+				Phone:          identity.Phone,
+				Address1:       identity.Address1,
+				Address2:       address2,
+				City:           identity.City,
+				State:          identity.State,
+				PostalCode:     identity.PostalCode,
+				Country:        identity.Country,
+				SSN:            identity.SSN,
+				PassportNumber: identity.PassportNumber,
+				LicenseNumber:  identity.LicenseNumber,
+			}
+		}
+	case bitwardenSSHKey:
+		entry.Type = models.ItemTypeSSHKey
+		if key := item.SSHKey; key != nil {
+			entry.SSHKey = &models.SSHKeyData{PrivateKey: key.PrivateKey, PublicKey: key.PublicKey}
+		}
+	default:
+		return models.PasswordEntry{}, fmt.Errorf("unsupported item type %d", item.Type)
+	}
+
+	for i, field := range item.Fields {
+		name := strings.TrimSpace(field.Name)
+		if name == "" {
+			name = "Field " + strconv.Itoa(i+1)
+		}
+
+		custom := models.CustomField{Name: uniqueFieldName(entry.CustomFields, name), Type: models.FieldTypeText, Value: field.Value}
+		switch field.Type {
+		case bitwardenFieldText, bitwardenFieldBoolean:
+		case bitwardenFieldHidden:
+			custom.Type = models.FieldTypeHidden
+		case bitwardenFieldLinked:
+			// Linked fields only point at another field of the item
+			continue
+		default:
+			warnings.warnf("field %q of %q has unsupported type %d and was imported as text", name, item.Name, field.Type)
+		}
+		entry.CustomFields = append(entry.CustomFields, custom)
+	}
+
+	return entry, nil
+}
+
+// bitwardenPasswordHistory returns the previous passwords of a Bitwarden
+// item, dated by the revision of the item when they have no date
+func bitwardenPasswordHistory(item bitwardenItem) []models.PasswordHistoryEntry {
+	var history []models.PasswordHistoryEntry
+	for _, record := range item.PasswordHistory {
+		if record.Password == "" {
+			continue
+		}
+		replaced := record.LastUsedDate
+		if replaced.IsZero() {
+			replaced = item.RevisionDate
+		}
+		history = append(history, models.PasswordHistoryEntry{Password: record.Password, CreatedAt: replaced})
+	}
+	return history
+}
@@ -0,0 +1,104 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/loganmanery/passmanager/pkg/urlmatch"
+)
+
+const testBitwardenExport = `{
+  "encrypted": false,
+  "folders": [],
+  "items": [
+    {
+      "id": "2b7c6c0e-0d4c-4d7e-9a43-5d0c1b6d2a11",
+      "type": 1,
+      "name": "GitHub",
+      "login": {
+        "uris": [{"uri": "^https://(?!gist)[a-z]+\\.github\\.com/", "match": 4}],
+        "username": "octocat",
+        "password": "hunter3"
+      },
+      "passwordHistory": [
+        {"lastUsedDate": "2024-03-01T10:00:00.000Z", "password": "hunter2"},
+        {"lastUsedDate": "2023-01-15T08:30:00.000Z", "password": "hunter1"}
+      ],
+      "creationDate": "2022-06-01T12:00:00.000Z",
+      "revisionDate": "2024-03-01T10:00:00.000Z"
+    },
+    {
+      "id": "9d3e8f4a-6b1c-4e2d-8f7a-1c2b3d4e5f60",
+      "type": 1,
+      "name": "GitLab",
+      "login": {
+        "uris": [{"uri": "^https://gitlab\\.com/", "match": 4}],
+        "password": "s3cret"
+      },
+      "creationDate": "2022-06-01T12:00:00.000Z",
+      "revisionDate": "2022-06-01T12:00:00.000Z"
+    }
+  ]
+}`
+
+func TestReadBitwarden(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "bitwarden.json")
+	if err := os.WriteFile(filename, []byte(testBitwardenExport), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	pm := newTestManager(t)
+	src, err := pm.ReadBitwarden(filename)
+	if err != nil {
+		t.Fatalf("ReadBitwarden failed: %v", err)
+	}
+	report, err := src.Import(ImportOptions{Mode: ImportModeAppend})
+	if err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+	if report.Added != 2 {
+		t.Errorf("report = %s, want 2 added", report)
+	}
+
+	// Lookahead is not RE2, so the pattern falls back to domain matching
+	// instead of skipping the item
+	wantWarnings := []string{`URL pattern of "GitHub" is not a valid regular expression and matches by domain instead`}
+	if !reflect.DeepEqual(report.Warnings, wantWarnings) {
+		t.Errorf("warnings = %q, want %q", report.Warnings, wantWarnings)
+	}
+
+	github, err := pm.GetPasswordByUUID("2b7c6c0e-0d4c-4d7e-9a43-5d0c1b6d2a11")
+	if err != nil {
+		t.Fatalf("GetPasswordByUUID failed: %v", err)
+	}
+	if github.URLMatch != urlmatch.ModeDomain {
+		t.Errorf("URL match = %q, want %q", github.URLMatch, urlmatch.ModeDomain)
+	}
+	gitlab, err := pm.GetPasswordByUUID("9d3e8f4a-6b1c-4e2d-8f7a-1c2b3d4e5f60")
+	if err != nil {
+		t.Fatalf("GetPasswordByUUID failed: %v", err)
+	}
+	if gitlab.URLMatch != urlmatch.ModeRegex {
+		t.Errorf("URL match = %q, want %q", gitlab.URLMatch, urlmatch.ModeRegex)
+	}
+
+	history, err := pm.GetPasswordHistory(github.ID)
+	if err != nil {
+		t.Fatalf("GetPasswordHistory failed: %v", err)
+	}
+	want := map[string]time.Time{
+		"hunter2": time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+		"hunter1": time.Date(2023, 1, 15, 8, 30, 0, 0, time.UTC),
+	}
+	if len(history) != len(want) {
+		t.Fatalf("got %d history records, want %d", len(history), len(want))
+	}
+	for _, record := range history {
+		if replaced, ok := want[record.Password]; !ok || !record.CreatedAt.Equal(replaced) {
+			t.Errorf("history record %q at %v, want one of %v", record.Password, record.CreatedAt, want)
+		}
+	}
+}
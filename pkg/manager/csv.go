@@ -0,0 +1,427 @@
+package manager
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+	"github.com/loganmanery/passmanager/pkg/otp"
+)
+
+// Entry fields that CSV columns can be mapped to
+const (
+	CSVFieldTitle    = "title"
+	CSVFieldURL      = "url"
+	CSVFieldUsername = "username"
+	CSVFieldPassword = "password"
+	CSVFieldNotes    = "notes"
+	CSVFieldTOTP     = "totp"
+	CSVFieldCategory = "category"
+	CSVFieldTags     = "tags"
+)
+
+// CSVFields lists the entry fields CSV columns can be mapped to
+var CSVFields = []string{
+	CSVFieldTitle,
+	CSVFieldURL,
+	CSVFieldUsername,
+	CSVFieldPassword,
+	CSVFieldNotes,
+	CSVFieldTOTP,
+	CSVFieldCategory,
+	CSVFieldTags,
+}
+
+// CSV presets for the formats of browsers and other password managers
+const (
+	CSVPresetChrome      = "chrome"
+	CSVPresetFirefox     = "firefox"
+	CSVPresetOnePassword = "1password"
+	CSVPresetLastPass    = "lastpass"
+)
+
+// lastPassSecureNoteURL is the URL LastPass exports secure notes with
+const lastPassSecureNoteURL = "http://sn"
+
+// csvColumn is a column of a CSV file. Columns without a field are ignored on
+// import and left empty on export. A required column must be in the header
+// of an imported file.
+type csvColumn struct {
+	header   string
+	field    string
+	required bool
+}
+
+// csvPresets lists the columns of each preset in file order
+var csvPresets = map[string][]csvColumn{
+	CSVPresetChrome: {
+		{header: "name", field: CSVFieldTitle},
+		{header: "url", field: CSVFieldURL},
+		{header: "username", field: CSVFieldUsername},
+		{header: "password", field: CSVFieldPassword, required: true},
+		{header: "note", field: CSVFieldNotes},
+	},
+	CSVPresetFirefox: {
+		{header: "url", field: CSVFieldURL, required: true},
+		{header: "username", field: CSVFieldUsername},
+		{header: "password", field: CSVFieldPassword, required: true},
+		{header: "httpRealm"},
+		{header: "formActionOrigin"},
+		{header: "guid"},
+		{header: "timeCreated"},
+		{header: "timeLastUsed"},
+		{header: "timePasswordChanged"},
+	},
+	CSVPresetOnePassword: {
+		{header: "Title", field: CSVFieldTitle},
+		{header: "Url", field: CSVFieldURL},
+		{header: "Username", field: CSVFieldUsername},
+		{header: "Password", field: CSVFieldPassword, required: true},
+		{header: "OTPAuth", field: CSVFieldTOTP},
+		{header: "Favorite"},
+		{header: "Archived"},
+		{header: "Tags", field: CSVFieldTags},
+		{header: "Notes", field: CSVFieldNotes},
+	},
+	CSVPresetLastPass: {
+		{header: "url", field: CSVFieldURL},
+		{header: "username", field: CSVFieldUsername},
+		{header: "password", field: CSVFieldPassword, required: true},
+		{header: "totp", field: CSVFieldTOTP},
+		{header: "extra", field: CSVFieldNotes},
+		{header: "name", field: CSVFieldTitle},
+		{header: "grouping", field: CSVFieldCategory},
+		{header: "fav"},
+	},
+}
+
+// CSVFormat selects the columns of a CSV file: a preset, and Columns mapping
+// entry fields to column headers. The mapping overrides the columns of the
+// preset and can be used without one for other CSV files.
+type CSVFormat struct {
+	Preset  string
+	Columns map[string]string
+}
+
+// columns returns the columns of the format in file order
+func (f CSVFormat) columns() ([]csvColumn, error) {
+	var columns []csvColumn
+	if f.Preset != "" {
+		preset, ok := csvPresets[strings.ToLower(f.Preset)]
+		if !ok {
+			return nil, fmt.Errorf("unknown CSV preset %q", f.Preset)
+		}
+		columns = append(columns, preset...)
+	}
+
+	for field := range f.Columns {
+		if !isCSVField(field) {
+			return nil, fmt.Errorf("unknown CSV field %q", field)
+		}
+	}
+
+	for _, field := range CSVFields {
+		header := strings.TrimSpace(f.Columns[field])
+		if header == "" {
+			continue
+		}
+
+		// A mapped field replaces the column of the preset
+		mapped := false
+		for i := range columns {
+			if columns[i].field == field {
+				columns[i].field = ""
+			}
+			if strings.EqualFold(columns[i].header, header) {
+				columns[i].field = field
+				columns[i].required = true
+				mapped = true
+			}
+		}
+		if !mapped {
+			columns = append(columns, csvColumn{header: header, field: field, required: true})
+		}
+	}
+
+	if len(columns) == 0 {
+		return nil, errors.New("no CSV preset or column mapping given")
+	}
+	for _, column := range columns {
+		if column.field == CSVFieldPassword {
+			return columns, nil
+		}
+	}
+	return nil, errors.New("no column is mapped to the password")
+}
+
+// isCSVField reports whether field is an entry field CSV columns can be mapped to
+func isCSVField(field string) bool {
+	for _, f := range CSVFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadCSV reads a CSV file exported from a browser or another password
+// manager, with the columns selected by the format. Every row becomes a login,
+// or a secure note for LastPass secure notes; rows without a title are named
+// after the host of their URL. CSV files carry no entry IDs, so every row is
+// added, even in merge mode. Rows that cannot be imported are skipped with a
+// warning in the report.
+func (pm *PasswordManager) ReadCSV(filename string, format CSVFormat) (*ImportSource, error) {
+	if !pm.initialized {
+		return nil, errors.New("password manager not initialized")
+	}
+	pm.updateLastActivity()
+
+	columns, err := format.columns()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Spreadsheet programs often start the file with a byte order mark
+	buffered := bufio.NewReader(file)
+	if bom, _ := buffered.Peek(3); string(bom) == "\xef\xbb\xbf" {
+		buffered.Discard(3)
+	}
+
+	reader := csv.NewReader(buffered)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV file: %w", err)
+	}
+
+	index := make(map[string]int)
+	for _, column := range columns {
+		if column.field == "" {
+			continue
+		}
+
+		found := false
+		for i, name := range header {
+			if strings.EqualFold(strings.TrimSpace(name), column.header) {
+				index[column.field] = i
+				found = true
+				break
+			}
+		}
+		if !found && column.required {
+			return nil, fmt.Errorf("CSV file has no %q column", column.header)
+		}
+	}
+
+	var warnings importWarnings
+	var entries []models.ExportEntry
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV file: %w", err)
+		}
+
+		entry, ok := csvEntry(record, index, strings.ToLower(format.Preset), row, &warnings)
+		if !ok {
+			continue
+		}
+
+		encrypted, err := pm.encryptImported(entry)
+		if err != nil {
+			warnings.warnf("skipped row %d: %v", row, err)
+			continue
+		}
+		entries = append(entries, encrypted)
+	}
+
+	return pm.importSource("csv", entries, warnings), nil
+}
+
+// csvEntry converts a CSV row to an entry, adding warnings for the parts of
+// it that cannot be imported. Empty rows are skipped.
+func csvEntry(record []string, index map[string]int, preset string, row int, warnings *importWarnings) (models.PasswordEntry, bool) {
+	value := func(field string) string {
+		i, ok := index[field]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return record[i]
+	}
+
+	empty := true
+	for _, v := range record {
+		if strings.TrimSpace(v) != "" {
+			empty = false
+			break
+		}
+	}
+	if empty {
+		return models.PasswordEntry{}, false
+	}
+
+	// Passwords and notes are kept as they are, spaces included
+	entry := models.PasswordEntry{
+		Type:     models.ItemTypeLogin,
+		Title:    strings.TrimSpace(value(CSVFieldTitle)),
+		URL:      strings.TrimSpace(value(CSVFieldURL)),
+		Username: strings.TrimSpace(value(CSVFieldUsername)),
+		Password: value(CSVFieldPassword),
+		Notes:    value(CSVFieldNotes),
+		Category: strings.TrimSpace(value(CSVFieldCategory)),
+		Tags:     strings.FieldsFunc(value(CSVFieldTags), func(r rune) bool { return r == ',' || r == ';' }),
+	}
+
+	if preset == CSVPresetLastPass {
+		if entry.URL == lastPassSecureNoteURL {
+			entry.Type = models.ItemTypeSecureNote
+			entry.URL = ""
+		}
+		// LastPass separates nested folders with backslashes
+		entry.Category = strings.ReplaceAll(entry.Category, `\`, "/")
+	}
+
+	if entry.Title == "" {
+		entry.Title = csvHost(entry.URL)
+	}
+	if entry.Title == "" {
+		entry.Title = entry.Username
+	}
+
+	if secret := strings.TrimSpace(value(CSVFieldTOTP)); secret != "" {
+		if _, err := otp.Parse(secret); err != nil {
+			warnings.warnf("one-time password of row %d was not imported: %v", row, err)
+		} else {
+			entry.TOTP = secret
+		}
+	}
+
+	return entry, true
+}
+
+// csvHost returns the host name of a URL, which may lack a scheme
+func csvHost(rawURL string) string {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// ExportCSV exports every entry outside the trash to a CSV file with the
+// columns selected by the format, returning the number of entries written.
+// The file holds every password in plaintext. Only the fields mapped to
+// columns are written, so the type-specific data of cards, identities and
+// other items is left out.
+func (pm *PasswordManager) ExportCSV(filename string, format CSVFormat) (int, error) {
+	if !pm.initialized {
+		return 0, errors.New("password manager not initialized")
+	}
+	pm.updateLastActivity()
+
+	columns, err := format.columns()
+	if err != nil {
+		return 0, err
+	}
+
+	summaries, err := pm.GetAllPasswords()
+	if err != nil {
+		return 0, err
+	}
+
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, err
+	}
+
+	err = pm.writeCSV(file, summaries, columns, strings.ToLower(format.Preset))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(filename)
+		return 0, err
+	}
+
+	return len(summaries), pm.logAudit(AuditActionExport, AuditResourceVault, 0, fmt.Sprintf("csv: %d entries", len(summaries)))
+}
+
+// writeCSV writes the header and a row for every entry
+func (pm *PasswordManager) writeCSV(w io.Writer, summaries []models.PasswordEntry, columns []csvColumn, preset string) error {
+	writer := csv.NewWriter(w)
+
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.header
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, summary := range summaries {
+		entry, err := pm.GetPassword(summary.ID)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt %q: %w", summary.Title, err)
+		}
+
+		if preset == CSVPresetLastPass {
+			if entry.Type == models.ItemTypeSecureNote {
+				entry.URL = lastPassSecureNoteURL
+			}
+			entry.Category = strings.ReplaceAll(entry.Category, "/", `\`)
+		}
+
+		record := make([]string, len(columns))
+		for i, column := range columns {
+			record[i] = csvValue(entry, column.field)
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvValue returns the value of an entry field
+func csvValue(entry models.PasswordEntry, field string) string {
+	switch field {
+	case CSVFieldTitle:
+		return entry.Title
+	case CSVFieldURL:
+		return entry.URL
+	case CSVFieldUsername:
+		return entry.Username
+	case CSVFieldPassword:
+		return entry.Password
+	case CSVFieldNotes:
+		return entry.Notes
+	case CSVFieldTOTP:
+		return entry.TOTP
+	case CSVFieldCategory:
+		return entry.Category
+	case CSVFieldTags:
+		return strings.Join(entry.Tags, ",")
+	default:
+		return ""
+	}
+}
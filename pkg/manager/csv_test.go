@@ -0,0 +1,286 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+)
+
+// csvTestEntry holds the entry fields a CSV file can carry
+type csvTestEntry struct {
+	Type, Title, URL, Username, Password, Notes, TOTP, Category string
+	Tags                                                        []string
+}
+
+// writeCSVFile writes a CSV file to a temporary directory
+func writeCSVFile(t *testing.T, content string) string {
+	t.Helper()
+
+	filename := filepath.Join(t.TempDir(), "passwords.csv")
+	if err := os.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+// vaultCSVEntries returns the entries of a vault sorted by title
+func vaultCSVEntries(t *testing.T, pm *PasswordManager) []csvTestEntry {
+	t.Helper()
+
+	summaries, err := pm.GetAllPasswords()
+	if err != nil {
+		t.Fatalf("GetAllPasswords failed: %v", err)
+	}
+
+	var result []csvTestEntry
+	for _, summary := range summaries {
+		entry, err := pm.GetPassword(summary.ID)
+		if err != nil {
+			t.Fatalf("GetPassword failed: %v", err)
+		}
+		result = append(result, csvTestEntry{
+			Type: entry.Type, Title: entry.Title, URL: entry.URL, Username: entry.Username, Password: entry.Password,
+			Notes: entry.Notes, TOTP: entry.TOTP, Category: entry.Category, Tags: entry.Tags,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Title < result[j].Title })
+	return result
+}
+
+// importCSV reads a CSV file into a new vault and returns its entries and
+// the warnings of the import
+func importCSV(t *testing.T, filename string, format CSVFormat) ([]csvTestEntry, []string) {
+	t.Helper()
+
+	pm := newTestManager(t)
+	src, err := pm.ReadCSV(filename, format)
+	if err != nil {
+		t.Fatalf("ReadCSV failed: %v", err)
+	}
+	report, err := src.Import(ImportOptions{Mode: ImportModeAppend})
+	if err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+	return vaultCSVEntries(t, pm), report.Warnings
+}
+
+const csvTestTOTP = "otpauth://totp/GitHub?secret=JBSWY3DPEHPK3PXP"
+
+func TestReadCSVPresets(t *testing.T) {
+	tests := []struct {
+		preset string
+		csv    string
+		want   []csvTestEntry
+	}{
+		{
+			preset: CSVPresetChrome,
+			csv: "name,url,username,password,note\n" +
+				"GitHub,https://github.com/login,octocat,hunter2,Recovery codes\n" +
+				",https://example.com/,bob, spaces kept ,\n",
+			want: []csvTestEntry{
+				{Type: models.ItemTypeLogin, Title: "GitHub", URL: "https://github.com/login", Username: "octocat", Password: "hunter2", Notes: "Recovery codes"},
+				{Type: models.ItemTypeLogin, Title: "example.com", URL: "https://example.com/", Username: "bob", Password: " spaces kept "},
+			},
+		},
+		{
+			preset: CSVPresetFirefox,
+			csv: `"url","username","password","httpRealm","formActionOrigin","guid","timeCreated","timeLastUsed","timePasswordChanged"` + "\n" +
+				`"https://github.com","octocat","hunter2",,"https://github.com","{0b5d}","1700000000000","1700000000000","1700000000000"` + "\n",
+			want: []csvTestEntry{
+				{Type: models.ItemTypeLogin, Title: "github.com", URL: "https://github.com", Username: "octocat", Password: "hunter2"},
+			},
+		},
+		{
+			preset: CSVPresetOnePassword,
+			csv: "Title,Url,Username,Password,OTPAuth,Favorite,Archived,Tags,Notes\n" +
+				"GitHub,https://github.com/,octocat,hunter2," + csvTestTOTP + ",true,false,\"dev,prod\",\"Line one\nLine two\"\n",
+			want: []csvTestEntry{
+				{Type: models.ItemTypeLogin, Title: "GitHub", URL: "https://github.com/", Username: "octocat", Password: "hunter2",
+					Notes: "Line one\nLine two", TOTP: csvTestTOTP, Tags: []string{"dev", "prod"}},
+			},
+		},
+		{
+			preset: CSVPresetLastPass,
+			csv: "url,username,password,totp,extra,name,grouping,fav\n" +
+				"https://github.com/,octocat,hunter2,JBSWY3DPEHPK3PXP,,GitHub,Work\\Dev,0\n" +
+				"http://sn,,,,Guest network: hello,Wifi,Home,0\n",
+			want: []csvTestEntry{
+				{Type: models.ItemTypeLogin, Title: "GitHub", URL: "https://github.com/", Username: "octocat", Password: "hunter2",
+					TOTP: "JBSWY3DPEHPK3PXP", Category: "Work/Dev"},
+				{Type: models.ItemTypeSecureNote, Title: "Wifi", Notes: "Guest network: hello", Category: "Home"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.preset, func(t *testing.T) {
+			got, warnings := importCSV(t, writeCSVFile(t, tt.csv), CSVFormat{Preset: tt.preset})
+			if len(warnings) != 0 {
+				t.Errorf("warnings = %q", warnings)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("imported %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadCSVByteOrderMark(t *testing.T) {
+	filename := writeCSVFile(t, "\xef\xbb\xbfname,url,username,password,note\nGitHub,,octocat,hunter2,\n")
+	got, _ := importCSV(t, filename, CSVFormat{Preset: "Chrome"})
+	want := []csvTestEntry{{Type: models.ItemTypeLogin, Title: "GitHub", Username: "octocat", Password: "hunter2"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("imported %+v, want %+v", got, want)
+	}
+}
+
+func TestReadCSVColumnMapping(t *testing.T) {
+	tests := []struct {
+		name   string
+		csv    string
+		format CSVFormat
+		want   []csvTestEntry
+	}{
+		{
+			name: "mapping without preset",
+			csv:  "Site,Login,Secret,Folder,Ignored\nGitHub,octocat,hunter2,Work,x\n",
+			format: CSVFormat{Columns: map[string]string{
+				CSVFieldTitle: "site", CSVFieldUsername: "Login", CSVFieldPassword: "Secret", CSVFieldCategory: "Folder",
+			}},
+			want: []csvTestEntry{{Type: models.ItemTypeLogin, Title: "GitHub", Username: "octocat", Password: "hunter2", Category: "Work"}},
+		},
+		{
+			name:   "mapping overrides preset",
+			csv:    "name,url,username,password,note,comments\nGitHub,,octocat,hunter2,ignored,Recovery codes\n",
+			format: CSVFormat{Preset: CSVPresetChrome, Columns: map[string]string{CSVFieldNotes: "comments"}},
+			want:   []csvTestEntry{{Type: models.ItemTypeLogin, Title: "GitHub", Username: "octocat", Password: "hunter2", Notes: "Recovery codes"}},
+		},
+		{
+			name:   "mapping onto another preset column",
+			csv:    "name,url,username,password,note\nGitHub,,octocat,hunter2,Work\n",
+			format: CSVFormat{Preset: CSVPresetChrome, Columns: map[string]string{CSVFieldCategory: "note"}},
+			want:   []csvTestEntry{{Type: models.ItemTypeLogin, Title: "GitHub", Username: "octocat", Password: "hunter2", Category: "Work"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := importCSV(t, writeCSVFile(t, tt.csv), tt.format)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("imported %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadCSVRejects(t *testing.T) {
+	pm := newTestManager(t)
+	tests := []struct {
+		name   string
+		csv    string
+		format CSVFormat
+		err    string
+	}{
+		{"missing required column", "name,url,username\nGitHub,,octocat\n", CSVFormat{Preset: CSVPresetChrome}, `CSV file has no "password" column`},
+		{"missing mapped column", "name,url,username,password\n", CSVFormat{Preset: CSVPresetChrome, Columns: map[string]string{CSVFieldTags: "labels"}}, `CSV file has no "labels" column`},
+		{"unknown preset", "", CSVFormat{Preset: "netscape"}, `unknown CSV preset "netscape"`},
+		{"unknown field", "", CSVFormat{Columns: map[string]string{"pin": "PIN"}}, `unknown CSV field "pin"`},
+		{"no format", "", CSVFormat{}, "no CSV preset or column mapping given"},
+		{"no password column", "", CSVFormat{Columns: map[string]string{CSVFieldTitle: "name"}}, "no column is mapped to the password"},
+		{"empty file", "", CSVFormat{Preset: CSVPresetChrome}, "invalid CSV file"},
+		{"unterminated quote", "name,url,username,password\n\"GitHub,,octocat,hunter2\n", CSVFormat{Preset: CSVPresetChrome}, "invalid CSV file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := pm.ReadCSV(writeCSVFile(t, tt.csv), tt.format)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ReadCSV error = %v, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestReadCSVWarnings(t *testing.T) {
+	filename := writeCSVFile(t, "url,username,password,totp,extra,name,grouping,fav\n"+
+		"https://github.com/,octocat,hunter2,not a secret!,,GitHub,,0\n"+
+		",,,,,,,\n"+
+		",,hunter2,,,,,0\n")
+	got, warnings := importCSV(t, filename, CSVFormat{Preset: CSVPresetLastPass})
+
+	want := []csvTestEntry{{Type: models.ItemTypeLogin, Title: "GitHub", URL: "https://github.com/", Username: "octocat", Password: "hunter2"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("imported %+v, want %+v", got, want)
+	}
+	if len(warnings) != 2 || !strings.HasPrefix(warnings[0], "one-time password of row 2 was not imported") ||
+		warnings[1] != "skipped row 4: entry has no title" {
+		t.Errorf("warnings = %q", warnings)
+	}
+}
+
+func TestExportCSVRoundTrip(t *testing.T) {
+	tests := []struct {
+		preset string
+		want   func(entry csvTestEntry) csvTestEntry
+	}{
+		{
+			preset: CSVPresetChrome,
+			want: func(e csvTestEntry) csvTestEntry {
+				return csvTestEntry{Type: models.ItemTypeLogin, Title: e.Title, URL: e.URL, Username: e.Username, Password: e.Password, Notes: e.Notes}
+			},
+		},
+		{
+			preset: CSVPresetOnePassword,
+			want: func(e csvTestEntry) csvTestEntry {
+				return csvTestEntry{Type: models.ItemTypeLogin, Title: e.Title, URL: e.URL, Username: e.Username, Password: e.Password, Notes: e.Notes, TOTP: e.TOTP, Tags: e.Tags}
+			},
+		},
+		{
+			preset: CSVPresetLastPass,
+			want: func(e csvTestEntry) csvTestEntry {
+				e.Tags = nil
+				return e
+			},
+		},
+	}
+
+	pm := newTestManager(t)
+	addTestEntries(t, pm,
+		models.PasswordEntry{
+			Title: "GitHub", URL: "https://github.com/login", Username: "octocat", Password: "hunter2, \"quoted\"",
+			Notes: "Line one\nLine two", TOTP: csvTestTOTP, Category: "Work/Dev", Tags: []string{"dev", "prod"},
+		},
+		models.PasswordEntry{Type: models.ItemTypeSecureNote, Title: "Wifi", Notes: "Guest network: hello", Category: "Home"},
+	)
+	entries := vaultCSVEntries(t, pm)
+
+	for _, tt := range tests {
+		t.Run(tt.preset, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "export.csv")
+			count, err := pm.ExportCSV(filename, CSVFormat{Preset: tt.preset})
+			if err != nil {
+				t.Fatalf("ExportCSV failed: %v", err)
+			}
+			if count != len(entries) {
+				t.Errorf("exported %d entries, want %d", count, len(entries))
+			}
+
+			got, warnings := importCSV(t, filename, CSVFormat{Preset: tt.preset})
+			if len(warnings) != 0 {
+				t.Errorf("warnings = %q", warnings)
+			}
+			var want []csvTestEntry
+			for _, entry := range entries {
+				want = append(want, tt.want(entry))
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("imported %+v, want %+v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+	"github.com/loganmanery/passmanager/pkg/urlmatch"
+)
+
+// DuplicateGroup is a set of entries for the same site and username, most
+// recently updated first. Site is the normalized host of their URL, or the
+// title for entries without one. SamePassword reports whether all entries
+// share the same password, making them safe to merge.
+type DuplicateGroup struct {
+	Site         string
+	Username     string
+	Entries      []models.PasswordEntry
+	SamePassword bool
+}
+
+// FindDuplicates groups the entries outside the trash that have the same type,
+// normalized URL host and username
+func (pm *PasswordManager) FindDuplicates() ([]DuplicateGroup, error) {
+	if !pm.initialized {
+		return nil, errors.New("password manager not initialized")
+	}
+
+	entries, err := pm.GetAllPasswords()
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string]*DuplicateGroup)
+	var keys []string
+	for _, entry := range entries {
+		site := duplicateSite(entry)
+		username := strings.ToLower(strings.TrimSpace(entry.Username))
+		key := entry.Type + "\x00" + site + "\x00" + username
+
+		group, ok := groups[key]
+		if !ok {
+			group = &DuplicateGroup{Site: site, Username: entry.Username}
+			groups[key] = group
+			keys = append(keys, key)
+		}
+		group.Entries = append(group.Entries, entry)
+	}
+
+	var result []DuplicateGroup
+	for _, key := range keys {
+		group := groups[key]
+		if len(group.Entries) < 2 {
+			continue
+		}
+
+		sort.SliceStable(group.Entries, func(i, j int) bool {
+			return group.Entries[i].LastUpdated.After(group.Entries[j].LastUpdated)
+		})
+
+		group.SamePassword, err = pm.samePassword(group.Entries)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, *group)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Site != result[j].Site {
+			return result[i].Site < result[j].Site
+		}
+		return result[i].Username < result[j].Username
+	})
+
+	return result, nil
+}
+
+// MergePasswords merges duplicate entries into the entry keepID. Notes are
+// appended, tags and custom fields combined, and fields missing from the
+// surviving entry are filled in, a one-time password with its HOTP counter.
+// The passwords and password history of the merged entries move to its
+// history, their attachments move to it, and the merged entries are moved to
+// the trash.
+func (pm *PasswordManager) MergePasswords(keepID int64, mergeIDs ...int64) error {
+	if !pm.initialized {
+		return errors.New("password manager not initialized")
+	}
+	if len(mergeIDs) == 0 {
+		return errors.New("no entries to merge")
+	}
+	pm.updateLastActivity()
+
+	survivor, err := pm.GetPassword(keepID)
+	if err != nil {
+		return err
+	}
+	if survivor.IsTrashed() {
+		return errors.New("cannot merge into an entry in the trash")
+	}
+
+	seen := map[int64]bool{keepID: true}
+	archivedPasswords := map[string]bool{survivor.Password: true}
+	var archived [][]byte
+	var otpSource int64
+	for _, id := range mergeIDs {
+		if seen[id] {
+			return fmt.Errorf("entry %d is merged more than once", id)
+		}
+		seen[id] = true
+
+		other, err := pm.GetPassword(id)
+		if err != nil {
+			return err
+		}
+		if other.IsTrashed() {
+			return fmt.Errorf("entry %d is in the trash", id)
+		}
+		if other.Type != survivor.Type {
+			return fmt.Errorf("cannot merge %s %q into %s %q", other.Type, other.Title, survivor.Type, survivor.Title)
+		}
+
+		if survivor.TOTP == "" && other.TOTP != "" {
+			otpSource = id
+		}
+		mergeEntry(&survivor, other)
+
+		if !archivedPasswords[other.Password] {
+			archivedPasswords[other.Password] = true
+			encPassword, err := pm.crypto.Encrypt(other.Password, pm.masterKey)
+			if err != nil {
+				return err
+			}
+			archived = append(archived, encPassword)
+		}
+	}
+
+	encrypted, err := pm.encryptUpdate(survivor)
+	if err != nil {
+		return err
+	}
+
+	// A one-time password secret taken from a merged entry keeps its HOTP
+	// counter, so that codes the server has already seen are not reused
+	if otpSource != 0 {
+		encrypted.OTPCounter, err = pm.storage.GetOTPCounter(otpSource)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = pm.storage.MergePasswords(keepID, encrypted, mergeIDs, archived)
+	if err != nil {
+		return err
+	}
+
+	err = pm.pruneHistory(keepID)
+	if err != nil {
+		return fmt.Errorf("failed to prune password history: %w", err)
+	}
+
+	return pm.logAudit(AuditActionMerge, AuditResourcePassword, keepID,
+		fmt.Sprintf("%s (merged %d entries)", survivor.Title, len(mergeIDs)))
+}
+
+// mergeEntry folds the fields of other into entry
+func mergeEntry(entry *models.PasswordEntry, other models.PasswordEntry) {
+	if other.Notes != "" && !strings.Contains(entry.Notes, other.Notes) {
+		if entry.Notes != "" {
+			entry.Notes += "\n\n"
+		}
+		entry.Notes += other.Notes
+	}
+
+	entry.Tags = append(entry.Tags, other.Tags...)
+
+	names := make(map[string]bool, len(entry.CustomFields))
+	for _, field := range entry.CustomFields {
+		names[field.Name] = true
+	}
+	for _, field := range other.CustomFields {
+		if !names[field.Name] {
+			names[field.Name] = true
+			entry.CustomFields = append(entry.CustomFields, field)
+		}
+	}
+
+	if entry.URL == "" {
+		entry.URL, entry.URLMatch = other.URL, other.URLMatch
+	}
+	if entry.Username == "" {
+		entry.Username = other.Username
+	}
+	if entry.Category == "" {
+		entry.Category = other.Category
+	}
+	if entry.TOTP == "" {
+		entry.TOTP = other.TOTP
+	}
+	if itemData(entry) == nil {
+		entry.Card, entry.Identity, entry.SSHKey = other.Card, other.Identity, other.SSHKey
+		entry.APICredential, entry.WiFi = other.APICredential, other.WiFi
+	}
+}
+
+// samePassword reports whether all entries have the same password
+func (pm *PasswordManager) samePassword(entries []models.PasswordEntry) (bool, error) {
+	var first string
+	for i, entry := range entries {
+		full, err := pm.GetPassword(entry.ID)
+		if err != nil {
+			return false, err
+		}
+		if i == 0 {
+			first = full.Password
+		} else if full.Password != first {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// duplicateSite returns the normalized site of an entry: the host of its URL
+// without a leading www., or its title if it has no usable URL
+func duplicateSite(entry models.PasswordEntry) string {
+	if u, err := urlmatch.Normalize(entry.URL); err == nil {
+		return strings.TrimPrefix(u.Host, "www.")
+	}
+	return strings.ToLower(strings.TrimSpace(entry.Title))
+}
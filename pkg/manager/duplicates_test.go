@@ -0,0 +1,236 @@
+package manager
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+)
+
+// addTestEntries adds entries to a vault, returning their IDs by title
+func addTestEntries(t *testing.T, pm *PasswordManager, entries ...models.PasswordEntry) map[string]int64 {
+	t.Helper()
+
+	ids := make(map[string]int64, len(entries))
+	for _, entry := range entries {
+		id, err := pm.AddPassword(entry)
+		if err != nil {
+			t.Fatalf("AddPassword(%q) failed: %v", entry.Title, err)
+		}
+		ids[entry.Title] = id
+	}
+	return ids
+}
+
+func TestFindDuplicates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.db")
+	pm := newTestManagerAt(t, path)
+	ids := addTestEntries(t, pm,
+		models.PasswordEntry{Title: "GitHub", URL: "https://github.com/login", Username: "octocat", Password: "hunter2"},
+		models.PasswordEntry{Title: "GitHub (old)", URL: "http://www.github.com/", Username: "OctoCat ", Password: "hunter2"},
+		models.PasswordEntry{Title: "GitHub work", URL: "https://github.com/", Username: "mona", Password: "hunter2"},
+		models.PasswordEntry{Title: "Router", Username: "admin", Password: "admin"},
+		models.PasswordEntry{Title: "router ", Username: "admin", Password: "changed"},
+		models.PasswordEntry{Type: models.ItemTypeSecureNote, Title: "ROUTER", Username: "admin", Notes: "Firmware 1.2"},
+		models.PasswordEntry{Title: "Trashed GitHub", URL: "https://github.com/", Username: "octocat", Password: "hunter2"},
+	)
+	if err := pm.DeletePassword(ids["Trashed GitHub"]); err != nil {
+		t.Fatalf("DeletePassword failed: %v", err)
+	}
+
+	// Entries of a group are listed most recently updated first
+	db := openTestDB(t, path)
+	for title, updated := range map[string]string{"GitHub": "2023-01-01", "GitHub (old)": "2024-01-01", "Router": "2022-01-01", "router ": "2021-01-01"} {
+		if _, err := db.Exec("UPDATE passwords SET updated_at = ? WHERE id = ?", updated+" 00:00:00", ids[title]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	groups, err := pm.FindDuplicates()
+	if err != nil {
+		t.Fatalf("FindDuplicates failed: %v", err)
+	}
+
+	type group struct {
+		site, username string
+		titles         []string
+		samePassword   bool
+	}
+	var got []group
+	for _, g := range groups {
+		var titles []string
+		for _, entry := range g.Entries {
+			titles = append(titles, entry.Title)
+		}
+		got = append(got, group{g.Site, g.Username, titles, g.SamePassword})
+	}
+	want := []group{
+		{"github.com", "octocat", []string{"GitHub (old)", "GitHub"}, true},
+		{"router", "admin", []string{"Router", "router "}, false},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FindDuplicates = %+v, want %+v", got, want)
+	}
+}
+
+func TestMergePasswords(t *testing.T) {
+	pm := newTestManager(t)
+	ids := addTestEntries(t, pm,
+		models.PasswordEntry{
+			Title: "GitHub", Username: "octocat", Password: "hunter2", Notes: "Personal account",
+			Tags:         []string{"dev"},
+			CustomFields: []models.CustomField{{Name: "PIN", Value: "1234"}},
+		},
+		models.PasswordEntry{
+			Title: "GitHub (old)", URL: "https://github.com/login", Username: "octocat", Password: "hunter1",
+			Notes: "Recovery codes are in the safe", Category: "Work", Tags: []string{"old", "dev"},
+			TOTP: "otpauth://hotp/GitHub?secret=JBSWY3DPEHPK3PXP&counter=5",
+			CustomFields: []models.CustomField{
+				{Name: "PIN", Value: "0000"},
+				{Name: "Recovery email", Value: "octo@example.com"},
+			},
+		},
+		models.PasswordEntry{Title: "GitHub (copy)", Username: "octocat", Password: "hunter2", Notes: "Personal account"},
+	)
+	keep, old, dup := ids["GitHub"], ids["GitHub (old)"], ids["GitHub (copy)"]
+
+	// The merged entry has used HOTP codes, a previous password and an attachment
+	for i := 0; i < 3; i++ {
+		if _, err := pm.GetOTPCode(old); err != nil {
+			t.Fatalf("GetOTPCode failed: %v", err)
+		}
+	}
+	entry, err := pm.GetPassword(old)
+	if err != nil {
+		t.Fatalf("GetPassword failed: %v", err)
+	}
+	entry.Password = "hunter0"
+	if err := pm.UpdatePassword(entry); err != nil {
+		t.Fatalf("UpdatePassword failed: %v", err)
+	}
+	if _, err := pm.AddAttachment(old, "codes.txt", strings.NewReader("recovery codes"), 14); err != nil {
+		t.Fatalf("AddAttachment failed: %v", err)
+	}
+
+	if err := pm.MergePasswords(keep, old, dup); err != nil {
+		t.Fatalf("MergePasswords failed: %v", err)
+	}
+
+	got, err := pm.GetPassword(keep)
+	if err != nil {
+		t.Fatalf("GetPassword failed: %v", err)
+	}
+	if got.Password != "hunter2" || got.URL != "https://github.com/login" || got.Category != "Work" || got.TOTP != entry.TOTP {
+		t.Errorf("merged entry = %+v, want the password kept and the missing fields filled in", got)
+	}
+	if want := "Personal account\n\nRecovery codes are in the safe"; got.Notes != want {
+		t.Errorf("notes = %q, want %q", got.Notes, want)
+	}
+	if want := []string{"dev", "old"}; !reflect.DeepEqual(got.Tags, want) {
+		t.Errorf("tags = %q, want %q", got.Tags, want)
+	}
+	wantFields := []models.CustomField{
+		{Name: "PIN", Type: models.FieldTypeText, Value: "1234"},
+		{Name: "Recovery email", Type: models.FieldTypeText, Value: "octo@example.com"},
+	}
+	if !reflect.DeepEqual(got.CustomFields, wantFields) {
+		t.Errorf("custom fields = %+v, want %+v", got.CustomFields, wantFields)
+	}
+
+	// The HOTP counter continues where the merged entry left off
+	code, err := pm.GetOTPCode(keep)
+	if err != nil {
+		t.Fatalf("GetOTPCode failed: %v", err)
+	}
+	if code.Counter != 8 {
+		t.Errorf("HOTP counter = %d, want 8", code.Counter)
+	}
+
+	// The merged password and the history of the merged entry move over,
+	// and a password equal to the kept one is not archived
+	history, err := pm.GetPasswordHistory(keep)
+	if err != nil {
+		t.Fatalf("GetPasswordHistory failed: %v", err)
+	}
+	var passwords []string
+	for _, record := range history {
+		passwords = append(passwords, record.Password)
+	}
+	sort.Strings(passwords)
+	if want := []string{"hunter0", "hunter1"}; !reflect.DeepEqual(passwords, want) {
+		t.Errorf("history = %q, want %q", passwords, want)
+	}
+
+	attachments, err := pm.GetAttachments(keep)
+	if err != nil || len(attachments) != 1 || attachments[0].Name != "codes.txt" {
+		t.Fatalf("GetAttachments = %+v, %v, want codes.txt", attachments, err)
+	}
+	var content bytes.Buffer
+	if err := pm.ExtractAttachment(attachments[0].ID, &content); err != nil || content.String() != "recovery codes" {
+		t.Errorf("attachment = %q, %v", content.String(), err)
+	}
+
+	trash, err := pm.GetTrash()
+	if err != nil {
+		t.Fatalf("GetTrash failed: %v", err)
+	}
+	trashed := make(map[int64]bool)
+	for _, entry := range trash {
+		trashed[entry.ID] = true
+	}
+	if want := map[int64]bool{old: true, dup: true}; !reflect.DeepEqual(trashed, want) {
+		t.Errorf("trash = %v, want the merged entries %v", trashed, want)
+	}
+	if attachments, _ := pm.GetAttachments(old); len(attachments) != 0 {
+		t.Errorf("merged entry still has %d attachments", len(attachments))
+	}
+}
+
+func TestMergePasswordsRejects(t *testing.T) {
+	pm := newTestManager(t)
+	ids := addTestEntries(t, pm,
+		models.PasswordEntry{Title: "GitHub", Username: "octocat", Password: "hunter2"},
+		models.PasswordEntry{Title: "GitHub (old)", Username: "octocat", Password: "hunter1"},
+		models.PasswordEntry{Type: models.ItemTypeSecureNote, Title: "GitHub notes", Notes: "Recovery codes"},
+		models.PasswordEntry{Title: "Trashed", Username: "octocat", Password: "hunter0"},
+	)
+	if err := pm.DeletePassword(ids["Trashed"]); err != nil {
+		t.Fatalf("DeletePassword failed: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		keep  int64
+		merge []int64
+		err   string
+	}{
+		{"no entries", ids["GitHub"], nil, "no entries to merge"},
+		{"other type", ids["GitHub"], []int64{ids["GitHub notes"]}, `cannot merge secure_note "GitHub notes" into login "GitHub"`},
+		{"merged entry in the trash", ids["GitHub"], []int64{ids["Trashed"]}, "is in the trash"},
+		{"surviving entry in the trash", ids["Trashed"], []int64{ids["GitHub"]}, "cannot merge into an entry in the trash"},
+		{"entry merged into itself", ids["GitHub"], []int64{ids["GitHub"]}, "is merged more than once"},
+		{"entry merged twice", ids["GitHub"], []int64{ids["GitHub (old)"], ids["GitHub (old)"]}, "is merged more than once"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := pm.MergePasswords(tt.keep, tt.merge...)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("MergePasswords error = %v, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+
+	// Nothing was merged or trashed by the rejected merges
+	entries, err := pm.GetAllPasswords()
+	if err != nil {
+		t.Fatalf("GetAllPasswords failed: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("%d entries outside the trash, want 3", len(entries))
+	}
+}
@@ -0,0 +1,614 @@
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/loganmanery/passmanager/internal/crypto"
+	"github.com/loganmanery/passmanager/pkg/models"
+	"github.com/loganmanery/passmanager/pkg/urlmatch"
+)
+
+// Export file formats. An export starts with exportMagic and a line of JSON
+// holding the ExportHeader, followed by an encrypted stream of the header
+// again and the entries with their password history and attachments. The
+// encrypted copy authenticates the plaintext header. The stream and the
+// secrets of the entries are encrypted with a key derived from an export
+// password using the salt and KDF parameters in the header, so the file can
+// be imported into any vault. Files without a magic are the original base64
+// AES-GCM format, encrypted with the key of the vault they came from.
+const (
+	exportMagic         = "PMVAULT2\n"
+	exportFormatVersion = 1
+	minExportSaltSize   = 16
+)
+
+// ExportHeader describes an export file
+type ExportHeader struct {
+	FormatVersion int              `json:"format_version"`
+	Created       time.Time        `json:"created"`
+	EntryCount    int              `json:"entry_count"`
+	KDF           crypto.KDFParams `json:"kdf"`
+	Salt          []byte           `json:"salt,omitempty"`
+	Cipher        string           `json:"cipher"`
+}
+
+// equal reports whether two headers describe the same export
+func (h ExportHeader) equal(other ExportHeader) bool {
+	return h.FormatVersion == other.FormatVersion &&
+		h.Created.Equal(other.Created) &&
+		h.EntryCount == other.EntryCount &&
+		h.KDF == other.KDF &&
+		bytes.Equal(h.Salt, other.Salt) &&
+		h.Cipher == other.Cipher
+}
+
+// exportPayload is the encrypted content of an export file
+type exportPayload struct {
+	Header  ExportHeader         `json:"header"`
+	Entries []models.ExportEntry `json:"entries"`
+}
+
+// writeExport writes the entries of the vault to w in the current export
+// format, reading, re-encrypting and writing them one at a time, and returns
+// how many it wrote
+func (pm *PasswordManager) writeExport(w io.Writer, exportPassword string) (int, error) {
+	var export *exportWriter
+	err := pm.storage.ExportEntries(func(n int) error {
+		var err error
+		export, err = pm.newExportWriter(w, n, exportPassword)
+		return err
+	}, func(entry models.ExportEntry) error {
+		return export.writeEntry(entry)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return export.count, export.close()
+}
+
+// exportWriter writes an export in the current format an entry at a time, so
+// that only the entry being written is held in memory
+type exportWriter struct {
+	pm      *PasswordManager
+	key     []byte
+	enc     io.WriteCloser
+	encoder *json.Encoder
+	count   int
+	written int
+}
+
+// newExportWriter writes the header of an export of count entries to w and
+// starts its payload, encrypted with a key derived from the export password
+// and a fresh salt
+func (pm *PasswordManager) newExportWriter(w io.Writer, count int, exportPassword string) (*exportWriter, error) {
+	salt, err := pm.crypto.GenerateSalt()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	kdf := pm.crypto.KDFParams()
+	key, err := pm.crypto.DeriveKeyWithParams(exportPassword, salt, kdf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+
+	header := ExportHeader{
+		FormatVersion: exportFormatVersion,
+		Created:       time.Now().UTC().Truncate(time.Second),
+		EntryCount:    count,
+		KDF:           kdf,
+		Salt:          salt,
+		Cipher:        crypto.StreamCipher,
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(w, exportMagic); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(append(headerJSON, '\n')); err != nil {
+		return nil, err
+	}
+
+	enc, err := pm.crypto.NewEncryptWriter(w, key)
+	if err != nil {
+		return nil, err
+	}
+
+	// The payload is an exportPayload written in pieces: the header, then
+	// the entries of its array as they are read
+	if _, err := io.WriteString(enc, `{"header":`); err != nil {
+		return nil, err
+	}
+	encoder := json.NewEncoder(enc)
+	if err := encoder.Encode(header); err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(enc, `,"entries":[`); err != nil {
+		return nil, err
+	}
+
+	return &exportWriter{pm: pm, key: key, enc: enc, encoder: encoder, count: count}, nil
+}
+
+// writeEntry re-encrypts the secrets of an entry from the vault key to the
+// export key and appends it to the export
+func (e *exportWriter) writeEntry(entry models.ExportEntry) error {
+	if e.written == e.count {
+		return fmt.Errorf("vault has more entries than the %d counted for the export", e.count)
+	}
+
+	entry, err := e.pm.transcodeEntry(entry, e.pm.masterKey, e.key)
+	if err != nil {
+		return err
+	}
+
+	if e.written > 0 {
+		if _, err := io.WriteString(e.enc, ","); err != nil {
+			return err
+		}
+	}
+	if err := e.encoder.Encode(entry); err != nil {
+		return err
+	}
+
+	e.written++
+	return nil
+}
+
+// close ends the payload and seals the encrypted stream
+func (e *exportWriter) close() error {
+	if e.written != e.count {
+		return fmt.Errorf("vault has %d entries but %d were counted for the export", e.written, e.count)
+	}
+	if _, err := io.WriteString(e.enc, "]}\n"); err != nil {
+		return err
+	}
+	return e.enc.Close()
+}
+
+// readExportFile reads the entries of an export in either format, returning
+// them with their secrets encrypted with the vault key. The export password
+// is only used by exports in the current format.
+func (pm *PasswordManager) readExportFile(r io.Reader, exportPassword string) ([]models.ExportEntry, error) {
+	reader := bufio.NewReader(r)
+	magic, _ := reader.Peek(len(exportMagic))
+	if string(magic) == exportMagic {
+		reader.Discard(len(exportMagic))
+		return pm.readExport(reader, exportPassword)
+	}
+
+	var entries []map[string]interface{}
+	if err := pm.readLegacyExport(reader, &entries); err != nil {
+		return nil, err
+	}
+
+	result := make([]models.ExportEntry, len(entries))
+	for i, m := range entries {
+		entry := legacyExportEntry(m)
+		if err := validateEntryContent(&entry); err != nil {
+			return nil, fmt.Errorf("export entry %d: %w", i+1, err)
+		}
+		result[i] = entry
+	}
+
+	// Older exports hold secrets encrypted with the vault key, so re-encrypting
+	// them checks that every one of them decrypts
+	result, err := pm.transcodeEntries(result, pm.masterKey, pm.masterKey)
+	if err != nil {
+		return nil, fmt.Errorf("export was made by another vault or is damaged: %w", err)
+	}
+	return result, nil
+}
+
+// readExport reads an export in the current format after its magic, checking
+// the header and entries strictly
+func (pm *PasswordManager) readExport(r *bufio.Reader, exportPassword string) ([]models.ExportEntry, error) {
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return nil, fmt.Errorf("reading export header: %w", err)
+	}
+
+	var header ExportHeader
+	if err := decodeStrict(json.NewDecoder(bytes.NewReader(line)), &header); err != nil {
+		return nil, fmt.Errorf("invalid export header: %w", err)
+	}
+	if err := validateExportHeader(header); err != nil {
+		return nil, err
+	}
+
+	key, err := pm.crypto.DeriveKeyWithParams(exportPassword, header.Salt, header.KDF)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+
+	decReader, err := pm.crypto.NewDecryptReader(r, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload exportPayload
+	err = decodeStrict(json.NewDecoder(decReader), &payload)
+	if errors.Is(err, crypto.ErrStreamAuth) {
+		return nil, errors.New("wrong export password or damaged export file")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid export: %w", err)
+	}
+	if !payload.Header.equal(header) {
+		return nil, errors.New("export header does not match its encrypted copy")
+	}
+
+	if err := validateExportEntries(header.EntryCount, payload.Entries); err != nil {
+		return nil, err
+	}
+
+	return pm.transcodeEntries(payload.Entries, key, pm.masterKey)
+}
+
+// decodeStrict decodes a single JSON value into v, rejecting unknown fields
+// and anything after the value. Reading to the end also authenticates the
+// last chunk of an encrypted stream.
+func decodeStrict(dec *json.Decoder, v interface{}) error {
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+
+	_, err := dec.Token()
+	if err == nil {
+		return errors.New("unexpected data after JSON value")
+	}
+	if err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// validateExportHeader checks that an export header describes a file this
+// version can read
+func validateExportHeader(header ExportHeader) error {
+	if header.FormatVersion != exportFormatVersion {
+		return fmt.Errorf("unsupported export format version %d", header.FormatVersion)
+	}
+	if len(header.Salt) < minExportSaltSize {
+		return errors.New("export header has no salt")
+	}
+	if header.Cipher != crypto.StreamCipher {
+		return fmt.Errorf("unsupported export cipher %q", header.Cipher)
+	}
+	if err := header.KDF.Validate(); err != nil {
+		return fmt.Errorf("invalid export key derivation: %w", err)
+	}
+	if header.Created.IsZero() {
+		return errors.New("export header has no creation time")
+	}
+	if header.EntryCount < 0 {
+		return fmt.Errorf("invalid export entry count %d", header.EntryCount)
+	}
+	return nil
+}
+
+// validateExportEntries checks the entries of an export against the count in
+// its header and for fields every entry must have, normalizing their tags
+func validateExportEntries(count int, entries []models.ExportEntry) error {
+	if len(entries) != count {
+		return fmt.Errorf("export has %d entries but its header says %d", len(entries), count)
+	}
+
+	uuids := make(map[string]bool, len(entries))
+	for i := range entries {
+		entry := &entries[i]
+		if err := validateExportEntry(entry); err != nil {
+			return fmt.Errorf("export entry %d: %w", i+1, err)
+		}
+
+		entryUUID := strings.ToLower(entry.UUID)
+		if uuids[entryUUID] {
+			return fmt.Errorf("export entry %d: duplicate UUID %s", i+1, entry.UUID)
+		}
+		uuids[entryUUID] = true
+	}
+
+	return nil
+}
+
+// validateExportEntry checks a single exported entry
+func validateExportEntry(entry *models.ExportEntry) error {
+	if !models.IsUUID(entry.UUID) {
+		return fmt.Errorf("invalid UUID %q", entry.UUID)
+	}
+	if entry.CreatedAt.IsZero() || entry.UpdatedAt.IsZero() {
+		return errors.New("missing timestamps")
+	}
+	return validateEntryContent(entry)
+}
+
+// validateEntryContent checks the fields of an exported entry other than its
+// UUID and timestamps, which older exports may lack, and normalizes its tags
+// the way AddTags does
+func validateEntryContent(entry *models.ExportEntry) error {
+	if !isItemType(entry.Type) {
+		return fmt.Errorf("invalid type %q", entry.Type)
+	}
+	if strings.TrimSpace(entry.Title) == "" {
+		return errors.New("missing title")
+	}
+	if len(entry.Password) == 0 {
+		return errors.New("missing password")
+	}
+	if _, err := urlmatch.ParseMode(entry.URLMatch); err != nil {
+		return err
+	}
+
+	tags, err := normalizeTags(entry.Tags)
+	if err != nil {
+		return err
+	}
+	entry.Tags = tags
+
+	for _, field := range entry.CustomFields {
+		if field.Name == "" {
+			return errors.New("custom field without a name")
+		}
+		switch field.Type {
+		case models.FieldTypeText, models.FieldTypeHidden, models.FieldTypeURL:
+		default:
+			return fmt.Errorf("custom field %q has invalid type %q", field.Name, field.Type)
+		}
+	}
+
+	for _, record := range entry.History {
+		if len(record.Password) == 0 || record.CreatedAt.IsZero() {
+			return errors.New("incomplete password history")
+		}
+	}
+
+	for _, attachment := range entry.Attachments {
+		if attachment.Name == "" {
+			return errors.New("attachment without a name")
+		}
+		if attachment.Size < 0 || len(attachment.Data) == 0 {
+			return fmt.Errorf("attachment %q is incomplete", attachment.Name)
+		}
+	}
+
+	return nil
+}
+
+// transcodeEntries returns copies of entries with their secrets decrypted with
+// one key and encrypted with another
+func (pm *PasswordManager) transcodeEntries(entries []models.ExportEntry, from, to []byte) ([]models.ExportEntry, error) {
+	result := make([]models.ExportEntry, len(entries))
+	for i, entry := range entries {
+		var err error
+		result[i], err = pm.transcodeEntry(entry, from, to)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// transcodeEntry returns a copy of an entry with its secrets decrypted with
+// one key and encrypted with another
+func (pm *PasswordManager) transcodeEntry(entry models.ExportEntry, from, to []byte) (models.ExportEntry, error) {
+	var err error
+	for _, secret := range []*[]byte{&entry.Password, &entry.Notes, &entry.TOTP, &entry.ItemData} {
+		*secret, err = pm.reencrypt(*secret, from, to)
+		if err != nil {
+			return models.ExportEntry{}, fmt.Errorf("failed to re-encrypt %q: %w", entry.Title, err)
+		}
+	}
+
+	entry.CustomFields = append([]models.ExportCustomField(nil), entry.CustomFields...)
+	for j, field := range entry.CustomFields {
+		if field.Type != models.FieldTypeHidden {
+			continue
+		}
+		entry.CustomFields[j].Value, err = pm.reencrypt(field.Value, from, to)
+		if err != nil {
+			return models.ExportEntry{}, fmt.Errorf("failed to re-encrypt field %q of %q: %w", field.Name, entry.Title, err)
+		}
+	}
+
+	entry.History = append([]models.ExportHistory(nil), entry.History...)
+	for j, record := range entry.History {
+		entry.History[j].Password, err = pm.reencrypt(record.Password, from, to)
+		if err != nil {
+			return models.ExportEntry{}, fmt.Errorf("failed to re-encrypt password history of %q: %w", entry.Title, err)
+		}
+	}
+
+	entry.Attachments = append([]models.ExportAttachment(nil), entry.Attachments...)
+	for j, attachment := range entry.Attachments {
+		entry.Attachments[j].Data, err = pm.reencryptAttachment(attachment, from, to)
+		if err != nil {
+			return models.ExportEntry{}, fmt.Errorf("failed to re-encrypt attachment %q of %q: %w", attachment.Name, entry.Title, err)
+		}
+	}
+
+	return entry, nil
+}
+
+// reencrypt decrypts a secret with one key and encrypts it with another.
+// Empty secrets were never encrypted and are returned as they are.
+func (pm *PasswordManager) reencrypt(ciphertext, from, to []byte) ([]byte, error) {
+	if len(ciphertext) == 0 {
+		return ciphertext, nil
+	}
+	plaintext, err := pm.crypto.Decrypt(ciphertext, from)
+	if err != nil {
+		return nil, err
+	}
+	return pm.crypto.Encrypt(plaintext, to)
+}
+
+// reencryptAttachment decrypts the content of an attachment with one key and
+// encrypts it with another as it is decrypted, checking it against the size
+// of the attachment
+func (pm *PasswordManager) reencryptAttachment(attachment models.ExportAttachment, from, to []byte) ([]byte, error) {
+	dec, err := pm.crypto.NewDecryptReader(bytes.NewReader(attachment.Data), from)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(attachment.Data))
+	enc, err := pm.crypto.NewEncryptWriter(&buf, to)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := io.Copy(enc, dec)
+	if err != nil {
+		return nil, err
+	}
+	if n != attachment.Size {
+		return nil, fmt.Errorf("content is %d bytes but the attachment says %d", n, attachment.Size)
+	}
+
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decryptSecret decrypts a secret with the vault key. Empty secrets were never
+// encrypted and decrypt to an empty string.
+func (pm *PasswordManager) decryptSecret(ciphertext []byte) (string, error) {
+	if len(ciphertext) == 0 {
+		return "", nil
+	}
+	return pm.crypto.Decrypt(ciphertext, pm.masterKey)
+}
+
+// encryptSecret encrypts a secret with the vault key, leaving empty secrets
+// unencrypted as they are stored
+func (pm *PasswordManager) encryptSecret(value string) ([]byte, error) {
+	if value == "" {
+		return nil, nil
+	}
+	return pm.crypto.Encrypt(value, pm.masterKey)
+}
+
+// isItemType reports whether typ is exactly one of models.ItemTypes
+func isItemType(typ string) bool {
+	for _, t := range models.ItemTypes {
+		if typ == t {
+			return true
+		}
+	}
+	return false
+}
+
+// readLegacyExport decodes an export written in the original base64 AES-GCM format into v
+func (pm *PasswordManager) readLegacyExport(r io.Reader, v interface{}) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	// Decode base64
+	decodedData, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		return err
+	}
+
+	// Decrypt
+	jsonData, err := pm.crypto.Decrypt(decodedData, pm.masterKey)
+	if err != nil {
+		return err
+	}
+
+	// Parse JSON
+	return json.Unmarshal([]byte(jsonData), v)
+}
+
+// legacyExportEntry converts an untyped entry from an older export. Binary
+// values went through JSON as base64 text and are decoded back to bytes.
+// Entries from before item types are logins.
+func legacyExportEntry(m map[string]interface{}) models.ExportEntry {
+	var entry models.ExportEntry
+	entry.UUID, _ = m["uuid"].(string)
+	entry.Type, _ = m["type"].(string)
+	if entry.Type == "" {
+		entry.Type = models.ItemTypeLogin
+	}
+	entry.Title, _ = m["title"].(string)
+	entry.URL, _ = m["url"].(string)
+	entry.URLMatch, _ = m["url_match"].(string)
+	entry.Username, _ = m["username"].(string)
+	entry.Category, _ = m["category"].(string)
+	entry.Password = legacyBytes(m["password"])
+	entry.Notes = legacyBytes(m["notes"])
+	entry.TOTP = legacyBytes(m["totp"])
+	entry.ItemData = legacyBytes(m["item_data"])
+	entry.CreatedAt = legacyTime(m["created_at"])
+	entry.UpdatedAt = legacyTime(m["updated_at"])
+
+	if counter, ok := m["otp_counter"].(float64); ok && counter > 0 {
+		entry.OTPCounter = uint64(counter)
+	}
+
+	tags, _ := m["tags"].([]interface{})
+	for _, tag := range tags {
+		if name, ok := tag.(string); ok && name != "" {
+			entry.Tags = append(entry.Tags, name)
+		}
+	}
+
+	fields, _ := m["custom_fields"].([]interface{})
+	for _, item := range fields {
+		field, _ := item.(map[string]interface{})
+		name, _ := field["name"].(string)
+		fieldType, _ := field["type"].(string)
+		if name == "" || fieldType == "" {
+			continue
+		}
+		entry.CustomFields = append(entry.CustomFields, models.ExportCustomField{
+			Name:  name,
+			Type:  fieldType,
+			Value: legacyBytes(field["value"]),
+		})
+	}
+
+	return entry
+}
+
+// legacyBytes decodes a binary value from an older export, falling back to
+// the raw text if it is not base64
+func legacyBytes(value interface{}) []byte {
+	s, ok := value.(string)
+	if !ok {
+		return nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return []byte(s)
+	}
+	return decoded
+}
+
+// legacyTime parses a timestamp from an older export, returning the zero time
+// if it is missing or malformed
+func legacyTime(value interface{}) time.Time {
+	s, _ := value.(string)
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,622 @@
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+)
+
+const (
+	testExportPassword = "export password"
+	testAttachment     = "ssh-rsa AAAAB3NzaC1yc2E octocat"
+)
+
+// newTestManager creates an unlocked vault in a temporary directory
+func newTestManager(t *testing.T) *PasswordManager {
+	t.Helper()
+	return newTestManagerAt(t, filepath.Join(t.TempDir(), "vault.db"))
+}
+
+// newTestManagerAt creates an unlocked vault at the given path
+func newTestManagerAt(t *testing.T, path string) *PasswordManager {
+	t.Helper()
+
+	pm := NewPasswordManager(path)
+	if err := pm.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	if err := pm.CreateMasterPassword("correct horse battery staple"); err != nil {
+		t.Fatalf("CreateMasterPassword failed: %v", err)
+	}
+	t.Cleanup(func() { pm.Close() })
+	return pm
+}
+
+// addExportEntries fills a vault with entries using every exported field
+func addExportEntries(t *testing.T, pm *PasswordManager) {
+	t.Helper()
+
+	entries := []models.PasswordEntry{
+		{
+			Title: "GitHub", URL: "https://github.com/login", URLMatch: "host", Username: "octocat",
+			Password: "hunter2", Notes: "Recovery codes are in the safe", Category: "Work",
+			Tags: []string{"dev", "prod"},
+			TOTP: "otpauth://hotp/GitHub?secret=JBSWY3DPEHPK3PXP&counter=5",
+			CustomFields: []models.CustomField{
+				{Name: "Recovery email", Value: "octo@example.com"},
+				{Name: "PIN", Type: models.FieldTypeHidden, Value: "1234"},
+				{Name: "Docs", Type: models.FieldTypeURL, Value: "https://docs.github.com"},
+			},
+		},
+		{
+			Type: models.ItemTypeCard, Title: "Visa", Category: "Finance",
+			Card: &models.CardData{CardholderName: "Mona Lisa", Number: "4111111111111111", ExpiryMonth: 12, ExpiryYear: 2030, CVV: "123"},
+		},
+		{
+			Type: models.ItemTypeSecureNote, Title: "Wifi", Notes: "Guest network: hello",
+			Tags: []string{"home"},
+		},
+	}
+
+	for _, entry := range entries {
+		if _, err := pm.AddPassword(entry); err != nil {
+			t.Fatalf("AddPassword(%q) failed: %v", entry.Title, err)
+		}
+	}
+
+	// Advance the HOTP counter so that the exported counter differs from the URI
+	github, err := pm.SearchPasswords(models.SearchParams{Keyword: "GitHub"})
+	if err != nil || len(github) != 1 {
+		t.Fatalf("SearchPasswords failed: %v", err)
+	}
+	if _, err := pm.GetOTPCode(github[0].ID); err != nil {
+		t.Fatalf("GetOTPCode failed: %v", err)
+	}
+
+	// Change the password to give the entry a history, and attach a file
+	entry, err := pm.GetPassword(github[0].ID)
+	if err != nil {
+		t.Fatalf("GetPassword failed: %v", err)
+	}
+	entry.Password = "hunter3"
+	if err := pm.UpdatePassword(entry); err != nil {
+		t.Fatalf("UpdatePassword failed: %v", err)
+	}
+	_, err = pm.AddAttachment(entry.ID, "id_rsa.pub", strings.NewReader(testAttachment), int64(len(testAttachment)))
+	if err != nil {
+		t.Fatalf("AddAttachment failed: %v", err)
+	}
+}
+
+// exportTestVault exports every entry of a vault in the current format
+func exportTestVault(t *testing.T, pm *PasswordManager) ([]models.ExportEntry, []byte) {
+	t.Helper()
+
+	entries, err := pm.storage.ExportData()
+	if err != nil {
+		t.Fatalf("ExportData failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	count, err := pm.writeExport(&buf, testExportPassword)
+	if err != nil {
+		t.Fatalf("writeExport failed: %v", err)
+	}
+	if count != len(entries) {
+		t.Errorf("wrote %d entries, want %d", count, len(entries))
+	}
+	return entries, buf.Bytes()
+}
+
+// compareExportEntries checks that two entries, each with secrets encrypted
+// with the key of its own vault, are the same
+func compareExportEntries(t *testing.T, wantPM *PasswordManager, want models.ExportEntry, gotPM *PasswordManager, got models.ExportEntry) {
+	t.Helper()
+
+	if got.UUID != want.UUID || got.Type != want.Type || got.Title != want.Title ||
+		got.URL != want.URL || got.URLMatch != want.URLMatch || got.Username != want.Username ||
+		got.Category != want.Category || got.OTPCounter != want.OTPCounter {
+		t.Errorf("entry = %+v, want %+v", got, want)
+	}
+	if !reflect.DeepEqual(got.Tags, want.Tags) {
+		t.Errorf("%s: tags = %q, want %q", want.Title, got.Tags, want.Tags)
+	}
+	if !got.CreatedAt.Equal(want.CreatedAt) || !got.UpdatedAt.Equal(want.UpdatedAt) {
+		t.Errorf("%s: timestamps = %v, %v, want %v, %v", want.Title, got.CreatedAt, got.UpdatedAt, want.CreatedAt, want.UpdatedAt)
+	}
+
+	secrets := []struct {
+		name      string
+		want, got []byte
+	}{
+		{"password", want.Password, got.Password},
+		{"notes", want.Notes, got.Notes},
+		{"totp", want.TOTP, got.TOTP},
+		{"item_data", want.ItemData, got.ItemData},
+	}
+	for _, secret := range secrets {
+		wantValue, err := wantPM.decryptSecret(secret.want)
+		if err != nil {
+			t.Fatalf("%s: decrypting exported %s failed: %v", want.Title, secret.name, err)
+		}
+		gotValue, err := gotPM.decryptSecret(secret.got)
+		if err != nil {
+			t.Fatalf("%s: decrypting imported %s failed: %v", want.Title, secret.name, err)
+		}
+		if gotValue != wantValue {
+			t.Errorf("%s: %s = %q, want %q", want.Title, secret.name, gotValue, wantValue)
+		}
+	}
+
+	if len(got.CustomFields) != len(want.CustomFields) {
+		t.Fatalf("%s: %d custom fields, want %d", want.Title, len(got.CustomFields), len(want.CustomFields))
+	}
+	for i, field := range want.CustomFields {
+		gotField := got.CustomFields[i]
+		if gotField.Name != field.Name || gotField.Type != field.Type {
+			t.Errorf("%s: custom field %q (%s), want %q (%s)", want.Title, gotField.Name, gotField.Type, field.Name, field.Type)
+		}
+
+		wantValue, gotValue := string(field.Value), string(gotField.Value)
+		if field.Type == models.FieldTypeHidden {
+			var err error
+			if wantValue, err = wantPM.decryptSecret(field.Value); err != nil {
+				t.Fatalf("%s: decrypting exported field %q failed: %v", want.Title, field.Name, err)
+			}
+			if gotValue, err = gotPM.decryptSecret(gotField.Value); err != nil {
+				t.Fatalf("%s: decrypting imported field %q failed: %v", want.Title, field.Name, err)
+			}
+		}
+		if gotValue != wantValue {
+			t.Errorf("%s: custom field %q = %q, want %q", want.Title, field.Name, gotValue, wantValue)
+		}
+	}
+
+	if len(got.History) != len(want.History) {
+		t.Fatalf("%s: %d history records, want %d", want.Title, len(got.History), len(want.History))
+	}
+	for i, record := range want.History {
+		wantValue, err := wantPM.decryptSecret(record.Password)
+		if err != nil {
+			t.Fatalf("%s: decrypting exported history failed: %v", want.Title, err)
+		}
+		gotValue, err := gotPM.decryptSecret(got.History[i].Password)
+		if err != nil {
+			t.Fatalf("%s: decrypting imported history failed: %v", want.Title, err)
+		}
+		if gotValue != wantValue || !got.History[i].CreatedAt.Equal(record.CreatedAt) {
+			t.Errorf("%s: history record %q at %v, want %q at %v", want.Title, gotValue, got.History[i].CreatedAt, wantValue, record.CreatedAt)
+		}
+	}
+
+	if len(got.Attachments) != len(want.Attachments) {
+		t.Fatalf("%s: %d attachments, want %d", want.Title, len(got.Attachments), len(want.Attachments))
+	}
+	for i, attachment := range want.Attachments {
+		var wantContent, gotContent bytes.Buffer
+		if err := wantPM.crypto.DecryptStream(&wantContent, bytes.NewReader(attachment.Data), wantPM.masterKey); err != nil {
+			t.Fatalf("%s: decrypting exported attachment failed: %v", want.Title, err)
+		}
+		gotAttachment := got.Attachments[i]
+		if err := gotPM.crypto.DecryptStream(&gotContent, bytes.NewReader(gotAttachment.Data), gotPM.masterKey); err != nil {
+			t.Fatalf("%s: decrypting imported attachment failed: %v", want.Title, err)
+		}
+		if gotAttachment.Name != attachment.Name || gotAttachment.Size != attachment.Size || gotContent.String() != wantContent.String() {
+			t.Errorf("%s: attachment %q (%d bytes) = %q, want %q (%d bytes) = %q", want.Title,
+				gotAttachment.Name, gotAttachment.Size, gotContent.String(), attachment.Name, attachment.Size, wantContent.String())
+		}
+	}
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	pm := newTestManager(t)
+	addExportEntries(t, pm)
+	want, data := exportTestVault(t, pm)
+
+	got, err := pm.readExportFile(bytes.NewReader(data), testExportPassword)
+	if err != nil {
+		t.Fatalf("readExportFile failed: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("read %d entries, want %d", len(got), len(want))
+	}
+	if len(want[0].History) != 1 || len(want[0].Attachments) != 1 {
+		t.Fatalf("exported %d history records and %d attachments, want 1 each", len(want[0].History), len(want[0].Attachments))
+	}
+	for i := range want {
+		compareExportEntries(t, pm, want[i], pm, got[i])
+	}
+}
+
+func TestExportEmptyVault(t *testing.T) {
+	pm := newTestManager(t)
+	_, data := exportTestVault(t, pm)
+
+	entries, err := pm.readExportFile(bytes.NewReader(data), testExportPassword)
+	if err != nil {
+		t.Fatalf("readExportFile failed: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("read %d entries from an empty vault", len(entries))
+	}
+}
+
+func TestExportImportIntoOtherVault(t *testing.T) {
+	pm := newTestManager(t)
+	addExportEntries(t, pm)
+	want, data := exportTestVault(t, pm)
+
+	filename := filepath.Join(t.TempDir(), "vault.pmexport")
+	if err := os.WriteFile(filename, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	other := newTestManager(t)
+	report, err := other.ImportVault(filename, testExportPassword, ImportOptions{Mode: ImportModeReplace})
+	if err != nil {
+		t.Fatalf("ImportVault failed: %v", err)
+	}
+	if report.Added != len(want) {
+		t.Errorf("report = %s, want %d added", report, len(want))
+	}
+
+	got, err := other.storage.ExportData()
+	if err != nil {
+		t.Fatalf("ExportData failed: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("imported %d entries, want %d", len(got), len(want))
+	}
+	for i := range want {
+		compareExportEntries(t, pm, want[i], other, got[i])
+	}
+}
+
+func TestExportImportHistoryInOneSecond(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.db")
+	pm := newTestManagerAt(t, path)
+	id, err := pm.AddPassword(models.PasswordEntry{Title: "GitHub", Password: "hunter1"})
+	if err != nil {
+		t.Fatalf("AddPassword failed: %v", err)
+	}
+	for _, password := range []string{"hunter2", "hunter3", "hunter4"} {
+		setPassword(t, pm, id, password)
+	}
+
+	// Quick successive changes share a timestamp
+	db := openTestDB(t, path)
+	if _, err := db.Exec("UPDATE password_history SET created_at = '2024-03-01 12:00:00'"); err != nil {
+		t.Fatal(err)
+	}
+
+	filename := filepath.Join(t.TempDir(), "vault.pmexport")
+	if err := pm.ExportVault(filename, testExportPassword); err != nil {
+		t.Fatalf("ExportVault failed: %v", err)
+	}
+
+	other := newTestManager(t)
+	if _, err := other.ImportVault(filename, testExportPassword, ImportOptions{Mode: ImportModeAppend}); err != nil {
+		t.Fatalf("ImportVault failed: %v", err)
+	}
+	imported, err := other.GetAllPasswords()
+	if err != nil || len(imported) != 1 {
+		t.Fatalf("GetAllPasswords = %+v, %v, want the imported entry", imported, err)
+	}
+
+	got := historyPasswords(t, other, imported[0].ID)
+	sort.Strings(got)
+	if want := []string{"hunter1", "hunter2", "hunter3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("imported history = %q, want %q", got, want)
+	}
+}
+
+// tamperExport decrypts an export, lets mutate change its plaintext header
+// line and decrypted payload, and encrypts the payload again
+func tamperExport(t *testing.T, pm *PasswordManager, data []byte, mutate func(headerLine, payload []byte) ([]byte, []byte)) []byte {
+	t.Helper()
+
+	r := bufio.NewReader(bytes.NewReader(data[len(exportMagic):]))
+	headerLine, err := r.ReadBytes('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var header ExportHeader
+	if err := json.Unmarshal(headerLine, &header); err != nil {
+		t.Fatal(err)
+	}
+	key, err := pm.crypto.DeriveKeyWithParams(testExportPassword, header.Salt, header.KDF)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decReader, err := pm.crypto.NewDecryptReader(r, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := io.ReadAll(decReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headerLine, payload = mutate(headerLine, payload)
+
+	var buf bytes.Buffer
+	buf.WriteString(exportMagic)
+	buf.Write(headerLine)
+	encWriter, err := pm.crypto.NewEncryptWriter(&buf, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := encWriter.Write(payload); err != nil {
+		t.Fatal(err)
+	}
+	if err := encWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// setEntryCount changes the entry count of a header encoded as JSON
+func setEntryCount(t *testing.T, data []byte, count int) []byte {
+	t.Helper()
+
+	var header map[string]interface{}
+	if err := json.Unmarshal(data, &header); err != nil {
+		t.Fatal(err)
+	}
+	header["entry_count"] = count
+	result, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestReadExportRejects(t *testing.T) {
+	pm := newTestManager(t)
+	addExportEntries(t, pm)
+	_, data := exportTestVault(t, pm)
+
+	tests := []struct {
+		name   string
+		mutate func(headerLine, payload []byte) ([]byte, []byte)
+		err    string
+	}{
+		{
+			name: "unknown header field",
+			mutate: func(headerLine, payload []byte) ([]byte, []byte) {
+				return bytes.Replace(headerLine, []byte("{"), []byte(`{"extra":1,`), 1), payload
+			},
+			err: `invalid export header: json: unknown field "extra"`,
+		},
+		{
+			name: "unknown payload field",
+			mutate: func(headerLine, payload []byte) ([]byte, []byte) {
+				return headerLine, bytes.Replace(payload, []byte("{"), []byte(`{"extra":1,`), 1)
+			},
+			err: `invalid export: json: unknown field "extra"`,
+		},
+		{
+			name: "unknown entry field",
+			mutate: func(headerLine, payload []byte) ([]byte, []byte) {
+				return headerLine, bytes.Replace(payload, []byte(`"title":`), []byte(`"color":"red","title":`), 1)
+			},
+			err: `invalid export: json: unknown field "color"`,
+		},
+		{
+			name: "trailing data after header",
+			mutate: func(headerLine, payload []byte) ([]byte, []byte) {
+				return append(bytes.TrimSuffix(headerLine, []byte("\n")), []byte(" {}\n")...), payload
+			},
+			err: "unexpected data after JSON value",
+		},
+		{
+			name: "trailing data after payload",
+			mutate: func(headerLine, payload []byte) ([]byte, []byte) {
+				return headerLine, append(payload, []byte(`{"header":{}}`)...)
+			},
+			err: "unexpected data after JSON value",
+		},
+		{
+			name: "unsupported format version",
+			mutate: func(headerLine, payload []byte) ([]byte, []byte) {
+				return bytes.Replace(headerLine, []byte(`"format_version":1,`), []byte(`"format_version":2,`), 1), payload
+			},
+			err: "unsupported export format version 2",
+		},
+		{
+			name: "header differs from encrypted copy",
+			mutate: func(headerLine, payload []byte) ([]byte, []byte) {
+				return bytes.Replace(headerLine, []byte(`"created":"20`), []byte(`"created":"19`), 1), payload
+			},
+			err: "export header does not match its encrypted copy",
+		},
+		{
+			name: "entry count mismatch",
+			mutate: func(headerLine, payload []byte) ([]byte, []byte) {
+				var p map[string]json.RawMessage
+				if err := json.Unmarshal(payload, &p); err != nil {
+					t.Fatal(err)
+				}
+				p["header"] = setEntryCount(t, p["header"], 4)
+				payload, err := json.Marshal(p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return append(setEntryCount(t, headerLine, 4), '\n'), payload
+			},
+			err: "export has 3 entries but its header says 4",
+		},
+		{
+			name: "invalid entry",
+			mutate: func(headerLine, payload []byte) ([]byte, []byte) {
+				return headerLine, bytes.Replace(payload, []byte(`"title":"GitHub"`), []byte(`"title":" "`), 1)
+			},
+			err: "export entry 1: missing title",
+		},
+		{
+			name: "tag with a comma",
+			mutate: func(headerLine, payload []byte) ([]byte, []byte) {
+				return headerLine, bytes.Replace(payload, []byte(`"tags":["dev","prod"]`), []byte(`"tags":["dev,prod"]`), 1)
+			},
+			err: `export entry 1: invalid tag "dev,prod": tags cannot contain commas`,
+		},
+		{
+			name: "attachment size mismatch",
+			mutate: func(headerLine, payload []byte) ([]byte, []byte) {
+				size := fmt.Sprintf(`"size":%d`, len(testAttachment))
+				return headerLine, bytes.Replace(payload, []byte(size), []byte(`"size":1`), 1)
+			},
+			err: fmt.Sprintf("content is %d bytes but the attachment says 1", len(testAttachment)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := tamperExport(t, pm, data, tt.mutate)
+			_, err := pm.readExportFile(bytes.NewReader(tampered), testExportPassword)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("readExportFile error = %v, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+
+	// The untouched export must still be readable, so that the cases above
+	// fail for their change alone
+	unchanged := tamperExport(t, pm, data, func(headerLine, payload []byte) ([]byte, []byte) {
+		return headerLine, payload
+	})
+	if _, err := pm.readExportFile(bytes.NewReader(unchanged), testExportPassword); err != nil {
+		t.Fatalf("readExportFile of re-encrypted export failed: %v", err)
+	}
+}
+
+func TestReadExportNormalizesTags(t *testing.T) {
+	pm := newTestManager(t)
+	addExportEntries(t, pm)
+	_, data := exportTestVault(t, pm)
+
+	edited := tamperExport(t, pm, data, func(headerLine, payload []byte) ([]byte, []byte) {
+		return headerLine, bytes.Replace(payload, []byte(`"tags":["dev","prod"]`), []byte(`"tags":["Prod"," dev","DEV"]`), 1)
+	})
+	entries, err := pm.readExportFile(bytes.NewReader(edited), testExportPassword)
+	if err != nil {
+		t.Fatalf("readExportFile failed: %v", err)
+	}
+	if want := []string{"dev", "prod"}; !reflect.DeepEqual(entries[0].Tags, want) {
+		t.Errorf("tags = %q, want %q", entries[0].Tags, want)
+	}
+}
+
+func TestReadExportWrongPasswordOrDamaged(t *testing.T) {
+	pm := newTestManager(t)
+	addExportEntries(t, pm)
+	_, data := exportTestVault(t, pm)
+
+	_, err := pm.readExportFile(bytes.NewReader(data), "wrong password")
+	if err == nil || !strings.Contains(err.Error(), "wrong export password or damaged export file") {
+		t.Errorf("wrong password: error = %v", err)
+	}
+
+	_, err = pm.readExportFile(bytes.NewReader(data[:len(data)-10]), testExportPassword)
+	if err == nil {
+		t.Error("truncated export was read")
+	}
+
+	damaged := bytes.Clone(data)
+	damaged[len(damaged)-20] ^= 1
+	_, err = pm.readExportFile(bytes.NewReader(damaged), testExportPassword)
+	if err == nil {
+		t.Error("damaged export was read")
+	}
+}
+
+// legacyExport encodes entries in the original base64 AES-GCM export format
+func legacyExport(t *testing.T, pm *PasswordManager, entries []map[string]interface{}) []byte {
+	t.Helper()
+
+	jsonData, err := json.Marshal(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encData, err := pm.crypto.Encrypt(string(jsonData), pm.masterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []byte(base64.StdEncoding.EncodeToString(encData))
+}
+
+func TestReadLegacyExport(t *testing.T) {
+	pm := newTestManager(t)
+	encPassword, err := pm.crypto.Encrypt("hunter2", pm.masterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := legacyExport(t, pm, []map[string]interface{}{{
+		"id": 1, "title": "GitHub", "url": "https://github.com", "username": "octocat",
+		"password": encPassword, "notes": nil, "category": "Work",
+		"created_at": "2023-04-05 06:07:08", "updated_at": "2023-04-05 06:07:08",
+	}})
+	entries, err := pm.readExportFile(bytes.NewReader(data), "")
+	if err != nil {
+		t.Fatalf("readExportFile failed: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("read %d entries, want 1", len(entries))
+	}
+
+	entry := entries[0]
+	if entry.Type != models.ItemTypeLogin || entry.Title != "GitHub" || entry.Username != "octocat" {
+		t.Errorf("entry = %+v", entry)
+	}
+	if want := time.Date(2023, 4, 5, 6, 7, 8, 0, time.UTC); !entry.UpdatedAt.Equal(want) {
+		t.Errorf("updated at %v, want %v", entry.UpdatedAt, want)
+	}
+	if password, err := pm.decryptSecret(entry.Password); err != nil || password != "hunter2" {
+		t.Errorf("password = %q, %v", password, err)
+	}
+}
+
+func TestReadLegacyExportRejects(t *testing.T) {
+	pm := newTestManager(t)
+	encPassword, err := pm.crypto.Encrypt("hunter2", pm.masterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		entry map[string]interface{}
+		err   string
+	}{
+		{"missing title", map[string]interface{}{"title": " ", "password": encPassword}, "export entry 1: missing title"},
+		{"missing password", map[string]interface{}{"title": "GitHub"}, "export entry 1: missing password"},
+		{"plaintext password", map[string]interface{}{"title": "GitHub", "password": "hunter2!"}, "made by another vault or is damaged"},
+		{"undecryptable notes", map[string]interface{}{"title": "GitHub", "password": encPassword, "notes": []byte("notes")}, "made by another vault or is damaged"},
+		{"invalid type", map[string]interface{}{"title": "GitHub", "password": encPassword, "type": "car"}, `export entry 1: invalid type "car"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := legacyExport(t, pm, []map[string]interface{}{tt.entry})
+			_, err := pm.readExportFile(bytes.NewReader(data), "")
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("readExportFile error = %v, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+)
+
+// SetCustomField adds a custom field to an entry, replacing any field with the same name
+func (pm *PasswordManager) SetCustomField(id int64, field models.CustomField) error {
+	if !pm.initialized {
+		return errors.New("password manager not initialized")
+	}
+	pm.updateLastActivity()
+
+	fields, err := pm.getCustomFields(id)
+	if err != nil {
+		return err
+	}
+
+	replaced := false
+	for i := range fields {
+		if fields[i].Name == field.Name {
+			fields[i] = field
+			replaced = true
+		}
+	}
+	if !replaced {
+		fields = append(fields, field)
+	}
+
+	err = pm.saveCustomFields(id, fields)
+	if err != nil {
+		return err
+	}
+
+	return pm.logAudit(AuditActionUpdate, AuditResourcePassword, id, "field "+field.Name)
+}
+
+// RemoveCustomField removes a named custom field from an entry
+func (pm *PasswordManager) RemoveCustomField(id int64, name string) error {
+	if !pm.initialized {
+		return errors.New("password manager not initialized")
+	}
+	pm.updateLastActivity()
+
+	fields, err := pm.getCustomFields(id)
+	if err != nil {
+		return err
+	}
+
+	var kept []models.CustomField
+	for _, field := range fields {
+		if field.Name != name {
+			kept = append(kept, field)
+		}
+	}
+	if len(kept) == len(fields) {
+		return fmt.Errorf("custom field %q not found", name)
+	}
+
+	err = pm.saveCustomFields(id, kept)
+	if err != nil {
+		return err
+	}
+
+	return pm.logAudit(AuditActionUpdate, AuditResourcePassword, id, "removed field "+name)
+}
+
+// getCustomFields loads and decrypts the custom fields of an entry
+func (pm *PasswordManager) getCustomFields(id int64) ([]models.CustomField, error) {
+	fields, values, err := pm.storage.GetCustomFields(id)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range fields {
+		if fields[i].Type != models.FieldTypeHidden {
+			fields[i].Value = string(values[i])
+			continue
+		}
+
+		if len(values[i]) > 0 {
+			fields[i].Value, err = pm.crypto.Decrypt(values[i], pm.masterKey)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return fields, nil
+}
+
+// saveCustomFields validates and encrypts custom fields and replaces those stored for an entry
+func (pm *PasswordManager) saveCustomFields(id int64, fields []models.CustomField) error {
+	fields, err := normalizeCustomFields(fields)
+	if err != nil {
+		return err
+	}
+
+	values := make([][]byte, len(fields))
+	for i, field := range fields {
+		if field.Type != models.FieldTypeHidden {
+			values[i] = []byte(field.Value)
+			continue
+		}
+
+		values[i], err = pm.crypto.Encrypt(field.Value, pm.masterKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	return pm.storage.SaveCustomFields(id, fields, values)
+}
+
+// normalizeCustomFields validates custom fields and defaults their type to text
+func normalizeCustomFields(fields []models.CustomField) ([]models.CustomField, error) {
+	seen := make(map[string]bool, len(fields))
+	result := make([]models.CustomField, 0, len(fields))
+
+	for _, field := range fields {
+		field.Name = strings.TrimSpace(field.Name)
+		if field.Name == "" {
+			return nil, errors.New("custom field name cannot be empty")
+		}
+		if seen[field.Name] {
+			return nil, fmt.Errorf("duplicate custom field %q", field.Name)
+		}
+		seen[field.Name] = true
+
+		switch field.Type {
+		case "":
+			field.Type = models.FieldTypeText
+		case models.FieldTypeText, models.FieldTypeHidden:
+		case models.FieldTypeURL:
+			if _, err := url.Parse(field.Value); err != nil {
+				return nil, fmt.Errorf("custom field %q: invalid URL: %w", field.Name, err)
+			}
+		default:
+			return nil, fmt.Errorf("custom field %q: unknown type %q", field.Name, field.Type)
+		}
+
+		result = append(result, field)
+	}
+
+	return result, nil
+}
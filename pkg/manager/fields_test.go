@@ -0,0 +1,175 @@
+package manager
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+)
+
+func TestNormalizeCustomFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []models.CustomField
+		want   []models.CustomField
+		err    string
+	}{
+		{
+			name:   "type defaults to text",
+			fields: []models.CustomField{{Name: " PIN ", Value: "1234"}},
+			want:   []models.CustomField{{Name: "PIN", Type: models.FieldTypeText, Value: "1234"}},
+		},
+		{
+			name: "known types",
+			fields: []models.CustomField{
+				{Name: "Recovery key", Type: models.FieldTypeHidden, Value: "abcd"},
+				{Name: "Admin", Type: models.FieldTypeURL, Value: "https://example.com/admin"},
+			},
+			want: []models.CustomField{
+				{Name: "Recovery key", Type: models.FieldTypeHidden, Value: "abcd"},
+				{Name: "Admin", Type: models.FieldTypeURL, Value: "https://example.com/admin"},
+			},
+		},
+		{
+			name:   "empty name",
+			fields: []models.CustomField{{Name: "  ", Value: "1234"}},
+			err:    "custom field name cannot be empty",
+		},
+		{
+			name:   "duplicate name",
+			fields: []models.CustomField{{Name: "PIN", Value: "1234"}, {Name: "PIN ", Value: "0000"}},
+			err:    `duplicate custom field "PIN"`,
+		},
+		{
+			name:   "invalid URL",
+			fields: []models.CustomField{{Name: "Admin", Type: models.FieldTypeURL, Value: "http://[::1"}},
+			err:    `custom field "Admin": invalid URL`,
+		},
+		{
+			name:   "unknown type",
+			fields: []models.CustomField{{Name: "PIN", Type: "number", Value: "1234"}},
+			err:    `custom field "PIN": unknown type "number"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeCustomFields(tt.fields)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("normalizeCustomFields error = %v, want it to contain %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("normalizeCustomFields failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeCustomFields = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// entryFields returns the custom fields of an entry
+func entryFields(t *testing.T, pm *PasswordManager, id int64) []models.CustomField {
+	t.Helper()
+
+	entry, err := pm.GetPassword(id)
+	if err != nil {
+		t.Fatalf("GetPassword failed: %v", err)
+	}
+	return entry.CustomFields
+}
+
+func TestSetRemoveCustomField(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.db")
+	pm := newTestManagerAt(t, path)
+	db := openTestDB(t, path)
+	id, err := pm.AddPassword(models.PasswordEntry{
+		Title: "Bank", Password: "hunter2",
+		CustomFields: []models.CustomField{{Name: "Branch", Value: "Main Street"}},
+	})
+	if err != nil {
+		t.Fatalf("AddPassword failed: %v", err)
+	}
+
+	if err := pm.SetCustomField(id, models.CustomField{Name: "PIN", Type: models.FieldTypeHidden, Value: "1234"}); err != nil {
+		t.Fatalf("SetCustomField failed: %v", err)
+	}
+	want := []models.CustomField{
+		{Name: "Branch", Type: models.FieldTypeText, Value: "Main Street"},
+		{Name: "PIN", Type: models.FieldTypeHidden, Value: "1234"},
+	}
+	if got := entryFields(t, pm, id); !reflect.DeepEqual(got, want) {
+		t.Errorf("custom fields = %+v, want %+v", got, want)
+	}
+
+	// Hidden values are stored encrypted, other values in the clear
+	stored := make(map[string][]byte)
+	rows, err := db.Query("SELECT name, value FROM custom_fields WHERE password_id = ?", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var name string
+		var value []byte
+		if err := rows.Scan(&name, &value); err != nil {
+			t.Fatal(err)
+		}
+		stored[name] = value
+	}
+	rows.Close()
+	if string(stored["Branch"]) != "Main Street" {
+		t.Errorf("stored Branch value = %q, want it in the clear", stored["Branch"])
+	}
+	if len(stored["PIN"]) == 0 || bytes.Contains(stored["PIN"], []byte("1234")) {
+		t.Errorf("stored PIN value = %q, want it encrypted", stored["PIN"])
+	}
+
+	// Setting a field of the same name replaces it in place
+	if err := pm.SetCustomField(id, models.CustomField{Name: "Branch", Type: models.FieldTypeURL, Value: "https://bank.example.com/branches/12"}); err != nil {
+		t.Fatalf("SetCustomField failed: %v", err)
+	}
+	want[0] = models.CustomField{Name: "Branch", Type: models.FieldTypeURL, Value: "https://bank.example.com/branches/12"}
+	if got := entryFields(t, pm, id); !reflect.DeepEqual(got, want) {
+		t.Errorf("custom fields = %+v, want %+v", got, want)
+	}
+
+	// Invalid fields are rejected and leave the entry unchanged
+	invalid := []struct {
+		name  string
+		field models.CustomField
+		err   string
+	}{
+		{"empty name", models.CustomField{Value: "x"}, "custom field name cannot be empty"},
+		{"unknown type", models.CustomField{Name: "Account", Type: "number", Value: "42"}, `unknown type "number"`},
+		{"invalid URL", models.CustomField{Name: "Portal", Type: models.FieldTypeURL, Value: "http://[::1"}, "invalid URL"},
+		{"duplicate name", models.CustomField{Name: "PIN ", Value: "0000"}, `duplicate custom field "PIN"`},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			err := pm.SetCustomField(id, tt.field)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("SetCustomField error = %v, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+	if got := entryFields(t, pm, id); !reflect.DeepEqual(got, want) {
+		t.Errorf("custom fields = %+v, want %+v", got, want)
+	}
+
+	if err := pm.RemoveCustomField(id, "Branch"); err != nil {
+		t.Fatalf("RemoveCustomField failed: %v", err)
+	}
+	if got := entryFields(t, pm, id); !reflect.DeepEqual(got, want[1:]) {
+		t.Errorf("custom fields = %+v, want %+v", got, want[1:])
+	}
+	err = pm.RemoveCustomField(id, "Branch")
+	if err == nil || !strings.Contains(err.Error(), `custom field "Branch" not found`) {
+		t.Errorf("RemoveCustomField error = %v, want it to contain %q", err, `custom field "Branch" not found`)
+	}
+}
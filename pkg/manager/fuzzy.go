@@ -0,0 +1,277 @@
+package manager
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+)
+
+// Fuzzy match scoring. A query matches a field either as a subsequence of it
+// or, to tolerate typos, as a word within a small edit distance.
+const (
+	fuzzyScoreMatch       = 1
+	fuzzyScoreConsecutive = 8
+	fuzzyScoreBoundary    = 12
+	fuzzyScoreStart       = 16
+	fuzzyPenaltyGap       = 1
+	fuzzyScoreTypo        = 6
+	fuzzyPenaltyTypo      = 12
+)
+
+// fuzzyFields are the searchable fields of an entry with the bonus given to
+// matches in each of them
+var fuzzyFields = []struct {
+	name  string
+	bonus int
+	value func(models.PasswordEntry) string
+}{
+	{"title", 20, func(e models.PasswordEntry) string { return e.Title }},
+	{"username", 10, func(e models.PasswordEntry) string { return e.Username }},
+	{"url", 10, func(e models.PasswordEntry) string { return e.URL }},
+	{"tags", 5, func(e models.PasswordEntry) string { return strings.Join(e.Tags, ", ") }},
+	{"category", 0, func(e models.PasswordEntry) string { return e.Category }},
+}
+
+// FuzzyMatch is an entry matched by FuzzySearch. Field names the field that
+// matched best and Highlights holds the rune offsets of the matched
+// characters in Value, the content of that field.
+type FuzzyMatch struct {
+	Entry      models.PasswordEntry
+	Score      int
+	Field      string
+	Value      string
+	Highlights []int
+}
+
+// Highlight returns the matched field value with every run of matched
+// characters wrapped in open and close
+func (m FuzzyMatch) Highlight(open, close string) string {
+	highlighted := make(map[int]bool, len(m.Highlights))
+	for _, i := range m.Highlights {
+		highlighted[i] = true
+	}
+
+	var b strings.Builder
+	inside := false
+	for i, r := range []rune(m.Value) {
+		if highlighted[i] != inside {
+			inside = !inside
+			if inside {
+				b.WriteString(open)
+			} else {
+				b.WriteString(close)
+			}
+		}
+		b.WriteRune(r)
+	}
+	if inside {
+		b.WriteString(close)
+	}
+	return b.String()
+}
+
+// FuzzySearch ranks the entries outside the trash by how well their title,
+// username, URL, tags and category match the query, tolerating typos. At most
+// limit matches are returned; a limit of zero returns all of them.
+func (pm *PasswordManager) FuzzySearch(query string, limit int) ([]FuzzyMatch, error) {
+	if !pm.initialized {
+		return nil, errors.New("password manager not initialized")
+	}
+
+	entries, err := pm.GetAllPasswords()
+	if err != nil {
+		return nil, err
+	}
+
+	needle := lowerRunes(strings.TrimSpace(query))
+	if len(needle) == 0 {
+		return nil, nil
+	}
+
+	var matches []FuzzyMatch
+	for _, entry := range entries {
+		best := FuzzyMatch{Entry: entry}
+		for _, field := range fuzzyFields {
+			value := field.value(entry)
+			score, highlights := fuzzyScore(needle, value)
+			if highlights == nil {
+				continue
+			}
+			score += field.bonus
+			if best.Highlights == nil || score > best.Score {
+				best.Score = score
+				best.Field = field.name
+				best.Value = value
+				best.Highlights = highlights
+			}
+		}
+		if best.Highlights != nil {
+			matches = append(matches, best)
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return strings.ToLower(matches[i].Entry.Title) < strings.ToLower(matches[j].Entry.Title)
+	})
+
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+// fuzzyScore scores how well the lower-case needle matches value, returning
+// the matched rune offsets or nil if it does not match
+func fuzzyScore(needle []rune, value string) (int, []int) {
+	haystack := lowerRunes(value)
+
+	score, highlights := subsequenceScore(needle, haystack)
+	if typoScore, typoHighlights := typoScore(needle, haystack); typoHighlights != nil && (highlights == nil || typoScore > score) {
+		return typoScore, typoHighlights
+	}
+	return score, highlights
+}
+
+// subsequenceScore finds the best placement of needle as a subsequence of
+// haystack, rewarding matches at word starts and runs of consecutive characters
+func subsequenceScore(needle, haystack []rune) (int, []int) {
+	bestScore := 0
+	var best []int
+
+	for start := range haystack {
+		if haystack[start] != needle[0] {
+			continue
+		}
+
+		positions := make([]int, 0, len(needle))
+		score := 0
+		n := 0
+		for i := start; i < len(haystack) && n < len(needle); i++ {
+			if haystack[i] != needle[n] {
+				continue
+			}
+
+			score += fuzzyScoreMatch
+			switch {
+			case i == 0:
+				score += fuzzyScoreStart
+			case isWordBoundary(haystack, i):
+				score += fuzzyScoreBoundary
+			}
+			if n > 0 {
+				if gap := i - positions[n-1] - 1; gap == 0 {
+					score += fuzzyScoreConsecutive
+				} else {
+					score -= fuzzyPenaltyGap * min(gap, 8)
+				}
+			}
+
+			positions = append(positions, i)
+			n++
+		}
+
+		if n == len(needle) && (best == nil || score > bestScore) {
+			bestScore = score
+			best = positions
+		}
+	}
+
+	return bestScore, best
+}
+
+// typoScore matches needle against the words of haystack, and their
+// prefixes of the same length, allowing a few edits depending on its length
+func typoScore(needle, haystack []rune) (int, []int) {
+	allowed := len(needle) / 4
+	if allowed == 0 {
+		return 0, nil
+	}
+
+	bestDistance := allowed + 1
+	var best []int
+	for start := 0; start < len(haystack); start++ {
+		if !isWordChar(haystack[start]) || (start > 0 && isWordChar(haystack[start-1])) {
+			continue
+		}
+		end := start
+		for end < len(haystack) && isWordChar(haystack[end]) {
+			end++
+		}
+
+		// Compare against the whole word and its prefix, so that partly typed
+		// words match as well
+		candidates := []int{end}
+		if prefix := start + len(needle); prefix < end {
+			candidates = append(candidates, prefix)
+		}
+		for _, stop := range candidates {
+			distance := editDistance(needle, haystack[start:stop])
+			if distance < bestDistance {
+				bestDistance = distance
+				best = make([]int, 0, stop-start)
+				for i := start; i < stop; i++ {
+					best = append(best, i)
+				}
+			}
+		}
+	}
+
+	if best == nil {
+		return 0, nil
+	}
+	return fuzzyScoreTypo*len(needle) - fuzzyPenaltyTypo*bestDistance, best
+}
+
+// editDistance returns the Damerau-Levenshtein distance between a and b,
+// counting an adjacent transposition as a single edit
+func editDistance(a, b []rune) int {
+	rows := make([][]int, len(a)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(b)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			rows[i][j] = min(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				rows[i][j] = min(rows[i][j], rows[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return rows[len(a)][len(b)]
+}
+
+// lowerRunes lower-cases s rune by rune, so that offsets into the result are
+// offsets into s as well
+func lowerRunes(s string) []rune {
+	runes := []rune(s)
+	for i, r := range runes {
+		runes[i] = unicode.ToLower(r)
+	}
+	return runes
+}
+
+// isWordBoundary reports whether the rune at i starts a word
+func isWordBoundary(s []rune, i int) bool {
+	return isWordChar(s[i]) && !isWordChar(s[i-1])
+}
+
+// isWordChar reports whether r is part of a word
+func isWordChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,144 @@
+package manager
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+)
+
+// fuzzyTestManager returns a vault holding entries with the given titles
+func fuzzyTestManager(t *testing.T, titles ...string) *PasswordManager {
+	t.Helper()
+
+	pm := newTestManager(t)
+	for _, title := range titles {
+		if _, err := pm.AddPassword(models.PasswordEntry{Title: title, Password: "hunter2"}); err != nil {
+			t.Fatalf("AddPassword(%q) failed: %v", title, err)
+		}
+	}
+	return pm
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"github", "github", 0},
+		{"githbu", "github", 1},
+		{"gihtub", "github", 1},
+		{"gitub", "github", 1},
+		{"githuub", "github", 1},
+		{"gitlab", "github", 2},
+		{"kitten", "sitting", 3},
+		{"", "abc", 3},
+		{"zürich", "zurich", 1},
+	}
+
+	for _, tt := range tests {
+		if got := editDistance([]rune(tt.a), []rune(tt.b)); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestFuzzyScore(t *testing.T) {
+	tests := []struct {
+		query, value string
+		highlights   []int
+	}{
+		// A transposition is within the single edit allowed for six runes
+		{"githbu", "GitHub", []int{0, 1, 2, 3, 4, 5}},
+		// Partly typed words match their prefix
+		{"gihtu", "GitHub", []int{0, 1, 2, 3, 4}},
+		// Subsequences prefer word starts
+		{"gh", "GitHub", []int{0, 3}},
+		{"ac", "My GitHub account", []int{10, 11}},
+		// Short queries allow no typos
+		{"gti", "GitHub", nil},
+		{"githbu", "GitLab", nil},
+		// Offsets count runes, not bytes
+		{"züri", "Café Zürich", []int{5, 6, 7, 8}},
+		{"fé", "Café Zürich", []int{2, 3}},
+	}
+
+	for _, tt := range tests {
+		_, highlights := fuzzyScore(lowerRunes(tt.query), tt.value)
+		if !reflect.DeepEqual(highlights, tt.highlights) {
+			t.Errorf("fuzzyScore(%q, %q) highlights %v, want %v", tt.query, tt.value, highlights, tt.highlights)
+		}
+	}
+}
+
+func TestFuzzySearchRanking(t *testing.T) {
+	pm := fuzzyTestManager(t, "GitHib", "GitLab", "My GitHub", "Bank")
+
+	matches, err := pm.FuzzySearch("github", 0)
+	if err != nil {
+		t.Fatalf("FuzzySearch failed: %v", err)
+	}
+
+	// The subsequence match ranks above the one a typo away; GitLab is too far
+	var titles []string
+	for _, match := range matches {
+		titles = append(titles, match.Entry.Title)
+	}
+	if want := []string{"My GitHub", "GitHib"}; !reflect.DeepEqual(titles, want) {
+		t.Fatalf("matched %q, want %q", titles, want)
+	}
+	if matches[0].Score <= matches[1].Score {
+		t.Errorf("subsequence score %d is not above typo score %d", matches[0].Score, matches[1].Score)
+	}
+	if matches[0].Field != "title" {
+		t.Errorf("matched field %q, want title", matches[0].Field)
+	}
+	if got := matches[0].Highlight("[", "]"); got != "My [GitHub]" {
+		t.Errorf("Highlight = %q, want %q", got, "My [GitHub]")
+	}
+}
+
+func TestFuzzySearchHighlightRunes(t *testing.T) {
+	pm := fuzzyTestManager(t, "Café Zürich")
+
+	matches, err := pm.FuzzySearch("zri", 0)
+	if err != nil {
+		t.Fatalf("FuzzySearch failed: %v", err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("got %d matches, want 1", len(matches))
+	}
+	if got, want := matches[0].Highlight("<", ">"), "Café <Z>ü<ri>ch"; got != want {
+		t.Errorf("Highlight = %q, want %q", got, want)
+	}
+}
+
+func TestFuzzySearchLimit(t *testing.T) {
+	pm := fuzzyTestManager(t, "Amazon", "Atlassian", "Apple", "Zoo")
+
+	tests := []struct {
+		limit int
+		want  []string
+	}{
+		{0, []string{"Amazon", "Apple", "Atlassian"}},
+		{2, []string{"Amazon", "Apple"}},
+		{10, []string{"Amazon", "Apple", "Atlassian"}},
+	}
+	for _, tt := range tests {
+		matches, err := pm.FuzzySearch("a", tt.limit)
+		if err != nil {
+			t.Fatalf("FuzzySearch failed: %v", err)
+		}
+		var titles []string
+		for _, match := range matches {
+			titles = append(titles, match.Entry.Title)
+		}
+		if !reflect.DeepEqual(titles, tt.want) {
+			t.Errorf("limit %d matched %q, want %q", tt.limit, titles, tt.want)
+		}
+	}
+
+	if matches, err := pm.FuzzySearch("  ", 0); err != nil || matches != nil {
+		t.Errorf("blank query = %v, %v, want no matches", matches, err)
+	}
+}
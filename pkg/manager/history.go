@@ -0,0 +1,115 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+)
+
+// Password history retention settings
+const (
+	settingHistoryRetention = "history_retention"
+
+	// DefaultHistoryRetention is the number of previous passwords kept per entry
+	DefaultHistoryRetention = 10
+)
+
+// GetPasswordHistory retrieves the previous passwords of an entry, newest first
+func (pm *PasswordManager) GetPasswordHistory(id int64) ([]models.PasswordHistoryEntry, error) {
+	if !pm.initialized {
+		return nil, errors.New("password manager not initialized")
+	}
+	pm.updateLastActivity()
+
+	entries, encPasswords, err := pm.storage.GetPasswordHistory(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decrypt previous passwords
+	for i := range entries {
+		password, err := pm.crypto.Decrypt(encPasswords[i], pm.masterKey)
+		if err != nil {
+			return nil, err
+		}
+		entries[i].Password = password
+	}
+
+	return entries, nil
+}
+
+// RestorePasswordVersion makes a previous password current again. The password
+// being replaced is itself archived, so a restore can be undone.
+func (pm *PasswordManager) RestorePasswordVersion(historyID int64) error {
+	if !pm.initialized {
+		return errors.New("password manager not initialized")
+	}
+	pm.updateLastActivity()
+
+	version, encPassword, err := pm.storage.GetPasswordHistoryEntry(historyID)
+	if err != nil {
+		return err
+	}
+
+	password, err := pm.crypto.Decrypt(encPassword, pm.masterKey)
+	if err != nil {
+		return err
+	}
+
+	entry, err := pm.GetPassword(version.PasswordID)
+	if err != nil {
+		return err
+	}
+	entry.Password = password
+
+	return pm.UpdatePassword(entry)
+}
+
+// GetHistoryRetention returns how many previous passwords are kept per entry.
+// Zero means history is never pruned.
+func (pm *PasswordManager) GetHistoryRetention() (int, error) {
+	value, err := pm.storage.GetSetting(settingHistoryRetention)
+	if err != nil {
+		return 0, err
+	}
+	if value == "" {
+		return DefaultHistoryRetention, nil
+	}
+
+	return strconv.Atoi(value)
+}
+
+// SetHistoryRetention sets how many previous passwords are kept per entry and
+// prunes existing history to the new limit. Zero keeps all history.
+func (pm *PasswordManager) SetHistoryRetention(limit int) error {
+	if !pm.initialized {
+		return errors.New("password manager not initialized")
+	}
+	pm.updateLastActivity()
+
+	if limit < 0 {
+		return errors.New("history retention cannot be negative")
+	}
+
+	err := pm.storage.SaveSetting(settingHistoryRetention, strconv.Itoa(limit))
+	if err != nil {
+		return fmt.Errorf("failed to save history retention: %w", err)
+	}
+
+	return pm.pruneHistory(0)
+}
+
+// pruneHistory applies the retention limit to an entry, or to all entries if id is 0
+func (pm *PasswordManager) pruneHistory(id int64) error {
+	limit, err := pm.GetHistoryRetention()
+	if err != nil {
+		return err
+	}
+	if limit == 0 {
+		return nil
+	}
+
+	return pm.storage.PrunePasswordHistory(id, limit)
+}
@@ -0,0 +1,172 @@
+package manager
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+)
+
+// historyPasswords returns the previous passwords of an entry, newest first
+func historyPasswords(t *testing.T, pm *PasswordManager, id int64) []string {
+	t.Helper()
+
+	history, err := pm.GetPasswordHistory(id)
+	if err != nil {
+		t.Fatalf("GetPasswordHistory failed: %v", err)
+	}
+
+	var passwords []string
+	for _, record := range history {
+		if record.PasswordID != id {
+			t.Errorf("history record %d belongs to entry %d, want %d", record.ID, record.PasswordID, id)
+		}
+		passwords = append(passwords, record.Password)
+	}
+	return passwords
+}
+
+// setPassword changes the password of an entry
+func setPassword(t *testing.T, pm *PasswordManager, id int64, password string) {
+	t.Helper()
+
+	entry, err := pm.GetPassword(id)
+	if err != nil {
+		t.Fatalf("GetPassword failed: %v", err)
+	}
+	entry.Password = password
+	if err := pm.UpdatePassword(entry); err != nil {
+		t.Fatalf("UpdatePassword failed: %v", err)
+	}
+}
+
+func TestPasswordHistoryArchivesChanges(t *testing.T) {
+	pm := newTestManager(t)
+	id, err := pm.AddPassword(models.PasswordEntry{Title: "GitHub", Password: "hunter1"})
+	if err != nil {
+		t.Fatalf("AddPassword failed: %v", err)
+	}
+	if got := historyPasswords(t, pm, id); len(got) != 0 {
+		t.Errorf("history of a new entry = %q, want none", got)
+	}
+
+	// Edits that keep the password are not archived
+	entry, err := pm.GetPassword(id)
+	if err != nil {
+		t.Fatalf("GetPassword failed: %v", err)
+	}
+	entry.Title = "GitHub (personal)"
+	entry.Notes = "Recovery codes are in the safe"
+	if err := pm.UpdatePassword(entry); err != nil {
+		t.Fatalf("UpdatePassword failed: %v", err)
+	}
+	setPassword(t, pm, id, "hunter1")
+	if got := historyPasswords(t, pm, id); len(got) != 0 {
+		t.Errorf("history after edits keeping the password = %q, want none", got)
+	}
+
+	setPassword(t, pm, id, "hunter2")
+	setPassword(t, pm, id, "hunter3")
+	if got, want := historyPasswords(t, pm, id), []string{"hunter2", "hunter1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("history = %q, want %q", got, want)
+	}
+}
+
+func TestRestorePasswordVersion(t *testing.T) {
+	pm := newTestManager(t)
+	id, err := pm.AddPassword(models.PasswordEntry{Title: "GitHub", Password: "hunter1"})
+	if err != nil {
+		t.Fatalf("AddPassword failed: %v", err)
+	}
+	setPassword(t, pm, id, "hunter2")
+	setPassword(t, pm, id, "hunter3")
+
+	history, err := pm.GetPasswordHistory(id)
+	if err != nil {
+		t.Fatalf("GetPasswordHistory failed: %v", err)
+	}
+	if err := pm.RestorePasswordVersion(history[1].ID); err != nil {
+		t.Fatalf("RestorePasswordVersion failed: %v", err)
+	}
+
+	// The restored password is current and the replaced one is archived, so
+	// that the restore can be undone
+	entry, err := pm.GetPassword(id)
+	if err != nil {
+		t.Fatalf("GetPassword failed: %v", err)
+	}
+	if entry.Password != "hunter1" {
+		t.Errorf("password = %q, want the restored hunter1", entry.Password)
+	}
+	if got, want := historyPasswords(t, pm, id), []string{"hunter3", "hunter2", "hunter1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("history = %q, want %q", got, want)
+	}
+
+	history, err = pm.GetPasswordHistory(id)
+	if err != nil {
+		t.Fatalf("GetPasswordHistory failed: %v", err)
+	}
+	if err := pm.RestorePasswordVersion(history[0].ID); err != nil {
+		t.Fatalf("RestorePasswordVersion failed: %v", err)
+	}
+	if entry, err = pm.GetPassword(id); err != nil || entry.Password != "hunter3" {
+		t.Errorf("password = %q, %v, want hunter3 back", entry.Password, err)
+	}
+
+	if err := pm.RestorePasswordVersion(history[0].ID + 100); err == nil {
+		t.Error("RestorePasswordVersion of an unknown record succeeded")
+	}
+}
+
+func TestHistoryRetention(t *testing.T) {
+	pm := newTestManager(t)
+	ids := addTestEntries(t, pm,
+		models.PasswordEntry{Title: "GitHub", Password: "github0"},
+		models.PasswordEntry{Title: "GitLab", Password: "gitlab0"},
+	)
+	github, gitlab := ids["GitHub"], ids["GitLab"]
+
+	limit, err := pm.GetHistoryRetention()
+	if err != nil || limit != DefaultHistoryRetention {
+		t.Errorf("GetHistoryRetention = %d, %v, want %d", limit, err, DefaultHistoryRetention)
+	}
+
+	for _, password := range []string{"github1", "github2", "github3", "github4"} {
+		setPassword(t, pm, github, password)
+	}
+	setPassword(t, pm, gitlab, "gitlab1")
+
+	// Lowering the limit prunes every entry to the newest records
+	if err := pm.SetHistoryRetention(2); err != nil {
+		t.Fatalf("SetHistoryRetention failed: %v", err)
+	}
+	if got, want := historyPasswords(t, pm, github), []string{"github3", "github2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GitHub history = %q, want %q", got, want)
+	}
+	if got, want := historyPasswords(t, pm, gitlab), []string{"gitlab0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GitLab history = %q, want %q", got, want)
+	}
+
+	// Later changes keep to the limit
+	setPassword(t, pm, github, "github5")
+	if got, want := historyPasswords(t, pm, github), []string{"github4", "github3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GitHub history = %q, want %q", got, want)
+	}
+
+	// Zero keeps all history
+	if err := pm.SetHistoryRetention(0); err != nil {
+		t.Fatalf("SetHistoryRetention failed: %v", err)
+	}
+	setPassword(t, pm, github, "github6")
+	setPassword(t, pm, github, "github7")
+	if got := historyPasswords(t, pm, github); len(got) != 4 {
+		t.Errorf("GitHub history = %q, want 4 records", got)
+	}
+
+	if err := pm.SetHistoryRetention(-1); err == nil {
+		t.Error("SetHistoryRetention accepted a negative limit")
+	}
+	if limit, err := pm.GetHistoryRetention(); err != nil || limit != 0 {
+		t.Errorf("GetHistoryRetention = %d, %v, want 0", limit, err)
+	}
+}
@@ -0,0 +1,438 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+	"github.com/loganmanery/passmanager/pkg/otp"
+)
+
+// Import modes
+const (
+	// ImportModeAppend adds every imported entry as a new entry
+	ImportModeAppend = "append"
+	// ImportModeReplace removes every existing entry before importing
+	ImportModeReplace = "replace"
+	// ImportModeMerge matches imported entries to existing ones by UUID,
+	// adding new entries and resolving entries that exist on both sides.
+	// An entry in the trash that is overwritten by an import is restored.
+	ImportModeMerge = "merge"
+)
+
+// ConflictResolution decides what happens to an entry that exists in both the
+// vault and the import with different contents
+type ConflictResolution int
+
+// Conflict resolutions
+const (
+	// ResolveNewest keeps whichever version was updated last
+	ResolveNewest ConflictResolution = iota
+	// ResolveKeepExisting keeps the entry in the vault
+	ResolveKeepExisting
+	// ResolveUseImported overwrites the entry in the vault with the imported one
+	ResolveUseImported
+	// ResolveKeepBoth adds the imported entry as a new entry
+	ResolveKeepBoth
+)
+
+// ImportOptions controls how an import combines entries with the vault
+type ImportOptions struct {
+	Mode string
+
+	// DryRun plans the import and reports it without changing the vault
+	DryRun bool
+
+	// Resolve is asked about every conflict in merge mode. Only the title,
+	// URL, username and update time of the imported entry are set. When nil,
+	// or when it returns ResolveNewest, the newest version wins.
+	Resolve func(existing, imported models.PasswordEntry) ConflictResolution
+}
+
+// ImportConflict is an entry that existed in both the vault and the import
+type ImportConflict struct {
+	UUID       string
+	Title      string
+	Resolution ConflictResolution
+}
+
+// ImportedEntry is an entry that an import added or updated
+type ImportedEntry struct {
+	Title    string
+	Type     string
+	Category string
+	Updated  bool
+}
+
+// ImportReport summarizes the outcome of an import. Warnings describe items
+// of a file from another password manager that were skipped or could only be
+// imported in part.
+type ImportReport struct {
+	Added     int
+	Updated   int
+	Skipped   int
+	Conflicts []ImportConflict
+	Entries   []ImportedEntry
+	Warnings  []string
+}
+
+// String summarizes the report in a single line
+func (r ImportReport) String() string {
+	summary := fmt.Sprintf("%d added, %d updated, %d skipped, %d conflicting",
+		r.Added, r.Updated, r.Skipped, len(r.Conflicts))
+	if len(r.Warnings) > 0 {
+		summary += fmt.Sprintf(", %d warnings", len(r.Warnings))
+	}
+	return summary
+}
+
+// importWarnings collects the warnings of an importer about the parts of a
+// file it skipped or changed
+type importWarnings []string
+
+// warnf adds a warning
+func (w *importWarnings) warnf(format string, args ...interface{}) {
+	*w = append(*w, fmt.Sprintf(format, args...))
+}
+
+// ImportSource holds the entries read from the file of another password
+// manager, encrypted with the vault key, so that an import can be previewed
+// with a dry run and then carried out without reading the file again
+type ImportSource struct {
+	pm       *PasswordManager
+	name     string
+	entries  []models.ExportEntry
+	warnings importWarnings
+}
+
+// importSource wraps the entries and warnings of an importer. Name is the
+// file format recorded in the audit log.
+func (pm *PasswordManager) importSource(name string, entries []models.ExportEntry, warnings importWarnings) *ImportSource {
+	return &ImportSource{pm: pm, name: name, entries: entries, warnings: warnings}
+}
+
+// Import combines the entries of the source with the vault as selected by the
+// import options
+func (s *ImportSource) Import(options ImportOptions) (ImportReport, error) {
+	if !s.pm.initialized {
+		return ImportReport{}, errors.New("password manager not initialized")
+	}
+	s.pm.updateLastActivity()
+
+	return s.pm.importEntries(s.entries, options, s.name, s.warnings)
+}
+
+// importEntries combines entries read from a file with the vault as selected
+// by the import options and records the import in the audit log. Source names
+// the file format in the log and is empty for native exports. The warnings
+// of the importer become the warnings of the report.
+func (pm *PasswordManager) importEntries(entries []models.ExportEntry, options ImportOptions, source string, warnings importWarnings) (ImportReport, error) {
+	// Decide which entries to add and which to update
+	added, updated, report, err := pm.planImport(entries, options)
+	if err != nil {
+		return ImportReport{}, err
+	}
+	report.Warnings = warnings
+
+	for _, entry := range added {
+		report.Entries = append(report.Entries, ImportedEntry{Title: entry.Title, Type: entry.Type, Category: entry.Category})
+	}
+	for _, entry := range updated {
+		report.Entries = append(report.Entries, ImportedEntry{Title: entry.Title, Type: entry.Type, Category: entry.Category, Updated: true})
+	}
+
+	if options.DryRun {
+		return report, nil
+	}
+
+	// Import into storage
+	err = pm.storage.ImportData(added, updated, options.Mode == ImportModeReplace)
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	// Updated entries and imported history can exceed the retention limit
+	err = pm.pruneHistory(0)
+	if err != nil {
+		return ImportReport{}, fmt.Errorf("failed to prune password history: %w", err)
+	}
+
+	details := fmt.Sprintf("%s: %s", options.Mode, report)
+	if source != "" {
+		details = source + " " + details
+	}
+	return report, pm.logAudit(AuditActionImport, AuditResourceVault, 0, details)
+}
+
+// encryptImported validates an entry read from another password manager the
+// way AddPassword does and encrypts its secrets with the vault key. Missing
+// timestamps default to now; a missing or invalid UUID is assigned on import.
+func (pm *PasswordManager) encryptImported(entry models.PasswordEntry) (models.ExportEntry, error) {
+	entry.Title = strings.TrimSpace(entry.Title)
+	if entry.Title == "" {
+		return models.ExportEntry{}, errors.New("entry has no title")
+	}
+
+	result, err := pm.encryptEntry(entry)
+	if err != nil {
+		return models.ExportEntry{}, err
+	}
+
+	result.CreatedAt = entry.CreatedAt.UTC().Truncate(time.Second)
+	result.UpdatedAt = entry.LastUpdated.UTC().Truncate(time.Second)
+	if models.IsUUID(entry.UUID) {
+		result.UUID = strings.ToLower(entry.UUID)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	if result.CreatedAt.IsZero() {
+		result.CreatedAt = now
+	}
+	if result.UpdatedAt.IsZero() {
+		result.UpdatedAt = result.CreatedAt
+	}
+
+	return result, nil
+}
+
+// encryptEntry validates an entry and encrypts its password, notes, one-time
+// password secret, type-specific data and hidden custom fields with the vault
+// key, leaving out its UUID and timestamps
+func (pm *PasswordManager) encryptEntry(entry models.PasswordEntry) (models.ExportEntry, error) {
+	var err error
+	entry.Tags, err = normalizeTags(entry.Tags)
+	if err != nil {
+		return models.ExportEntry{}, err
+	}
+
+	entry.CustomFields, err = normalizeCustomFields(entry.CustomFields)
+	if err != nil {
+		return models.ExportEntry{}, err
+	}
+
+	entry.TOTP, err = normalizeTOTP(entry.TOTP)
+	if err != nil {
+		return models.ExportEntry{}, err
+	}
+
+	err = normalizeItem(&entry)
+	if err != nil {
+		return models.ExportEntry{}, err
+	}
+
+	err = normalizeURLMatch(&entry)
+	if err != nil {
+		return models.ExportEntry{}, err
+	}
+
+	result := models.ExportEntry{
+		Type:     entry.Type,
+		Title:    entry.Title,
+		URL:      entry.URL,
+		URLMatch: entry.URLMatch,
+		Username: entry.Username,
+		Category: entry.Category,
+		Tags:     entry.Tags,
+	}
+
+	// The password is always stored encrypted, even when empty
+	result.Password, err = pm.crypto.Encrypt(entry.Password, pm.masterKey)
+	if err != nil {
+		return models.ExportEntry{}, err
+	}
+
+	result.Notes, err = pm.encryptSecret(entry.Notes)
+	if err != nil {
+		return models.ExportEntry{}, err
+	}
+
+	if entry.TOTP != "" {
+		key, err := otp.Parse(entry.TOTP)
+		if err != nil {
+			return models.ExportEntry{}, err
+		}
+		result.OTPCounter = key.Counter
+
+		result.TOTP, err = pm.encryptSecret(entry.TOTP)
+		if err != nil {
+			return models.ExportEntry{}, err
+		}
+	}
+
+	if data := itemData(&entry); data != nil {
+		plaintext, err := json.Marshal(data)
+		if err != nil {
+			return models.ExportEntry{}, err
+		}
+		result.ItemData, err = pm.encryptSecret(string(plaintext))
+		if err != nil {
+			return models.ExportEntry{}, err
+		}
+	}
+
+	for _, field := range entry.CustomFields {
+		value := []byte(field.Value)
+		if field.Type == models.FieldTypeHidden {
+			value, err = pm.crypto.Encrypt(field.Value, pm.masterKey)
+			if err != nil {
+				return models.ExportEntry{}, err
+			}
+		}
+		result.CustomFields = append(result.CustomFields, models.ExportCustomField{Name: field.Name, Type: field.Type, Value: value})
+	}
+
+	return result, nil
+}
+
+// encryptImportedHistory encrypts the previous passwords of an entry read
+// from another password manager. Missing timestamps default to the import time.
+func (pm *PasswordManager) encryptImportedHistory(history []models.PasswordHistoryEntry) ([]models.ExportHistory, error) {
+	result := make([]models.ExportHistory, 0, len(history))
+	for _, record := range history {
+		password, err := pm.crypto.Encrypt(record.Password, pm.masterKey)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, models.ExportHistory{Password: password, CreatedAt: record.CreatedAt.UTC().Truncate(time.Second)})
+	}
+	return result, nil
+}
+
+// encryptImportedAttachment encrypts the content of an attachment read from
+// another password manager the way AddAttachment does
+func (pm *PasswordManager) encryptImportedAttachment(name string, content []byte) (models.ExportAttachment, error) {
+	if name == "" {
+		return models.ExportAttachment{}, errors.New("attachment name cannot be empty")
+	}
+
+	var buf bytes.Buffer
+	if err := pm.crypto.EncryptStream(&buf, bytes.NewReader(content), pm.masterKey); err != nil {
+		return models.ExportAttachment{}, err
+	}
+	return models.ExportAttachment{Name: name, Size: int64(len(content)), Data: buf.Bytes()}, nil
+}
+
+// uniqueFieldName returns name, or name with a number appended if a custom
+// field of that name is already in fields
+func uniqueFieldName(fields []models.CustomField, name string) string {
+	taken := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		taken[field.Name] = true
+	}
+
+	unique := name
+	for i := 2; taken[unique]; i++ {
+		unique = fmt.Sprintf("%s (%d)", name, i)
+	}
+	return unique
+}
+
+// planImport splits imported entries into the ones to add and the ones that
+// update an existing entry, filling in the report
+func (pm *PasswordManager) planImport(entries []models.ExportEntry, options ImportOptions) ([]models.ExportEntry, []models.ExportEntry, ImportReport, error) {
+	var report ImportReport
+
+	switch options.Mode {
+	case ImportModeAppend, ImportModeReplace:
+		report.Added = len(entries)
+		return entries, nil, report, nil
+	case ImportModeMerge:
+	default:
+		return nil, nil, report, fmt.Errorf("unknown import mode %q", options.Mode)
+	}
+
+	versions, err := pm.storage.GetEntryVersions()
+	if err != nil {
+		return nil, nil, report, err
+	}
+
+	var added, updated []models.ExportEntry
+	for _, entry := range entries {
+		entryUUID := strings.ToLower(entry.UUID)
+		entry.UUID = entryUUID
+		existing, ok := versions[entryUUID]
+		if entryUUID == "" || !ok {
+			added = append(added, entry)
+			report.Added++
+			continue
+		}
+
+		imported := importedSummary(entry)
+		if imported.LastUpdated.Equal(existing.LastUpdated) {
+			report.Skipped++
+			continue
+		}
+
+		resolution := ResolveNewest
+		if options.Resolve != nil {
+			resolution = options.Resolve(existing, imported)
+		}
+		if resolution == ResolveNewest {
+			resolution = ResolveKeepExisting
+			if imported.LastUpdated.After(existing.LastUpdated) {
+				resolution = ResolveUseImported
+			}
+		}
+
+		report.Conflicts = append(report.Conflicts, ImportConflict{UUID: entryUUID, Title: existing.Title, Resolution: resolution})
+		switch resolution {
+		case ResolveKeepExisting:
+			report.Skipped++
+		case ResolveUseImported:
+			entry.Password, err = pm.storedPassword(existing.ID, entry.Password)
+			if err != nil {
+				return nil, nil, report, err
+			}
+			updated = append(updated, entry)
+			report.Updated++
+		case ResolveKeepBoth:
+			// The UUID is taken, so the entry is added under a new one
+			added = append(added, entry)
+			report.Added++
+		default:
+			return nil, nil, report, fmt.Errorf("invalid conflict resolution %d", resolution)
+		}
+	}
+
+	return added, updated, report, nil
+}
+
+// storedPassword returns the stored ciphertext of the entry id if encPassword
+// decrypts to the same password, so that importing an unchanged password does
+// not archive it in the history, and encPassword otherwise
+func (pm *PasswordManager) storedPassword(id int64, encPassword []byte) ([]byte, error) {
+	_, currentEncPassword, _, err := pm.storage.GetPassword(id)
+	if err != nil {
+		return nil, err
+	}
+
+	currentPassword, err := pm.crypto.Decrypt(currentEncPassword, pm.masterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	password, err := pm.crypto.Decrypt(encPassword, pm.masterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if password == currentPassword {
+		return currentEncPassword, nil
+	}
+	return encPassword, nil
+}
+
+// importedSummary returns the non-sensitive fields of an imported entry
+func importedSummary(entry models.ExportEntry) models.PasswordEntry {
+	return models.PasswordEntry{
+		UUID:        entry.UUID,
+		Title:       entry.Title,
+		URL:         entry.URL,
+		Username:    entry.Username,
+		LastUpdated: entry.UpdatedAt,
+	}
+}
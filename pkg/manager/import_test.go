@@ -0,0 +1,361 @@
+package manager
+
+import (
+	"bytes"
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+)
+
+// mergeTestTime is the update time of every entry in an export made by
+// newMergeTestVault
+var mergeTestTime = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// mergeTestVault is a vault with two entries and an export of them
+type mergeTestVault struct {
+	pm             *PasswordManager
+	db             *sql.DB
+	github, gitlab int64
+	export         []byte
+}
+
+// newMergeTestVault creates a vault with two entries last updated at
+// mergeTestTime and exports it
+func newMergeTestVault(t *testing.T) *mergeTestVault {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "vault.db")
+	v := &mergeTestVault{pm: newTestManagerAt(t, path), db: openTestDB(t, path)}
+
+	var err error
+	v.github, err = v.pm.AddPassword(models.PasswordEntry{
+		Title: "GitHub", Username: "octocat", Password: "hunter2", Tags: []string{"dev"},
+		CustomFields: []models.CustomField{{Name: "PIN", Type: models.FieldTypeHidden, Value: "1234"}},
+	})
+	if err != nil {
+		t.Fatalf("AddPassword failed: %v", err)
+	}
+	v.gitlab, err = v.pm.AddPassword(models.PasswordEntry{Title: "GitLab", Username: "tanuki", Password: "gitlab1"})
+	if err != nil {
+		t.Fatalf("AddPassword failed: %v", err)
+	}
+
+	v.setUpdated(t, v.github, mergeTestTime)
+	v.setUpdated(t, v.gitlab, mergeTestTime)
+	_, v.export = exportTestVault(t, v.pm)
+	return v
+}
+
+// setUpdated sets the update time of an entry behind the password manager's back
+func (v *mergeTestVault) setUpdated(t *testing.T, id int64, updated time.Time) {
+	t.Helper()
+
+	_, err := v.db.Exec("UPDATE passwords SET updated_at = ? WHERE id = ?", updated.UTC().Format("2006-01-02 15:04:05"), id)
+	if err != nil {
+		t.Fatalf("setting update time failed: %v", err)
+	}
+}
+
+// merge imports the export of the vault back into it in merge mode
+func (v *mergeTestVault) merge(t *testing.T, options ImportOptions) ImportReport {
+	t.Helper()
+
+	entries, err := v.pm.readExportFile(bytes.NewReader(v.export), testExportPassword)
+	if err != nil {
+		t.Fatalf("readExportFile failed: %v", err)
+	}
+	options.Mode = ImportModeMerge
+	report, err := v.pm.importEntries(entries, options, "", nil)
+	if err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+	return report
+}
+
+// password returns the current password of an entry
+func (v *mergeTestVault) password(t *testing.T, id int64) string {
+	t.Helper()
+
+	entry, err := v.pm.GetPassword(id)
+	if err != nil {
+		t.Fatalf("GetPassword failed: %v", err)
+	}
+	return entry.Password
+}
+
+// changePassword updates the password of an entry, which sets its update time to now
+func (v *mergeTestVault) changePassword(t *testing.T, id int64, password string) {
+	t.Helper()
+
+	entry, err := v.pm.GetPassword(id)
+	if err != nil {
+		t.Fatalf("GetPassword failed: %v", err)
+	}
+	entry.Password = password
+	if err := v.pm.UpdatePassword(entry); err != nil {
+		t.Fatalf("UpdatePassword failed: %v", err)
+	}
+}
+
+// conflictResolutions maps the titles of the conflicts in a report to their resolution
+func conflictResolutions(report ImportReport) map[string]ConflictResolution {
+	result := make(map[string]ConflictResolution)
+	for _, conflict := range report.Conflicts {
+		result[conflict.Title] = conflict.Resolution
+	}
+	return result
+}
+
+func TestImportMergeUnchanged(t *testing.T) {
+	v := newMergeTestVault(t)
+
+	// Entries with the same update time are skipped without asking, even if
+	// their contents differ
+	if _, err := v.db.Exec("UPDATE passwords SET title = 'GitHub (renamed)' WHERE id = ?", v.github); err != nil {
+		t.Fatal(err)
+	}
+	report := v.merge(t, ImportOptions{
+		Resolve: func(existing, imported models.PasswordEntry) ConflictResolution {
+			t.Errorf("Resolve called for %q with equal update times", existing.Title)
+			return ResolveNewest
+		},
+	})
+
+	if report.Added != 0 || report.Updated != 0 || report.Skipped != 2 || len(report.Conflicts) != 0 {
+		t.Errorf("report = %s, want 2 skipped without conflicts", report)
+	}
+	entry, err := v.pm.GetPassword(v.github)
+	if err != nil {
+		t.Fatalf("GetPassword failed: %v", err)
+	}
+	if entry.Title != "GitHub (renamed)" {
+		t.Errorf("title = %q, want the skipped entry unchanged", entry.Title)
+	}
+}
+
+func TestImportMergeAddsMissing(t *testing.T) {
+	v := newMergeTestVault(t)
+	if err := v.pm.DeletePassword(v.gitlab); err != nil {
+		t.Fatalf("DeletePassword failed: %v", err)
+	}
+	if err := v.pm.PurgePassword(v.gitlab); err != nil {
+		t.Fatalf("PurgePassword failed: %v", err)
+	}
+
+	report := v.merge(t, ImportOptions{})
+	if report.Added != 1 || report.Skipped != 1 || len(report.Conflicts) != 0 {
+		t.Errorf("report = %s, want 1 added and 1 skipped", report)
+	}
+
+	entries, err := v.pm.SearchPasswords(models.SearchParams{Keyword: "GitLab"})
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("SearchPasswords = %v, %v, want the purged entry back", entries, err)
+	}
+	if got := v.password(t, entries[0].ID); got != "gitlab1" {
+		t.Errorf("password = %q, want %q", got, "gitlab1")
+	}
+}
+
+func TestImportMergeNewestWins(t *testing.T) {
+	v := newMergeTestVault(t)
+
+	// GitHub was changed after the export, GitLab before it
+	v.changePassword(t, v.github, "hunter3")
+	v.changePassword(t, v.gitlab, "gitlab2")
+	v.setUpdated(t, v.gitlab, mergeTestTime.Add(-time.Hour))
+	if err := v.pm.DeletePassword(v.gitlab); err != nil {
+		t.Fatalf("DeletePassword failed: %v", err)
+	}
+
+	// A dry run reports the plan without carrying it out
+	preview := v.merge(t, ImportOptions{DryRun: true})
+	if got := v.password(t, v.gitlab); got != "gitlab2" {
+		t.Errorf("dry run changed the password to %q", got)
+	}
+
+	report := v.merge(t, ImportOptions{})
+	for _, r := range []ImportReport{preview, report} {
+		if r.Added != 0 || r.Updated != 1 || r.Skipped != 1 {
+			t.Errorf("report = %s, want 1 updated and 1 skipped", r)
+		}
+		want := map[string]ConflictResolution{"GitHub": ResolveKeepExisting, "GitLab": ResolveUseImported}
+		if got := conflictResolutions(r); !reflect.DeepEqual(got, want) {
+			t.Errorf("conflicts = %v, want %v", got, want)
+		}
+	}
+
+	if got := v.password(t, v.github); got != "hunter3" {
+		t.Errorf("GitHub password = %q, want the newer vault password", got)
+	}
+	if got := v.password(t, v.gitlab); got != "gitlab1" {
+		t.Errorf("GitLab password = %q, want the newer imported password", got)
+	}
+
+	// The overwritten entry is restored from the trash with its replaced
+	// password in the history
+	trash, err := v.pm.GetTrash()
+	if err != nil {
+		t.Fatalf("GetTrash failed: %v", err)
+	}
+	if len(trash) != 0 {
+		t.Errorf("trash holds %d entries, want the overwritten entry restored", len(trash))
+	}
+	history, err := v.pm.GetPasswordHistory(v.gitlab)
+	if err != nil {
+		t.Fatalf("GetPasswordHistory failed: %v", err)
+	}
+	if len(history) == 0 || history[0].Password != "gitlab2" {
+		t.Errorf("history = %+v, want the replaced password archived first", history)
+	}
+}
+
+func TestImportMergeKeepsLaterEdits(t *testing.T) {
+	tests := []struct {
+		name  string
+		edit  func(pm *PasswordManager, id int64) error
+		check func(t *testing.T, entry models.PasswordEntry)
+	}{
+		{
+			name: "added tag",
+			edit: func(pm *PasswordManager, id int64) error { return pm.AddTags(id, "prod") },
+			check: func(t *testing.T, entry models.PasswordEntry) {
+				if want := []string{"dev", "prod"}; !reflect.DeepEqual(entry.Tags, want) {
+					t.Errorf("tags = %q, want %q", entry.Tags, want)
+				}
+			},
+		},
+		{
+			name: "removed tag",
+			edit: func(pm *PasswordManager, id int64) error { return pm.RemoveTags(id, "dev") },
+			check: func(t *testing.T, entry models.PasswordEntry) {
+				if len(entry.Tags) != 0 {
+					t.Errorf("tags = %q, want none", entry.Tags)
+				}
+			},
+		},
+		{
+			name: "set custom field",
+			edit: func(pm *PasswordManager, id int64) error {
+				return pm.SetCustomField(id, models.CustomField{Name: "PIN", Type: models.FieldTypeHidden, Value: "9999"})
+			},
+			check: func(t *testing.T, entry models.PasswordEntry) {
+				if len(entry.CustomFields) != 1 || entry.CustomFields[0].Value != "9999" {
+					t.Errorf("custom fields = %+v, want PIN 9999", entry.CustomFields)
+				}
+			},
+		},
+		{
+			name: "removed custom field",
+			edit: func(pm *PasswordManager, id int64) error { return pm.RemoveCustomField(id, "PIN") },
+			check: func(t *testing.T, entry models.PasswordEntry) {
+				if len(entry.CustomFields) != 0 {
+					t.Errorf("custom fields = %+v, want none", entry.CustomFields)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newMergeTestVault(t)
+			if err := tt.edit(v.pm, v.github); err != nil {
+				t.Fatalf("edit failed: %v", err)
+			}
+
+			entry, err := v.pm.GetPassword(v.github)
+			if err != nil {
+				t.Fatalf("GetPassword failed: %v", err)
+			}
+			if !entry.LastUpdated.After(mergeTestTime) {
+				t.Errorf("update time = %v, want the edit to update it", entry.LastUpdated)
+			}
+
+			report := v.merge(t, ImportOptions{})
+			if report.Updated != 0 || conflictResolutions(report)["GitHub"] != ResolveKeepExisting {
+				t.Errorf("report = %s with conflicts %v, want the edited entry kept", report, report.Conflicts)
+			}
+
+			entry, err = v.pm.GetPassword(v.github)
+			if err != nil {
+				t.Fatalf("GetPassword failed: %v", err)
+			}
+			tt.check(t, entry)
+		})
+	}
+}
+
+func TestImportMergeResolve(t *testing.T) {
+	tests := []struct {
+		name       string
+		resolution ConflictResolution
+		added      int
+		updated    int
+		skipped    int
+		password   string
+	}{
+		{name: "newest", resolution: ResolveNewest, skipped: 1, password: "hunter3"},
+		{name: "keep existing", resolution: ResolveKeepExisting, skipped: 1, password: "hunter3"},
+		{name: "use imported", resolution: ResolveUseImported, updated: 1, password: "hunter2"},
+		{name: "keep both", resolution: ResolveKeepBoth, added: 1, password: "hunter3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newMergeTestVault(t)
+			v.changePassword(t, v.github, "hunter3")
+
+			var calls int
+			report := v.merge(t, ImportOptions{
+				Resolve: func(existing, imported models.PasswordEntry) ConflictResolution {
+					calls++
+					if existing.ID != v.github || existing.Title != "GitHub" || !existing.LastUpdated.After(mergeTestTime) {
+						t.Errorf("existing = %+v, want the edited GitHub entry", existing)
+					}
+					if imported.Title != "GitHub" || imported.Username != "octocat" || !imported.LastUpdated.Equal(mergeTestTime) {
+						t.Errorf("imported = %+v, want the exported GitHub entry", imported)
+					}
+					if imported.Password != "" {
+						t.Error("imported entry passed to Resolve has a password")
+					}
+					return tt.resolution
+				},
+			})
+
+			if calls != 1 {
+				t.Errorf("Resolve called %d times, want once", calls)
+			}
+
+			// GitLab is unchanged and skipped in every case
+			if report.Added != tt.added || report.Updated != tt.updated || report.Skipped != tt.skipped+1 {
+				t.Errorf("report = %s, want %d added, %d updated, %d skipped", report, tt.added, tt.updated, tt.skipped+1)
+			}
+
+			want := tt.resolution
+			if want == ResolveNewest {
+				want = ResolveKeepExisting
+			}
+			if len(report.Conflicts) != 1 || report.Conflicts[0].Resolution != want {
+				t.Errorf("conflicts = %+v, want GitHub resolved as %d", report.Conflicts, want)
+			}
+
+			if got := v.password(t, v.github); got != tt.password {
+				t.Errorf("password = %q, want %q", got, tt.password)
+			}
+
+			entries, err := v.pm.SearchPasswords(models.SearchParams{Keyword: "GitHub"})
+			if err != nil {
+				t.Fatalf("SearchPasswords failed: %v", err)
+			}
+			if len(entries) != 1+tt.added {
+				t.Fatalf("found %d GitHub entries, want %d", len(entries), 1+tt.added)
+			}
+			if tt.added > 0 && entries[0].UUID == entries[1].UUID {
+				t.Errorf("kept copy shares UUID %s with the existing entry", entries[0].UUID)
+			}
+		})
+	}
+}
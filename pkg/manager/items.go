@@ -0,0 +1,385 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+	"golang.org/x/crypto/ssh"
+)
+
+// Wi-Fi security modes
+const (
+	WiFiSecurityOpen = "open"
+	WiFiSecurityWEP  = "wep"
+	WiFiSecurityWPA  = "wpa"
+	WiFiSecurityWPA2 = "wpa2"
+	WiFiSecurityWPA3 = "wpa3"
+)
+
+// ParseItemType resolves an item type name or a common alias to an item type
+func ParseItemType(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	value = strings.NewReplacer("-", "_", " ", "_").Replace(value)
+
+	switch value {
+	case "", "password":
+		return models.ItemTypeLogin, nil
+	case "note":
+		return models.ItemTypeSecureNote, nil
+	case "ssh":
+		return models.ItemTypeSSHKey, nil
+	case "api", "api_key":
+		return models.ItemTypeAPICredential, nil
+	case "wi_fi":
+		return models.ItemTypeWiFi, nil
+	}
+
+	for _, typ := range models.ItemTypes {
+		if value == typ {
+			return typ, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown item type %q", value)
+}
+
+// normalizeItem validates the type-specific data of an entry, filling in
+// derived values and dropping data that does not belong to its type
+func normalizeItem(entry *models.PasswordEntry) error {
+	typ, err := ParseItemType(entry.Type)
+	if err != nil {
+		return err
+	}
+	entry.Type = typ
+
+	card, identity, sshKey, apiCredential, wifi := entry.Card, entry.Identity, entry.SSHKey, entry.APICredential, entry.WiFi
+	entry.Card, entry.Identity, entry.SSHKey, entry.APICredential, entry.WiFi = nil, nil, nil, nil, nil
+
+	switch typ {
+	case models.ItemTypeSecureNote:
+		if strings.TrimSpace(entry.Notes) == "" {
+			return errors.New("secure note must not be empty")
+		}
+	case models.ItemTypeCard:
+		if card == nil {
+			return errors.New("card details are required")
+		}
+		entry.Card = card
+		return normalizeCard(card)
+	case models.ItemTypeIdentity:
+		if identity == nil {
+			return errors.New("identity details are required")
+		}
+		entry.Identity = identity
+		return normalizeIdentity(identity)
+	case models.ItemTypeSSHKey:
+		if sshKey == nil {
+			return errors.New("SSH key details are required")
+		}
+		entry.SSHKey = sshKey
+		return normalizeSSHKey(sshKey, entry.Password)
+	case models.ItemTypeAPICredential:
+		if apiCredential == nil {
+			return errors.New("API credential details are required")
+		}
+		entry.APICredential = apiCredential
+		return normalizeAPICredential(apiCredential, entry.Password)
+	case models.ItemTypeWiFi:
+		if wifi == nil {
+			return errors.New("Wi-Fi details are required")
+		}
+		entry.WiFi = wifi
+		return normalizeWiFi(wifi, entry.Password)
+	}
+
+	return nil
+}
+
+// normalizeCard validates a payment card and detects its brand
+func normalizeCard(card *models.CardData) error {
+	number := strings.NewReplacer(" ", "", "-", "").Replace(card.Number)
+	if len(number) < 12 || len(number) > 19 || !isDigits(number) {
+		return errors.New("card number must have 12 to 19 digits")
+	}
+	if !luhnValid(number) {
+		return errors.New("card number failed the checksum")
+	}
+	card.Number = number
+
+	if card.Brand == "" {
+		card.Brand = cardBrand(number)
+	}
+
+	if card.ExpiryMonth < 0 || card.ExpiryMonth > 12 {
+		return errors.New("card expiry month must be between 1 and 12")
+	}
+	if card.ExpiryYear > 0 && card.ExpiryYear < 100 {
+		card.ExpiryYear += 2000
+	}
+	if card.ExpiryYear < 0 || (card.ExpiryYear > 0 && card.ExpiryYear < 1970) {
+		return errors.New("invalid card expiry year")
+	}
+	if (card.ExpiryMonth == 0) != (card.ExpiryYear == 0) {
+		return errors.New("card expiry needs both month and year")
+	}
+
+	card.CVV = strings.TrimSpace(card.CVV)
+	if card.CVV != "" && (len(card.CVV) < 3 || len(card.CVV) > 4 || !isDigits(card.CVV)) {
+		return errors.New("card security code must have 3 or 4 digits")
+	}
+
+	card.PIN = strings.TrimSpace(card.PIN)
+	if card.PIN != "" && (len(card.PIN) < 4 || len(card.PIN) > 12 || !isDigits(card.PIN)) {
+		return errors.New("card PIN must have 4 to 12 digits")
+	}
+
+	return nil
+}
+
+// luhnValid checks the Luhn checksum of a card number
+func luhnValid(number string) bool {
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		digit := int(number[i] - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// cardBrand guesses the brand of a card from its number
+func cardBrand(number string) string {
+	prefix := func(n int) int {
+		value := 0
+		for _, c := range number[:n] {
+			value = value*10 + int(c-'0')
+		}
+		return value
+	}
+
+	switch {
+	case number[0] == '4':
+		return "Visa"
+	case prefix(2) >= 51 && prefix(2) <= 55, prefix(4) >= 2221 && prefix(4) <= 2720:
+		return "Mastercard"
+	case prefix(2) == 34 || prefix(2) == 37:
+		return "American Express"
+	case prefix(4) == 6011 || prefix(2) == 65:
+		return "Discover"
+	case prefix(4) >= 3528 && prefix(4) <= 3589:
+		return "JCB"
+	case prefix(2) == 36 || prefix(2) == 38 || (prefix(3) >= 300 && prefix(3) <= 305):
+		return "Diners Club"
+	}
+	return ""
+}
+
+// normalizeIdentity validates an identity
+func normalizeIdentity(identity *models.IdentityData) error {
+	if identity.FirstName == "" && identity.LastName == "" && identity.Company == "" {
+		return errors.New("identity needs a name or company")
+	}
+
+	if identity.Email != "" {
+		addr, err := mail.ParseAddress(identity.Email)
+		if err != nil {
+			return fmt.Errorf("invalid identity email: %w", err)
+		}
+		identity.Email = addr.Address
+	}
+
+	return nil
+}
+
+// normalizeSSHKey validates an SSH private key and derives its public key and
+// fingerprint. An encrypted key is opened with the entry's password.
+func normalizeSSHKey(key *models.SSHKeyData, passphrase string) error {
+	key.PrivateKey = strings.TrimSpace(key.PrivateKey)
+	if key.PrivateKey == "" {
+		return errors.New("SSH private key is required")
+	}
+
+	signer, err := ssh.ParsePrivateKey([]byte(key.PrivateKey))
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		if passphrase == "" {
+			return errors.New("SSH private key is encrypted; its passphrase is required")
+		}
+		signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(key.PrivateKey), []byte(passphrase))
+	}
+	if err != nil {
+		return fmt.Errorf("invalid SSH private key: %w", err)
+	}
+
+	publicKey := signer.PublicKey()
+	if key.PublicKey != "" {
+		given, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key.PublicKey))
+		if err != nil {
+			return fmt.Errorf("invalid SSH public key: %w", err)
+		}
+		if ssh.FingerprintSHA256(given) != ssh.FingerprintSHA256(publicKey) {
+			return errors.New("SSH public key does not match the private key")
+		}
+	} else {
+		key.PublicKey = strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey)))
+	}
+	key.Fingerprint = ssh.FingerprintSHA256(publicKey)
+
+	return nil
+}
+
+// normalizeAPICredential validates an API credential
+func normalizeAPICredential(credential *models.APICredentialData, secret string) error {
+	credential.KeyID = strings.TrimSpace(credential.KeyID)
+	if credential.KeyID == "" && secret == "" {
+		return errors.New("API credential needs a key ID or secret")
+	}
+
+	credential.ExpiresAt = strings.TrimSpace(credential.ExpiresAt)
+	if credential.ExpiresAt != "" {
+		if _, err := time.Parse("2006-01-02", credential.ExpiresAt); err != nil {
+			return errors.New("API credential expiry must be a date like 2006-01-02")
+		}
+	}
+
+	return nil
+}
+
+// normalizeWiFi validates a Wi-Fi network and its passphrase
+func normalizeWiFi(wifi *models.WiFiData, passphrase string) error {
+	if wifi.SSID == "" || len(wifi.SSID) > 32 {
+		return errors.New("Wi-Fi SSID must have 1 to 32 bytes")
+	}
+
+	wifi.Security = strings.ToLower(strings.TrimSpace(wifi.Security))
+	switch wifi.Security {
+	case "":
+		wifi.Security = WiFiSecurityWPA2
+	case WiFiSecurityOpen, WiFiSecurityWEP, WiFiSecurityWPA, WiFiSecurityWPA2, WiFiSecurityWPA3:
+	default:
+		return fmt.Errorf("unknown Wi-Fi security %q", wifi.Security)
+	}
+
+	switch wifi.Security {
+	case WiFiSecurityOpen:
+		if passphrase != "" {
+			return errors.New("open Wi-Fi networks have no passphrase")
+		}
+	case WiFiSecurityWEP:
+		switch len(passphrase) {
+		case 5, 13:
+		case 10, 26:
+			if !isHex(passphrase) {
+				return errors.New("WEP key must be hexadecimal")
+			}
+		default:
+			return errors.New("WEP key must have 5 or 13 characters, or 10 or 26 hex digits")
+		}
+	default:
+		if len(passphrase) == 64 {
+			if !isHex(passphrase) {
+				return errors.New("64 character WPA key must be hexadecimal")
+			}
+		} else if len(passphrase) < 8 || len(passphrase) > 63 {
+			return errors.New("WPA passphrase must have 8 to 63 characters")
+		}
+	}
+
+	return nil
+}
+
+// itemData returns the type-specific data of an entry, or nil if it has none
+func itemData(entry *models.PasswordEntry) interface{} {
+	switch {
+	case entry.Card != nil:
+		return entry.Card
+	case entry.Identity != nil:
+		return entry.Identity
+	case entry.SSHKey != nil:
+		return entry.SSHKey
+	case entry.APICredential != nil:
+		return entry.APICredential
+	case entry.WiFi != nil:
+		return entry.WiFi
+	}
+	return nil
+}
+
+// loadItemData decrypts the type-specific data of an entry into the field
+// matching its type
+func (pm *PasswordManager) loadItemData(entry *models.PasswordEntry) error {
+	encData, err := pm.storage.GetItemData(entry.ID)
+	if err != nil {
+		return err
+	}
+	if len(encData) == 0 {
+		return nil
+	}
+
+	plaintext, err := pm.crypto.Decrypt(encData, pm.masterKey)
+	if err != nil {
+		return err
+	}
+
+	target := newItemData(entry)
+	if target == nil {
+		return nil
+	}
+
+	return json.Unmarshal([]byte(plaintext), target)
+}
+
+// newItemData sets the field matching the type of an entry to empty
+// type-specific data and returns it, or returns nil if the type has none
+func newItemData(entry *models.PasswordEntry) interface{} {
+	switch entry.Type {
+	case models.ItemTypeCard:
+		entry.Card = &models.CardData{}
+		return entry.Card
+	case models.ItemTypeIdentity:
+		entry.Identity = &models.IdentityData{}
+		return entry.Identity
+	case models.ItemTypeSSHKey:
+		entry.SSHKey = &models.SSHKeyData{}
+		return entry.SSHKey
+	case models.ItemTypeAPICredential:
+		entry.APICredential = &models.APICredentialData{}
+		return entry.APICredential
+	case models.ItemTypeWiFi:
+		entry.WiFi = &models.WiFiData{}
+		return entry.WiFi
+	}
+	return nil
+}
+
+// isDigits reports whether s consists only of ASCII digits
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// isHex reports whether s consists only of hexadecimal digits
+func isHex(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'f') && !(c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,363 @@
+package manager
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestParseItemType(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", models.ItemTypeLogin},
+		{"password", models.ItemTypeLogin},
+		{" Login ", models.ItemTypeLogin},
+		{"note", models.ItemTypeSecureNote},
+		{"secure-note", models.ItemTypeSecureNote},
+		{"Secure Note", models.ItemTypeSecureNote},
+		{"card", models.ItemTypeCard},
+		{"identity", models.ItemTypeIdentity},
+		{"ssh", models.ItemTypeSSHKey},
+		{"ssh_key", models.ItemTypeSSHKey},
+		{"api", models.ItemTypeAPICredential},
+		{"API key", models.ItemTypeAPICredential},
+		{"wi-fi", models.ItemTypeWiFi},
+		{"wifi", models.ItemTypeWiFi},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseItemType(tt.value)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseItemType(%q) = %q, %v, want %q", tt.value, got, err, tt.want)
+		}
+	}
+
+	for _, value := range []string{"bank account", "logins"} {
+		if got, err := ParseItemType(value); err == nil {
+			t.Errorf("ParseItemType(%q) = %q, want an error", value, got)
+		}
+	}
+}
+
+func TestLuhnValid(t *testing.T) {
+	tests := []struct {
+		number string
+		want   bool
+	}{
+		{"4111111111111111", true},
+		{"4111111111111112", false},
+		{"5555555555554444", true},
+		{"378282246310005", true},
+		{"378282246310006", false},
+		{"79927398713", true},
+		{"79927398710", false},
+		{"0000000000000", true},
+	}
+
+	for _, tt := range tests {
+		if got := luhnValid(tt.number); got != tt.want {
+			t.Errorf("luhnValid(%q) = %v, want %v", tt.number, got, tt.want)
+		}
+	}
+}
+
+func TestCardBrand(t *testing.T) {
+	tests := []struct {
+		number string
+		want   string
+	}{
+		{"4111111111111111", "Visa"},
+		{"5555555555554444", "Mastercard"},
+		{"5105105105105100", "Mastercard"},
+		{"2223003122003222", "Mastercard"},
+		{"378282246310005", "American Express"},
+		{"341111111111111", "American Express"},
+		{"6011111111111117", "Discover"},
+		{"6500000000000002", "Discover"},
+		{"3530111333300000", "JCB"},
+		{"30569309025904", "Diners Club"},
+		{"38520000023237", "Diners Club"},
+		{"36227206271667", "Diners Club"},
+		{"1234567812345670", ""},
+		{"2720990000000007", "Mastercard"},
+		{"2721000000000004", ""},
+	}
+
+	for _, tt := range tests {
+		if got := cardBrand(tt.number); got != tt.want {
+			t.Errorf("cardBrand(%q) = %q, want %q", tt.number, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeCard(t *testing.T) {
+	card := models.CardData{Number: "4111 1111-1111 1111", ExpiryMonth: 3, ExpiryYear: 29, CVV: " 123 ", PIN: "0000"}
+	if err := normalizeCard(&card); err != nil {
+		t.Fatalf("normalizeCard failed: %v", err)
+	}
+	want := models.CardData{Brand: "Visa", Number: "4111111111111111", ExpiryMonth: 3, ExpiryYear: 2029, CVV: "123", PIN: "0000"}
+	if card != want {
+		t.Errorf("normalizeCard = %+v, want %+v", card, want)
+	}
+
+	// A brand given by the user is kept
+	card = models.CardData{Number: "4111111111111111", Brand: "Visa Electron"}
+	if err := normalizeCard(&card); err != nil || card.Brand != "Visa Electron" {
+		t.Errorf("normalizeCard = %+v, %v, want the brand kept", card, err)
+	}
+
+	tests := []struct {
+		name string
+		card models.CardData
+		err  string
+	}{
+		{"too short", models.CardData{Number: "41111111111"}, "must have 12 to 19 digits"},
+		{"too long", models.CardData{Number: "41111111111111111111"}, "must have 12 to 19 digits"},
+		{"letters", models.CardData{Number: "4111x11111111111"}, "must have 12 to 19 digits"},
+		{"checksum", models.CardData{Number: "4111111111111112"}, "failed the checksum"},
+		{"month", models.CardData{Number: "4111111111111111", ExpiryMonth: 13, ExpiryYear: 2030}, "month must be between 1 and 12"},
+		{"year", models.CardData{Number: "4111111111111111", ExpiryMonth: 1, ExpiryYear: 1969}, "invalid card expiry year"},
+		{"month without year", models.CardData{Number: "4111111111111111", ExpiryMonth: 1}, "needs both month and year"},
+		{"year without month", models.CardData{Number: "4111111111111111", ExpiryYear: 2030}, "needs both month and year"},
+		{"short security code", models.CardData{Number: "4111111111111111", CVV: "12"}, "3 or 4 digits"},
+		{"security code letters", models.CardData{Number: "4111111111111111", CVV: "12a"}, "3 or 4 digits"},
+		{"short PIN", models.CardData{Number: "4111111111111111", PIN: "123"}, "4 to 12 digits"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := normalizeCard(&tt.card)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("normalizeCard error = %v, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
+
+// testSSHKey returns a new Ed25519 private key in OpenSSH format, encrypted
+// with passphrase unless it is empty, and its public key
+func testSSHKey(t *testing.T, passphrase string) (string, ssh.PublicKey) {
+	t.Helper()
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var block *pem.Block
+	if passphrase == "" {
+		block, err = ssh.MarshalPrivateKey(private, "test key")
+	} else {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(private, "test key", []byte(passphrase))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sshPublic, err := ssh.NewPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(block)), sshPublic
+}
+
+func TestNormalizeSSHKey(t *testing.T) {
+	private, public := testSSHKey(t, "")
+	encrypted, encryptedPublic := testSSHKey(t, "open sesame")
+	_, otherPublic := testSSHKey(t, "")
+	authorized := func(key ssh.PublicKey) string {
+		return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+	}
+
+	tests := []struct {
+		name       string
+		key        models.SSHKeyData
+		passphrase string
+		public     ssh.PublicKey
+	}{
+		{"derived public key", models.SSHKeyData{PrivateKey: "\n" + private + "\n"}, "", public},
+		{"matching public key", models.SSHKeyData{PrivateKey: private, PublicKey: authorized(public) + " octocat@example.com"}, "", public},
+		{"encrypted", models.SSHKeyData{PrivateKey: encrypted}, "open sesame", encryptedPublic},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := tt.key
+			if err := normalizeSSHKey(&key, tt.passphrase); err != nil {
+				t.Fatalf("normalizeSSHKey failed: %v", err)
+			}
+			if key.PrivateKey != strings.TrimSpace(tt.key.PrivateKey) {
+				t.Error("private key was changed beyond trimming")
+			}
+			if want := ssh.FingerprintSHA256(tt.public); key.Fingerprint != want {
+				t.Errorf("fingerprint = %q, want %q", key.Fingerprint, want)
+			}
+			if tt.key.PublicKey == "" && key.PublicKey != authorized(tt.public) {
+				t.Errorf("public key = %q, want %q", key.PublicKey, authorized(tt.public))
+			}
+			if tt.key.PublicKey != "" && key.PublicKey != tt.key.PublicKey {
+				t.Errorf("public key = %q, want the given key kept", key.PublicKey)
+			}
+		})
+	}
+
+	rejects := []struct {
+		name       string
+		key        models.SSHKeyData
+		passphrase string
+		err        string
+	}{
+		{"missing", models.SSHKeyData{PrivateKey: "  "}, "", "SSH private key is required"},
+		{"not a key", models.SSHKeyData{PrivateKey: "ssh-ed25519 AAAA"}, "", "invalid SSH private key"},
+		{"missing passphrase", models.SSHKeyData{PrivateKey: encrypted}, "", "its passphrase is required"},
+		{"wrong passphrase", models.SSHKeyData{PrivateKey: encrypted}, "open barley", "invalid SSH private key"},
+		{"invalid public key", models.SSHKeyData{PrivateKey: private, PublicKey: "ssh-ed25519 !!"}, "", "invalid SSH public key"},
+		{"other public key", models.SSHKeyData{PrivateKey: private, PublicKey: authorized(otherPublic)}, "", "does not match the private key"},
+	}
+
+	for _, tt := range rejects {
+		t.Run(tt.name, func(t *testing.T) {
+			err := normalizeSSHKey(&tt.key, tt.passphrase)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("normalizeSSHKey error = %v, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestNormalizeWiFi(t *testing.T) {
+	tests := []struct {
+		name       string
+		wifi       models.WiFiData
+		passphrase string
+		security   string
+		err        string
+	}{
+		{"default security", models.WiFiData{SSID: "home"}, "password", WiFiSecurityWPA2, ""},
+		{"security case", models.WiFiData{SSID: "home", Security: " WPA3 "}, "password", WiFiSecurityWPA3, ""},
+		{"WPA 63 characters", models.WiFiData{SSID: "home", Security: "wpa"}, strings.Repeat("a", 63), WiFiSecurityWPA, ""},
+		{"WPA hex key", models.WiFiData{SSID: "home"}, strings.Repeat("0f", 32), WiFiSecurityWPA2, ""},
+		{"WPA 7 characters", models.WiFiData{SSID: "home"}, "passwor", "", "8 to 63 characters"},
+		{"WPA 65 characters", models.WiFiData{SSID: "home"}, strings.Repeat("a", 65), "", "8 to 63 characters"},
+		{"WPA 64 characters not hex", models.WiFiData{SSID: "home"}, strings.Repeat("g", 64), "", "must be hexadecimal"},
+		{"open", models.WiFiData{SSID: "cafe", Security: "open"}, "", WiFiSecurityOpen, ""},
+		{"open with passphrase", models.WiFiData{SSID: "cafe", Security: "open"}, "password", "", "have no passphrase"},
+		{"WEP 5 characters", models.WiFiData{SSID: "old", Security: "wep"}, "abcde", WiFiSecurityWEP, ""},
+		{"WEP 26 hex digits", models.WiFiData{SSID: "old", Security: "wep"}, strings.Repeat("a1", 13), WiFiSecurityWEP, ""},
+		{"WEP 10 characters not hex", models.WiFiData{SSID: "old", Security: "wep"}, "abcdefghij", "", "must be hexadecimal"},
+		{"WEP 8 characters", models.WiFiData{SSID: "old", Security: "wep"}, "abcdefgh", "", "5 or 13 characters"},
+		{"missing SSID", models.WiFiData{}, "password", "", "1 to 32 bytes"},
+		{"long SSID", models.WiFiData{SSID: strings.Repeat("s", 33)}, "password", "", "1 to 32 bytes"},
+		{"unknown security", models.WiFiData{SSID: "home", Security: "wpa4"}, "password", "", `unknown Wi-Fi security "wpa4"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := normalizeWiFi(&tt.wifi, tt.passphrase)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("normalizeWiFi error = %v, want it to contain %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil || tt.wifi.Security != tt.security {
+				t.Errorf("normalizeWiFi = %q, %v, want security %q", tt.wifi.Security, err, tt.security)
+			}
+		})
+	}
+}
+
+func TestNormalizeAPICredential(t *testing.T) {
+	tests := []struct {
+		name       string
+		credential models.APICredentialData
+		secret     string
+		err        string
+	}{
+		{"key ID only", models.APICredentialData{KeyID: " AKIA123 "}, "", ""},
+		{"secret only", models.APICredentialData{}, "sk_live_123", ""},
+		{"expiry", models.APICredentialData{KeyID: "AKIA123", ExpiresAt: " 2030-12-31 "}, "", ""},
+		{"neither", models.APICredentialData{KeyID: "  "}, "", "needs a key ID or secret"},
+		{"invalid expiry", models.APICredentialData{KeyID: "AKIA123", ExpiresAt: "31/12/2030"}, "", "must be a date like 2006-01-02"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := normalizeAPICredential(&tt.credential, tt.secret)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("normalizeAPICredential error = %v, want it to contain %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("normalizeAPICredential failed: %v", err)
+			}
+			if tt.credential.KeyID != strings.TrimSpace(tt.credential.KeyID) || tt.credential.ExpiresAt != strings.TrimSpace(tt.credential.ExpiresAt) {
+				t.Errorf("normalizeAPICredential = %+v, want trimmed fields", tt.credential)
+			}
+		})
+	}
+}
+
+func TestNormalizeIdentity(t *testing.T) {
+	identity := models.IdentityData{FirstName: "Mona", Email: "Mona Lisa <mona@example.com>"}
+	if err := normalizeIdentity(&identity); err != nil || identity.Email != "mona@example.com" {
+		t.Errorf("normalizeIdentity = %+v, %v, want the address extracted", identity, err)
+	}
+
+	for _, identity := range []models.IdentityData{{Email: "mona@example.com"}, {Company: "GitHub", Email: "not an address"}} {
+		if err := normalizeIdentity(&identity); err == nil {
+			t.Errorf("normalizeIdentity(%+v) succeeded, want an error", identity)
+		}
+	}
+}
+
+func TestNormalizeItem(t *testing.T) {
+	card := &models.CardData{Number: "4111111111111111"}
+
+	// Data that does not belong to the type is dropped
+	entry := models.PasswordEntry{Type: "Login", Card: card, WiFi: &models.WiFiData{SSID: "home"}}
+	if err := normalizeItem(&entry); err != nil {
+		t.Fatalf("normalizeItem failed: %v", err)
+	}
+	if entry.Type != models.ItemTypeLogin || itemData(&entry) != nil {
+		t.Errorf("normalizeItem = %+v, want a login without item data", entry)
+	}
+
+	entry = models.PasswordEntry{Type: "card", Card: card, Identity: &models.IdentityData{FirstName: "Mona"}}
+	if err := normalizeItem(&entry); err != nil {
+		t.Fatalf("normalizeItem failed: %v", err)
+	}
+	if entry.Card != card || entry.Identity != nil || card.Brand != "Visa" {
+		t.Errorf("normalizeItem = %+v, want only the normalized card", entry)
+	}
+
+	tests := []struct {
+		entry models.PasswordEntry
+		err   string
+	}{
+		{models.PasswordEntry{Type: "vault"}, `unknown item type "vault"`},
+		{models.PasswordEntry{Type: models.ItemTypeSecureNote, Notes: " \n"}, "secure note must not be empty"},
+		{models.PasswordEntry{Type: models.ItemTypeCard}, "card details are required"},
+		{models.PasswordEntry{Type: models.ItemTypeIdentity}, "identity details are required"},
+		{models.PasswordEntry{Type: models.ItemTypeSSHKey}, "SSH key details are required"},
+		{models.PasswordEntry{Type: models.ItemTypeAPICredential}, "API credential details are required"},
+		{models.PasswordEntry{Type: models.ItemTypeWiFi}, "Wi-Fi details are required"},
+		{models.PasswordEntry{Type: models.ItemTypeWiFi, WiFi: &models.WiFiData{SSID: "home"}, Password: "short"}, "8 to 63 characters"},
+	}
+
+	for _, tt := range tests {
+		err := normalizeItem(&tt.entry)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("normalizeItem(%q) error = %v, want it to contain %q", tt.entry.Type, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,510 @@
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/loganmanery/passmanager/pkg/kdbx"
+	"github.com/loganmanery/passmanager/pkg/models"
+	"github.com/loganmanery/passmanager/pkg/otp"
+)
+
+// keepassOTP holds the otpauth URI KeePassXC stores TOTP settings in
+const keepassOTP = "otp"
+
+// keepassTimeOTP maps the TOTP string fields of KeePass 2.47 and later to
+// otpauth URI parameters
+var keepassTimeOTP = map[string]string{
+	"TimeOtp-Secret-Base32": "secret",
+	"TimeOtp-Length":        "digits",
+	"TimeOtp-Period":        "period",
+	"TimeOtp-Algorithm":     "algorithm",
+}
+
+// KeePassKey is the composite key of a KDBX database: a password, a key file,
+// or both
+type KeePassKey struct {
+	Password string
+	KeyFile  string
+}
+
+// ReadKDBX reads a KeePass database file in the KDBX 4 format, unlocked with
+// the composite key. Argon2d, Argon2id and AES-KDF key derivation and
+// AES-256 and ChaCha20 encryption are supported. See readKeePass for how
+// entries are mapped.
+func (pm *PasswordManager) ReadKDBX(filename string, key KeePassKey) (*ImportSource, error) {
+	if !pm.initialized {
+		return nil, errors.New("password manager not initialized")
+	}
+	pm.updateLastActivity()
+
+	dbKey := kdbx.Key{Password: key.Password}
+	if key.KeyFile != "" {
+		var err error
+		dbKey.KeyFile, err = os.ReadFile(key.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key file: %w", err)
+		}
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	db, err := kdbx.Read(bufio.NewReader(file), dbKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open KeePass database: %w", err)
+	}
+
+	return pm.readKeePass(db), nil
+}
+
+// ReadKeePassXML reads an unencrypted KeePass 2.x XML export. See
+// readKeePass for how entries are mapped.
+func (pm *PasswordManager) ReadKeePassXML(filename string) (*ImportSource, error) {
+	if !pm.initialized {
+		return nil, errors.New("password manager not initialized")
+	}
+	pm.updateLastActivity()
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	db, err := kdbx.ReadXML(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return pm.readKeePass(db), nil
+}
+
+// readKeePass reads the entries of a KeePass database. Groups become
+// categories named by their path below the root group, e.g. "Internet/Email",
+// and string fields other than the standard ones become custom fields, hidden
+// if protected. Entries without a username, password or URL but with notes
+// become secure notes, every other entry a login. Previous passwords in the
+// entry history become password history and binaries become attachments.
+// Entry UUIDs are kept, so importing a newer database in merge mode updates
+// the entries. Entries in the recycle bin are left out, and entries that
+// cannot be imported are skipped with a warning in the report.
+func (pm *PasswordManager) readKeePass(db *kdbx.Database) *ImportSource {
+	var warnings importWarnings
+	var entries []models.ExportEntry
+	recycled := 0
+
+	var walk func(group kdbx.Group, category string)
+	walk = func(group kdbx.Group, category string) {
+		if db.Meta.RecycleBinEnabled && group.UUID == db.Meta.RecycleBinUUID {
+			recycled += countKeePassEntries(group)
+			return
+		}
+
+		for _, item := range group.Entries {
+			entry, err := pm.keepassEntry(item, category, db.Binaries, &warnings)
+			if err != nil {
+				warnings.warnf("skipped %q: %v", item.Get(kdbx.FieldTitle), err)
+				continue
+			}
+			entries = append(entries, entry)
+		}
+
+		for _, subgroup := range group.Groups {
+			name := strings.TrimSpace(subgroup.Name)
+			if category != "" {
+				name = category + "/" + name
+			}
+			walk(subgroup, name)
+		}
+	}
+
+	// The root group only holds the database name, so it is not a category
+	walk(db.Root, "")
+	if recycled > 0 {
+		warnings.warnf("%d entries in the recycle bin were not imported", recycled)
+	}
+
+	return pm.importSource("keepass", entries, warnings)
+}
+
+// countKeePassEntries counts the entries of a group and its subgroups
+func countKeePassEntries(group kdbx.Group) int {
+	count := len(group.Entries)
+	for _, subgroup := range group.Groups {
+		count += countKeePassEntries(subgroup)
+	}
+	return count
+}
+
+// keepassEntry converts a KeePass entry and encrypts it with the vault key,
+// adding warnings for the parts of it that cannot be imported
+func (pm *PasswordManager) keepassEntry(item kdbx.Entry, category string, binaries [][]byte, warnings *importWarnings) (models.ExportEntry, error) {
+	entry := models.PasswordEntry{
+		UUID:        item.UUID.String(),
+		Type:        models.ItemTypeLogin,
+		Title:       item.Get(kdbx.FieldTitle),
+		URL:         item.Get(kdbx.FieldURL),
+		Username:    item.Get(kdbx.FieldUserName),
+		Password:    item.Get(kdbx.FieldPassword),
+		Notes:       item.Get(kdbx.FieldNotes),
+		Category:    category,
+		Tags:        strings.FieldsFunc(item.Tags, func(r rune) bool { return r == ';' || r == ',' }),
+		CreatedAt:   item.Times.CreationTime.Time,
+		LastUpdated: item.Times.LastModificationTime.Time,
+	}
+	if entry.Username == "" && entry.Password == "" && entry.URL == "" && strings.TrimSpace(entry.Notes) != "" {
+		entry.Type = models.ItemTypeSecureNote
+	}
+
+	timeOTP := url.Values{}
+	for _, field := range item.Strings {
+		switch field.Key {
+		case kdbx.FieldTitle, kdbx.FieldUserName, kdbx.FieldPassword, kdbx.FieldURL, kdbx.FieldNotes:
+			continue
+		case keepassOTP:
+			entry.TOTP = field.Value.Content
+			continue
+		}
+		if param, ok := keepassTimeOTP[field.Key]; ok {
+			timeOTP.Set(param, field.Value.Content)
+			continue
+		}
+
+		custom := models.CustomField{Name: uniqueFieldName(entry.CustomFields, strings.TrimSpace(field.Key)), Type: models.FieldTypeText, Value: field.Value.Content}
+		if field.Value.IsProtected() {
+			custom.Type = models.FieldTypeHidden
+		}
+		entry.CustomFields = append(entry.CustomFields, custom)
+	}
+	if entry.TOTP == "" && timeOTP.Get("secret") != "" {
+		// KeePass names algorithms like HMAC-SHA-256
+		if algorithm := timeOTP.Get("algorithm"); algorithm != "" {
+			timeOTP.Set("algorithm", strings.ReplaceAll(strings.TrimPrefix(algorithm, "HMAC-"), "-", ""))
+		}
+		entry.TOTP = (&url.URL{Scheme: "otpauth", Host: "totp", Path: "/" + entry.Title, RawQuery: timeOTP.Encode()}).String()
+	}
+
+	result, err := pm.encryptImported(entry)
+	if err != nil {
+		return models.ExportEntry{}, err
+	}
+
+	result.History, err = pm.encryptImportedHistory(keepassHistory(item))
+	if err != nil {
+		return models.ExportEntry{}, err
+	}
+
+	for _, ref := range item.Binaries {
+		if ref.Value.Ref < 0 || ref.Value.Ref >= len(binaries) {
+			warnings.warnf("attachment %q of %q is missing from the database", ref.Key, entry.Title)
+			continue
+		}
+
+		attachment, err := pm.encryptImportedAttachment(ref.Key, binaries[ref.Value.Ref])
+		if err != nil {
+			return models.ExportEntry{}, err
+		}
+		result.Attachments = append(result.Attachments, attachment)
+	}
+
+	return result, nil
+}
+
+// keepassHistory returns the previous passwords of a KeePass entry. KeePass
+// keeps whole previous versions of an entry, so only the versions after which
+// the password changed are kept, dated by the change.
+func keepassHistory(item kdbx.Entry) []models.PasswordHistoryEntry {
+	versions := append(append([]kdbx.Entry(nil), item.History...), item)
+
+	var history []models.PasswordHistoryEntry
+	for i := 0; i < len(versions)-1; i++ {
+		password, next := versions[i].Get(kdbx.FieldPassword), versions[i+1]
+		if password == "" || password == next.Get(kdbx.FieldPassword) {
+			continue
+		}
+		history = append(history, models.PasswordHistoryEntry{Password: password, CreatedAt: next.Times.LastModificationTime.Time})
+	}
+	return history
+}
+
+// keepassGenerator names this program in the databases it writes
+const keepassGenerator = "passmanager"
+
+// ExportKDBX exports every entry outside the trash to a KeePass database in
+// the KDBX 4 format, protected by password, returning the number of entries
+// written. Categories become groups, split into subgroups at "/", and tags,
+// notes, TOTP secrets, custom fields, password history and attachments are
+// kept. The fields of cards, identities and other items become string fields.
+// Passwords and hidden fields are marked protected.
+func (pm *PasswordManager) ExportKDBX(filename, password string) (int, error) {
+	if !pm.initialized {
+		return 0, errors.New("password manager not initialized")
+	}
+	pm.updateLastActivity()
+
+	if password == "" {
+		return 0, errors.New("database password must not be empty")
+	}
+
+	summaries, err := pm.GetAllPasswords()
+	if err != nil {
+		return 0, err
+	}
+
+	rootUUID, err := kdbx.NewUUID()
+	if err != nil {
+		return 0, err
+	}
+	now := kdbx.Time{Time: time.Now().UTC()}
+	db := &kdbx.Database{
+		Meta: kdbx.Meta{Generator: keepassGenerator, DatabaseName: keepassGenerator},
+		Root: kdbx.Group{UUID: rootUUID, Name: keepassGenerator, Times: keepassTimes(now.Time, now.Time)},
+	}
+
+	for _, summary := range summaries {
+		entry, err := pm.GetPassword(summary.ID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to decrypt %q: %w", summary.Title, err)
+		}
+
+		item, err := pm.keepassExportEntry(entry, db)
+		if err != nil {
+			return 0, fmt.Errorf("failed to export %q: %w", entry.Title, err)
+		}
+
+		group, err := keepassGroup(&db.Root, entry.Category)
+		if err != nil {
+			return 0, err
+		}
+		group.Entries = append(group.Entries, item)
+	}
+
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, err
+	}
+
+	err = kdbx.Write(file, db, kdbx.Key{Password: password})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(filename)
+		return 0, err
+	}
+
+	return len(summaries), pm.logAudit(AuditActionExport, AuditResourceVault, 0, fmt.Sprintf("kdbx: %d entries", len(summaries)))
+}
+
+// keepassGroup returns the group of a category below the root group, creating
+// the groups on its path as needed
+func keepassGroup(root *kdbx.Group, category string) (*kdbx.Group, error) {
+	group := root
+	for _, name := range strings.Split(category, "/") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		var next *kdbx.Group
+		for i := range group.Groups {
+			if group.Groups[i].Name == name {
+				next = &group.Groups[i]
+				break
+			}
+		}
+		if next == nil {
+			id, err := kdbx.NewUUID()
+			if err != nil {
+				return nil, err
+			}
+			group.Groups = append(group.Groups, kdbx.Group{UUID: id, Name: name, Times: root.Times})
+			next = &group.Groups[len(group.Groups)-1]
+		}
+		group = next
+	}
+	return group, nil
+}
+
+// keepassExportEntry converts an entry to a KeePass entry, adding its
+// attachments to the binaries of the database. Previous passwords become
+// previous versions of the entry.
+func (pm *PasswordManager) keepassExportEntry(entry models.PasswordEntry, db *kdbx.Database) (kdbx.Entry, error) {
+	id, err := kdbx.ParseUUID(entry.UUID)
+	if err != nil {
+		id, err = kdbx.NewUUID()
+		if err != nil {
+			return kdbx.Entry{}, err
+		}
+	}
+
+	item := kdbx.Entry{
+		UUID:  id,
+		Tags:  strings.Join(entry.Tags, ";"),
+		Times: keepassTimes(entry.CreatedAt, entry.LastUpdated),
+	}
+	item.Strings = keepassStrings(entry)
+
+	history, err := pm.GetPasswordHistory(entry.ID)
+	if err != nil {
+		return kdbx.Entry{}, err
+	}
+	// History is newest first, and each previous password was current from
+	// the change before it, or from the creation of the entry
+	for i := len(history) - 1; i >= 0; i-- {
+		since := entry.CreatedAt
+		if i+1 < len(history) {
+			since = history[i+1].CreatedAt
+		}
+
+		version := kdbx.Entry{UUID: item.UUID, Tags: item.Tags, Times: keepassTimes(entry.CreatedAt, since)}
+		version.Strings = keepassStrings(entry)
+		for j := range version.Strings {
+			if version.Strings[j].Key == kdbx.FieldPassword {
+				version.Strings[j].Value.Content = history[i].Password
+			}
+		}
+		item.History = append(item.History, version)
+	}
+
+	attachments, err := pm.GetAttachments(entry.ID)
+	if err != nil {
+		return kdbx.Entry{}, err
+	}
+	for _, attachment := range attachments {
+		var content bytes.Buffer
+		if err := pm.ExtractAttachment(attachment.ID, &content); err != nil {
+			return kdbx.Entry{}, err
+		}
+
+		ref := kdbx.BinaryRef{Key: attachment.Name}
+		ref.Value.Ref = len(db.Binaries)
+		db.Binaries = append(db.Binaries, content.Bytes())
+		item.Binaries = append(item.Binaries, ref)
+	}
+
+	return item, nil
+}
+
+// keepassTimes returns the timestamps of a group or entry
+func keepassTimes(created, updated time.Time) kdbx.Times {
+	return kdbx.Times{
+		CreationTime:         kdbx.Time{Time: created},
+		LastModificationTime: kdbx.Time{Time: updated},
+		LastAccessTime:       kdbx.Time{Time: updated},
+		LocationChanged:      kdbx.Time{Time: updated},
+	}
+}
+
+// keepassStrings returns the string fields of an entry: the standard fields,
+// the TOTP secret as an otpauth URI, the fields specific to its type and its
+// custom fields. Names already taken get a number appended.
+func keepassStrings(entry models.PasswordEntry) []kdbx.String {
+	var fields []kdbx.String
+	add := func(key, value string, protected bool) {
+		name := key
+		for i := 2; slices.ContainsFunc(fields, func(s kdbx.String) bool { return s.Key == name }); i++ {
+			name = fmt.Sprintf("%s (%d)", key, i)
+		}
+		fields = append(fields, kdbx.String{Key: name, Value: kdbx.Value{Content: value, Protected: kdbx.Bool(protected)}})
+	}
+
+	add(kdbx.FieldTitle, entry.Title, false)
+	add(kdbx.FieldUserName, entry.Username, false)
+	add(kdbx.FieldPassword, entry.Password, true)
+	add(kdbx.FieldURL, entry.URL, false)
+	add(kdbx.FieldNotes, entry.Notes, false)
+
+	if entry.TOTP != "" {
+		uri := entry.TOTP
+		if key, err := otp.Parse(entry.TOTP); err == nil && !strings.HasPrefix(entry.TOTP, "otpauth://") {
+			key.Account = entry.Title
+			uri = key.URI()
+		}
+		add(keepassOTP, uri, true)
+	}
+
+	for _, field := range keepassItemFields(entry) {
+		if field.Value != "" {
+			add(field.Name, field.Value, field.Type == models.FieldTypeHidden)
+		}
+	}
+
+	for _, field := range entry.CustomFields {
+		add(field.Name, field.Value, field.Type == models.FieldTypeHidden)
+	}
+	return fields
+}
+
+// keepassItemFields returns the fields specific to the type of an entry, as
+// hidden fields for the sensitive ones
+func keepassItemFields(entry models.PasswordEntry) []models.CustomField {
+	text := func(name, value string) models.CustomField {
+		return models.CustomField{Name: name, Type: models.FieldTypeText, Value: value}
+	}
+	hidden := func(name, value string) models.CustomField {
+		return models.CustomField{Name: name, Type: models.FieldTypeHidden, Value: value}
+	}
+
+	var fields []models.CustomField
+	if card := entry.Card; card != nil {
+		fields = append(fields,
+			text("Cardholder", card.CardholderName),
+			text("Brand", card.Brand),
+			hidden("Number", card.Number),
+			hidden("Security code", card.CVV),
+			hidden("PIN", card.PIN))
+		if card.ExpiryMonth > 0 {
+			fields = append(fields, text("Expiry", fmt.Sprintf("%02d/%04d", card.ExpiryMonth, card.ExpiryYear)))
+		}
+	}
+	if identity := entry.Identity; identity != nil {
+		fields = append(fields,
+			text("First name", identity.FirstName),
+			text("Middle name", identity.MiddleName),
+			text("Last name", identity.LastName),
+			text("Company", identity.Company),
+			text("Email", identity.Email),
+			text("Phone", identity.Phone),
+			text("Address 1", identity.Address1),
+			text("Address 2", identity.Address2),
+			text("City", identity.City),
+			text("State", identity.State),
+			text("Postal code", identity.PostalCode),
+			text("Country", identity.Country),
+			hidden("Social security number", identity.SSN),
+			hidden("Passport number", identity.PassportNumber),
+			hidden("License number", identity.LicenseNumber))
+	}
+	if key := entry.SSHKey; key != nil {
+		fields = append(fields,
+			hidden("Private key", key.PrivateKey),
+			text("Public key", key.PublicKey),
+			text("Fingerprint", key.Fingerprint))
+	}
+	if credential := entry.APICredential; credential != nil {
+		fields = append(fields,
+			text("Key ID", credential.KeyID),
+			text("Expires", credential.ExpiresAt))
+	}
+	if wifi := entry.WiFi; wifi != nil {
+		fields = append(fields,
+			text("SSID", wifi.SSID),
+			text("Security", wifi.Security))
+		if wifi.Hidden {
+			fields = append(fields, text("Hidden network", "true"))
+		}
+	}
+	return fields
+}
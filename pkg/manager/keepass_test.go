@@ -0,0 +1,206 @@
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/loganmanery/passmanager/pkg/kdbx"
+	"github.com/loganmanery/passmanager/pkg/models"
+)
+
+const testKDBXPassword = "keepass password"
+
+func TestExportKDBXRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "vault.db")
+	pm := newTestManagerAt(t, path)
+	addExportEntries(t, pm)
+
+	_, err := pm.AddPassword(models.PasswordEntry{Title: "Build server", Username: "root", Password: "toor", Category: "Work/Servers"})
+	if err != nil {
+		t.Fatalf("AddPassword failed: %v", err)
+	}
+
+	// Give GitHub a second previous password, and date the history apart so
+	// that its order does not depend on changes made within one second
+	github, err := pm.SearchPasswords(models.SearchParams{Keyword: "GitHub"})
+	if err != nil || len(github) != 1 {
+		t.Fatalf("SearchPasswords = %v, %v", github, err)
+	}
+	entry, err := pm.GetPassword(github[0].ID)
+	if err != nil {
+		t.Fatalf("GetPassword failed: %v", err)
+	}
+	entry.Password = "hunter4"
+	if err := pm.UpdatePassword(entry); err != nil {
+		t.Fatalf("UpdatePassword failed: %v", err)
+	}
+	_, err = openTestDB(t, path).Exec("UPDATE password_history SET created_at = datetime('2023-01-01', '+' || id || ' days')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := pm.GetPassword(entry.ID)
+	if err != nil {
+		t.Fatalf("GetPassword failed: %v", err)
+	}
+	wantHistory, err := pm.GetPasswordHistory(entry.ID)
+	if err != nil {
+		t.Fatalf("GetPasswordHistory failed: %v", err)
+	}
+	if len(wantHistory) != 2 || wantHistory[0].Password != "hunter3" || wantHistory[1].Password != "hunter2" {
+		t.Fatalf("history = %+v, want hunter3 and hunter2", wantHistory)
+	}
+
+	filename := filepath.Join(dir, "vault.kdbx")
+	count, err := pm.ExportKDBX(filename, testKDBXPassword)
+	if err != nil {
+		t.Fatalf("ExportKDBX failed: %v", err)
+	}
+	if count != 4 {
+		t.Errorf("exported %d entries, want 4", count)
+	}
+
+	// The database holds a group per category, below the root group
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	db, err := kdbx.Read(bufio.NewReader(file), kdbx.Key{Password: testKDBXPassword})
+	if err != nil {
+		t.Fatalf("kdbx.Read failed: %v", err)
+	}
+
+	groups := make(map[string]kdbx.Group)
+	var walk func(group kdbx.Group, path string)
+	walk = func(group kdbx.Group, path string) {
+		groups[path] = group
+		for _, subgroup := range group.Groups {
+			walk(subgroup, path+"/"+subgroup.Name)
+		}
+	}
+	walk(db.Root, "")
+
+	titles := func(group kdbx.Group) []string {
+		var result []string
+		for _, item := range group.Entries {
+			result = append(result, item.Get(kdbx.FieldTitle))
+		}
+		return result
+	}
+	wantGroups := map[string][]string{
+		"":              {"Wifi"},
+		"/Work":         {"GitHub"},
+		"/Work/Servers": {"Build server"},
+		"/Finance":      {"Visa"},
+	}
+	if len(groups) != len(wantGroups) {
+		t.Errorf("database has %d groups, want %d", len(groups), len(wantGroups))
+	}
+	for path, want := range wantGroups {
+		if got := titles(groups[path]); !reflect.DeepEqual(got, want) {
+			t.Errorf("group %q holds %q, want %q", path, got, want)
+		}
+	}
+
+	// Passwords, secrets and hidden fields are protected, nothing else is
+	protected := func(item kdbx.Entry) map[string]bool {
+		result := make(map[string]bool)
+		for _, s := range item.Strings {
+			if s.Value.Content != "" {
+				result[s.Key] = s.Value.IsProtected()
+			}
+		}
+		return result
+	}
+	item := groups["/Work"].Entries[0]
+	wantProtected := map[string]bool{
+		kdbx.FieldTitle: false, kdbx.FieldUserName: false, kdbx.FieldPassword: true, kdbx.FieldURL: false,
+		kdbx.FieldNotes: false, "otp": true, "Recovery email": false, "PIN": true, "Docs": false,
+	}
+	if got := protected(item); !reflect.DeepEqual(got, wantProtected) {
+		t.Errorf("GitHub fields protected = %v, want %v", got, wantProtected)
+	}
+	wantProtected = map[string]bool{kdbx.FieldTitle: false, "Cardholder": false, "Brand": false, "Number": true, "Security code": true, "Expiry": false}
+	if got := protected(groups["/Finance"].Entries[0]); !reflect.DeepEqual(got, wantProtected) {
+		t.Errorf("Visa fields protected = %v, want %v", got, wantProtected)
+	}
+
+	// Previous versions are oldest first, each dated when it became current
+	if len(item.History) != 2 || item.History[0].Get(kdbx.FieldPassword) != "hunter2" || item.History[1].Get(kdbx.FieldPassword) != "hunter3" {
+		t.Fatalf("GitHub history = %+v, want versions with hunter2 and hunter3", item.History)
+	}
+	if got := item.History[1].Times.LastModificationTime; !got.Equal(wantHistory[1].CreatedAt) {
+		t.Errorf("second version modified %v, want %v", got.Time, wantHistory[1].CreatedAt)
+	}
+	if len(item.Binaries) != 1 || string(db.Binaries[item.Binaries[0].Value.Ref]) != testAttachment {
+		t.Errorf("GitHub binaries = %+v", item.Binaries)
+	}
+
+	// Reading the database back gives the same entries
+	other := newTestManager(t)
+	src, err := other.ReadKDBX(filename, KeePassKey{Password: testKDBXPassword})
+	if err != nil {
+		t.Fatalf("ReadKDBX failed: %v", err)
+	}
+	report, err := src.Import(ImportOptions{Mode: ImportModeMerge})
+	if err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+	if report.Added != 4 || len(report.Warnings) != 0 {
+		t.Errorf("report = %s with warnings %q, want 4 added", report, report.Warnings)
+	}
+
+	got, err := other.GetPasswordByUUID(want.UUID)
+	if err != nil {
+		t.Fatalf("GetPasswordByUUID failed: %v", err)
+	}
+	if got.Title != want.Title || got.Password != want.Password || got.Category != want.Category ||
+		got.TOTP != want.TOTP || got.Notes != want.Notes || !reflect.DeepEqual(got.Tags, want.Tags) {
+		t.Errorf("entry read back = %+v, want %+v", got, want)
+	}
+	// KeePass only tells protected fields from others, so URL fields become text
+	wantFields := append([]models.CustomField(nil), want.CustomFields...)
+	for i := range wantFields {
+		if wantFields[i].Type == models.FieldTypeURL {
+			wantFields[i].Type = models.FieldTypeText
+		}
+	}
+	if !reflect.DeepEqual(got.CustomFields, wantFields) {
+		t.Errorf("custom fields read back = %+v, want %+v", got.CustomFields, wantFields)
+	}
+
+	gotHistory, err := other.GetPasswordHistory(got.ID)
+	if err != nil {
+		t.Fatalf("GetPasswordHistory failed: %v", err)
+	}
+	if len(gotHistory) != len(wantHistory) {
+		t.Fatalf("history read back = %+v, want %+v", gotHistory, wantHistory)
+	}
+	for i := range wantHistory {
+		if gotHistory[i].Password != wantHistory[i].Password {
+			t.Errorf("history record %d = %q, want %q", i, gotHistory[i].Password, wantHistory[i].Password)
+		}
+	}
+
+	attachments, err := other.GetAttachments(got.ID)
+	if err != nil || len(attachments) != 1 {
+		t.Fatalf("GetAttachments = %v, %v, want one attachment", attachments, err)
+	}
+	var content bytes.Buffer
+	if err := other.ExtractAttachment(attachments[0].ID, &content); err != nil {
+		t.Fatalf("ExtractAttachment failed: %v", err)
+	}
+	if content.String() != testAttachment {
+		t.Errorf("attachment = %q, want %q", content.String(), testAttachment)
+	}
+
+	servers, err := other.SearchPasswords(models.SearchParams{Keyword: "Build server"})
+	if err != nil || len(servers) != 1 || servers[0].Category != "Work/Servers" {
+		t.Errorf("SearchPasswords = %+v, %v, want the entry in Work/Servers", servers, err)
+	}
+}
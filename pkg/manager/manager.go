@@ -1,11 +1,10 @@
 package manager
 
 import (
-	"encoding/base64"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/loganmanery/passmanager/internal/crypto"
@@ -77,7 +76,8 @@ func (pm *PasswordManager) CreateMasterPassword(masterPassword string) error {
 
 	pm.initialized = true
 	pm.updateLastActivity()
-	return nil
+
+	return pm.logAudit(AuditActionCreateVault, AuditResourceVault, 0, "")
 }
 
 // UnlockVault authenticates with the master password and unlocks the vault
@@ -112,6 +112,18 @@ func (pm *PasswordManager) UnlockVault(masterPassword string) error {
 	pm.masterKey = key
 	pm.initialized = true
 	pm.updateLastActivity()
+
+	err = pm.logAudit(AuditActionUnlock, AuditResourceVault, 0, "")
+	if err != nil {
+		return err
+	}
+
+	// Purge entries that have been in the trash longer than the retention period
+	_, err = pm.purgeExpiredTrash()
+	if err != nil {
+		return fmt.Errorf("failed to purge trash: %w", err)
+	}
+
 	return nil
 }
 
@@ -133,26 +145,22 @@ func (pm *PasswordManager) AddPassword(entry models.PasswordEntry) (int64, error
 	}
 	pm.updateLastActivity()
 
-	// Encrypt sensitive fields
-	encPassword, err := pm.crypto.Encrypt(entry.Password, pm.masterKey)
+	// The entry is validated and encrypted first, so that it is stored with
+	// its custom fields, one-time password and item data in one transaction
+	encrypted, err := pm.encryptEntry(entry)
 	if err != nil {
 		return 0, err
 	}
 
-	var encNotes []byte
-	if entry.Notes != "" {
-		encNotes, err = pm.crypto.Encrypt(entry.Notes, pm.masterKey)
-		if err != nil {
-			return 0, err
-		}
-	}
-
-	// Add to storage
-	id, err := pm.storage.AddPassword(&entry, encPassword, encNotes)
+	id, err := pm.storage.AddPassword(encrypted)
 	if err != nil {
 		return 0, err
 	}
 
+	if err := pm.logAudit(AuditActionAdd, AuditResourcePassword, id, entry.Title); err != nil {
+		return id, err
+	}
+
 	return id, nil
 }
 
@@ -185,10 +193,42 @@ func (pm *PasswordManager) GetPassword(id int64) (models.PasswordEntry, error) {
 		entry.Notes = notes
 	}
 
+	// Load custom fields
+	entry.CustomFields, err = pm.getCustomFields(id)
+	if err != nil {
+		return models.PasswordEntry{}, err
+	}
+
+	// Decrypt one-time password secret
+	entry.TOTP, err = pm.getTOTP(id)
+	if err != nil {
+		return models.PasswordEntry{}, err
+	}
+
+	// Decrypt type-specific data
+	err = pm.loadItemData(entry)
+	if err != nil {
+		return models.PasswordEntry{}, err
+	}
+
 	return *entry, nil
 }
 
-// GetAllPasswords retrieves all password entries (without sensitive data)
+// GetPasswordByUUID retrieves a password entry by its UUID
+func (pm *PasswordManager) GetPasswordByUUID(uuid string) (models.PasswordEntry, error) {
+	if !pm.initialized {
+		return models.PasswordEntry{}, errors.New("password manager not initialized")
+	}
+
+	id, err := pm.storage.GetPasswordID(uuid)
+	if err != nil {
+		return models.PasswordEntry{}, err
+	}
+
+	return pm.GetPassword(id)
+}
+
+// GetAllPasswords retrieves all password entries outside the trash (without sensitive data)
 func (pm *PasswordManager) GetAllPasswords() ([]models.PasswordEntry, error) {
 	if !pm.initialized {
 		return nil, errors.New("password manager not initialized")
@@ -198,39 +238,98 @@ func (pm *PasswordManager) GetAllPasswords() ([]models.PasswordEntry, error) {
 	return pm.storage.GetAllPasswords()
 }
 
-// UpdatePassword updates an existing password entry
+// UpdatePassword updates an existing password entry, identified by its ID or,
+// when the ID is zero, by its UUID
 func (pm *PasswordManager) UpdatePassword(entry models.PasswordEntry) error {
 	if !pm.initialized {
 		return errors.New("password manager not initialized")
 	}
 	pm.updateLastActivity()
 
-	// Encrypt sensitive fields
-	encPassword, err := pm.crypto.Encrypt(entry.Password, pm.masterKey)
+	if entry.ID == 0 && entry.UUID != "" {
+		id, err := pm.storage.GetPasswordID(entry.UUID)
+		if err != nil {
+			return err
+		}
+		entry.ID = id
+	}
+
+	encrypted, err := pm.encryptUpdate(entry)
+	if err != nil {
+		return err
+	}
+
+	// Update in storage
+	err = pm.storage.UpdatePassword(entry.ID, encrypted)
 	if err != nil {
 		return err
 	}
 
-	var encNotes []byte
-	if entry.Notes != "" {
-		encNotes, err = pm.crypto.Encrypt(entry.Notes, pm.masterKey)
+	err = pm.pruneHistory(entry.ID)
+	if err != nil {
+		return fmt.Errorf("failed to prune password history: %w", err)
+	}
+
+	return pm.logAudit(AuditActionUpdate, AuditResourcePassword, entry.ID, entry.Title)
+}
+
+// encryptUpdate validates and encrypts an entry that replaces the stored
+// entry with the same ID, keeping the stored ciphertexts of a password or
+// one-time password secret that did not change
+func (pm *PasswordManager) encryptUpdate(entry models.PasswordEntry) (models.ExportEntry, error) {
+	encrypted, err := pm.encryptEntry(entry)
+	if err != nil {
+		return models.ExportEntry{}, err
+	}
+
+	// Keep the stored ciphertext if the password is unchanged, so that only
+	// real changes are archived in the password history
+	_, currentEncPassword, _, err := pm.storage.GetPassword(entry.ID)
+	if err != nil {
+		return models.ExportEntry{}, err
+	}
+
+	currentPassword, err := pm.crypto.Decrypt(currentEncPassword, pm.masterKey)
+	if err != nil {
+		return models.ExportEntry{}, err
+	}
+	if entry.Password == currentPassword {
+		encrypted.Password = currentEncPassword
+	}
+
+	// Likewise keep the stored one-time password secret if it is unchanged,
+	// so that the HOTP counter is not reset by unrelated edits
+	currentEncTOTP, err := pm.storage.GetTOTP(entry.ID)
+	if err != nil {
+		return models.ExportEntry{}, err
+	}
+
+	if len(currentEncTOTP) > 0 {
+		currentTOTP, err := pm.crypto.Decrypt(currentEncTOTP, pm.masterKey)
 		if err != nil {
-			return err
+			return models.ExportEntry{}, err
+		}
+		if strings.TrimSpace(entry.TOTP) == currentTOTP {
+			encrypted.TOTP = currentEncTOTP
 		}
 	}
 
-	// Update in storage
-	return pm.storage.UpdatePassword(&entry, encPassword, encNotes)
+	return encrypted, nil
 }
 
-// DeletePassword deletes a password entry
+// DeletePassword moves a password entry to the trash
 func (pm *PasswordManager) DeletePassword(id int64) error {
 	if !pm.initialized {
 		return errors.New("password manager not initialized")
 	}
 	pm.updateLastActivity()
 
-	return pm.storage.DeletePassword(id)
+	err := pm.storage.DeletePassword(id)
+	if err != nil {
+		return err
+	}
+
+	return pm.logAudit(AuditActionDelete, AuditResourcePassword, id, "")
 }
 
 // SearchPasswords searches for password entries
@@ -240,6 +339,12 @@ func (pm *PasswordManager) SearchPasswords(params models.SearchParams) ([]models
 	}
 	pm.updateLastActivity()
 
+	tags, err := normalizeTags(params.Tags)
+	if err != nil {
+		return nil, err
+	}
+	params.Tags = tags
+
 	return pm.storage.SearchPasswords(params)
 }
 
@@ -249,72 +354,58 @@ func (pm *PasswordManager) GeneratePassword(options generator.PasswordOptions) (
 	return generator.GeneratePassword(options)
 }
 
-// ExportVault exports the password vault to a file
-func (pm *PasswordManager) ExportVault(filename string) error {
+// ExportVault exports the password vault, including password history and
+// attachments, to a file protected by an export password, which can be
+// imported into any vault knowing only that password
+func (pm *PasswordManager) ExportVault(filename, exportPassword string) error {
 	if !pm.initialized {
 		return errors.New("password manager not initialized")
 	}
+	if exportPassword == "" {
+		return errors.New("export password cannot be empty")
+	}
 	pm.updateLastActivity()
 
-	// Get all entries
-	entries, err := pm.storage.ExportData()
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		return err
 	}
 
-	// Serialize to JSON
-	jsonData, err := json.Marshal(entries)
-	if err != nil {
-		return err
+	count, err := pm.writeExport(file, exportPassword)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
 	}
-
-	// Encrypt the entire export
-	encData, err := pm.crypto.Encrypt(string(jsonData), pm.masterKey)
 	if err != nil {
+		os.Remove(filename)
 		return err
 	}
 
-	// Base64 encode for safety
-	encodedData := base64.StdEncoding.EncodeToString(encData)
-
-	// Write to file
-	return os.WriteFile(filename, []byte(encodedData), 0600)
+	return pm.logAudit(AuditActionExport, AuditResourceVault, 0, fmt.Sprintf("%d entries", count))
 }
 
-// ImportVault imports the password vault from a file
-func (pm *PasswordManager) ImportVault(filename string) error {
+// ImportVault imports the password vault from a file, decrypting it with the
+// export password it was written with and combining it with the
+// existing entries as selected by the import options
+func (pm *PasswordManager) ImportVault(filename, exportPassword string, options ImportOptions) (ImportReport, error) {
 	if !pm.initialized {
-		return errors.New("password manager not initialized")
+		return ImportReport{}, errors.New("password manager not initialized")
 	}
 	pm.updateLastActivity()
 
-	// Read file
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return err
-	}
-
-	// Decode base64
-	decodedData, err := base64.StdEncoding.DecodeString(string(data))
+	// Open file
+	file, err := os.Open(filename)
 	if err != nil {
-		return err
+		return ImportReport{}, err
 	}
+	defer file.Close()
 
-	// Decrypt
-	jsonData, err := pm.crypto.Decrypt(decodedData, pm.masterKey)
+	// Decrypt, decode and validate the entries
+	entries, err := pm.readExportFile(file, exportPassword)
 	if err != nil {
-		return err
-	}
-
-	// Parse JSON
-	var entries []map[string]interface{}
-	err = json.Unmarshal([]byte(jsonData), &entries)
-	if err != nil {
-		return err
+		return ImportReport{}, err
 	}
 
-	// Import into storage
-	return pm.storage.ImportData(entries)
+	return pm.importEntries(entries, options, "", nil)
 }
 
 // Close closes the password manager and its resources
@@ -0,0 +1,90 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/loganmanery/passmanager/pkg/otp"
+)
+
+// OTPCode is a generated one-time password. Remaining is how long a time-based
+// code stays valid; Counter is the counter a counter-based code was generated with.
+type OTPCode struct {
+	Type      string
+	Code      string
+	Remaining time.Duration
+	Counter   uint64
+}
+
+// GetOTPCode generates the current one-time password of an entry. For HOTP
+// entries every call consumes the next counter value.
+func (pm *PasswordManager) GetOTPCode(id int64) (OTPCode, error) {
+	if !pm.initialized {
+		return OTPCode{}, errors.New("password manager not initialized")
+	}
+	pm.updateLastActivity()
+
+	value, err := pm.getTOTP(id)
+	if err != nil {
+		return OTPCode{}, err
+	}
+	if value == "" {
+		return OTPCode{}, errors.New("entry has no one-time password configured")
+	}
+
+	key, err := otp.Parse(value)
+	if err != nil {
+		return OTPCode{}, err
+	}
+
+	if key.IsCounterBased() {
+		counter, err := pm.storage.NextOTPCounter(id)
+		if err != nil {
+			return OTPCode{}, fmt.Errorf("failed to advance HOTP counter: %w", err)
+		}
+
+		code, err := key.Code(counter)
+		if err != nil {
+			return OTPCode{}, err
+		}
+
+		return OTPCode{Type: key.Type, Code: code, Counter: counter}, nil
+	}
+
+	now := time.Now()
+	code, err := key.Generate(now)
+	if err != nil {
+		return OTPCode{}, err
+	}
+
+	return OTPCode{Type: key.Type, Code: code, Remaining: key.Remaining(now)}, nil
+}
+
+// getTOTP loads and decrypts the one-time password secret of an entry
+func (pm *PasswordManager) getTOTP(id int64) (string, error) {
+	encTOTP, err := pm.storage.GetTOTP(id)
+	if err != nil {
+		return "", err
+	}
+	if len(encTOTP) == 0 {
+		return "", nil
+	}
+
+	return pm.crypto.Decrypt(encTOTP, pm.masterKey)
+}
+
+// normalizeTOTP validates a one-time password secret or otpauth:// URI
+func normalizeTOTP(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+
+	if _, err := otp.Parse(value); err != nil {
+		return "", err
+	}
+
+	return value, nil
+}
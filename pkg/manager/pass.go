@@ -0,0 +1,244 @@
+package manager
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+	"github.com/loganmanery/passmanager/pkg/otp"
+)
+
+// passExtension is the extension of the encrypted files of a password store
+const passExtension = ".gpg"
+
+// passPlaintextExtension is dropped from the names of pre-decrypted files
+const passPlaintextExtension = ".txt"
+
+// passOTPPrefix starts the otpauth URI lines written by pass-otp
+const passOTPPrefix = "otpauth://"
+
+// passFields maps the field names used by pass and its browser extensions to
+// entry fields
+var passFields = map[string]string{
+	"login":    CSVFieldUsername,
+	"username": CSVFieldUsername,
+	"user":     CSVFieldUsername,
+	"url":      CSVFieldURL,
+	"website":  CSVFieldURL,
+	"site":     CSVFieldURL,
+	"otp":      CSVFieldTOTP,
+	"totp":     CSVFieldTOTP,
+}
+
+// PassDecryptor decrypts the content of a .gpg file of a password store
+type PassDecryptor interface {
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+// GPGDecryptor decrypts password store files with GnuPG, the way pass does.
+// Passphrases are asked for by the GnuPG agent.
+type GPGDecryptor struct {
+	// Program is the gpg binary, "gpg" when empty
+	Program string
+}
+
+// Decrypt decrypts ciphertext by running gpg
+func (d GPGDecryptor) Decrypt(ciphertext []byte) ([]byte, error) {
+	program := d.Program
+	if program == "" {
+		program = "gpg"
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(program, "--quiet", "--yes", "--decrypt")
+	cmd.Stdin = bytes.NewReader(ciphertext)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("gpg failed: %s", strings.ReplaceAll(message, "\n", "; "))
+		}
+		return nil, fmt.Errorf("gpg failed: %w", err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// ReadPass reads a password store directory as used by the pass tool.
+// Every .gpg file is decrypted with the decryptor and .txt files are read as
+// pre-decrypted plaintext, so a decrypted copy of a store with its files
+// renamed to .txt can be imported with a nil decryptor. Other files, such as
+// a README or scripts, are skipped with a warning, and hidden files and
+// directories, such as .gpg-id and .git, are left out.
+//
+// Every file becomes a login titled by its name and filed under its directory
+// path, e.g. "Email/work". The first line of a file is the password, and
+// "key: value" lines below it become fields: the username, URL and TOTP
+// secret for their usual names, custom fields otherwise. otpauth URIs set the
+// TOTP secret and any other lines become the notes. Files with only notes
+// become secure notes. Password stores carry no entry IDs, so every file is
+// added, even in merge mode. Files that cannot be imported are skipped with a
+// warning in the report.
+func (pm *PasswordManager) ReadPass(dir string, decryptor PassDecryptor) (*ImportSource, error) {
+	if !pm.initialized {
+		return nil, errors.New("password manager not initialized")
+	}
+	pm.updateLastActivity()
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a password store directory", dir)
+	}
+
+	var warnings importWarnings
+	var entries []models.ExportEntry
+	err = filepath.WalkDir(dir, func(filename string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if filename != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, filename)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if ext := path.Ext(rel); ext != passExtension && ext != passPlaintextExtension {
+			warnings.warnf("skipped %s: not a .gpg or .txt file", rel)
+			return nil
+		}
+
+		entry, err := pm.passEntry(filename, rel, decryptor, &warnings)
+		if err != nil {
+			warnings.warnf("skipped %s: %v", rel, err)
+			return nil
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return pm.importSource("pass", entries, warnings), nil
+}
+
+// passEntry reads a file of a password store and encrypts it with the vault
+// key, adding warnings for the parts of it that cannot be imported
+func (pm *PasswordManager) passEntry(filename, rel string, decryptor PassDecryptor, warnings *importWarnings) (models.ExportEntry, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return models.ExportEntry{}, err
+	}
+
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return models.ExportEntry{}, err
+	}
+
+	name := rel
+	switch path.Ext(rel) {
+	case passExtension:
+		if decryptor == nil {
+			return models.ExportEntry{}, errors.New("file is encrypted and no decryptor was given")
+		}
+		content, err = decryptor.Decrypt(content)
+		if err != nil {
+			return models.ExportEntry{}, err
+		}
+		name = strings.TrimSuffix(rel, passExtension)
+	case passPlaintextExtension:
+		name = strings.TrimSuffix(rel, passPlaintextExtension)
+	}
+
+	entry := parsePassFile(string(content), rel, warnings)
+	entry.Title = path.Base(name)
+	if category := path.Dir(name); category != "." {
+		entry.Category = category
+	}
+	entry.CreatedAt = info.ModTime()
+	entry.LastUpdated = info.ModTime()
+
+	if entry.Password == "" && entry.Username == "" && entry.URL == "" {
+		if strings.TrimSpace(entry.Notes) == "" {
+			return models.ExportEntry{}, errors.New("file is empty")
+		}
+		entry.Type = models.ItemTypeSecureNote
+	}
+
+	return pm.encryptImported(entry)
+}
+
+// parsePassFile parses the decrypted content of a password store file
+func parsePassFile(content, rel string, warnings *importWarnings) models.PasswordEntry {
+	entry := models.PasswordEntry{Type: models.ItemTypeLogin}
+
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	entry.Password = lines[0]
+
+	var notes []string
+	for _, line := range lines[1:] {
+		if strings.HasPrefix(strings.TrimSpace(line), passOTPPrefix) && entry.TOTP == "" {
+			entry.TOTP = strings.TrimSpace(line)
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		key = strings.TrimSpace(key)
+		// A URL such as https://example.com is not a field
+		if !ok || key == "" || (value != "" && value[0] != ' ' && value[0] != '\t') {
+			notes = append(notes, line)
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		switch passFields[strings.ToLower(key)] {
+		case CSVFieldUsername:
+			if entry.Username == "" {
+				entry.Username = value
+				continue
+			}
+		case CSVFieldURL:
+			if entry.URL == "" {
+				entry.URL = value
+				continue
+			}
+		case CSVFieldTOTP:
+			if entry.TOTP == "" {
+				if _, err := otp.Parse(value); err != nil {
+					warnings.warnf("one-time password of %s was not imported: %v", rel, err)
+				} else {
+					entry.TOTP = value
+				}
+				continue
+			}
+		}
+
+		entry.CustomFields = append(entry.CustomFields, models.CustomField{
+			Name:  uniqueFieldName(entry.CustomFields, key),
+			Type:  models.FieldTypeText,
+			Value: value,
+		})
+	}
+
+	entry.Notes = strings.TrimSpace(strings.Join(notes, "\n"))
+	return entry
+}
@@ -0,0 +1,87 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// countingDecryptor "decrypts" files stored in plaintext and counts the calls
+type countingDecryptor struct {
+	calls int
+}
+
+func (d *countingDecryptor) Decrypt(ciphertext []byte) ([]byte, error) {
+	d.calls++
+	return ciphertext, nil
+}
+
+func TestReadPass(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"Email/work.gpg":  "hunter2\nlogin: octocat\n",
+		"Bank/main.txt":   "s3cret\nurl: https://bank.example.com\n",
+		"README.md":       "# My password store\n",
+		"sync.sh":         "#!/bin/sh\ngit pull\n",
+		".gpg-id":         "octocat@example.com\n",
+		".git/config":     "[core]\n",
+		"Email/empty.gpg": "",
+	}
+	for name, content := range files {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pm := newTestManager(t)
+	decryptor := &countingDecryptor{}
+	src, err := pm.ReadPass(dir, decryptor)
+	if err != nil {
+		t.Fatalf("ReadPass failed: %v", err)
+	}
+
+	// The preview and the import come from the same read of the store
+	preview, err := src.Import(ImportOptions{Mode: ImportModeMerge, DryRun: true})
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	report, err := src.Import(ImportOptions{Mode: ImportModeMerge})
+	if err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+	if decryptor.calls != 2 {
+		t.Errorf("decrypted %d files, want 2", decryptor.calls)
+	}
+	if preview.Added != 2 || report.Added != 2 {
+		t.Errorf("preview = %s, report = %s, want 2 added each", preview, report)
+	}
+
+	sort.Strings(report.Warnings)
+	want := []string{
+		"skipped Email/empty.gpg: file is empty",
+		"skipped README.md: not a .gpg or .txt file",
+		"skipped sync.sh: not a .gpg or .txt file",
+	}
+	if !reflect.DeepEqual(report.Warnings, want) {
+		t.Errorf("warnings = %q, want %q", report.Warnings, want)
+	}
+
+	entries, err := pm.GetAllPasswords()
+	if err != nil {
+		t.Fatalf("GetAllPasswords failed: %v", err)
+	}
+	var titles []string
+	for _, entry := range entries {
+		titles = append(titles, entry.Category+"/"+entry.Title)
+	}
+	sort.Strings(titles)
+	if want := []string{"Bank/main", "Email/work"}; !reflect.DeepEqual(titles, want) {
+		t.Errorf("imported %q, want %q", titles, want)
+	}
+}
@@ -0,0 +1,92 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// AddTags attaches tags to a password entry
+func (pm *PasswordManager) AddTags(id int64, tags ...string) error {
+	if !pm.initialized {
+		return errors.New("password manager not initialized")
+	}
+	pm.updateLastActivity()
+
+	tags, err := normalizeTags(tags)
+	if err != nil {
+		return err
+	}
+
+	err = pm.storage.AddTags(id, tags)
+	if err != nil {
+		return err
+	}
+
+	return pm.logAudit(AuditActionTag, AuditResourcePassword, id, "+"+strings.Join(tags, ","))
+}
+
+// RemoveTags detaches tags from a password entry
+func (pm *PasswordManager) RemoveTags(id int64, tags ...string) error {
+	if !pm.initialized {
+		return errors.New("password manager not initialized")
+	}
+	pm.updateLastActivity()
+
+	tags, err := normalizeTags(tags)
+	if err != nil {
+		return err
+	}
+
+	err = pm.storage.RemoveTags(id, tags)
+	if err != nil {
+		return err
+	}
+
+	return pm.logAudit(AuditActionTag, AuditResourcePassword, id, "-"+strings.Join(tags, ","))
+}
+
+// GetTags retrieves the names of all tags in use
+func (pm *PasswordManager) GetTags() ([]string, error) {
+	if !pm.initialized {
+		return nil, errors.New("password manager not initialized")
+	}
+	pm.updateLastActivity()
+
+	return pm.storage.GetTags()
+}
+
+// ParseTags splits a comma-separated tag list as typed by a user
+func ParseTags(input string) []string {
+	var tags []string
+	for _, tag := range strings.Split(input, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// normalizeTags lowercases, trims and deduplicates tag names
+func normalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	var result []string
+
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+		if strings.Contains(tag, ",") {
+			return nil, fmt.Errorf("invalid tag %q: tags cannot contain commas", tag)
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			result = append(result, tag)
+		}
+	}
+
+	sort.Strings(result)
+	return result, nil
+}
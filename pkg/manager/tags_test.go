@@ -0,0 +1,173 @@
+package manager
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tests := []struct {
+		name string
+		tags []string
+		want []string
+		err  string
+	}{
+		{"none", nil, nil, ""},
+		{"sorted", []string{"work", "dev"}, []string{"dev", "work"}, ""},
+		{"lowercased and trimmed", []string{" Dev ", "WORK"}, []string{"dev", "work"}, ""},
+		{"deduplicated", []string{"dev", "DEV", " dev"}, []string{"dev"}, ""},
+		{"empty skipped", []string{"", "  ", "dev"}, []string{"dev"}, ""},
+		{"comma", []string{"dev,work"}, nil, "tags cannot contain commas"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeTags(tt.tags)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("normalizeTags error = %v, want it to contain %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("normalizeTags failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeTags = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"", nil},
+		{"dev", []string{"dev"}},
+		{"dev, work ,,Home", []string{"dev", "work", "Home"}},
+		{" , ", nil},
+	}
+
+	for _, tt := range tests {
+		if got := ParseTags(tt.input); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseTags(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+// entryTags returns the tags of an entry
+func entryTags(t *testing.T, pm *PasswordManager, id int64) []string {
+	t.Helper()
+
+	entry, err := pm.GetPassword(id)
+	if err != nil {
+		t.Fatalf("GetPassword failed: %v", err)
+	}
+	return entry.Tags
+}
+
+func TestAddRemoveTags(t *testing.T) {
+	pm := newTestManager(t)
+	ids := addTestEntries(t, pm,
+		models.PasswordEntry{Title: "GitHub", Password: "hunter2", Tags: []string{"Dev"}},
+		models.PasswordEntry{Title: "GitLab", Password: "gitlab1", Tags: []string{"dev"}},
+	)
+	github, gitlab := ids["GitHub"], ids["GitLab"]
+
+	if err := pm.AddTags(github, "Work", " 2FA ", "dev"); err != nil {
+		t.Fatalf("AddTags failed: %v", err)
+	}
+	if got, want := entryTags(t, pm, github), []string{"2fa", "dev", "work"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GitHub tags = %q, want %q", got, want)
+	}
+	if err := pm.AddTags(github, "a,b"); err == nil {
+		t.Error("AddTags accepted a tag containing a comma")
+	}
+	if err := pm.AddTags(gitlab+100, "dev"); err == nil {
+		t.Error("AddTags of an unknown entry succeeded")
+	}
+
+	// Removing a tag from one entry keeps it while another entry uses it
+	if err := pm.RemoveTags(github, "DEV", "2fa", "unknown"); err != nil {
+		t.Fatalf("RemoveTags failed: %v", err)
+	}
+	if got, want := entryTags(t, pm, github), []string{"work"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GitHub tags = %q, want %q", got, want)
+	}
+	if tags, err := pm.GetTags(); err != nil || !reflect.DeepEqual(tags, []string{"dev", "work"}) {
+		t.Errorf("GetTags = %q, %v, want the unused 2fa tag removed", tags, err)
+	}
+
+	if err := pm.RemoveTags(gitlab, "dev"); err != nil {
+		t.Fatalf("RemoveTags failed: %v", err)
+	}
+	if got := entryTags(t, pm, gitlab); len(got) != 0 {
+		t.Errorf("GitLab tags = %q, want none", got)
+	}
+	if tags, err := pm.GetTags(); err != nil || !reflect.DeepEqual(tags, []string{"work"}) {
+		t.Errorf("GetTags = %q, %v, want the unused dev tag removed", tags, err)
+	}
+
+	// Replacing the tags of an entry also drops tags no longer in use
+	entry, err := pm.GetPassword(github)
+	if err != nil {
+		t.Fatalf("GetPassword failed: %v", err)
+	}
+	entry.Tags = []string{"Personal"}
+	if err := pm.UpdatePassword(entry); err != nil {
+		t.Fatalf("UpdatePassword failed: %v", err)
+	}
+	if tags, err := pm.GetTags(); err != nil || !reflect.DeepEqual(tags, []string{"personal"}) {
+		t.Errorf("GetTags = %q, %v, want [personal]", tags, err)
+	}
+}
+
+func TestSearchByTags(t *testing.T) {
+	pm := newTestManager(t)
+	addTestEntries(t, pm,
+		models.PasswordEntry{Title: "AWS", Password: "aws", Tags: []string{"work", "cloud"}},
+		models.PasswordEntry{Title: "GitHub", Password: "github", Tags: []string{"work", "dev"}},
+		models.PasswordEntry{Title: "Netflix", Password: "netflix", Tags: []string{"home"}},
+		models.PasswordEntry{Title: "Router", Password: "router"},
+	)
+
+	tests := []struct {
+		name     string
+		tags     []string
+		matchAll bool
+		want     []string
+	}{
+		{"single tag", []string{"work"}, false, []string{"AWS", "GitHub"}},
+		{"tag case ignored", []string{" WORK "}, false, []string{"AWS", "GitHub"}},
+		{"any tag", []string{"cloud", "home"}, false, []string{"AWS", "Netflix"}},
+		{"all tags", []string{"work", "dev"}, true, []string{"GitHub"}},
+		{"all tags with a duplicate", []string{"work", "Work", "dev"}, true, []string{"GitHub"}},
+		{"all tags none match", []string{"cloud", "home"}, true, nil},
+		{"unknown tag", []string{"travel"}, false, nil},
+		{"no tags", nil, false, []string{"AWS", "GitHub", "Netflix", "Router"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := pm.SearchPasswords(models.SearchParams{Tags: tt.tags, MatchAllTags: tt.matchAll})
+			if err != nil {
+				t.Fatalf("SearchPasswords failed: %v", err)
+			}
+
+			var got []string
+			for _, entry := range results {
+				got = append(got, entry.Title)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SearchPasswords(%q) = %q, want %q", tt.tags, got, tt.want)
+			}
+		})
+	}
+}
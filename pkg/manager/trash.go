@@ -0,0 +1,129 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+)
+
+// Trash retention settings
+const (
+	settingTrashRetentionDays = "trash_retention_days"
+
+	// DefaultTrashRetentionDays is how long trashed entries are kept before automatic purge
+	DefaultTrashRetentionDays = 30
+)
+
+// GetTrash retrieves all entries in the trash (without sensitive data)
+func (pm *PasswordManager) GetTrash() ([]models.PasswordEntry, error) {
+	if !pm.initialized {
+		return nil, errors.New("password manager not initialized")
+	}
+	pm.updateLastActivity()
+
+	return pm.storage.GetTrashedPasswords()
+}
+
+// RestorePassword moves an entry out of the trash
+func (pm *PasswordManager) RestorePassword(id int64) error {
+	if !pm.initialized {
+		return errors.New("password manager not initialized")
+	}
+	pm.updateLastActivity()
+
+	err := pm.storage.RestorePassword(id)
+	if err != nil {
+		return err
+	}
+
+	return pm.logAudit(AuditActionRestore, AuditResourcePassword, id, "")
+}
+
+// PurgePassword permanently deletes an entry in the trash and its history
+func (pm *PasswordManager) PurgePassword(id int64) error {
+	if !pm.initialized {
+		return errors.New("password manager not initialized")
+	}
+	pm.updateLastActivity()
+
+	err := pm.storage.PurgePassword(id)
+	if err != nil {
+		return err
+	}
+
+	return pm.logAudit(AuditActionPurge, AuditResourcePassword, id, "")
+}
+
+// EmptyTrash permanently deletes every entry in the trash
+func (pm *PasswordManager) EmptyTrash() (int64, error) {
+	if !pm.initialized {
+		return 0, errors.New("password manager not initialized")
+	}
+	pm.updateLastActivity()
+
+	return pm.purgeTrash(time.Now())
+}
+
+// GetTrashRetentionDays returns how many days entries stay in the trash.
+// Zero means trashed entries are never purged automatically.
+func (pm *PasswordManager) GetTrashRetentionDays() (int, error) {
+	value, err := pm.storage.GetSetting(settingTrashRetentionDays)
+	if err != nil {
+		return 0, err
+	}
+	if value == "" {
+		return DefaultTrashRetentionDays, nil
+	}
+
+	return strconv.Atoi(value)
+}
+
+// SetTrashRetentionDays sets how many days entries stay in the trash and purges
+// anything older. Zero disables automatic purging.
+func (pm *PasswordManager) SetTrashRetentionDays(days int) error {
+	if !pm.initialized {
+		return errors.New("password manager not initialized")
+	}
+	pm.updateLastActivity()
+
+	if days < 0 {
+		return errors.New("trash retention cannot be negative")
+	}
+
+	err := pm.storage.SaveSetting(settingTrashRetentionDays, strconv.Itoa(days))
+	if err != nil {
+		return fmt.Errorf("failed to save trash retention: %w", err)
+	}
+
+	_, err = pm.purgeExpiredTrash()
+	return err
+}
+
+// purgeExpiredTrash permanently deletes entries that have outlived the trash retention period
+func (pm *PasswordManager) purgeExpiredTrash() (int64, error) {
+	days, err := pm.GetTrashRetentionDays()
+	if err != nil {
+		return 0, err
+	}
+	if days == 0 {
+		return 0, nil
+	}
+
+	return pm.purgeTrash(time.Now().AddDate(0, 0, -days))
+}
+
+// purgeTrash permanently deletes entries trashed at or before the cutoff
+func (pm *PasswordManager) purgeTrash(before time.Time) (int64, error) {
+	purged, err := pm.storage.PurgeTrash(before)
+	if err != nil {
+		return 0, err
+	}
+	if purged == 0 {
+		return 0, nil
+	}
+
+	return purged, pm.logAudit(AuditActionPurge, AuditResourceVault, 0, fmt.Sprintf("%d entries", purged))
+}
@@ -0,0 +1,217 @@
+package manager
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+)
+
+// trashTitles returns the titles of the entries in the trash, sorted
+func trashTitles(t *testing.T, pm *PasswordManager) []string {
+	t.Helper()
+
+	trash, err := pm.GetTrash()
+	if err != nil {
+		t.Fatalf("GetTrash failed: %v", err)
+	}
+
+	var titles []string
+	for _, entry := range trash {
+		if !entry.IsTrashed() {
+			t.Errorf("entry %q in the trash has no deletion time", entry.Title)
+		}
+		titles = append(titles, entry.Title)
+	}
+	sort.Strings(titles)
+	return titles
+}
+
+// vaultTitles returns the titles of the entries outside the trash, sorted
+func vaultTitles(t *testing.T, pm *PasswordManager) []string {
+	t.Helper()
+
+	entries, err := pm.GetAllPasswords()
+	if err != nil {
+		t.Fatalf("GetAllPasswords failed: %v", err)
+	}
+
+	var titles []string
+	for _, entry := range entries {
+		titles = append(titles, entry.Title)
+	}
+	sort.Strings(titles)
+	return titles
+}
+
+func TestTrashAndRestore(t *testing.T) {
+	pm := newTestManager(t)
+	ids := addTestEntries(t, pm,
+		models.PasswordEntry{Title: "GitHub", Password: "hunter2"},
+		models.PasswordEntry{Title: "GitLab", Password: "gitlab1"},
+	)
+
+	if err := pm.DeletePassword(ids["GitHub"]); err != nil {
+		t.Fatalf("DeletePassword failed: %v", err)
+	}
+	if got, want := vaultTitles(t, pm), []string{"GitLab"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("vault = %q, want %q", got, want)
+	}
+	if got, want := trashTitles(t, pm), []string{"GitHub"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("trash = %q, want %q", got, want)
+	}
+	results, err := pm.SearchPasswords(models.SearchParams{Keyword: "GitHub"})
+	if err != nil || len(results) != 0 {
+		t.Errorf("SearchPasswords = %+v, %v, want the trashed entry left out", results, err)
+	}
+
+	// A trashed entry keeps its contents
+	entry, err := pm.GetPassword(ids["GitHub"])
+	if err != nil || entry.Password != "hunter2" || !entry.IsTrashed() {
+		t.Errorf("GetPassword = %+v, %v, want the trashed entry", entry, err)
+	}
+
+	if err := pm.DeletePassword(ids["GitHub"]); err == nil {
+		t.Error("DeletePassword of a trashed entry succeeded")
+	}
+	if err := pm.RestorePassword(ids["GitLab"]); err == nil {
+		t.Error("RestorePassword of an entry outside the trash succeeded")
+	}
+
+	if err := pm.RestorePassword(ids["GitHub"]); err != nil {
+		t.Fatalf("RestorePassword failed: %v", err)
+	}
+	if got, want := vaultTitles(t, pm), []string{"GitHub", "GitLab"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("vault = %q, want %q", got, want)
+	}
+	if got := trashTitles(t, pm); len(got) != 0 {
+		t.Errorf("trash = %q, want it empty", got)
+	}
+}
+
+func TestPurgePassword(t *testing.T) {
+	pm := newTestManager(t)
+	ids := addTestEntries(t, pm,
+		models.PasswordEntry{Title: "GitHub", Password: "hunter1", Tags: []string{"dev"}},
+		models.PasswordEntry{Title: "GitLab", Password: "gitlab1", Tags: []string{"ops"}},
+		models.PasswordEntry{Title: "Bitbucket", Password: "bucket1"},
+	)
+	setPassword(t, pm, ids["GitHub"], "hunter2")
+
+	// Entries outside the trash cannot be purged
+	err := pm.PurgePassword(ids["GitHub"])
+	if err == nil || !strings.Contains(err.Error(), "is not in the trash") {
+		t.Errorf("PurgePassword error = %v, want it to contain %q", err, "is not in the trash")
+	}
+	if entry, err := pm.GetPassword(ids["GitHub"]); err != nil || entry.IsTrashed() {
+		t.Errorf("GetPassword = %+v, %v, want the entry kept outside the trash", entry, err)
+	}
+	if got := historyPasswords(t, pm, ids["GitHub"]); len(got) != 1 {
+		t.Errorf("history = %q, want it kept", got)
+	}
+
+	if err := pm.DeletePassword(ids["GitHub"]); err != nil {
+		t.Fatalf("DeletePassword failed: %v", err)
+	}
+	if err := pm.PurgePassword(ids["GitHub"]); err != nil {
+		t.Fatalf("PurgePassword failed: %v", err)
+	}
+	if _, err := pm.GetPassword(ids["GitHub"]); err == nil {
+		t.Error("GetPassword of a purged entry succeeded")
+	}
+	if got := historyPasswords(t, pm, ids["GitHub"]); len(got) != 0 {
+		t.Errorf("history of a purged entry = %q, want none", got)
+	}
+	if tags, err := pm.GetTags(); err != nil || !reflect.DeepEqual(tags, []string{"ops"}) {
+		t.Errorf("GetTags = %q, %v, want the tag of the purged entry removed", tags, err)
+	}
+	if err := pm.PurgePassword(ids["GitHub"]); err == nil {
+		t.Error("PurgePassword of a purged entry succeeded")
+	}
+
+	// Emptying the trash purges only trashed entries
+	if err := pm.DeletePassword(ids["GitLab"]); err != nil {
+		t.Fatalf("DeletePassword failed: %v", err)
+	}
+	purged, err := pm.EmptyTrash()
+	if err != nil || purged != 1 {
+		t.Errorf("EmptyTrash = %d, %v, want 1", purged, err)
+	}
+	if got, want := vaultTitles(t, pm), []string{"Bitbucket"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("vault = %q, want %q", got, want)
+	}
+	if got := trashTitles(t, pm); len(got) != 0 {
+		t.Errorf("trash = %q, want it empty", got)
+	}
+}
+
+// setDeleted moves an entry to the trash as of the given time
+func setDeleted(t *testing.T, db *sql.DB, id int64, deleted time.Time) {
+	t.Helper()
+
+	_, err := db.Exec("UPDATE passwords SET deleted_at = ? WHERE id = ?", deleted.UTC().Format("2006-01-02 15:04:05"), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTrashRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.db")
+	pm := newTestManagerAt(t, path)
+	db := openTestDB(t, path)
+	ids := addTestEntries(t, pm,
+		models.PasswordEntry{Title: "Old", Password: "old"},
+		models.PasswordEntry{Title: "Recent", Password: "recent"},
+		models.PasswordEntry{Title: "Kept", Password: "kept"},
+	)
+
+	days, err := pm.GetTrashRetentionDays()
+	if err != nil || days != DefaultTrashRetentionDays {
+		t.Errorf("GetTrashRetentionDays = %d, %v, want %d", days, err, DefaultTrashRetentionDays)
+	}
+
+	now := time.Now()
+	setDeleted(t, db, ids["Old"], now.AddDate(0, 0, -40))
+	setDeleted(t, db, ids["Recent"], now.AddDate(0, 0, -10))
+
+	// Unlocking the vault purges entries trashed longer than the retention period
+	pm.Lock()
+	if err := pm.UnlockVault("correct horse battery staple"); err != nil {
+		t.Fatalf("UnlockVault failed: %v", err)
+	}
+	if got, want := trashTitles(t, pm), []string{"Recent"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("trash = %q, want %q", got, want)
+	}
+
+	// Shortening the period purges at once
+	if err := pm.SetTrashRetentionDays(7); err != nil {
+		t.Fatalf("SetTrashRetentionDays failed: %v", err)
+	}
+	if got := trashTitles(t, pm); len(got) != 0 {
+		t.Errorf("trash = %q, want it empty", got)
+	}
+
+	// Zero keeps trashed entries forever
+	if err := pm.SetTrashRetentionDays(0); err != nil {
+		t.Fatalf("SetTrashRetentionDays failed: %v", err)
+	}
+	setDeleted(t, db, ids["Kept"], now.AddDate(-10, 0, 0))
+	if purged, err := pm.purgeExpiredTrash(); err != nil || purged != 0 {
+		t.Errorf("purgeExpiredTrash = %d, %v, want nothing purged", purged, err)
+	}
+	if got, want := trashTitles(t, pm), []string{"Kept"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("trash = %q, want %q", got, want)
+	}
+
+	if err := pm.SetTrashRetentionDays(-1); err == nil {
+		t.Error("SetTrashRetentionDays accepted a negative period")
+	}
+	if days, err := pm.GetTrashRetentionDays(); err != nil || days != 0 {
+		t.Errorf("GetTrashRetentionDays = %d, %v, want 0", days, err)
+	}
+}
@@ -0,0 +1,72 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+	"github.com/loganmanery/passmanager/pkg/urlmatch"
+)
+
+// URLCandidate is an entry matching a page URL, ranked by Score
+type URLCandidate struct {
+	Entry models.PasswordEntry
+	Score int
+}
+
+// FindByURL returns the entries outside the trash whose URL matches a page
+// URL under their match mode, best match first
+func (pm *PasswordManager) FindByURL(pageURL string) ([]URLCandidate, error) {
+	if !pm.initialized {
+		return nil, errors.New("password manager not initialized")
+	}
+
+	page, err := urlmatch.Normalize(pageURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid page URL: %w", err)
+	}
+
+	entries, err := pm.GetAllPasswords()
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []URLCandidate
+	for _, entry := range entries {
+		if score, ok := urlmatch.Match(entry.URL, entry.URLMatch, page); ok {
+			candidates = append(candidates, URLCandidate{Entry: entry, Score: score})
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		return candidates[i].Entry.LastUpdated.After(candidates[j].Entry.LastUpdated)
+	})
+
+	return candidates, nil
+}
+
+// normalizeURLMatch validates the URL match mode of an entry
+func normalizeURLMatch(entry *models.PasswordEntry) error {
+	mode, err := urlmatch.ParseMode(entry.URLMatch)
+	if err != nil {
+		return err
+	}
+	entry.URLMatch = mode
+
+	if mode == urlmatch.ModeRegex {
+		if strings.TrimSpace(entry.URL) == "" {
+			return errors.New("regex URL matching needs a pattern in the URL")
+		}
+		if _, err := regexp.Compile(entry.URL); err != nil {
+			return fmt.Errorf("invalid URL pattern: %w", err)
+		}
+	}
+
+	return nil
+}
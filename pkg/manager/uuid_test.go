@@ -0,0 +1,87 @@
+package manager
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/loganmanery/passmanager/pkg/models"
+)
+
+func TestPasswordUUIDs(t *testing.T) {
+	pm := newTestManager(t)
+	ids := addTestEntries(t, pm,
+		models.PasswordEntry{Title: "GitHub", Password: "hunter2"},
+		models.PasswordEntry{Title: "GitLab", Password: "gitlab1"},
+	)
+
+	entry, err := pm.GetPassword(ids["GitHub"])
+	if err != nil {
+		t.Fatalf("GetPassword failed: %v", err)
+	}
+	uuid := entry.UUID
+	if !models.IsUUID(uuid) {
+		t.Fatalf("UUID = %q, want a UUID", uuid)
+	}
+	other, err := pm.GetPassword(ids["GitLab"])
+	if err != nil {
+		t.Fatalf("GetPassword failed: %v", err)
+	}
+	if other.UUID == uuid {
+		t.Errorf("entries share the UUID %q", uuid)
+	}
+
+	// Lookups ignore the case of the UUID
+	for _, lookup := range []string{uuid, strings.ToUpper(uuid)} {
+		got, err := pm.GetPasswordByUUID(lookup)
+		if err != nil || got.ID != ids["GitHub"] || got.Password != "hunter2" {
+			t.Errorf("GetPasswordByUUID(%q) = %+v, %v, want GitHub", lookup, got, err)
+		}
+	}
+	for _, lookup := range []string{"00000000-0000-4000-8000-000000000000", "not-a-uuid", ""} {
+		if _, err := pm.GetPasswordByUUID(lookup); err == nil {
+			t.Errorf("GetPasswordByUUID(%q) succeeded", lookup)
+		}
+	}
+
+	// Updates keep the UUID, also when they ignore the UUID they are given
+	entry.Password = "hunter3"
+	entry.UUID = "00000000-0000-4000-8000-000000000000"
+	if err := pm.UpdatePassword(entry); err != nil {
+		t.Fatalf("UpdatePassword failed: %v", err)
+	}
+	if got, err := pm.GetPassword(ids["GitHub"]); err != nil || got.UUID != uuid {
+		t.Errorf("UUID after update = %q, %v, want %q", got.UUID, err, uuid)
+	}
+
+	// An entry without an ID is updated by its UUID
+	update := models.PasswordEntry{UUID: strings.ToUpper(uuid), Title: "GitHub (personal)", Password: "hunter4"}
+	if err := pm.UpdatePassword(update); err != nil {
+		t.Fatalf("UpdatePassword by UUID failed: %v", err)
+	}
+	got, err := pm.GetPassword(ids["GitHub"])
+	if err != nil {
+		t.Fatalf("GetPassword failed: %v", err)
+	}
+	if got.Title != "GitHub (personal)" || got.Password != "hunter4" || got.UUID != uuid {
+		t.Errorf("entry updated by UUID = %+v, want the new title and password and UUID %q", got, uuid)
+	}
+	if got, err := pm.GetPassword(ids["GitLab"]); err != nil || got.Title != "GitLab" {
+		t.Errorf("GitLab = %+v, %v, want it unchanged", got, err)
+	}
+
+	update.UUID = "00000000-0000-4000-8000-000000000000"
+	if err := pm.UpdatePassword(update); err == nil {
+		t.Error("UpdatePassword of an unknown UUID succeeded")
+	}
+
+	// The UUID survives the trash
+	if err := pm.DeletePassword(ids["GitHub"]); err != nil {
+		t.Fatalf("DeletePassword failed: %v", err)
+	}
+	if err := pm.RestorePassword(ids["GitHub"]); err != nil {
+		t.Fatalf("RestorePassword failed: %v", err)
+	}
+	if got, err := pm.GetPasswordByUUID(uuid); err != nil || got.ID != ids["GitHub"] {
+		t.Errorf("GetPasswordByUUID after restore = %+v, %v, want GitHub", got, err)
+	}
+}
@@ -2,25 +2,243 @@ package models
 
 import "time"
 
+// Item types. Logins are the default; the other types keep their specific
+// fields in the matching data struct on PasswordEntry.
+const (
+	ItemTypeLogin         = "login"
+	ItemTypeSecureNote    = "secure_note"
+	ItemTypeCard          = "card"
+	ItemTypeIdentity      = "identity"
+	ItemTypeSSHKey        = "ssh_key"
+	ItemTypeAPICredential = "api_credential"
+	ItemTypeWiFi          = "wifi"
+)
+
+// ItemTypes lists every supported item type
+var ItemTypes = []string{
+	ItemTypeLogin,
+	ItemTypeSecureNote,
+	ItemTypeCard,
+	ItemTypeIdentity,
+	ItemTypeSSHKey,
+	ItemTypeAPICredential,
+	ItemTypeWiFi,
+}
+
 // PasswordEntry represents a stored password entry
 type PasswordEntry struct {
-	ID          int64
-	Title       string
-	URL         string
-	Username    string
-	Password    string
-	Notes       string
-	Category    string
-	CreatedAt   time.Time
-	LastUpdated time.Time
+	ID            int64
+	UUID          string
+	Type          string
+	Title         string
+	URL           string
+	URLMatch      string
+	Username      string
+	Password      string
+	Notes         string
+	TOTP          string
+	Category      string
+	Tags          []string
+	CustomFields  []CustomField
+	Card          *CardData
+	Identity      *IdentityData
+	SSHKey        *SSHKeyData
+	APICredential *APICredentialData
+	WiFi          *WiFiData
+	CreatedAt     time.Time
+	LastUpdated   time.Time
+	DeletedAt     time.Time
+}
+
+// IsTrashed reports whether the entry has been moved to the trash
+func (e PasswordEntry) IsTrashed() bool {
+	return !e.DeletedAt.IsZero()
+}
+
+// IsUUID reports whether s is a UUID in its canonical textual form
+func IsUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, c := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'f') && !(c >= 'A' && c <= 'F') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// CardData holds the fields of a payment card item
+type CardData struct {
+	CardholderName string `json:"cardholder_name,omitempty"`
+	Brand          string `json:"brand,omitempty"`
+	Number         string `json:"number"`
+	ExpiryMonth    int    `json:"expiry_month,omitempty"`
+	ExpiryYear     int    `json:"expiry_year,omitempty"`
+	CVV            string `json:"cvv,omitempty"`
+	PIN            string `json:"pin,omitempty"`
+}
+
+// IdentityData holds the fields of an identity item
+type IdentityData struct {
+	FirstName      string `json:"first_name,omitempty"`
+	MiddleName     string `json:"middle_name,omitempty"`
+	LastName       string `json:"last_name,omitempty"`
+	Company        string `json:"company,omitempty"`
+	Email          string `json:"email,omitempty"`
+	Phone          string `json:"phone,omitempty"`
+	Address1       string `json:"address1,omitempty"`
+	Address2       string `json:"address2,omitempty"`
+	City           string `json:"city,omitempty"`
+	State          string `json:"state,omitempty"`
+	PostalCode     string `json:"postal_code,omitempty"`
+	Country        string `json:"country,omitempty"`
+	SSN            string `json:"ssn,omitempty"`
+	PassportNumber string `json:"passport_number,omitempty"`
+	LicenseNumber  string `json:"license_number,omitempty"`
+}
+
+// SSHKeyData holds the fields of an SSH key item. The passphrase of an
+// encrypted private key is kept in the entry's Password.
+type SSHKeyData struct {
+	PrivateKey  string `json:"private_key"`
+	PublicKey   string `json:"public_key,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// APICredentialData holds the fields of an API credential item. The secret is
+// kept in the entry's Password and the endpoint in its URL.
+type APICredentialData struct {
+	KeyID     string `json:"key_id"`
+	ExpiresAt string `json:"expires_at,omitempty"`
+}
+
+// WiFiData holds the fields of a Wi-Fi network item. The passphrase is kept
+// in the entry's Password.
+type WiFiData struct {
+	SSID     string `json:"ssid"`
+	Security string `json:"security,omitempty"`
+	Hidden   bool   `json:"hidden,omitempty"`
+}
+
+// Custom field types
+const (
+	FieldTypeText   = "text"
+	FieldTypeHidden = "hidden"
+	FieldTypeURL    = "url"
+)
+
+// CustomField represents a user-defined named field on a password entry.
+// Hidden fields are encrypted at rest like the password.
+type CustomField struct {
+	Name  string
+	Type  string
+	Value string
+}
+
+// ExportEntry is an entry as written to an export file. Secrets stay
+// encrypted as they are stored in the vault: Password, Notes, TOTP, ItemData
+// and the values of hidden custom fields are AES-GCM ciphertexts, and so are
+// the passwords in History. The Data of every attachment is its content
+// encrypted as an attachment stream.
+type ExportEntry struct {
+	UUID         string              `json:"uuid"`
+	Type         string              `json:"type"`
+	Title        string              `json:"title"`
+	URL          string              `json:"url"`
+	URLMatch     string              `json:"url_match"`
+	Username     string              `json:"username"`
+	Password     []byte              `json:"password"`
+	Notes        []byte              `json:"notes"`
+	TOTP         []byte              `json:"totp"`
+	OTPCounter   uint64              `json:"otp_counter"`
+	ItemData     []byte              `json:"item_data"`
+	Category     string              `json:"category"`
+	Tags         []string            `json:"tags"`
+	CustomFields []ExportCustomField `json:"custom_fields"`
+	CreatedAt    time.Time           `json:"created_at"`
+	UpdatedAt    time.Time           `json:"updated_at"`
+	History      []ExportHistory     `json:"history"`
+	Attachments  []ExportAttachment  `json:"attachments"`
+}
+
+// ExportCustomField is a custom field as written to an export file
+type ExportCustomField struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value []byte `json:"value"`
+}
+
+// ExportHistory is a previous password of an entry, encrypted
+type ExportHistory struct {
+	Password  []byte    `json:"password"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ExportAttachment is an attachment of an entry. Data is the content
+// encrypted as an attachment stream.
+type ExportAttachment struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	Data []byte `json:"data"`
 }
 
 // SearchParams represents search criteria for password entries
 type SearchParams struct {
-	Keyword  string
-	Category string
-	SortBy   string
-	SortDesc bool
-	Limit    int
-	Offset   int
+	Keyword        string
+	Query          string
+	Category       string
+	Type           string
+	Tags           []string
+	MatchAllTags   bool
+	IncludeTrashed bool
+	SortBy         string
+	SortDesc       bool
+	Limit          int
+	Offset         int
+}
+
+// AuditLogEntry represents a single record in the hash-chained audit log
+type AuditLogEntry struct {
+	ID           int64
+	Seq          int64
+	Action       string
+	ResourceType string
+	ResourceID   int64
+	Details      string
+	CreatedAt    time.Time
+	PrevMAC      []byte
+	MAC          []byte
+}
+
+// AuditVerification reports the outcome of verifying the audit log chain
+type AuditVerification struct {
+	Records   int
+	Valid     bool
+	BrokenSeq int64
+	Reason    string
+}
+
+// PasswordHistoryEntry represents a previous password of an entry
+type PasswordHistoryEntry struct {
+	ID         int64
+	PasswordID int64
+	Password   string
+	CreatedAt  time.Time
+}
+
+// Attachment represents an encrypted file attached to a password entry
+type Attachment struct {
+	ID         int64
+	PasswordID int64
+	Name       string
+	Size       int64
+	CreatedAt  time.Time
 }
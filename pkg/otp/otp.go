@@ -0,0 +1,335 @@
+package otp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Supported one-time password types
+const (
+	TypeTOTP  = "totp"
+	TypeHOTP  = "hotp"
+	TypeSteam = "steam"
+)
+
+// Supported HMAC algorithms
+const (
+	AlgorithmSHA1   = "SHA1"
+	AlgorithmSHA256 = "SHA256"
+	AlgorithmSHA512 = "SHA512"
+)
+
+// Defaults used when a secret or URI does not specify them
+const (
+	DefaultAlgorithm = AlgorithmSHA1
+	DefaultDigits    = 6
+	DefaultPeriod    = 30
+)
+
+// Steam Guard codes are five characters from their own alphabet
+const (
+	steamAlphabet = "23456789BCDFGHJKMNPQRTVWXY"
+	steamDigits   = 5
+)
+
+// Key holds everything needed to generate one-time passwords for an account.
+// Counter is the initial counter of an HOTP key.
+type Key struct {
+	Type      string
+	Issuer    string
+	Account   string
+	Secret    []byte
+	Algorithm string
+	Digits    int
+	Period    int
+	Counter   uint64
+}
+
+// Parse parses an otpauth:// URI, a steam:// secret, or a bare base32 secret,
+// which gets the default TOTP parameters
+func Parse(value string) (*Key, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(strings.ToLower(value), "otpauth://") {
+		return ParseURI(value)
+	}
+
+	if strings.HasPrefix(strings.ToLower(value), "steam://") {
+		secret, err := DecodeSecret(value[len("steam://"):])
+		if err != nil {
+			return nil, err
+		}
+		return newSteamKey(secret), nil
+	}
+
+	secret, err := DecodeSecret(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Key{
+		Type:      TypeTOTP,
+		Secret:    secret,
+		Algorithm: DefaultAlgorithm,
+		Digits:    DefaultDigits,
+		Period:    DefaultPeriod,
+	}, nil
+}
+
+// ParseURI parses an otpauth:// URI as used in authenticator QR codes, e.g.
+// otpauth://totp/Example:alice@example.com?secret=JBSWY3DPEHPK3PXP&issuer=Example
+func ParseURI(uri string) (*Key, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid otpauth URI: %w", err)
+	}
+	if !strings.EqualFold(u.Scheme, "otpauth") {
+		return nil, fmt.Errorf("invalid otpauth URI: unexpected scheme %q", u.Scheme)
+	}
+
+	key := &Key{
+		Type:      strings.ToLower(u.Host),
+		Algorithm: DefaultAlgorithm,
+		Digits:    DefaultDigits,
+		Period:    DefaultPeriod,
+	}
+	if key.Type != TypeTOTP && key.Type != TypeHOTP {
+		return nil, fmt.Errorf("unsupported one-time password type %q", u.Host)
+	}
+
+	// The label is "issuer:account" or just "account"
+	label := strings.TrimPrefix(u.Path, "/")
+	if issuer, account, found := strings.Cut(label, ":"); found {
+		key.Issuer = strings.TrimSpace(issuer)
+		key.Account = strings.TrimSpace(account)
+	} else {
+		key.Account = label
+	}
+
+	query := u.Query()
+	if issuer := query.Get("issuer"); issuer != "" {
+		key.Issuer = issuer
+	}
+
+	key.Secret, err = DecodeSecret(query.Get("secret"))
+	if err != nil {
+		return nil, err
+	}
+
+	if algorithm := query.Get("algorithm"); algorithm != "" {
+		key.Algorithm = strings.ToUpper(algorithm)
+	}
+
+	if digits := query.Get("digits"); digits != "" {
+		key.Digits, err = strconv.Atoi(digits)
+		if err != nil {
+			return nil, fmt.Errorf("invalid digits %q", digits)
+		}
+	}
+
+	if period := query.Get("period"); period != "" {
+		key.Period, err = strconv.Atoi(period)
+		if err != nil {
+			return nil, fmt.Errorf("invalid period %q", period)
+		}
+	}
+
+	if counter := query.Get("counter"); counter != "" {
+		key.Counter, err = strconv.ParseUint(counter, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid counter %q", counter)
+		}
+	}
+
+	// Steam Guard keys are TOTP keys marked with the steam encoder
+	if strings.EqualFold(query.Get("encoder"), TypeSteam) {
+		steam := newSteamKey(key.Secret)
+		steam.Issuer = key.Issuer
+		steam.Account = key.Account
+		key = steam
+	}
+
+	if err := key.Validate(); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// DecodeSecret decodes a base32 secret, ignoring case, spaces and padding
+func DecodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	secret = strings.TrimRight(secret, "=")
+	if secret == "" {
+		return nil, errors.New("one-time password secret is empty")
+	}
+
+	decoded, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		return nil, errors.New("one-time password secret is not valid base32")
+	}
+
+	return decoded, nil
+}
+
+// Validate checks that the key parameters are supported
+func (k *Key) Validate() error {
+	if len(k.Secret) == 0 {
+		return errors.New("one-time password secret is empty")
+	}
+
+	if _, err := hashFunc(k.Algorithm); err != nil {
+		return err
+	}
+
+	switch k.Type {
+	case TypeTOTP, TypeHOTP:
+		if k.Digits != 6 && k.Digits != 8 {
+			return fmt.Errorf("unsupported number of digits %d, must be 6 or 8", k.Digits)
+		}
+	case TypeSteam:
+		if k.Digits != steamDigits {
+			return fmt.Errorf("steam codes must have %d characters", steamDigits)
+		}
+	default:
+		return fmt.Errorf("unsupported one-time password type %q", k.Type)
+	}
+
+	if k.Type != TypeHOTP && k.Period <= 0 {
+		return fmt.Errorf("invalid period %d", k.Period)
+	}
+
+	return nil
+}
+
+// IsCounterBased reports whether codes are generated from a counter rather than the time
+func (k *Key) IsCounterBased() bool {
+	return k.Type == TypeHOTP
+}
+
+// URI formats the key as an otpauth:// URI
+func (k *Key) URI() string {
+	label := k.Account
+	if k.Issuer != "" {
+		label = k.Issuer + ":" + k.Account
+	}
+
+	query := url.Values{}
+	query.Set("secret", base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(k.Secret))
+	if k.Issuer != "" {
+		query.Set("issuer", k.Issuer)
+	}
+	host := k.Type
+	switch k.Type {
+	case TypeHOTP:
+		query.Set("algorithm", k.Algorithm)
+		query.Set("digits", strconv.Itoa(k.Digits))
+		query.Set("counter", strconv.FormatUint(k.Counter, 10))
+	case TypeSteam:
+		host = TypeTOTP
+		query.Set("encoder", TypeSteam)
+	default:
+		query.Set("algorithm", k.Algorithm)
+		query.Set("digits", strconv.Itoa(k.Digits))
+		query.Set("period", strconv.Itoa(k.Period))
+	}
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     host,
+		Path:     "/" + label,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
+
+// Code returns the one-time password for a counter value. For time-based
+// keys the counter is the number of periods since the Unix epoch.
+func (k *Key) Code(counter uint64) (string, error) {
+	if err := k.Validate(); err != nil {
+		return "", err
+	}
+
+	value, err := hotp(k.Secret, counter, k.Algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	if k.Type == TypeSteam {
+		return formatSteam(value), nil
+	}
+	return formatDecimal(value, k.Digits), nil
+}
+
+// newSteamKey creates a Steam Guard key, which always uses SHA1, five characters and 30 seconds
+func newSteamKey(secret []byte) *Key {
+	return &Key{
+		Type:      TypeSteam,
+		Issuer:    "Steam",
+		Secret:    secret,
+		Algorithm: AlgorithmSHA1,
+		Digits:    steamDigits,
+		Period:    DefaultPeriod,
+	}
+}
+
+// hotp computes the HMAC-based one-time password value for a counter (RFC 4226)
+func hotp(secret []byte, counter uint64, algorithm string) (uint32, error) {
+	newHash, err := hashFunc(algorithm)
+	if err != nil {
+		return 0, err
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(newHash, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	return binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff, nil
+}
+
+// formatDecimal renders a truncated HOTP value as a zero-padded decimal code
+func formatDecimal(value uint32, digits int) string {
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
+
+// formatSteam renders a truncated HOTP value in the Steam Guard alphabet
+func formatSteam(value uint32) string {
+	code := make([]byte, steamDigits)
+	for i := range code {
+		code[i] = steamAlphabet[value%uint32(len(steamAlphabet))]
+		value /= uint32(len(steamAlphabet))
+	}
+	return string(code)
+}
+
+// hashFunc returns the hash constructor for an algorithm name
+func hashFunc(algorithm string) (func() hash.Hash, error) {
+	switch algorithm {
+	case AlgorithmSHA1:
+		return sha1.New, nil
+	case AlgorithmSHA256:
+		return sha256.New, nil
+	case AlgorithmSHA512:
+		return sha512.New, nil
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", algorithm)
+	}
+}
@@ -0,0 +1,252 @@
+package otp
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 Appendix B seeds, one per algorithm
+var rfc6238Seeds = map[string][]byte{
+	AlgorithmSHA1:   []byte("12345678901234567890"),
+	AlgorithmSHA256: []byte("12345678901234567890123456789012"),
+	AlgorithmSHA512: []byte("1234567890123456789012345678901234567890123456789012345678901234"),
+}
+
+// RFC 6238 Appendix B test vectors
+var rfc6238Vectors = []struct {
+	unix      int64
+	algorithm string
+	code      string
+}{
+	{59, AlgorithmSHA1, "94287082"},
+	{59, AlgorithmSHA256, "46119246"},
+	{59, AlgorithmSHA512, "90693936"},
+	{1111111109, AlgorithmSHA1, "07081804"},
+	{1111111109, AlgorithmSHA256, "68084774"},
+	{1111111109, AlgorithmSHA512, "25091201"},
+	{1111111111, AlgorithmSHA1, "14050471"},
+	{1111111111, AlgorithmSHA256, "67062674"},
+	{1111111111, AlgorithmSHA512, "99943326"},
+	{1234567890, AlgorithmSHA1, "89005924"},
+	{1234567890, AlgorithmSHA256, "91819424"},
+	{1234567890, AlgorithmSHA512, "93441116"},
+	{2000000000, AlgorithmSHA1, "69279037"},
+	{2000000000, AlgorithmSHA256, "90698825"},
+	{2000000000, AlgorithmSHA512, "38618901"},
+	{20000000000, AlgorithmSHA1, "65353130"},
+	{20000000000, AlgorithmSHA256, "77737706"},
+	{20000000000, AlgorithmSHA512, "47863826"},
+}
+
+// rfc6238Key returns a TOTP key with the RFC 6238 seed for algorithm
+func rfc6238Key(algorithm string, digits, period int) *Key {
+	return &Key{
+		Type:      TypeTOTP,
+		Secret:    rfc6238Seeds[algorithm],
+		Algorithm: algorithm,
+		Digits:    digits,
+		Period:    period,
+	}
+}
+
+func TestGenerateRFC6238(t *testing.T) {
+	for _, tt := range rfc6238Vectors {
+		now := time.Unix(tt.unix, 0).UTC()
+
+		code, err := rfc6238Key(tt.algorithm, 8, 30).Generate(now)
+		if err != nil {
+			t.Fatalf("%s at %d: %v", tt.algorithm, tt.unix, err)
+		}
+		if code != tt.code {
+			t.Errorf("%s at %d = %s, want %s", tt.algorithm, tt.unix, code, tt.code)
+		}
+
+		// Six digit codes are the last six digits of the same value
+		code, err = rfc6238Key(tt.algorithm, 6, 30).Generate(now)
+		if err != nil {
+			t.Fatalf("%s at %d: %v", tt.algorithm, tt.unix, err)
+		}
+		if want := tt.code[2:]; code != want {
+			t.Errorf("%s at %d with 6 digits = %s, want %s", tt.algorithm, tt.unix, code, want)
+		}
+	}
+}
+
+func TestGenerateCustomPeriod(t *testing.T) {
+	// With a 60 second period the counter is half the 30 second one, so
+	// 1111111109 (counter 18518518) gives the code 1111111109/2 has at 30 seconds
+	key := rfc6238Key(AlgorithmSHA1, 8, 60)
+	code, err := key.Generate(time.Unix(1111111109, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := rfc6238Key(AlgorithmSHA1, 8, 30).Generate(time.Unix(1111111109/2, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != want {
+		t.Errorf("code with a 60 second period = %s, want %s", code, want)
+	}
+
+	if got := key.Remaining(time.Unix(1111111109, 0)); got != 31*time.Second {
+		t.Errorf("Remaining = %v, want 31s", got)
+	}
+
+	key.Period = 0
+	if _, err := key.Generate(time.Unix(59, 0)); err == nil {
+		t.Error("Generate accepted a zero period")
+	}
+}
+
+func TestParseURI(t *testing.T) {
+	tests := []struct {
+		name string
+		uri  string
+		want Key
+	}{
+		{
+			"issuer in the label",
+			"otpauth://totp/Example:alice@example.com?secret=JBSWY3DPEHPK3PXP",
+			Key{Type: TypeTOTP, Issuer: "Example", Account: "alice@example.com", Algorithm: AlgorithmSHA1, Digits: 6, Period: 30},
+		},
+		{
+			"issuer parameter wins",
+			"otpauth://totp/Old:alice?secret=JBSWY3DPEHPK3PXP&issuer=New",
+			Key{Type: TypeTOTP, Issuer: "New", Account: "alice", Algorithm: AlgorithmSHA1, Digits: 6, Period: 30},
+		},
+		{
+			"all parameters",
+			"otpauth://TOTP/alice?secret=jbswy3dpehpk3pxp&algorithm=sha512&digits=8&period=60",
+			Key{Type: TypeTOTP, Account: "alice", Algorithm: AlgorithmSHA512, Digits: 8, Period: 60},
+		},
+		{
+			"hotp counter",
+			"otpauth://hotp/Example:bob?secret=JBSWY3DPEHPK3PXP&counter=42",
+			Key{Type: TypeHOTP, Issuer: "Example", Account: "bob", Algorithm: AlgorithmSHA1, Digits: 6, Period: 30, Counter: 42},
+		},
+		{
+			"steam encoder",
+			"otpauth://totp/Steam:gaben?secret=JBSWY3DPEHPK3PXP&encoder=steam",
+			Key{Type: TypeSteam, Issuer: "Steam", Account: "gaben", Algorithm: AlgorithmSHA1, Digits: 5, Period: 30},
+		},
+	}
+
+	secret := []byte("Hello!\xde\xad\xbe\xef")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ParseURI(tt.uri)
+			if err != nil {
+				t.Fatalf("ParseURI failed: %v", err)
+			}
+			want := tt.want
+			want.Secret = secret
+			if !reflect.DeepEqual(*key, want) {
+				t.Errorf("key = %+v, want %+v", *key, want)
+			}
+
+			// Formatting the key and parsing it again gives the same key
+			again, err := ParseURI(key.URI())
+			if err != nil {
+				t.Fatalf("parsing %s failed: %v", key.URI(), err)
+			}
+			if !reflect.DeepEqual(again, key) {
+				t.Errorf("round trip key = %+v, want %+v", *again, *key)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	key, err := Parse(" jbsw y3dp ehpk 3pxp ")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if key.Type != TypeTOTP || key.Algorithm != DefaultAlgorithm || key.Digits != DefaultDigits || key.Period != DefaultPeriod {
+		t.Errorf("bare secret parsed as %+v, want the TOTP defaults", key)
+	}
+
+	key, err = Parse("steam://JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if key.Type != TypeSteam {
+		t.Errorf("steam:// secret parsed as type %q", key.Type)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		err   string
+	}{
+		{"bad secret", "otpauth://totp/alice?secret=not!base32", "one-time password secret is not valid base32"},
+		{"missing secret", "otpauth://totp/alice", "one-time password secret is empty"},
+		{"empty bare secret", "  ", "one-time password secret is empty"},
+		{"unknown algorithm", "otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&algorithm=md5", `unsupported algorithm "MD5"`},
+		{"unsupported digits", "otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&digits=7", "unsupported number of digits 7"},
+		{"invalid digits", "otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&digits=six", `invalid digits "six"`},
+		{"invalid period", "otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&period=0", "invalid period 0"},
+		{"invalid counter", "otpauth://hotp/alice?secret=JBSWY3DPEHPK3PXP&counter=-1", `invalid counter "-1"`},
+		{"unknown type", "otpauth://motp/alice?secret=JBSWY3DPEHPK3PXP", `unsupported one-time password type "motp"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.value)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Parse(%q) error = %v, want it to contain %q", tt.value, err, tt.err)
+			}
+		})
+	}
+
+	if _, err := ParseURI("https://totp/alice?secret=JBSWY3DPEHPK3PXP"); err == nil || !strings.Contains(err.Error(), `unexpected scheme "https"`) {
+		t.Errorf("ParseURI error = %v, want an unexpected scheme", err)
+	}
+}
+
+func TestCodeRFC4226(t *testing.T) {
+	// RFC 4226 Appendix D test values
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+
+	key := &Key{Type: TypeHOTP, Secret: []byte("12345678901234567890"), Algorithm: AlgorithmSHA1, Digits: 6}
+	for counter, code := range want {
+		got, err := key.Code(uint64(counter))
+		if err != nil {
+			t.Fatalf("counter %d: %v", counter, err)
+		}
+		if got != code {
+			t.Errorf("counter %d = %s, want %s", counter, got, code)
+		}
+	}
+
+	if _, err := key.Generate(time.Unix(59, 0)); err == nil {
+		t.Error("Generate accepted an HOTP key")
+	}
+}
+
+func TestGenerateSteam(t *testing.T) {
+	key, err := Parse("steam://JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{1234567890, "K8G5W"},
+		{1700000000, "2KM2P"},
+	}
+	for _, tt := range tests {
+		code, err := key.Generate(time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("at %d: %v", tt.unix, err)
+		}
+		if code != tt.code {
+			t.Errorf("at %d = %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package otp
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Generate returns the time-based one-time password for the given time (RFC 6238)
+func (k *Key) Generate(t time.Time) (string, error) {
+	if k.IsCounterBased() {
+		return "", errors.New("HOTP codes are generated from a counter, not the time")
+	}
+	if k.Period <= 0 {
+		return "", fmt.Errorf("invalid period %d", k.Period)
+	}
+
+	return k.Code(uint64(t.Unix() / int64(k.Period)))
+}
+
+// Remaining returns how long the code for the given time stays valid
+func (k *Key) Remaining(t time.Time) time.Duration {
+	period := int64(k.Period)
+	elapsed := t.Unix() % period
+	return time.Duration(period-elapsed) * time.Second
+}
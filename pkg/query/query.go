@@ -0,0 +1,415 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Node is a node of a parsed query
+type Node interface {
+	node()
+}
+
+// And matches entries matched by every one of its terms
+type And struct {
+	Terms []Node
+}
+
+// Or matches entries matched by any one of its terms
+type Or struct {
+	Terms []Node
+}
+
+// Not matches entries not matched by its term
+type Not struct {
+	Term Node
+}
+
+// Text matches entries containing a word or phrase
+type Text struct {
+	Value string
+}
+
+// Match matches entries whose field matches a value. Pattern reports whether
+// the value contains * or ? wildcards.
+type Match struct {
+	Field   string
+	Value   string
+	Pattern bool
+}
+
+// Has matches entries that have a property, such as a one-time password
+type Has struct {
+	Property string
+}
+
+// Compare matches entries whose timestamp field compares to a point in time
+type Compare struct {
+	Field string
+	Op    string
+	Time  time.Time
+}
+
+func (And) node()     {}
+func (Or) node()      {}
+func (Not) node()     {}
+func (Text) node()    {}
+func (Match) node()   {}
+func (Has) node()     {}
+func (Compare) node() {}
+
+// Fields matched by Match
+const (
+	FieldTitle    = "title"
+	FieldURL      = "url"
+	FieldUsername = "username"
+	FieldCategory = "category"
+	FieldTag      = "tag"
+	FieldType     = "type"
+)
+
+// Timestamp fields compared by Compare
+const (
+	FieldCreated = "created"
+	FieldUpdated = "updated"
+)
+
+// Properties tested by Has
+const (
+	HasTOTP       = "totp"
+	HasTags       = "tags"
+	HasNotes      = "notes"
+	HasURL        = "url"
+	HasUsername   = "username"
+	HasFields     = "fields"
+	HasAttachment = "attachment"
+	HasHistory    = "history"
+)
+
+// Comparison operators used by Compare
+const (
+	OpLess         = "<"
+	OpLessEqual    = "<="
+	OpGreater      = ">"
+	OpGreaterEqual = ">="
+	OpEqual        = "="
+)
+
+// fieldAliases maps the qualifiers accepted in queries to the field they match
+var fieldAliases = map[string]string{
+	"title":    FieldTitle,
+	"url":      FieldURL,
+	"site":     FieldURL,
+	"username": FieldUsername,
+	"user":     FieldUsername,
+	"category": FieldCategory,
+	"cat":      FieldCategory,
+	"tag":      FieldTag,
+	"type":     FieldType,
+	"created":  FieldCreated,
+	"updated":  FieldUpdated,
+	"has":      "has",
+}
+
+// hasAliases maps the values accepted by has: to the property they test
+var hasAliases = map[string]string{
+	"totp":        HasTOTP,
+	"otp":         HasTOTP,
+	"tags":        HasTags,
+	"tag":         HasTags,
+	"notes":       HasNotes,
+	"note":        HasNotes,
+	"url":         HasURL,
+	"username":    HasUsername,
+	"fields":      HasFields,
+	"field":       HasFields,
+	"attachment":  HasAttachment,
+	"attachments": HasAttachment,
+	"history":     HasHistory,
+}
+
+// Parse parses a query such as
+//
+//	tag:prod url:*.aws.amazon.com updated:<90d -category:personal has:totp
+//
+// Terms are separated by spaces and must all match unless joined by OR, and
+// can be grouped with parentheses. A leading - negates a term. Values may be
+// quoted. Relative times like 90d (also h, w, m and y) are resolved against
+// now; absolute times are dates like 2024-01-31. A query without terms
+// returns a nil Node.
+func Parse(input string, now time.Time) (Node, error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, now: now}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+
+	return node, nil
+}
+
+// token kinds
+const (
+	tokenWord = iota
+	tokenOpen
+	tokenClose
+	tokenNot
+)
+
+// token is a lexical token of a query. Words keep whether any part of them
+// was quoted, so that a quoted "OR" is not taken as an operator.
+type token struct {
+	kind   int
+	text   string
+	quoted bool
+}
+
+// tokenize splits a query into words and parentheses
+func tokenize(input string) ([]token, error) {
+	var tokens []token
+	runes := []rune(input)
+
+	for i := 0; i < len(runes); {
+		switch r := runes[i]; {
+		case r == ' ' || r == '\t' || r == '\n':
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenOpen, text: "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenClose, text: ")"})
+			i++
+		case r == '-' && i+1 < len(runes) && !strings.ContainsRune(" \t\n)", runes[i+1]):
+			tokens = append(tokens, token{kind: tokenNot, text: "-"})
+			i++
+		default:
+			var b strings.Builder
+			quoted := false
+			for i < len(runes) && !strings.ContainsRune(" \t\n()", runes[i]) {
+				if runes[i] != '"' {
+					b.WriteRune(runes[i])
+					i++
+					continue
+				}
+
+				quoted = true
+				i++
+				for i < len(runes) && runes[i] != '"' {
+					b.WriteRune(runes[i])
+					i++
+				}
+				if i == len(runes) {
+					return nil, errors.New("unterminated quote in query")
+				}
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: b.String(), quoted: quoted})
+		}
+	}
+
+	return tokens, nil
+}
+
+// parser is a recursive descent parser over query tokens
+type parser struct {
+	tokens []token
+	pos    int
+	now    time.Time
+}
+
+// parseOr parses terms joined by OR
+func (p *parser) parseOr() (Node, error) {
+	var terms []Node
+	for {
+		term, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+
+		if !p.peekOr() {
+			break
+		}
+		p.pos++
+	}
+
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return Or{Terms: terms}, nil
+}
+
+// parseAnd parses a sequence of terms that must all match
+func (p *parser) parseAnd() (Node, error) {
+	var terms []Node
+	for p.pos < len(p.tokens) && p.tokens[p.pos].kind != tokenClose && !p.peekOr() {
+		term, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+	}
+
+	switch len(terms) {
+	case 0:
+		if p.pos < len(p.tokens) {
+			return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+		}
+		return nil, errors.New("missing term at end of query")
+	case 1:
+		return terms[0], nil
+	}
+	return And{Terms: terms}, nil
+}
+
+// parseTerm parses a single, possibly negated or parenthesized, term
+func (p *parser) parseTerm() (Node, error) {
+	tok := p.tokens[p.pos]
+	p.pos++
+
+	if tok.kind == tokenOpen {
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != tokenClose {
+			return nil, errors.New("missing closing parenthesis")
+		}
+		p.pos++
+		return node, nil
+	}
+
+	if tok.kind == tokenNot {
+		node, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		return Not{Term: node}, nil
+	}
+
+	return p.parseWord(tok)
+}
+
+// parseWord parses a free text word or a qualifier:value term
+func (p *parser) parseWord(tok token) (Node, error) {
+	qualifier, value, ok := strings.Cut(tok.text, ":")
+	field, known := fieldAliases[strings.ToLower(qualifier)]
+	if !ok || !known {
+		if tok.text == "" {
+			return nil, errors.New("empty search term")
+		}
+		return Text{Value: tok.text}, nil
+	}
+
+	if value == "" {
+		return nil, fmt.Errorf("missing value for %s:", qualifier)
+	}
+
+	switch field {
+	case "has":
+		property, ok := hasAliases[strings.ToLower(value)]
+		if !ok {
+			return nil, fmt.Errorf("unknown property has:%s", value)
+		}
+		return Has{Property: property}, nil
+	case FieldCreated, FieldUpdated:
+		return parseCompare(field, value, p.now)
+	}
+
+	return Match{Field: field, Value: value, Pattern: strings.ContainsAny(value, "*?")}, nil
+}
+
+// peekOr reports whether the next token is the OR operator
+func (p *parser) peekOr() bool {
+	if p.pos >= len(p.tokens) {
+		return false
+	}
+	tok := p.tokens[p.pos]
+	return tok.kind == tokenWord && !tok.quoted && tok.text == "OR"
+}
+
+// parseCompare parses a time comparison such as <90d or >=2024-01-31. For a
+// relative time the operator compares the age of the entry, so <90d matches
+// entries changed less than 90 days ago.
+func parseCompare(field, value string, now time.Time) (Node, error) {
+	op := OpEqual
+	for _, candidate := range []string{OpLessEqual, OpGreaterEqual, OpLess, OpGreater, OpEqual} {
+		if strings.HasPrefix(value, candidate) {
+			op = candidate
+			value = value[len(candidate):]
+			break
+		}
+	}
+
+	if t, err := time.ParseInLocation("2006-01-02", value, now.Location()); err == nil {
+		if op == OpEqual {
+			// A bare date matches the whole day
+			return And{Terms: []Node{
+				Compare{Field: field, Op: OpGreaterEqual, Time: t},
+				Compare{Field: field, Op: OpLess, Time: t.AddDate(0, 0, 1)},
+			}}, nil
+		}
+		return Compare{Field: field, Op: op, Time: t}, nil
+	}
+
+	t, err := relativeTime(value, now)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time %q for %s: use a date like 2024-01-31 or an age like 90d", value, field)
+	}
+
+	// Ages run backwards in time, so flip the operator
+	switch op {
+	case OpLess:
+		op = OpGreater
+	case OpLessEqual:
+		op = OpGreaterEqual
+	case OpGreater:
+		op = OpLess
+	case OpGreaterEqual:
+		op = OpLessEqual
+	case OpEqual:
+		return nil, fmt.Errorf("ages need a comparison, like %s:<%s", field, value)
+	}
+
+	return Compare{Field: field, Op: op, Time: t}, nil
+}
+
+// relativeTime resolves an age such as 90d, 12h, 2w, 6m or 1y against now
+func relativeTime(value string, now time.Time) (time.Time, error) {
+	if len(value) < 2 {
+		return time.Time{}, errors.New("invalid age")
+	}
+
+	n, err := strconv.Atoi(value[:len(value)-1])
+	if err != nil || n < 0 {
+		return time.Time{}, errors.New("invalid age")
+	}
+
+	switch value[len(value)-1] {
+	case 'h':
+		return now.Add(-time.Duration(n) * time.Hour), nil
+	case 'd':
+		return now.AddDate(0, 0, -n), nil
+	case 'w':
+		return now.AddDate(0, 0, -7*n), nil
+	case 'm':
+		return now.AddDate(0, -n, 0), nil
+	case 'y':
+		return now.AddDate(-n, 0, 0), nil
+	}
+	return time.Time{}, errors.New("invalid age unit")
+}
@@ -0,0 +1,119 @@
+package query
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	day := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		input string
+		want  Node
+	}{
+		{"empty", "", nil},
+		{"blank", "  \t ", nil},
+		{"text", "github", Text{Value: "github"}},
+		{"tag", "tag:prod", Match{Field: FieldTag, Value: "prod"}},
+		{"qualifier case", "TAG:prod", Match{Field: FieldTag, Value: "prod"}},
+		{"alias", "site:example.com", Match{Field: FieldURL, Value: "example.com"}},
+		{"url pattern", "url:*.aws.amazon.com", Match{Field: FieldURL, Value: "*.aws.amazon.com", Pattern: true}},
+		{"single wildcard", "title:bank?", Match{Field: FieldTitle, Value: "bank?", Pattern: true}},
+		{"unknown qualifier", "foo:bar", Text{Value: "foo:bar"}},
+		{"updated age", "updated:<90d", Compare{Field: FieldUpdated, Op: OpGreater, Time: now.AddDate(0, 0, -90)}},
+		{"older than", "created:>=1y", Compare{Field: FieldCreated, Op: OpLessEqual, Time: now.AddDate(-1, 0, 0)}},
+		{"hours", "updated:>12h", Compare{Field: FieldUpdated, Op: OpLess, Time: now.Add(-12 * time.Hour)}},
+		{"weeks", "updated:<=2w", Compare{Field: FieldUpdated, Op: OpGreaterEqual, Time: now.AddDate(0, 0, -14)}},
+		{"months", "updated:<6m", Compare{Field: FieldUpdated, Op: OpGreater, Time: now.AddDate(0, -6, 0)}},
+		{"date", "created:>2024-01-31", Compare{Field: FieldCreated, Op: OpGreater, Time: day}},
+		{"whole day", "created:2024-01-31", And{Terms: []Node{
+			Compare{Field: FieldCreated, Op: OpGreaterEqual, Time: day},
+			Compare{Field: FieldCreated, Op: OpLess, Time: day.AddDate(0, 0, 1)},
+		}}},
+		{"negated", "-category:personal", Not{Term: Match{Field: FieldCategory, Value: "personal"}}},
+		{"has", "has:totp", Has{Property: HasTOTP}},
+		{"has alias", "has:OTP", Has{Property: HasTOTP}},
+		{"quoted value", `title:"my bank"`, Match{Field: FieldTitle, Value: "my bank"}},
+		{"quoted text", `"work email"`, Text{Value: "work email"}},
+		{"quoted operator", `"OR"`, Text{Value: "OR"}},
+		{"quoted inside word", `user:"john doe"@example.com`, Match{Field: FieldUsername, Value: "john doe@example.com"}},
+		{"hyphen inside word", "e-mail", Text{Value: "e-mail"}},
+		{"example", "tag:prod url:*.aws.amazon.com updated:<90d -category:personal has:totp", And{Terms: []Node{
+			Match{Field: FieldTag, Value: "prod"},
+			Match{Field: FieldURL, Value: "*.aws.amazon.com", Pattern: true},
+			Compare{Field: FieldUpdated, Op: OpGreater, Time: now.AddDate(0, 0, -90)},
+			Not{Term: Match{Field: FieldCategory, Value: "personal"}},
+			Has{Property: HasTOTP},
+		}}},
+		{"or", "tag:a OR tag:b", Or{Terms: []Node{
+			Match{Field: FieldTag, Value: "a"},
+			Match{Field: FieldTag, Value: "b"},
+		}}},
+		{"and binds tighter than or", "a b OR c", Or{Terms: []Node{
+			And{Terms: []Node{Text{Value: "a"}, Text{Value: "b"}}},
+			Text{Value: "c"},
+		}}},
+		{"group", "-(tag:a OR has:notes) bank", And{Terms: []Node{
+			Not{Term: Or{Terms: []Node{
+				Match{Field: FieldTag, Value: "a"},
+				Has{Property: HasNotes},
+			}}},
+			Text{Value: "bank"},
+		}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.input, now)
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %v", tt.input, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) = %#v, want %#v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{"unterminated quote", `title:"my bank`, "unterminated quote"},
+		{"empty quotes", `""`, "empty search term"},
+		{"missing value", "tag:", "missing value for tag:"},
+		{"unknown property", "has:password", "unknown property has:password"},
+		{"age without comparison", "updated:90d", "ages need a comparison"},
+		{"invalid age unit", "updated:<90x", "invalid time"},
+		{"invalid age", "updated:<d", "invalid time"},
+		{"negative age", "updated:<-5d", "invalid time"},
+		{"invalid date", "created:>2024-13-01", "invalid time"},
+		{"unclosed group", "(tag:a", "missing closing parenthesis"},
+		{"unopened group", "tag:a)", `unexpected ")"`},
+		{"empty group", "()", `unexpected ")"`},
+		{"leading or", "OR tag:a", `unexpected "OR"`},
+		{"trailing or", "tag:a OR", "missing term at end of query"},
+		{"dangling negation", "tag:a -(", "missing term at end of query"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := Parse(tt.input, now)
+			if err == nil {
+				t.Fatalf("Parse(%q) = %#v, want error containing %q", tt.input, node, tt.err)
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Parse(%q) error = %q, want it to contain %q", tt.input, err, tt.err)
+			}
+		})
+	}
+}
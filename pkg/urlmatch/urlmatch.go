@@ -0,0 +1,191 @@
+package urlmatch
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+// Match modes, deciding how an entry's URL is compared to a page URL
+const (
+	// ModeDomain matches pages on the same registrable domain, so that
+	// login.example.com matches www.example.com but not example.org
+	ModeDomain = "domain"
+	// ModeHost matches pages on the same host and port
+	ModeHost = "host"
+	// ModePrefix matches pages whose URL starts with the entry's URL at a
+	// path boundary, so that example.com/app matches example.com/app/login
+	// and example.com/app?id=1 but not example.com/apple
+	ModePrefix = "prefix"
+	// ModeExact matches pages whose URL equals the entry's URL
+	ModeExact = "exact"
+	// ModeRegex matches pages whose URL matches the entry's URL as a regular expression
+	ModeRegex = "regex"
+	// ModeNever never matches, excluding the entry from URL lookups
+	ModeNever = "never"
+)
+
+// Modes lists every match mode
+var Modes = []string{ModeDomain, ModeHost, ModePrefix, ModeExact, ModeRegex, ModeNever}
+
+// Scores of the match modes; more specific matches rank higher
+const (
+	scoreExact  = 500
+	scorePrefix = 400
+	scoreRegex  = 300
+	scoreHost   = 200
+	scoreDomain = 100
+
+	// bonusSameHost ranks domain matches on the page's own host first
+	bonusSameHost = 50
+)
+
+// ParseMode validates a match mode, defaulting to ModeDomain
+func ParseMode(mode string) (string, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	if mode == "" {
+		return ModeDomain, nil
+	}
+	for _, m := range Modes {
+		if mode == m {
+			return m, nil
+		}
+	}
+	return "", fmt.Errorf("unknown URL match mode %q", mode)
+}
+
+// Normalize parses a URL, assuming https:// when the scheme is missing, and
+// canonicalizes it: the scheme and host are lower-cased, internationalized
+// host names are converted to ASCII, default ports and fragments are dropped
+// and an empty path becomes "/".
+func Normalize(raw string) (*url.URL, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, errors.New("empty URL")
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("URL %q has no host", raw)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host, port := u.Hostname(), u.Port()
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if net.ParseIP(host) == nil {
+		host, err = idna.Lookup.ToASCII(host)
+		if err != nil {
+			return nil, fmt.Errorf("invalid host name: %w", err)
+		}
+	}
+	if (u.Scheme == "https" && port == "443") || (u.Scheme == "http" && port == "80") {
+		port = ""
+	}
+
+	u.Host = host
+	if strings.Contains(host, ":") {
+		u.Host = "[" + host + "]"
+	}
+	if port != "" {
+		u.Host += ":" + port
+	}
+
+	u.User = nil
+	u.Fragment = ""
+	u.RawFragment = ""
+	if u.Path == "" {
+		u.Path = "/"
+		u.RawPath = ""
+	}
+
+	return u, nil
+}
+
+// RegistrableDomain returns the registrable domain of a host, the public
+// suffix plus one label, such as example.co.uk for www.example.co.uk. IP
+// addresses and hosts that are themselves public suffixes are returned as is.
+func RegistrableDomain(host string) string {
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
+
+// Match compares the URL of an entry to a normalized page URL using a match
+// mode and returns a score for ranking, or false if they do not match. Pages
+// served over plain http never match entries saved for https.
+func Match(entryURL, mode string, page *url.URL) (int, bool) {
+	if mode == ModeNever || strings.TrimSpace(entryURL) == "" {
+		return 0, false
+	}
+
+	if mode == ModeRegex {
+		re, err := regexp.Compile(entryURL)
+		if err != nil || !re.MatchString(page.String()) {
+			return 0, false
+		}
+		return scoreRegex, true
+	}
+
+	entry, err := Normalize(entryURL)
+	if err != nil {
+		return 0, false
+	}
+	if entry.Scheme == "https" && page.Scheme == "http" {
+		return 0, false
+	}
+
+	switch mode {
+	case ModeExact:
+		if entry.String() == page.String() {
+			return scoreExact, true
+		}
+	case ModePrefix:
+		if hasPathPrefix(page.String(), entry.String()) {
+			return scorePrefix + len(entry.String()), true
+		}
+	case ModeHost:
+		if entry.Host == page.Host {
+			return scoreHost, true
+		}
+	default:
+		if RegistrableDomain(entry.Hostname()) != RegistrableDomain(page.Hostname()) {
+			return 0, false
+		}
+		score := scoreDomain
+		if entry.Hostname() == page.Hostname() {
+			score += bonusSameHost
+		}
+		return score, true
+	}
+
+	return 0, false
+}
+
+// hasPathPrefix reports whether s starts with prefix followed by the end of
+// s, a path separator or the query
+func hasPathPrefix(s, prefix string) bool {
+	if !strings.HasPrefix(s, prefix) {
+		return false
+	}
+	if len(s) == len(prefix) || strings.HasSuffix(prefix, "/") {
+		return true
+	}
+	return s[len(prefix)] == '/' || s[len(prefix)] == '?'
+}